@@ -26,12 +26,6 @@ import (
 
 // Start the main execution point for Castro
 func Start() {
-	// Wait for all goroutines to make their work
-	wait := &sync.WaitGroup{}
-
-	// Wait for all tasks
-	wait.Add(10)
-
 	// Load application logger
 	loadAppLogger()
 
@@ -44,6 +38,30 @@ func Start() {
 	loadLUAConfig()
 	connectDatabase()
 
+	// Create server-side session backend
+	createSessionBackend()
+
+	// Remove expired failed login counters
+	go loginAttemptPurger()
+
+	// Load application resources
+	loadApplication()
+
+	// Run background job workers
+	startJobWorkers()
+
+	// Run game server supervisor
+	startSupervisor()
+}
+
+// loadApplication loads all the application resources once the database is connected
+func loadApplication() {
+	// Wait for all goroutines to make their work
+	wait := &sync.WaitGroup{}
+
+	// Wait for all tasks
+	wait.Add(10)
+
 	// Execute our tasks
 	go func(wait *sync.WaitGroup) {
 
@@ -84,6 +102,37 @@ func Start() {
 	executeInitFile()
 }
 
+func startJobWorkers() {
+	// Check if job queue is enabled
+	if !util.Config.Configuration.Jobs.Enabled {
+		return
+	}
+
+	// Start queue workers
+	util.Jobs.Start()
+}
+
+func startSupervisor() {
+	// Check if supervisor is enabled
+	if !util.Config.Configuration.Supervisor.Enabled {
+		return
+	}
+
+	util.GameSupervisor = util.NewSupervisor(util.Config.Configuration.Supervisor)
+
+	// Servers left running by a previous Castro instance are not started again
+	autoStart := util.Config.Configuration.Supervisor.AutoStart
+
+	if autoStart && util.GetServerStatus(lua.ServerStatusAddress(), true).Online {
+		util.Logger.Logger.Info("Game server is already running. Skipping supervisor auto-start")
+		autoStart = false
+	}
+
+	if err := util.GameSupervisor.Run(autoStart); err != nil {
+		util.Logger.Logger.Errorf("Cannot start game server supervisor: %v", err)
+	}
+}
+
 func loadServerMonsters(wg *sync.WaitGroup) {
 	// Load server monsters
 	if err := util.LoadServerMonsters(util.Config.Configuration.Datapack); err != nil {
@@ -406,6 +455,51 @@ func loadLUAConfig() {
 	}
 }
 
+func createSessionBackend() {
+	switch util.Config.Configuration.Session.Backend {
+	case "database":
+		util.Sessions = &util.DatabaseSessionBackend{}
+	case "memory":
+		util.Sessions = util.NewMemorySessionBackend()
+	default:
+		// Sessions are stored on the cookie
+		return
+	}
+
+	go sessionPurger()
+}
+
+func loginAttemptPurger() {
+	ticker := time.NewTicker(time.Hour)
+
+	for range ticker.C {
+
+		// Remove expired failed login counters
+		if err := util.PurgeLoginAttempts(); err != nil {
+			util.Logger.Logger.Errorf("Cannot purge login attempts: %v", err)
+		}
+	}
+}
+
+func sessionPurger() {
+	// Get purge interval
+	interval := util.Config.Configuration.Session.Purge.Duration
+
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+
+	for range ticker.C {
+
+		// Remove expired sessions
+		if err := util.Sessions.Purge(time.Now().Add(-util.SessionLifetime()).Unix()); err != nil {
+			util.Logger.Logger.Errorf("Cannot purge sessions: %v", err)
+		}
+	}
+}
+
 func createCache() {
 	// Create a new cache instance with the given options
 	// first parameter is the default item duration on the cache
@@ -545,6 +639,30 @@ func templateFuncs() template.FuncMap {
 		"str2html": func(text string) template.HTML {
 			return template.HTML(text)
 		},
+		"sanitize": func(text string, policy ...string) template.HTML {
+			p := ""
+			if len(policy) > 0 {
+				p = policy[0]
+			}
+			out, err := util.Sanitizer.Sanitize(text, p)
+			if err != nil {
+				util.Logger.Logger.Errorf("Cannot sanitize template html: %v", err)
+				return template.HTML(template.HTMLEscapeString(text))
+			}
+			return template.HTML(out)
+		},
+		"markdown": func(text string, policy ...string) template.HTML {
+			p := ""
+			if len(policy) > 0 {
+				p = policy[0]
+			}
+			out, err := util.Sanitizer.RenderMarkdown(text, p)
+			if err != nil {
+				util.Logger.Logger.Errorf("Cannot render template markdown: %v", err)
+				return template.HTML(template.HTMLEscapeString(text))
+			}
+			return template.HTML(out)
+		},
 		"str2attr": func(text string) template.HTMLAttr {
 			return template.HTMLAttr(text)
 		},
@@ -582,6 +700,16 @@ func templateFuncs() template.FuncMap {
 		"captchaEnabled": func() bool {
 			return util.Config.Configuration.Captcha.Enabled
 		},
+		"captchaWidget": func() template.HTML {
+			widget, err := util.CaptchaWidget()
+
+			if err != nil {
+				util.Logger.Logger.Errorf("Cannot render captcha widget: %v", err)
+				return ""
+			}
+
+			return widget
+		},
 		"eq": func(a, b interface{}) bool {
 			return a == b
 		},
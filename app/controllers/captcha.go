@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/util"
+)
+
+// CaptchaImage serves the image of an image captcha challenge
+func CaptchaImage(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Get challenge characters
+	text, err := util.CaptchaImage(req.URL.Query().Get("id"))
+
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	img, err := util.GenerateCaptchaImage(text)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot generate captcha image: %v", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(img)
+}
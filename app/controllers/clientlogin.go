@@ -0,0 +1,517 @@
+package controllers
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/lua"
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// clientRequest struct used for the game client webservice requests
+type clientRequest struct {
+	Type         string `json:"type"`
+	Email        string `json:"email"`
+	AccountName  string `json:"accountname"`
+	Password     string `json:"password"`
+	Token        string `json:"token"`
+	StayLoggedIn bool   `json:"stayloggedin"`
+}
+
+// clientError struct used for the game client webservice errors
+type clientError struct {
+	Code    int    `json:"errorCode"`
+	Message string `json:"errorMessage"`
+}
+
+// clientSession struct used for the session of a game client login
+type clientSession struct {
+	SessionKey                    string `json:"sessionkey"`
+	LastLoginTime                 int64  `json:"lastlogintime"`
+	IsPremium                     bool   `json:"ispremium"`
+	PremiumUntil                  int64  `json:"premiumuntil"`
+	Status                        string `json:"status"`
+	ReturnerNotification          bool   `json:"returnernotification"`
+	ShowRewardNews                bool   `json:"showrewardnews"`
+	IsReturner                    bool   `json:"isreturner"`
+	FpsTracking                   bool   `json:"fpstracking"`
+	OptionTracking                bool   `json:"optiontracking"`
+	TournamentTicketPurchaseState int    `json:"tournamentticketpurchasestate"`
+	EmailCodeRequest              bool   `json:"emailcoderequest"`
+}
+
+// clientWorld struct used for the worlds of a game client login
+type clientWorld struct {
+	ID                         int    `json:"id"`
+	Name                       string `json:"name"`
+	ExternalAddress            string `json:"externaladdress"`
+	ExternalPort               int    `json:"externalport"`
+	ExternalAddressProtected   string `json:"externaladdressprotected"`
+	ExternalPortProtected      int    `json:"externalportprotected"`
+	ExternalAddressUnprotected string `json:"externaladdressunprotected"`
+	ExternalPortUnprotected    int    `json:"externalportunprotected"`
+	PreviewState               int    `json:"previewstate"`
+	Location                   string `json:"location"`
+	AntiCheatProtection        bool   `json:"anticheatprotection"`
+	PvpType                    int    `json:"pvptype"`
+	IsTournamentWorld          bool   `json:"istournamentworld"`
+	RestrictedStore            bool   `json:"restrictedstore"`
+	CurrentTournamentPhase     int    `json:"currenttournamentphase"`
+}
+
+// clientCharacter struct used for the characters of a game client login
+type clientCharacter struct {
+	WorldID          int    `json:"worldid"`
+	Name             string `json:"name"`
+	IsMale           bool   `json:"ismale"`
+	Tutorial         bool   `json:"tutorial"`
+	Level            int    `json:"level"`
+	Vocation         string `json:"vocation"`
+	OutfitID         int    `json:"outfitid"`
+	HeadColor        int    `json:"headcolor"`
+	TorsoColor       int    `json:"torsocolor"`
+	LegsColor        int    `json:"legscolor"`
+	DetailColor      int    `json:"detailcolor"`
+	AddonsFlags      int    `json:"addonsflags"`
+	IsHidden         bool   `json:"ishidden"`
+	IsMainCharacter  bool   `json:"ismaincharacter"`
+	DailyRewardState int    `json:"dailyrewardstate"`
+}
+
+// clientEvent struct used for the game client event schedule
+type clientEvent struct {
+	StartDate    int64  `json:"startdate"`
+	EndDate      int64  `json:"enddate"`
+	ColorLight   string `json:"colorlight"`
+	ColorDark    string `json:"colordark"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	IsSeasonal   bool   `json:"isseasonal"`
+	SpecialEvent int    `json:"specialevent"`
+}
+
+const (
+	// clientErrorRequest error code of malformed requests
+	clientErrorRequest = 2
+
+	// clientErrorLogin error code of wrong credentials and locked accounts
+	clientErrorLogin = 3
+
+	// clientErrorToken error code of missing or wrong two-factor tokens
+	clientErrorToken = 6
+)
+
+var (
+	// clientPvpTypes pvp types in the order used by the game client
+	clientPvpTypes = []string{"pvp", "no-pvp", "pvp-enforced"}
+
+	// clientWorldColumn whether the world of each character is read from the players table
+	clientWorldColumn bool
+)
+
+// CheckClientLogin validates the game client login worlds. Characters can only be listed
+// on several worlds when the players table has a world_id column
+func CheckClientLogin() error {
+	worlds := util.Config.Configuration.ClientLogin.Worlds
+	ids := map[int]bool{}
+
+	for _, world := range worlds {
+		if ids[world.ID] {
+			return fmt.Errorf("Duplicated client login world ID %v", world.ID)
+		}
+
+		ids[world.ID] = true
+	}
+
+	// A single world lists every character
+	if len(worlds) <= 1 {
+		clientWorldColumn = false
+		return nil
+	}
+
+	ok, err := models.PlayersHaveWorldColumn()
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("Client login lists several worlds but the players table has no world_id column")
+	}
+
+	clientWorldColumn = true
+
+	return nil
+}
+
+// ClientLogin serves the webservice used by the game clients to login and to request
+// the client information shown before login
+func ClientLogin(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	r := clientRequest{}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 16*1024)).Decode(&r); err != nil {
+		writeClientError(w, clientErrorRequest, "Invalid request")
+		return
+	}
+
+	switch strings.ToLower(r.Type) {
+	case "login":
+		clientLogin(w, req, r)
+	case "cacheinfo":
+		clientCacheInfo(w)
+	case "eventschedule":
+		clientEventSchedule(w)
+	case "boostedcreature":
+		clientBoostedCreature(w)
+	default:
+		writeClientError(w, clientErrorRequest, "Invalid request type")
+	}
+}
+
+// clientLogin authenticates the account returning the session, world list and character list
+func clientLogin(w http.ResponseWriter, req *http.Request, r clientRequest) {
+	ip := util.RequestIP(req)
+	name := r.Email
+
+	if name == "" {
+		name = r.AccountName
+	}
+
+	account, err := models.GetAccountByEmailOrName(name)
+
+	if err != nil && err != sql.ErrNoRows {
+		util.Logger.Logger.Errorf("Cannot get client login account: %v", err)
+		writeClientError(w, clientErrorLogin, "Internal error. Please try again later")
+		return
+	}
+
+	// Failed logins are counted using the account name as the website does
+	if err == nil {
+		name = account.Name
+	}
+
+	lock, err := util.LoginLockStatus(name, ip)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot get client login lock status: %v", err)
+		writeClientError(w, clientErrorLogin, "Internal error. Please try again later")
+		return
+	}
+
+	if lock.Locked {
+		writeClientError(w, clientErrorLogin, fmt.Sprintf("Too many failed login attempts. Please try again in %d seconds", int(lock.Remaining.Seconds())+1))
+		return
+	}
+
+	// Passwords are stored using the sha1 scheme the game server expects
+	sum := sha1.Sum([]byte(r.Password))
+
+	if account.ID == 0 || subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(account.Password)) != 1 {
+		clientLoginFailure(name, ip, req.UserAgent())
+		writeClientError(w, clientErrorLogin, "Email address or password is not correct.")
+		return
+	}
+
+	twoFactor := account.Secret.Valid && account.Secret.String != ""
+
+	if twoFactor {
+		if r.Token == "" {
+			writeClientError(w, clientErrorToken, "Two-factor token required for authentication.")
+			return
+		}
+
+		step, ok := util.TOTPStep(account.Secret.String, r.Token, time.Now())
+
+		if ok {
+			if ok, err = models.UseTOTPStep(account.ID, step); err != nil {
+				util.Logger.Logger.Errorf("Cannot save client login token step: %v", err)
+				writeClientError(w, clientErrorLogin, "Internal error. Please try again later")
+				return
+			}
+		}
+
+		if !ok {
+			clientLoginFailure(name, ip, req.UserAgent())
+			writeClientError(w, clientErrorToken, "Two-factor token required for authentication.")
+			return
+		}
+	}
+
+	if _, err := util.RecordLoginSuccess(account.Name, ip, req.UserAgent(), twoFactor); err != nil {
+		util.Logger.Logger.Errorf("Cannot record client login: %v", err)
+	}
+
+	characters, err := models.GetClientCharacters(account.ID, clientWorldColumn)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot get client login characters: %v", err)
+		writeClientError(w, clientErrorLogin, "Internal error. Please try again later")
+		return
+	}
+
+	worlds := clientWorlds()
+	list := clientCharacters(characters, worlds)
+	lastLogin := int64(0)
+
+	for _, c := range characters {
+		if c.Lastlogin > lastLogin {
+			lastLogin = c.Lastlogin
+		}
+	}
+
+	now := time.Now().Unix()
+
+	writeClientResponse(w, map[string]interface{}{
+		"session": clientSession{
+			SessionKey:     clientSessionKey(account.Name, r.Password, r.Token, now),
+			LastLoginTime:  lastLogin,
+			IsPremium:      account.Premium_ends_at > now,
+			PremiumUntil:   account.Premium_ends_at,
+			Status:         "active",
+			ShowRewardNews: true,
+		},
+		"playdata": map[string]interface{}{
+			"worlds":     worlds,
+			"characters": list,
+		},
+	})
+}
+
+// clientSessionKey returns the session key the game client sends to the game server:
+// the account name, password, two-factor token and 30 second token time step separated
+// by new lines. The game server must parse this format and check the sha1 password and
+// the token itself, as The Forgotten Server 1.3 and 1.4 do. Servers that look up the key
+// on a sessions table cannot use this webservice
+func clientSessionKey(name, password, token string, now int64) string {
+	return strings.Join([]string{name, password, token, fmt.Sprint(now / 30)}, "\n")
+}
+
+// clientCharacters converts the account characters to the game client format. Characters
+// are listed on their own world, or on the only world when a single world is configured.
+// Characters of worlds that are not configured are left out
+func clientCharacters(characters []*models.ClientCharacter, worlds []clientWorld) []clientCharacter {
+	list := make([]clientCharacter, 0, len(characters))
+	ids := map[int]bool{}
+
+	for _, world := range worlds {
+		ids[world.ID] = true
+	}
+
+	for _, c := range characters {
+		worldID := c.World_id
+
+		if len(worlds) == 1 {
+			worldID = worlds[0].ID
+		}
+
+		if !ids[worldID] {
+			continue
+		}
+
+		list = append(list, clientCharacter{
+			WorldID:     worldID,
+			Name:        c.Name,
+			IsMale:      c.Sex == 1,
+			Level:       c.Level,
+			Vocation:    clientVocationName(c.Vocation),
+			OutfitID:    c.Looktype,
+			HeadColor:   c.Lookhead,
+			TorsoColor:  c.Lookbody,
+			LegsColor:   c.Looklegs,
+			DetailColor: c.Lookfeet,
+			AddonsFlags: c.Lookaddons,
+		})
+	}
+
+	return list
+}
+
+// clientLoginFailure records a failed game client login
+func clientLoginFailure(name, ip, userAgent string) {
+	if _, err := util.RecordLoginFailure(name, ip); err != nil {
+		util.Logger.Logger.Errorf("Cannot record client login failure: %v", err)
+	}
+
+	if err := util.RecordFailedLoginHistory(name, ip, userAgent); err != nil {
+		util.Logger.Logger.Errorf("Cannot record client login failure: %v", err)
+	}
+}
+
+// clientWorlds returns the configured worlds. Servers without world definitions list a
+// single world using the game server config.lua values
+func clientWorlds() []clientWorld {
+	worlds := []clientWorld{}
+
+	for _, world := range util.Config.Configuration.ClientLogin.Worlds {
+		worlds = append(worlds, newClientWorld(world))
+	}
+
+	if len(worlds) > 0 {
+		return worlds
+	}
+
+	port := 7172
+
+	if p, ok := lua.Config.GetGlobal("gameProtocolPort").(glua.LNumber); ok {
+		port = int(p)
+	}
+
+	return []clientWorld{
+		newClientWorld(util.ClientWorld{
+			Name:     lua.Config.GetGlobal("serverName").String(),
+			Address:  lua.Config.GetGlobal("ip").String(),
+			Port:     port,
+			Location: "BRA",
+			PvpType:  lua.Config.GetGlobal("worldType").String(),
+		}),
+	}
+}
+
+// newClientWorld converts a configured world to the game client format
+func newClientWorld(world util.ClientWorld) clientWorld {
+	pvpType := 0
+
+	for i, t := range clientPvpTypes {
+		if strings.EqualFold(world.PvpType, t) {
+			pvpType = i
+		}
+	}
+
+	location := world.Location
+
+	if location == "" {
+		location = "BRA"
+	}
+
+	preview := 0
+
+	if world.Preview {
+		preview = 1
+	}
+
+	return clientWorld{
+		ID:                         world.ID,
+		Name:                       world.Name,
+		ExternalAddress:            world.Address,
+		ExternalPort:               world.Port,
+		ExternalAddressProtected:   world.Address,
+		ExternalPortProtected:      world.Port,
+		ExternalAddressUnprotected: world.Address,
+		ExternalPortUnprotected:    world.Port,
+		PreviewState:               preview,
+		Location:                   location,
+		PvpType:                    pvpType,
+		CurrentTournamentPhase:     2,
+	}
+}
+
+// clientVocationName returns the name of the given vocation
+func clientVocationName(id int) string {
+	for _, voc := range util.ServerVocationList.List.Vocations {
+		if voc.ID == id {
+			return voc.Name
+		}
+	}
+
+	return "None"
+}
+
+// clientCacheInfo returns the number of players online
+func clientCacheInfo(w http.ResponseWriter) {
+	online, err := models.GetOnlinePlayerCount()
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot get client online players: %v", err)
+	}
+
+	writeClientResponse(w, map[string]interface{}{
+		"playersonline":        online,
+		"twitchstreams":        0,
+		"twitchviewer":         0,
+		"gamingyoutubestreams": 0,
+		"gamingyoutubeviewer":  0,
+	})
+}
+
+// clientEventSchedule returns the configured event schedule
+func clientEventSchedule(w http.ResponseWriter) {
+	events := []clientEvent{}
+
+	for _, e := range util.Config.Configuration.ClientLogin.Events {
+		start, err := time.Parse("2006-01-02", e.Start)
+
+		if err != nil {
+			util.Logger.Logger.Errorf("Invalid client event %v start date: %v", e.Name, err)
+			continue
+		}
+
+		end, err := time.Parse("2006-01-02", e.End)
+
+		if err != nil {
+			util.Logger.Logger.Errorf("Invalid client event %v end date: %v", e.Name, err)
+			continue
+		}
+
+		events = append(events, clientEvent{
+			StartDate:   start.Unix(),
+			EndDate:     end.Unix(),
+			ColorLight:  e.ColorLight,
+			ColorDark:   e.ColorDark,
+			Name:        e.Name,
+			Description: e.Description,
+			IsSeasonal:  e.Seasonal,
+		})
+	}
+
+	writeClientResponse(w, map[string]interface{}{
+		"eventlist":           events,
+		"lastupdatetimestamp": time.Now().Unix(),
+	})
+}
+
+// clientBoostedCreature returns the boosted creature and boss. Configured values take
+// precedence over the values saved by the game server
+func clientBoostedCreature(w http.ResponseWriter) {
+	creature := util.Config.Configuration.ClientLogin.BoostedCreature
+	boss := util.Config.Configuration.ClientLogin.BoostedBoss
+
+	if creature == 0 && boss == 0 {
+		// Servers without boosted creatures do not have the tables
+		creature, boss, _ = models.GetBoostedCreatures()
+	}
+
+	writeClientResponse(w, map[string]interface{}{
+		"boostedcreature": creature != 0,
+		"raceid":          creature,
+		"creatureraceid":  creature,
+		"bossraceid":      boss,
+	})
+}
+
+// writeClientError writes a game client webservice error
+func writeClientError(w http.ResponseWriter, code int, message string) {
+	writeClientResponse(w, clientError{
+		Code:    code,
+		Message: message,
+	})
+}
+
+// writeClientResponse writes a game client webservice response
+func writeClientResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		util.Logger.Logger.Errorf("Cannot encode client webservice response: %v", err)
+	}
+}
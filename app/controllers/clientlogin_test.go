@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+)
+
+func TestClientCharacterWorlds(t *testing.T) {
+	characters := []*models.ClientCharacter{
+		{Name: "Alpha", World_id: 0},
+		{Name: "Beta", World_id: 1},
+		{Name: "Gamma", World_id: 2},
+	}
+
+	tests := []struct {
+		name     string
+		worlds   []clientWorld
+		expected map[string]int
+	}{
+		{
+			name:     "single world",
+			worlds:   []clientWorld{{ID: 5}},
+			expected: map[string]int{"Alpha": 5, "Beta": 5, "Gamma": 5},
+		},
+		{
+			name:     "own worlds",
+			worlds:   []clientWorld{{ID: 0}, {ID: 1}, {ID: 2}},
+			expected: map[string]int{"Alpha": 0, "Beta": 1, "Gamma": 2},
+		},
+		{
+			name:     "unlisted world",
+			worlds:   []clientWorld{{ID: 1}, {ID: 2}},
+			expected: map[string]int{"Beta": 1, "Gamma": 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			list := map[string]int{}
+
+			for _, c := range clientCharacters(characters, test.worlds) {
+				list[c.Name] = c.WorldID
+			}
+
+			if !reflect.DeepEqual(list, test.expected) {
+				t.Fatalf("Expected characters %v got %v", test.expected, list)
+			}
+		})
+	}
+}
+
+func TestCheckClientLoginDuplicatedWorlds(t *testing.T) {
+	util.Config.Configuration = &util.Configuration{
+		ClientLogin: util.ClientLoginConfig{
+			Worlds: []util.ClientWorld{{ID: 1, Name: "Castro"}, {ID: 1, Name: "Other"}},
+		},
+	}
+
+	if err := CheckClientLogin(); err == nil {
+		t.Fatalf("Expected duplicated world error")
+	}
+}
+
+func TestClientSessionKey(t *testing.T) {
+	key := clientSessionKey("account", "password", "123456", 90)
+
+	if key != "account\npassword\n123456\n3" {
+		t.Fatalf("Unexpected session key %q", key)
+	}
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	"github.com/ulule/limiter"
+	"github.com/ulule/limiter/drivers/store/memory"
+)
+
+// maxCSPReportSize maximum size of a violation report body
+const maxCSPReportSize = 64 * 1024
+
+var (
+	cspReportLimiterMu    sync.Mutex
+	cspReportLimiter      *limiter.Limiter
+	cspReportLimiterLimit int64
+)
+
+// reportLimiter returns the limiter used for the violation reports of each address. The
+// limiter is created again when the configured limit changes
+func reportLimiter() *limiter.Limiter {
+	// Lock mutex
+	cspReportLimiterMu.Lock()
+	defer cspReportLimiterMu.Unlock()
+
+	limit := util.Config.Configuration.Security.CSP.ReportsPerMinute()
+
+	if cspReportLimiter == nil || cspReportLimiterLimit != limit {
+		cspReportLimiter = limiter.New(memory.NewStore(), limiter.Rate{
+			Period: time.Minute,
+			Limit:  limit,
+		})
+		cspReportLimiterLimit = limit
+	}
+
+	return cspReportLimiter
+}
+
+// cspViolation struct used for the legacy report-uri violation body
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int64  `json:"line-number"`
+	ScriptSample       string `json:"script-sample"`
+}
+
+// cspReport struct used for the Reporting API violation body
+type cspReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int64  `json:"lineNumber"`
+		Sample             string `json:"sample"`
+	} `json:"body"`
+}
+
+// CSPReport saves the Content-Security-Policy violation reports sent by browsers
+func CSPReport(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Reports are only accepted when enabled
+	if !util.Config.Configuration.Security.CSP.Report {
+		w.WriteHeader(404)
+		return
+	}
+
+	// Reject oversized bodies before reading them
+	if req.ContentLength > maxCSPReportSize {
+		w.WriteHeader(413)
+		return
+	}
+
+	// Limit the reports sent from each address
+	ctx, err := reportLimiter().Get(req.Context(), util.RequestIP(req))
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot get CSP report rate-limit: %v", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	if ctx.Reached {
+		w.WriteHeader(429)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxCSPReportSize))
+
+	if err != nil {
+		w.WriteHeader(413)
+		return
+	}
+
+	reports := []*models.CSPReport{}
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/reports+json") {
+
+		// Reporting API sends a list of reports
+		list := []cspReport{}
+
+		if err := json.Unmarshal(body, &list); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+
+		for _, r := range list {
+			if r.Type != "csp-violation" {
+				continue
+			}
+
+			reports = append(reports, &models.CSPReport{
+				Directive:    r.Body.EffectiveDirective,
+				Blocked_uri:  r.Body.BlockedURL,
+				Document_uri: r.Body.DocumentURL,
+				Source_file:  r.Body.SourceFile,
+				Line_number:  r.Body.LineNumber,
+				Sample:       r.Body.Sample,
+			})
+		}
+
+	} else {
+
+		// report-uri sends a single report
+		v := struct {
+			Report cspViolation `json:"csp-report"`
+		}{}
+
+		if err := json.Unmarshal(body, &v); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+
+		directive := v.Report.EffectiveDirective
+
+		if directive == "" {
+			directive = strings.SplitN(v.Report.ViolatedDirective, " ", 2)[0]
+		}
+
+		reports = append(reports, &models.CSPReport{
+			Directive:    directive,
+			Blocked_uri:  v.Report.BlockedURI,
+			Document_uri: v.Report.DocumentURI,
+			Source_file:  v.Report.SourceFile,
+			Line_number:  v.Report.LineNumber,
+			Sample:       v.Report.ScriptSample,
+		})
+	}
+
+	for _, r := range reports {
+		if r.Directive == "" {
+			continue
+		}
+
+		if err := models.SaveCSPReport(r); err != nil {
+			util.Logger.Logger.Errorf("Cannot save CSP report: %v", err)
+			w.WriteHeader(500)
+			return
+		}
+	}
+
+	w.WriteHeader(204)
+}
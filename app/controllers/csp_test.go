@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/raggaer/castro/app/util"
+)
+
+func TestCSPReportLimits(t *testing.T) {
+	util.Config.Configuration = &util.Configuration{
+		Security: util.SecurityConfig{
+			CSP: util.ContentSecurityPolicyConfig{
+				Report:      true,
+				ReportLimit: 2,
+			},
+		},
+	}
+
+	// Invalid bodies are rejected before reaching the database
+	tests := []struct {
+		name    string
+		addr    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{name: "first report", addr: "192.0.2.1:1000", body: "{", status: 400},
+		{name: "second report", addr: "192.0.2.1:1001", body: "{", status: 400},
+		{name: "throttled report", addr: "192.0.2.1:1002", body: "{", status: 429},
+		{name: "other address", addr: "192.0.2.2:1000", body: "{", status: 400},
+		{name: "oversized report", addr: "192.0.2.3:1000", body: strings.Repeat("a", maxCSPReportSize+1), status: 413},
+		{name: "oversized chunked report", addr: "192.0.2.4:1000", body: strings.Repeat("a", maxCSPReportSize+1), chunked: true, status: 413},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, util.CSPReportPath, strings.NewReader(test.body))
+			req.RemoteAddr = test.addr
+
+			if test.chunked {
+				req.ContentLength = -1
+			}
+
+			req.Header.Set("Content-Type", "application/csp-report")
+
+			w := httptest.NewRecorder()
+			CSPReport(w, req, nil)
+
+			if w.Code != test.status {
+				t.Fatalf("Expected status %v got %v", test.status, w.Code)
+			}
+		})
+	}
+}
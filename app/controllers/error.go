@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/lua"
+)
+
+// statusResponseWriter response writer that always writes the given status code
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader writes the response writer status code
+func (s *statusResponseWriter) WriteHeader(int) {
+	s.ResponseWriter.WriteHeader(s.status)
+}
+
+// ErrorPage executes the GET lua page of the given status code or writes a plain
+// error if the page does not exist
+func ErrorPage(w http.ResponseWriter, r *http.Request, status int) {
+	page := strconv.Itoa(status)
+
+	if !lua.CompiledPageList.Exists(filepath.Join("pages", page, "get.lua")) {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Error pages are always rendered using their GET handler
+	req := r.WithContext(r.Context())
+	req.Method = http.MethodGet
+
+	LuaPage(&statusResponseWriter{w, status}, req, httprouter.Params{
+		{
+			Key:   "filepath",
+			Value: page,
+		},
+	})
+}
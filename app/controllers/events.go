@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/util"
+)
+
+// EventStream streams the public event bus topics as server-sent events
+func EventStream(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Get topic pattern
+	topic := req.URL.Query().Get("topic")
+
+	// Only public topics can be streamed
+	if !util.Config.Configuration.Bus.IsPublic(topic) {
+		w.WriteHeader(404)
+		return
+	}
+
+	// Check if response can be flushed
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		w.WriteHeader(500)
+		return
+	}
+
+	// Listen to the topic
+	events, cancel := util.Bus.Listen(topic, 16)
+	defer cancel()
+
+	// Keep the stream open past the server write timeout
+	if err := util.DisableWriteDeadline(w, req); err != nil {
+		util.Logger.Logger.Errorf("Cannot disable stream write deadline: %v", err)
+	}
+
+	// Set stream headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	// Create keep-alive ticker
+	ticker := time.NewTicker(util.Config.Configuration.Bus.KeepAliveInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-ticker.C:
+			// Send keep-alive comment
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+
+		case e := <-events:
+			// Encode event payload
+			buff, err := json.Marshal(e.Payload)
+
+			if err != nil {
+				util.Logger.Logger.Errorf("Cannot encode event %v payload: %v", e.Topic, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Topic, buff)
+			flusher.Flush()
+		}
+	}
+}
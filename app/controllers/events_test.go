@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/util"
+	"github.com/urfave/negroni"
+)
+
+func TestEventStreamOutlivesWriteTimeout(t *testing.T) {
+	util.Config.Configuration = &util.Configuration{
+		Bus: util.BusConfig{
+			Public:    []string{"stream.*"},
+			KeepAlive: util.StringDuration{Duration: 50 * time.Millisecond},
+		},
+	}
+
+	// Create the server the same way castro does
+	router := httprouter.New()
+	router.GET("/events", EventStream)
+
+	n := negroni.New()
+	n.UseHandler(router)
+
+	srv := httptest.NewUnstartedServer(util.ResponseControllerHandler(n))
+	srv.Config.WriteTimeout = 200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?topic=stream.*")
+
+	if err != nil {
+		t.Fatalf("Cannot open event stream: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %v", resp.StatusCode)
+	}
+
+	// Read stream lines
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(resp.Body)
+
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// Wait past the write timeout and the first keep-alive
+	time.Sleep(400 * time.Millisecond)
+
+	util.Bus.EmitAsync("stream.test", map[string]interface{}{
+		"message": "still open",
+	})
+
+	timeout := time.After(2 * time.Second)
+	ping := false
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Event stream closed before the event was received")
+			}
+
+			if line == ": ping" {
+				ping = true
+			}
+
+			if strings.Contains(line, "still open") {
+				if !ping {
+					t.Fatal("Expected a keep-alive before the event")
+				}
+				return
+			}
+
+		case <-timeout:
+			t.Fatal("Event not received")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/database"
+	"github.com/raggaer/castro/app/lua"
+	"github.com/raggaer/castro/app/util"
+)
+
+// healthResponse struct used for the health endpoint response
+type healthResponse struct {
+	Status     string             `json:"status"`
+	Database   bool               `json:"database"`
+	GameServer healthServerStatus `json:"gameServer"`
+}
+
+// healthServerStatus struct used for the game server status of the health endpoint
+type healthServerStatus struct {
+	Online    bool   `json:"online"`
+	Error     string `json:"error,omitempty"`
+	Players   int    `json:"players"`
+	Uptime    int64  `json:"uptime"`
+	CheckedAt int64  `json:"checkedAt"`
+}
+
+// Health reports the status of the database and the game server. Responds with 503 when
+// the database is unreachable, an offline game server only degrades the status
+func Health(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	status := util.GetServerStatus(lua.ServerStatusAddress(), false)
+
+	resp := healthResponse{
+		Status:   "ok",
+		Database: database.DB.Ping() == nil,
+		GameServer: healthServerStatus{
+			Online:    status.Online,
+			Error:     status.Error,
+			Players:   status.Players.Online,
+			Uptime:    status.Uptime,
+			CheckedAt: status.CheckedAt,
+		},
+	}
+
+	code := http.StatusOK
+
+	if !resp.GameServer.Online {
+		resp.Status = "degraded"
+	}
+
+	if !resp.Database {
+		resp.Status = "down"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		util.Logger.Logger.Errorf("Cannot encode health response: %v", err)
+	}
+}
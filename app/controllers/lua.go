@@ -1,14 +1,21 @@
 package controllers
 
 import (
+	"mime"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/raggaer/castro/app/lua"
+	"github.com/raggaer/castro/app/models"
 	"github.com/raggaer/castro/app/util"
 )
 
+// LegacyCsrfPrefix prefix of the old CSRF exempt routes. The routes are kept as an alias of
+// the subtopic pages but the CSRF token is checked unless the page declares csrf = false
+const LegacyCsrfPrefix = "/nocsrf/"
+
 // LuaPage executes the given lua page
 func LuaPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Create application paypal REST client
@@ -155,6 +162,10 @@ func LuaPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	// Profile page execution
+	stopProfile := lua.Profiler.Start(s, strings.TrimPrefix(filepath.ToSlash(filepath.Dir(protoPath)), "pages/"))
+	defer stopProfile()
+
 	// Execute compiled file
 	if err := lua.DoCompiledFile(
 		s,
@@ -165,8 +176,41 @@ func LuaPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	// Reject requests without a valid CSRF token unless the page is exempt
+	if valid, ok := r.Context().Value("csrf-valid").(bool); ok && !valid && !lua.IsCsrfExempt(s) && !csrfMultipartValid(r) {
+		util.Logger.Logger.Warnf("Invalid CSRF token on %v %v", r.Method, r.URL.Path)
+
+		if strings.HasPrefix(r.URL.Path, LegacyCsrfPrefix) {
+			util.Logger.Logger.Warnf("The %v routes no longer skip the CSRF check. Set csrf = false on %v to accept requests from other sites", LegacyCsrfPrefix, pageName)
+		}
+
+		ErrorPage(w, r, http.StatusForbidden)
+		return
+	}
+
 	if err := lua.ExecuteControllerPage(s, r.Method); err != nil {
 		w.WriteHeader(500)
 		util.Logger.Logger.Errorf("Cannot execute subtopic %v: %v", pageName, err)
 	}
 }
+
+// csrfMultipartValid checks the CSRF token sent on a multipart form. Multipart bodies are
+// only parsed by the pages so the CSRF middleware cannot read their token
+func csrfMultipartValid(r *http.Request) bool {
+	token, ok := r.Context().Value("csrf-token").(*models.CsrfToken)
+
+	if !ok {
+		return false
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "multipart/form-data" {
+		return false
+	}
+
+	// Parse the form the same way http:formFile does
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return false
+	}
+
+	return token.Valid(r.PostFormValue("_csrf"))
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+)
+
+func TestCsrfMultipartValid(t *testing.T) {
+	multipartBody := func(token string) (string, *bytes.Buffer) {
+		buff := &bytes.Buffer{}
+		mw := multipart.NewWriter(buff)
+		mw.WriteField("_csrf", token)
+		mw.Close()
+
+		return mw.FormDataContentType(), buff
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		form  bool
+		valid bool
+	}{
+		{name: "multipart token", token: "token", valid: true},
+		{name: "previous multipart token", token: "previous", valid: true},
+		{name: "wrong multipart token", token: "wrong", valid: false},
+		{name: "empty multipart token", token: "", valid: false},
+		{name: "urlencoded token", token: "token", form: true, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req *http.Request
+
+			if test.form {
+				req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_csrf="+test.token))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				contentType, body := multipartBody(test.token)
+				req = httptest.NewRequest(http.MethodPost, "/", body)
+				req.Header.Set("Content-Type", contentType)
+			}
+
+			req = req.WithContext(context.WithValue(req.Context(), "csrf-token", &models.CsrfToken{
+				Token:    "token",
+				Previous: "previous",
+				At:       time.Now(),
+			}))
+
+			if valid := csrfMultipartValid(req); valid != test.valid {
+				t.Fatalf("Expected token to be valid %v got %v", test.valid, valid)
+			}
+		})
+	}
+
+	// Requests without a session token are never valid
+	contentType, body := multipartBody("token")
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", contentType)
+
+	if csrfMultipartValid(req) {
+		t.Fatalf("Expected token without session to be invalid")
+	}
+}
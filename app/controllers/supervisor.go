@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+)
+
+// SupervisorConsolePath path of the game server console stream
+const SupervisorConsolePath = "/supervisor/console"
+
+// SupervisorConsole streams the game server console output and state changes to admins
+// as server-sent events. Reconnecting clients only receive the lines they missed
+func SupervisorConsole(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if util.GameSupervisor == nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	if !isAdminRequest(req) {
+		ErrorPage(w, req, 403)
+		return
+	}
+
+	// Check if response can be flushed
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		w.WriteHeader(500)
+		return
+	}
+
+	// Listen before reading the backlog so no line is lost
+	events, cancel := util.Bus.Listen("supervisor.*", 256)
+	defer cancel()
+
+	since, _ := strconv.ParseInt(req.Header.Get("Last-Event-ID"), 10, 64)
+
+	// Keep the stream open past the server write timeout
+	if err := util.DisableWriteDeadline(w, req); err != nil {
+		util.Logger.Logger.Errorf("Cannot disable stream write deadline: %v", err)
+	}
+
+	// Set stream headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+
+	// Send the captured lines
+	for _, line := range util.GameSupervisor.Lines(since, 0) {
+		writeConsoleLine(w, line.ID, map[string]interface{}{
+			"id":     line.ID,
+			"time":   line.Time,
+			"stream": line.Stream,
+			"text":   line.Text,
+		})
+		since = line.ID
+	}
+
+	writeConsoleEvent(w, "state", map[string]interface{}{
+		"state": util.GameSupervisor.Status().State,
+	})
+	flusher.Flush()
+
+	// Create keep-alive ticker
+	ticker := time.NewTicker(time.Second * 15)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-ticker.C:
+			// Send keep-alive comment
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+
+		case e := <-events:
+			switch e.Topic {
+			case "supervisor.console":
+				id, _ := e.Payload["id"].(int64)
+
+				// Skip lines already sent with the backlog
+				if id <= since {
+					continue
+				}
+
+				writeConsoleLine(w, id, e.Payload)
+			default:
+				writeConsoleEvent(w, e.Topic[len("supervisor."):], e.Payload)
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// isAdminRequest checks if the request session belongs to a logged admin account
+func isAdminRequest(req *http.Request) bool {
+	session, ok := req.Context().Value("session").(map[string]interface{})
+
+	if !ok {
+		return false
+	}
+
+	if logged, _ := session["logged"].(bool); !logged {
+		return false
+	}
+
+	name, _ := session["loggedAccount"].(string)
+
+	_, castroAccount, err := models.GetAccountByName(name)
+
+	if err != nil {
+		return false
+	}
+
+	return castroAccount.Admin
+}
+
+// writeConsoleLine writes a console line event using the line identifier as event identifier
+func writeConsoleLine(w http.ResponseWriter, id int64, payload map[string]interface{}) {
+	buff, err := json.Marshal(payload)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot encode console line: %v", err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: console\ndata: %s\n\n", id, buff)
+}
+
+// writeConsoleEvent writes a supervisor event
+func writeConsoleEvent(w http.ResponseWriter, name string, payload map[string]interface{}) {
+	buff, err := json.Marshal(payload)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot encode supervisor %v event: %v", name, err)
+		return
+	}
+
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, buff)
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"os"
+
+	"github.com/raggaer/castro/app/lua"
+)
+
+// Lint loads the application configuration and lints all the lua files of the given directories
+func Lint(dirs []string) ([]lua.LintIssue, error) {
+	// Load application logger
+	loadAppLogger()
+
+	// Load application config
+	loadAppConfig()
+
+	// Create linter
+	linter, err := lua.NewLinter("engine")
+
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []lua.LintIssue{}
+
+	for _, dir := range dirs {
+		list, err := linter.LintDirectory(dir)
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		issues = append(issues, list...)
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,180 @@
+package lua
+
+import (
+	"strings"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetBusMetaTable sets the bus metatable of the given state
+func SetBusMetaTable(luaState *glua.LState) {
+	// Create and set the bus metatable
+	busMetaTable := luaState.NewTypeMetatable(BusMetaTableName)
+	luaState.SetGlobal(BusMetaTableName, busMetaTable)
+
+	// Set all bus metatable functions
+	luaState.SetFuncs(busMetaTable, busMethods)
+}
+
+// luaEventHandler returns an event handler that executes the event function of the given compiled file
+func luaEventHandler(proto *glua.FunctionProto) util.EventHandler {
+	return func(e *util.Event) error {
+		// Create event state so handlers cannot see or leak page globals
+		state := NewState()
+		defer state.Close()
+
+		// Execute handler file
+		if err := DoCompiledFile(state, proto); err != nil {
+			return err
+		}
+
+		// Call event function
+		return state.CallByParam(
+			glua.P{
+				Fn:      state.GetGlobal("event"),
+				NRet:    0,
+				Protect: true,
+			},
+			glua.LString(e.Topic),
+			MapToTable(e.Payload),
+		)
+	}
+}
+
+// getEventPayload returns the event payload argument as a map
+func getEventPayload(L *glua.LState, n int) map[string]interface{} {
+	if tbl, ok := L.Get(n).(*glua.LTable); ok {
+		return TableToMap(tbl)
+	}
+	return map[string]interface{}{}
+}
+
+// EmitEvent delivers an event to all subscriptions waiting for synchronous handlers
+func EmitEvent(L *glua.LState) int {
+	// Get topic
+	topic := L.Get(2)
+
+	// Check valid topic
+	if topic.Type() != glua.LTString {
+		L.ArgError(1, "Invalid topic type. Expected string")
+		return 0
+	}
+
+	// Emit event
+	errs := util.Bus.Emit(topic.String(), getEventPayload(L, 3))
+
+	if len(errs) == 0 {
+		L.Push(glua.LBool(true))
+		return 1
+	}
+
+	// Join handler errors
+	messages := []string{}
+
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	L.Push(glua.LBool(false))
+	L.Push(glua.LString(strings.Join(messages, "; ")))
+
+	return 2
+}
+
+// EmitEventAsync delivers an event to all subscriptions without waiting
+func EmitEventAsync(L *glua.LState) int {
+	// Get topic
+	topic := L.Get(2)
+
+	// Check valid topic
+	if topic.Type() != glua.LTString {
+		L.ArgError(1, "Invalid topic type. Expected string")
+		return 0
+	}
+
+	// Emit event
+	util.Bus.EmitAsync(topic.String(), getEventPayload(L, 3))
+
+	return 0
+}
+
+// SubscribeEvent subscribes a lua file to the given topic pattern
+func SubscribeEvent(L *glua.LState) int {
+	// Get pattern
+	pattern := L.Get(2)
+
+	// Check valid pattern
+	if pattern.Type() != glua.LTString {
+		L.ArgError(1, "Invalid topic pattern type. Expected string")
+		return 0
+	}
+
+	// Get handler path
+	path := L.Get(3)
+
+	// Check valid path
+	if path.Type() != glua.LTString {
+		L.ArgError(2, "Invalid event handler path type. Expected string")
+		return 0
+	}
+
+	// Compile handler file
+	proto, err := CompileLua(path.String())
+
+	if err != nil {
+		L.RaiseError("Cannot compile event handler: %v", err)
+		return 0
+	}
+
+	// Subscribe handler
+	id := util.Bus.On(pattern.String(), L.ToBool(4), luaEventHandler(proto))
+
+	// Push subscription identifier
+	L.Push(glua.LNumber(id))
+
+	return 1
+}
+
+// SubscribeEventJob enqueues a background job for every event matching the given topic pattern
+func SubscribeEventJob(L *glua.LState) int {
+	// Get pattern
+	pattern := L.Get(2)
+
+	// Check valid pattern
+	if pattern.Type() != glua.LTString {
+		L.ArgError(1, "Invalid topic pattern type. Expected string")
+		return 0
+	}
+
+	// Get job name
+	name := L.Get(3)
+
+	// Check valid job name
+	if name.Type() != glua.LTString {
+		L.ArgError(2, "Invalid job name type. Expected string")
+		return 0
+	}
+
+	// Subscribe job
+	id := util.Bus.On(pattern.String(), false, func(e *util.Event) error {
+		_, err := util.Jobs.Enqueue(name.String(), map[string]interface{}{
+			"topic":   e.Topic,
+			"payload": e.Payload,
+		}, util.JobOptions{})
+		return err
+	})
+
+	// Push subscription identifier
+	L.Push(glua.LNumber(id))
+
+	return 1
+}
+
+// UnsubscribeEvent removes the given subscription
+func UnsubscribeEvent(L *glua.LState) int {
+	// Remove subscription
+	util.Bus.Off(L.ToInt64(2))
+
+	return 0
+}
@@ -0,0 +1,56 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raggaer/castro/app/util"
+)
+
+func TestEventHandlerRunsOnFreshState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.lua")
+
+	err := os.WriteFile(path, []byte(`
+		function event(topic, payload)
+			if previous ~= nil then
+				error("global leaked from the previous event " .. previous)
+			end
+
+			if http.method ~= nil or http.getValues ~= nil then
+				error("page request available on the event state")
+			end
+
+			if topic ~= "test.topic" or payload.message ~= "hello" then
+				error("unexpected event " .. topic)
+			end
+
+			previous = topic
+		end
+	`), 0644)
+
+	if err != nil {
+		t.Fatalf("Cannot write event handler: %v", err)
+	}
+
+	proto, err := CompileLua(path)
+
+	if err != nil {
+		t.Fatalf("Cannot compile event handler: %v", err)
+	}
+
+	handler := luaEventHandler(proto)
+
+	for i := 0; i < 2; i++ {
+		err := handler(&util.Event{
+			Topic: "test.topic",
+			Payload: map[string]interface{}{
+				"message": "hello",
+			},
+		})
+
+		if err != nil {
+			t.Fatalf("Event %v failed: %v", i+1, err)
+		}
+	}
+}
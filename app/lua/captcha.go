@@ -1,6 +1,8 @@
 package lua
 
 import (
+	"strings"
+
 	"github.com/raggaer/castro/app/util"
 	"github.com/yuin/gopher-lua"
 )
@@ -25,20 +27,30 @@ func IsEnabled(L *lua.LState) int {
 	return 1
 }
 
-// VerifyCaptcha checks if the given captcha response is valid
+// VerifyCaptcha checks if the captcha answer of the current request is valid. The answer is
+// read from the request form unless it is given
 func VerifyCaptcha(L *lua.LState) int {
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
 	// Get captcha response
 	answer := L.Get(2)
 
 	// Check for valid response type
-	if answer.Type() != lua.LTString {
+	if answer.Type() != lua.LTString && answer.Type() != lua.LTNil {
 
 		L.ArgError(1, "Invalid captcha response format. Expected string")
 		return 0
 	}
 
+	response := ""
+
+	if answer.Type() == lua.LTString {
+		response = answer.String()
+	}
+
 	// Verify captcha answer
-	check, err := util.VerifyCaptcha(answer.String())
+	check, err := util.VerifyCaptcha(req, response)
 
 	if err != nil {
 
@@ -51,3 +63,34 @@ func VerifyCaptcha(L *lua.LState) int {
 
 	return 1
 }
+
+// GetCaptchaWidget returns the widget HTML of the captcha provider
+func GetCaptchaWidget(L *lua.LState) int {
+	// Get captcha widget
+	widget, err := util.CaptchaWidget()
+
+	if err != nil {
+
+		L.RaiseError("Cannot get captcha widget: %v", err)
+		return 0
+	}
+
+	// Push widget to stack
+	L.Push(lua.LString(widget))
+
+	return 1
+}
+
+// GetCaptchaProvider returns the name of the configured captcha provider
+func GetCaptchaProvider(L *lua.LState) int {
+	provider := strings.ToLower(util.Config.Configuration.Captcha.Provider)
+
+	if provider == "" {
+		provider = "recaptcha"
+	}
+
+	// Push provider name to stack
+	L.Push(lua.LString(provider))
+
+	return 1
+}
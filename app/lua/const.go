@@ -4,6 +4,57 @@ const (
 	// I18nMetaTableName the name of the i18n metatable
 	I18nMetaTableName = "i18n"
 
+	// JobsMetaTableName the name of the jobs metatable
+	JobsMetaTableName = "jobs"
+
+	// BusMetaTableName the name of the event bus metatable
+	BusMetaTableName = "bus"
+
+	// ProfilerMetaTableName the name of the profiler metatable
+	ProfilerMetaTableName = "profiler"
+
+	// CSVMetaTableName the name of the csv metatable
+	CSVMetaTableName = "csv"
+
+	// TOMLMetaTableName the name of the toml metatable
+	TOMLMetaTableName = "toml"
+
+	// YAMLMetaTableName the name of the yaml metatable
+	YAMLMetaTableName = "yaml"
+
+	// HTMLMetaTableName the name of the html metatable
+	HTMLMetaTableName = "html"
+
+	// MarkdownMetaTableName the name of the markdown metatable
+	MarkdownMetaTableName = "markdown"
+
+	// TokenMetaTableName the name of the signed token metatable
+	TokenMetaTableName = "token"
+
+	// CookieMetaTableName the name of the signed cookie metatable
+	CookieMetaTableName = "cookie"
+
+	// SecurityMetaTableName the name of the login security metatable
+	SecurityMetaTableName = "security"
+
+	// ServerMetaTableName the name of the game server metatable
+	ServerMetaTableName = "server"
+
+	// SupervisorMetaTableName the name of the game server supervisor metatable
+	SupervisorMetaTableName = "supervisor"
+
+	// WebAuthnMetaTableName the name of the webauthn metatable
+	WebAuthnMetaTableName = "webauthn"
+
+	// PromiseMetaTableName the name of the http promise object table
+	PromiseMetaTableName = "promise"
+
+	// GuildMetaTableName the name of the guild object table
+	GuildMetaTableName = "guild"
+
+	// TestMetaTableName the name of the test object table
+	TestMetaTableName = "test"
+
 	// ExtensionMetaTableName the name of the extension metatable
 	ExtensionMetaTableName = "extension"
 
@@ -121,12 +172,18 @@ const (
 	// HTTPRequestName the field name of the http request
 	HTTPRequestName = "__r"
 
+	// HTTPOutboundCountName the field name of the outbound request counter
+	HTTPOutboundCountName = "__outbound"
+
 	// HTTPPostValuesName the field name of the list of POST values
 	HTTPPostValuesName = "postValues"
 
 	// HTTPCurrentSubtopic the field name of the current subtopic uri
 	HTTPCurrentSubtopic = "subtopic"
 
-	// HTTPMetaTableBodyName the field name of the http body
-	HTTPMetaTableBodyName = "body"
+	// HTTPRequestBodyName the field name of the read request body
+	HTTPRequestBodyName = "__body"
+
+	// defaultRequestBodyLimit default size limit of http:body
+	defaultRequestBodyLimit = 1 << 20
 )
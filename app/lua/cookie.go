@@ -0,0 +1,157 @@
+package lua
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetCookieMetaTable sets the cookie metatable of the given state
+func SetCookieMetaTable(luaState *glua.LState) {
+	// Create and set the cookie metatable
+	cookieMetaTable := luaState.NewTypeMetatable(CookieMetaTableName)
+	luaState.SetGlobal(CookieMetaTableName, cookieMetaTable)
+
+	// Set all cookie metatable functions
+	luaState.SetFuncs(cookieMetaTable, cookieMethods)
+}
+
+// SetSignedCookie signs, encrypts and sets the given cookie. Values can be strings, numbers, booleans or tables
+func SetSignedCookie(L *glua.LState) int {
+	// Get HTTP response writer
+	_, w := getRequestAndResponseWriter(L)
+
+	// Get cookie name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	var value interface{}
+
+	// Get cookie value
+	switch v := L.Get(3).(type) {
+	case glua.LString:
+		value = string(v)
+	case glua.LNumber:
+		value = float64(v)
+	case glua.LBool:
+		value = bool(v)
+	case *glua.LTable:
+		value = TableToMap(v)
+	default:
+		L.ArgError(2, "Invalid value type. Expected string, number, bool or table")
+		return 0
+	}
+
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		L.RaiseError("Cannot encode cookie value: %v", err)
+		return 0
+	}
+
+	encoded, err := util.SessionStore.Encode(name.String(), string(data))
+
+	if err != nil {
+		L.RaiseError("Cannot encode cookie value: %v", err)
+		return 0
+	}
+
+	c := util.NewCookie(name.String(), encoded, util.Config.Configuration.Cookies.MaxAge)
+
+	// Get cookie options
+	if tbl, ok := L.Get(4).(*glua.LTable); ok {
+		if maxAge, ok := tbl.RawGetString("maxAge").(glua.LNumber); ok {
+			c.MaxAge = int(maxAge)
+		}
+
+		if httpOnly := tbl.RawGetString("httpOnly"); httpOnly != glua.LNil {
+			c.HttpOnly = glua.LVAsBool(httpOnly)
+		}
+
+		if sameSite, ok := tbl.RawGetString("sameSite").(glua.LString); ok {
+			switch strings.ToLower(string(sameSite)) {
+			case "strict":
+				c.SameSite = http.SameSiteStrictMode
+			case "lax":
+				c.SameSite = http.SameSiteLaxMode
+			case "none":
+				c.SameSite = http.SameSiteNoneMode
+			default:
+				L.ArgError(3, "Invalid sameSite option. Expected strict, lax or none")
+				return 0
+			}
+		}
+	}
+
+	http.SetCookie(w, c)
+
+	return 0
+}
+
+// GetSignedCookie returns the value of the given signed cookie or nil if the cookie is
+// missing or was tampered with
+func GetSignedCookie(L *glua.LState) int {
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	// Get cookie name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	cookie, err := req.Cookie(util.Config.Configuration.CookieName(name.String()))
+
+	if err != nil {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	data := ""
+
+	if err := util.SessionStore.Decode(name.String(), cookie.Value, &data); err != nil {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	var value interface{}
+
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	L.Push(jsonValueToLua(value))
+
+	return 1
+}
+
+// DeleteSignedCookie removes the given signed cookie
+func DeleteSignedCookie(L *glua.LState) int {
+	// Get HTTP response writer
+	_, w := getRequestAndResponseWriter(L)
+
+	// Get cookie name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	http.SetCookie(w, util.NewCookie(name.String(), "", -1))
+
+	return 0
+}
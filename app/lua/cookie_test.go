@@ -0,0 +1,108 @@
+package lua
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+func TestSignedCookies(t *testing.T) {
+	util.Config.Configuration = &util.Configuration{
+		Cookies: util.CookieConfig{
+			MaxAge:   3600,
+			HashKey:  "cookie-test-hash-key-0123456789a",
+			BlockKey: "cookie-test-block-key-0123456789",
+		},
+	}
+
+	util.SessionStore = util.NewCookieStore(util.Config.Configuration.Cookies.KeyPairs())
+
+	// run executes the code with the given request cookies returning the response cookies
+	run := func(t *testing.T, code string, cookies []*http.Cookie) []*http.Cookie {
+		L := glua.NewState()
+		defer L.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+
+		w := httptest.NewRecorder()
+
+		SetHTTPMetaTable(L)
+		SetHTTPUserData(L, w, req)
+		SetCookieMetaTable(L)
+
+		if err := L.DoString(code); err != nil {
+			t.Fatal(err)
+		}
+
+		return w.Result().Cookies()
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		tamper func(c *http.Cookie)
+		code   string
+	}{
+		{
+			name:  "string value",
+			value: `"castro"`,
+			code:  `assert(cookie:get("prefs") == "castro")`,
+		},
+		{
+			name:  "table value",
+			value: `{theme = "dark", size = 12}`,
+			code: `
+				local prefs = cookie:get("prefs")
+				assert(prefs.theme == "dark" and prefs.size == 12)
+			`,
+		},
+		{
+			name:   "tampered value",
+			value:  `"castro"`,
+			tamper: func(c *http.Cookie) { c.Value = c.Value[:len(c.Value)-4] + "AAAA" },
+			code:   `assert(cookie:get("prefs") == nil)`,
+		},
+		{
+			name:   "renamed cookie",
+			value:  `"castro"`,
+			tamper: func(c *http.Cookie) { c.Name = "other" },
+			code:   `assert(cookie:get("prefs") == nil and cookie:get("other") == nil)`,
+		},
+		{
+			name:   "raw cookie",
+			value:  `"castro"`,
+			tamper: func(c *http.Cookie) { c.Value = "castro" },
+			code:   `assert(cookie:get("prefs") == nil)`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cookies := run(t, `cookie:set("prefs", `+test.value+`, {maxAge = 60, sameSite = "strict"})`, nil)
+
+			if len(cookies) != 1 || cookies[0].MaxAge != 60 || cookies[0].SameSite != http.SameSiteStrictMode || !cookies[0].HttpOnly {
+				t.Fatalf("Unexpected cookies %+v", cookies)
+			}
+
+			if test.tamper != nil {
+				test.tamper(cookies[0])
+			}
+
+			run(t, test.code, cookies)
+		})
+	}
+
+	// Deleted cookies are expired
+	cookies := run(t, `cookie:delete("prefs")`, nil)
+
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("Expected expired cookie got %+v", cookies)
+	}
+}
@@ -0,0 +1,100 @@
+package lua
+
+import (
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// getPolicySources returns the policy sources of the given argument
+func getPolicySources(L *glua.LState, n int) ([]string, bool) {
+	switch v := L.Get(n).(type) {
+	case glua.LString:
+		return []string{string(v)}, true
+	case *glua.LTable:
+		sources := []string{}
+
+		v.ForEach(func(_ glua.LValue, s glua.LValue) {
+			sources = append(sources, s.String())
+		})
+
+		return sources, true
+	}
+
+	return nil, false
+}
+
+// updateRequestPolicy applies the given change to the request policy and sets the policy header again
+func updateRequestPolicy(L *glua.LState, change func(p *util.ContentSecurityPolicy) *util.ContentSecurityPolicy) {
+	// Get HTTP request and HTTP response writer
+	req, w := getRequestAndResponseWriter(L)
+
+	// Get request policy
+	csp, ok := req.Context().Value("csp").(*util.RequestSecurityPolicy)
+
+	if !ok {
+		L.RaiseError("Cannot get the request security policy")
+		return
+	}
+
+	csp.Policy = change(csp.Policy)
+	csp.SetHeader(w)
+}
+
+// SetPolicy replaces the sources of a Content-Security-Policy directive for the current page. Removes the directive when no sources are given
+func SetPolicy(L *glua.LState) int {
+	// Get directive
+	directive := L.Get(2)
+
+	// Check valid directive
+	if directive.Type() != glua.LTString {
+		L.ArgError(1, "Invalid directive type. Expected string")
+		return 0
+	}
+
+	// Remove directive
+	if L.Get(3) == glua.LNil {
+		updateRequestPolicy(L, func(p *util.ContentSecurityPolicy) *util.ContentSecurityPolicy {
+			return p.Without(directive.String())
+		})
+
+		return 0
+	}
+
+	sources, ok := getPolicySources(L, 3)
+
+	if !ok {
+		L.ArgError(2, "Invalid sources type. Expected string or table")
+		return 0
+	}
+
+	updateRequestPolicy(L, func(p *util.ContentSecurityPolicy) *util.ContentSecurityPolicy {
+		return p.With(directive.String(), sources...)
+	})
+
+	return 0
+}
+
+// AddPolicy adds sources to a Content-Security-Policy directive for the current page
+func AddPolicy(L *glua.LState) int {
+	// Get directive
+	directive := L.Get(2)
+
+	// Check valid directive
+	if directive.Type() != glua.LTString {
+		L.ArgError(1, "Invalid directive type. Expected string")
+		return 0
+	}
+
+	sources, ok := getPolicySources(L, 3)
+
+	if !ok {
+		L.ArgError(2, "Invalid sources type. Expected string or table")
+		return 0
+	}
+
+	updateRequestPolicy(L, func(p *util.ContentSecurityPolicy) *util.ContentSecurityPolicy {
+		return p.Add(directive.String(), sources...)
+	})
+
+	return 0
+}
@@ -0,0 +1,416 @@
+package lua
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	glua "github.com/yuin/gopher-lua"
+)
+
+// csvOptions options used to decode and encode csv data
+type csvOptions struct {
+	Separator rune
+	Comment   rune
+	Trim      bool
+	Header    bool
+	Columns   []string
+	Titles    map[string]string
+}
+
+// SetCSVMetaTable sets the csv metatable of the given state
+func SetCSVMetaTable(luaState *glua.LState) {
+	// Create and set the csv metatable
+	csvMetaTable := luaState.NewTypeMetatable(CSVMetaTableName)
+	luaState.SetGlobal(CSVMetaTableName, csvMetaTable)
+
+	// Set all csv metatable functions
+	luaState.SetFuncs(csvMetaTable, csvMethods)
+}
+
+// csvOptionsFromTable parses the options table at the given position. The header field can be
+// a boolean or a table mapping column names to header titles
+func csvOptionsFromTable(L *glua.LState, n int) csvOptions {
+	opts := csvOptions{
+		Separator: ',',
+		Header:    true,
+		Titles:    map[string]string{},
+	}
+
+	tbl, ok := L.Get(n).(*glua.LTable)
+
+	if !ok {
+		return opts
+	}
+
+	if sep, ok := tbl.RawGetString("separator").(glua.LString); ok {
+		opts.Separator, _ = utf8.DecodeRuneInString(string(sep))
+	}
+
+	if comment, ok := tbl.RawGetString("comment").(glua.LString); ok {
+		opts.Comment, _ = utf8.DecodeRuneInString(string(comment))
+	}
+
+	opts.Trim = glua.LVAsBool(tbl.RawGetString("trim"))
+
+	switch header := tbl.RawGetString("header").(type) {
+	case glua.LBool:
+		opts.Header = bool(header)
+	case *glua.LTable:
+		header.ForEach(func(k glua.LValue, v glua.LValue) {
+			opts.Titles[k.String()] = v.String()
+		})
+	}
+
+	if columns, ok := tbl.RawGetString("columns").(*glua.LTable); ok {
+		for i := 1; i <= columns.Len(); i++ {
+			opts.Columns = append(opts.Columns, columns.RawGetInt(i).String())
+		}
+	}
+
+	return opts
+}
+
+// csvCell converts a lua value to a csv cell
+func csvCell(v glua.LValue) string {
+	switch val := v.(type) {
+	case *glua.LNilType:
+		return ""
+	case glua.LNumber:
+		return strconv.FormatFloat(float64(val), 'f', -1, 64)
+	}
+
+	return v.String()
+}
+
+// csvRowColumns returns the sorted keys of a csv row table
+func csvRowColumns(row *glua.LTable) []string {
+	columns := []string{}
+
+	row.ForEach(func(k glua.LValue, _ glua.LValue) {
+		if k.Type() == glua.LTString {
+			columns = append(columns, k.String())
+		}
+	})
+
+	sort.Strings(columns)
+
+	return columns
+}
+
+// csvRecord converts a row table to a csv record. Rows can be lists or tables keyed by column name
+func csvRecord(row *glua.LTable, columns []string) []string {
+	if len(columns) == 0 || row.Len() > 0 {
+		record := make([]string, 0, row.Len())
+
+		for i := 1; i <= row.Len(); i++ {
+			record = append(record, csvCell(row.RawGetInt(i)))
+		}
+
+		return record
+	}
+
+	record := make([]string, 0, len(columns))
+
+	for _, c := range columns {
+		record = append(record, csvCell(row.RawGetString(c)))
+	}
+
+	return record
+}
+
+// csvHeader returns the header record of the given columns
+func csvHeader(opts csvOptions, columns []string) []string {
+	header := make([]string, 0, len(columns))
+
+	for _, c := range columns {
+		if title, ok := opts.Titles[c]; ok {
+			header = append(header, title)
+			continue
+		}
+
+		header = append(header, c)
+	}
+
+	return header
+}
+
+// csvEncoder writes lua rows to a csv writer
+type csvEncoder struct {
+	opts    csvOptions
+	columns []string
+	writer  *csv.Writer
+	started bool
+}
+
+// newCSVEncoder creates a csv encoder for the given writer
+func newCSVEncoder(w io.Writer, opts csvOptions) *csvEncoder {
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.Separator
+
+	return &csvEncoder{
+		opts:    opts,
+		columns: opts.Columns,
+		writer:  writer,
+	}
+}
+
+// write encodes a single row, writing the header before the first row
+func (e *csvEncoder) write(row *glua.LTable) error {
+	if !e.started {
+		e.started = true
+
+		// Keyed rows without explicit columns use the keys of the first row
+		if len(e.columns) == 0 && row.Len() == 0 {
+			e.columns = csvRowColumns(row)
+		}
+
+		if e.opts.Header && len(e.columns) > 0 {
+			if err := e.writer.Write(csvHeader(e.opts, e.columns)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.writer.Write(csvRecord(row, e.columns))
+}
+
+// flush flushes the buffered rows
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// EncodeCSV encodes a list of rows as csv
+func EncodeCSV(L *glua.LState) int {
+	// Get rows table
+	rows := L.Get(2)
+
+	// Check valid rows table
+	if rows.Type() != glua.LTTable {
+		L.ArgError(1, "Invalid rows type. Expected table")
+		return 0
+	}
+
+	buff := &bytes.Buffer{}
+	encoder := newCSVEncoder(buff, csvOptionsFromTable(L, 3))
+
+	list := rows.(*glua.LTable)
+
+	for i := 1; i <= list.Len(); i++ {
+		row, ok := list.RawGetInt(i).(*glua.LTable)
+
+		if !ok {
+			L.RaiseError("Invalid csv row %v. Expected table", i)
+			return 0
+		}
+
+		if err := encoder.write(row); err != nil {
+			L.RaiseError("Cannot encode csv row: %v", err)
+			return 0
+		}
+	}
+
+	if err := encoder.flush(); err != nil {
+		L.RaiseError("Cannot encode csv: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LString(buff.String()))
+
+	return 1
+}
+
+// DecodeCSV decodes a csv string. When the header option is enabled rows are
+// returned as tables keyed by column name, otherwise rows are lists
+func DecodeCSV(L *glua.LState) int {
+	// Get csv source
+	src := L.Get(2)
+
+	// Check valid source
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid csv source. Expected string")
+		return 0
+	}
+
+	opts := csvOptionsFromTable(L, 3)
+
+	reader := csv.NewReader(strings.NewReader(src.String()))
+	reader.Comma = opts.Separator
+	reader.Comment = opts.Comment
+	reader.TrimLeadingSpace = opts.Trim
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+
+	if err != nil {
+		L.RaiseError("Cannot decode csv: %v", err)
+		return 0
+	}
+
+	result := L.NewTable()
+
+	// Get column names from the columns option or the header record
+	columns := opts.Columns
+
+	if opts.Header && len(records) > 0 {
+		if len(columns) == 0 {
+			columns = records[0]
+		}
+
+		records = records[1:]
+	}
+
+	// Map header titles to column names
+	names := map[string]string{}
+
+	for name, title := range opts.Titles {
+		names[title] = name
+	}
+
+	for i, c := range columns {
+		if name, ok := names[c]; ok {
+			columns[i] = name
+		}
+	}
+
+	for _, record := range records {
+		row := L.NewTable()
+
+		for i, cell := range record {
+			if opts.Trim {
+				cell = strings.TrimSpace(cell)
+			}
+
+			if i < len(columns) {
+				row.RawSetString(columns[i], glua.LString(cell))
+				continue
+			}
+
+			row.RawSetInt(i+1, glua.LString(cell))
+		}
+
+		result.Append(row)
+	}
+
+	L.Push(result)
+
+	return 1
+}
+
+// ServeCSV streams csv rows as a file download. The source can be a list of rows or a
+// function returning the next row, or nil when there are no more rows
+func ServeCSV(L *glua.LState) int {
+	// Get HTTP request and response writer
+	req, w := getRequestAndResponseWriter(L)
+
+	// Get file name
+	name := L.Get(2)
+
+	// Check valid file name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid file name type. Expected string")
+		return 0
+	}
+
+	// Get rows source
+	source := L.Get(3)
+
+	// Check valid source
+	if source.Type() != glua.LTTable && source.Type() != glua.LTFunction {
+		L.ArgError(2, "Invalid rows type. Expected table or function")
+		return 0
+	}
+
+	// Set file headers
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": filepath.Base(name.String()),
+	}))
+	disableWriteDeadline(w, req)
+	w.WriteHeader(200)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := newCSVEncoder(w, csvOptionsFromTable(L, 4))
+
+	// Get next row from the source
+	index := 0
+	next := func() (glua.LValue, error) {
+		if list, ok := source.(*glua.LTable); ok {
+			index++
+			return list.RawGetInt(index), nil
+		}
+
+		if err := L.CallByParam(glua.P{
+			Fn:      source,
+			NRet:    1,
+			Protect: true,
+		}); err != nil {
+			return nil, err
+		}
+
+		row := L.Get(-1)
+		L.Pop(1)
+
+		return row, nil
+	}
+
+	count := 0
+
+	for {
+		row, err := next()
+
+		if err != nil {
+			L.RaiseError("Cannot read csv row: %v", err)
+			return 0
+		}
+
+		if row == glua.LNil {
+			break
+		}
+
+		tbl, ok := row.(*glua.LTable)
+
+		if !ok {
+			L.RaiseError("Invalid csv row. Expected table")
+			return 0
+		}
+
+		if err := encoder.write(tbl); err != nil {
+			L.RaiseError("Cannot write csv row: %v", err)
+			return 0
+		}
+
+		count++
+
+		// Flush rows periodically
+		if count%100 == 0 {
+			if err := encoder.flush(); err != nil {
+				L.RaiseError("Cannot write csv rows: %v", err)
+				return 0
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if err := encoder.flush(); err != nil {
+		L.RaiseError("Cannot write csv rows: %v", err)
+		return 0
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return 0
+}
@@ -0,0 +1,158 @@
+package lua
+
+import (
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// loggedAccountName returns the account name of the logged session
+func loggedAccountName(L *glua.LState) (string, bool) {
+	session := getSessionData(L)
+
+	if logged, _ := session["logged"].(bool); !logged {
+		return "", false
+	}
+
+	name, ok := session["loggedAccount"].(string)
+
+	return name, ok
+}
+
+// currentSessionID returns the server-side identifier of the current session
+func currentSessionID(L *glua.LState) string {
+	req, _ := getRequestAndResponseWriter(L)
+
+	if id, ok := req.Context().Value("session-id").(*string); ok {
+		return *id
+	}
+
+	return ""
+}
+
+// GetSessionDevices returns the sessions of the logged account. Sessions stored
+// on the cookie can not be listed so an empty table is returned
+func GetSessionDevices(L *glua.LState) int {
+	list := L.NewTable()
+
+	name, ok := loggedAccountName(L)
+
+	if !ok || util.Sessions == nil {
+		L.Push(list)
+		return 1
+	}
+
+	sessions, err := util.Sessions.List(name)
+
+	if err != nil {
+		L.RaiseError("Cannot get account sessions: %v", err)
+		return 0
+	}
+
+	current := currentSessionID(L)
+
+	for _, s := range sessions {
+		device := L.NewTable()
+		device.RawSetString("id", glua.LString(util.SessionHandle(s.ID)))
+		device.RawSetString("ip", glua.LString(s.IP))
+		device.RawSetString("userAgent", glua.LString(s.User_agent))
+		device.RawSetString("created", glua.LNumber(s.Created_at))
+		device.RawSetString("lastSeen", glua.LNumber(s.Last_seen))
+		device.RawSetString("current", glua.LBool(s.ID == current))
+		list.Append(device)
+	}
+
+	L.Push(list)
+
+	return 1
+}
+
+// RevokeSessionDevice removes a session of the logged account using its handle
+func RevokeSessionDevice(L *glua.LState) int {
+	// Get session handle
+	handle := L.Get(2)
+
+	if handle.Type() != glua.LTString {
+		L.ArgError(1, "Invalid session type. Expected string")
+		return 0
+	}
+
+	name, ok := loggedAccountName(L)
+
+	if !ok || util.Sessions == nil {
+		L.Push(glua.LFalse)
+		return 1
+	}
+
+	sessions, err := util.Sessions.List(name)
+
+	if err != nil {
+		L.RaiseError("Cannot get account sessions: %v", err)
+		return 0
+	}
+
+	for _, s := range sessions {
+		if util.SessionHandle(s.ID) != handle.String() || s.ID == currentSessionID(L) {
+			continue
+		}
+
+		if err := util.Sessions.Delete(s.ID); err != nil {
+			L.RaiseError("Cannot revoke session: %v", err)
+			return 0
+		}
+
+		L.Push(glua.LTrue)
+		return 1
+	}
+
+	L.Push(glua.LFalse)
+
+	return 1
+}
+
+// RevokeOtherSessionDevices removes all the sessions of the logged account except the current one
+func RevokeOtherSessionDevices(L *glua.LState) int {
+	name, ok := loggedAccountName(L)
+
+	if !ok || util.Sessions == nil {
+		L.Push(glua.LNumber(0))
+		return 1
+	}
+
+	n, err := util.Sessions.DeleteAccount(name, currentSessionID(L))
+
+	if err != nil {
+		L.RaiseError("Cannot revoke sessions: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LNumber(n))
+
+	return 1
+}
+
+// RevokeAccountSessions removes all the sessions of the given account except the current one
+func RevokeAccountSessions(L *glua.LState) int {
+	// Get account name
+	name := L.Get(2)
+
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid account name type. Expected string")
+		return 0
+	}
+
+	if util.Sessions == nil {
+		L.Push(glua.LNumber(0))
+		return 1
+	}
+
+	n, err := util.Sessions.DeleteAccount(name.String(), currentSessionID(L))
+
+	if err != nil {
+		L.RaiseError("Cannot revoke sessions: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LNumber(n))
+
+	return 1
+}
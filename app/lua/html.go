@@ -0,0 +1,143 @@
+package lua
+
+import (
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetHTMLMetaTable sets the html metatable of the given state
+func SetHTMLMetaTable(luaState *glua.LState) {
+	// Create and set the html metatable
+	htmlMetaTable := luaState.NewTypeMetatable(HTMLMetaTableName)
+	luaState.SetGlobal(HTMLMetaTableName, htmlMetaTable)
+
+	// Set all html metatable functions
+	luaState.SetFuncs(htmlMetaTable, htmlMethods)
+}
+
+// SetMarkdownMetaTable sets the markdown metatable of the given state
+func SetMarkdownMetaTable(luaState *glua.LState) {
+	// Create and set the markdown metatable
+	markdownMetaTable := luaState.NewTypeMetatable(MarkdownMetaTableName)
+	luaState.SetGlobal(MarkdownMetaTableName, markdownMetaTable)
+
+	// Set all markdown metatable functions
+	luaState.SetFuncs(markdownMetaTable, markdownMethods)
+}
+
+// SanitizeHTML removes the elements and attributes not allowed by the given policy
+func SanitizeHTML(L *glua.LState) int {
+	// Get html source
+	src := L.Get(2)
+
+	// Check valid source
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid html type. Expected string")
+		return 0
+	}
+
+	out, err := util.Sanitizer.Sanitize(src.String(), L.OptString(3, ""))
+
+	if err != nil {
+		L.RaiseError("Cannot sanitize html: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LString(out))
+
+	return 1
+}
+
+// tableStringList converts a lua list to a string slice
+func tableStringList(tbl *glua.LTable) []string {
+	list := []string{}
+
+	if tbl == nil {
+		return list
+	}
+
+	for i := 1; i <= tbl.Len(); i++ {
+		list = append(list, tbl.RawGetInt(i).String())
+	}
+
+	return list
+}
+
+// SetSanitizePolicy registers a named sanitizer policy
+func SetSanitizePolicy(L *glua.LState) int {
+	// Get policy name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid policy name type. Expected string")
+		return 0
+	}
+
+	// Get policy options
+	opts := L.Get(3)
+
+	// Check valid options
+	if opts.Type() != glua.LTTable {
+		L.ArgError(2, "Invalid policy type. Expected table")
+		return 0
+	}
+
+	tbl := opts.(*glua.LTable)
+
+	cfg := util.SanitizePolicyConfig{
+		Base:       glua.LVAsString(tbl.RawGetString("base")),
+		NoFollow:   glua.LVAsBool(tbl.RawGetString("nofollow")),
+		Attributes: map[string][]string{},
+	}
+
+	if elements, ok := tbl.RawGetString("elements").(*glua.LTable); ok {
+		cfg.Elements = tableStringList(elements)
+	}
+
+	if schemes, ok := tbl.RawGetString("schemes").(*glua.LTable); ok {
+		cfg.Schemes = tableStringList(schemes)
+	}
+
+	if attrs, ok := tbl.RawGetString("attributes").(*glua.LTable); ok {
+		attrs.ForEach(func(k glua.LValue, v glua.LValue) {
+			if list, ok := v.(*glua.LTable); ok {
+				cfg.Attributes[k.String()] = tableStringList(list)
+			}
+		})
+	}
+
+	p, err := util.NewSanitizePolicy(cfg)
+
+	if err != nil {
+		L.RaiseError("Cannot create sanitizer policy: %v", err)
+		return 0
+	}
+
+	util.Sanitizer.Set(name.String(), p)
+
+	return 0
+}
+
+// RenderMarkdown renders the given markdown text as sanitized html
+func RenderMarkdown(L *glua.LState) int {
+	// Get markdown source
+	src := L.Get(2)
+
+	// Check valid source
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid markdown type. Expected string")
+		return 0
+	}
+
+	out, err := util.Sanitizer.RenderMarkdown(src.String(), L.OptString(3, ""))
+
+	if err != nil {
+		L.RaiseError("Cannot render markdown: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LString(out))
+
+	return 1
+}
@@ -1,11 +1,12 @@
 package lua
 
 import (
-	"bytes"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
-	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/raggaer/castro/app/util"
@@ -57,19 +58,13 @@ func SetHTTPUserData(luaState *glua.LState, w http.ResponseWriter, r *http.Reque
 	httpR.Value = r
 	luaState.SetField(httpMetaTable, HTTPRequestName, httpR)
 
-	// Request body placeholder
-	body := ""
+	// Reset outbound request counter
+	outbound := luaState.NewUserData()
+	outbound.Value = new(int)
+	luaState.SetField(httpMetaTable, HTTPOutboundCountName, outbound)
 
-	// Read request body
-	buf, err := ioutil.ReadAll(r.Body)
-	if err == nil {
-
-		// Update request body
-		body = string(buf[:])
-	}
-
-	// Set request body
-	luaState.SetField(httpMetaTable, HTTPMetaTableBodyName, glua.LString(body))
+	// Reset request body. The body is read on the first http:body call
+	luaState.SetField(httpMetaTable, HTTPRequestBodyName, glua.LNil)
 
 	// Set GET values as lua table
 	luaState.SetField(httpMetaTable, HTTPGetValuesName, URLValuesToTable(r.URL.Query()))
@@ -111,6 +106,7 @@ func SetCookie(L *glua.LState) int {
 		Expires:  time.Unix(L.ToInt64(4), 0),
 		Secure:   util.Config.Configuration.IsSSL(),
 		HttpOnly: true,
+		SameSite: util.Config.Configuration.CookieSameSite(),
 	}
 
 	// Set HTTP cookie
@@ -216,6 +212,159 @@ func WriteResponse(L *glua.LState) int {
 	return 0
 }
 
+// GetRequestBody reads the request body up to the given size limit
+func GetRequestBody(L *glua.LState) int {
+	// Get HTTP metatable
+	httpMetaTable := L.GetTypeMetatable(HTTPMetaTableName)
+
+	// Return the already read body
+	if body := L.GetField(httpMetaTable, HTTPRequestBodyName); body.Type() == glua.LTString {
+		L.Push(body)
+		return 1
+	}
+
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	// Get body size limit
+	limit := L.OptInt64(2, defaultRequestBodyLimit)
+
+	// Read request body
+	buff, err := ioutil.ReadAll(io.LimitReader(req.Body, limit+1))
+
+	if err != nil {
+		L.RaiseError("Cannot read request body: %v", err)
+		return 0
+	}
+
+	if int64(len(buff)) > limit {
+		L.RaiseError("Request body exceeds the %v bytes limit", limit)
+		return 0
+	}
+
+	// Save request body
+	L.SetField(httpMetaTable, HTTPRequestBodyName, glua.LString(string(buff)))
+
+	L.Push(glua.LString(string(buff)))
+
+	return 1
+}
+
+// disableWriteDeadline keeps streamed responses open past the server write timeout
+func disableWriteDeadline(w http.ResponseWriter, req *http.Request) {
+	if err := util.DisableWriteDeadline(w, req); err != nil {
+		util.Logger.Logger.Errorf("Cannot disable stream write deadline: %v", err)
+	}
+}
+
+// WriteChunk writes the given data to the response without ending it
+func WriteChunk(L *glua.LState) int {
+	// Get HTTP request and response writer
+	req, w := getRequestAndResponseWriter(L)
+
+	// Get data
+	data := L.Get(2)
+
+	// Check valid data type
+	if data.Type() != glua.LTString {
+		L.ArgError(1, "Invalid data type. Expected string")
+		return 0
+	}
+
+	disableWriteDeadline(w, req)
+
+	// Write chunk
+	if _, err := w.Write([]byte(data.String())); err != nil {
+		L.RaiseError("Cannot write response chunk: %v", err)
+	}
+
+	return 0
+}
+
+// FlushResponse sends the buffered response data to the client
+func FlushResponse(L *glua.LState) int {
+	// Get HTTP response writer
+	_, w := getRequestAndResponseWriter(L)
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return 0
+}
+
+// ServeReader streams a generated file to the client. The reader function is called until it returns nil
+func ServeReader(L *glua.LState) int {
+	// Get HTTP request and response writer
+	req, w := getRequestAndResponseWriter(L)
+
+	// Get file name
+	name := L.Get(2)
+
+	// Check valid file name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid file name type. Expected string")
+		return 0
+	}
+
+	// Get reader function
+	reader := L.Get(3)
+
+	// Check valid reader function
+	if reader.Type() != glua.LTFunction {
+		L.ArgError(2, "Invalid reader type. Expected function")
+		return 0
+	}
+
+	// Get content type
+	contentType := L.OptString(4, mime.TypeByExtension(filepath.Ext(name.String())))
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Set file headers
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": filepath.Base(name.String()),
+	}))
+	disableWriteDeadline(w, req)
+	w.WriteHeader(200)
+
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		// Get next chunk
+		if err := L.CallByParam(glua.P{
+			Fn:      reader,
+			NRet:    1,
+			Protect: true,
+		}); err != nil {
+			L.RaiseError("Cannot read file chunk: %v", err)
+			return 0
+		}
+
+		chunk := L.Get(-1)
+		L.Pop(1)
+
+		if chunk == glua.LNil {
+			break
+		}
+
+		// Write chunk
+		if _, err := w.Write([]byte(chunk.String())); err != nil {
+			L.RaiseError("Cannot write file chunk: %v", err)
+			return 0
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	return 0
+}
+
 // RenderTemplate renders the given template with the given data as a LUA table
 func RenderTemplate(L *glua.LState) int {
 	// Get HTTP request and HTTP response writer
@@ -352,26 +501,15 @@ func GetRequest(L *glua.LState) int {
 	}
 
 	// Make get request
-	resp, err := http.Get(url.String())
+	resp, err := util.Outbound.Do(outboundFormRequest(L, http.MethodGet, url.String(), nil))
 
 	if err != nil {
 		L.RaiseError("Cannot perform get request: %v", err)
 		return 0
 	}
 
-	// Close response body
-	defer resp.Body.Close()
-
-	// Read from response
-	buff, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		L.RaiseError("Cannot read response body: %v", err)
-		return 0
-	}
-
 	// Push response
-	L.Push(glua.LString(string(buff)))
+	L.Push(glua.LString(string(resp.Body)))
 
 	return 1
 }
@@ -394,26 +532,15 @@ func PostFormRequest(L *glua.LState) int {
 	values := TableToURLValues(data)
 
 	// Post form
-	resp, err := http.PostForm(url.String(), values)
+	resp, err := util.Outbound.Do(outboundFormRequest(L, http.MethodPost, url.String(), values))
 
 	if err != nil {
 		L.RaiseError("Cannot post form: %v", err)
 		return 0
 	}
 
-	// Close response body
-	defer resp.Body.Close()
-
-	// Read from response
-	buff, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		L.RaiseError("Cannot read response body: %v", err)
-		return 0
-	}
-
 	// Push response body
-	L.Push(glua.LString(string(buff)))
+	L.Push(glua.LString(string(resp.Body)))
 
 	return 1
 }
@@ -430,10 +557,10 @@ func GetHeader(L *glua.LState) int {
 	}
 
 	// Get request
-	_, w := getRequestAndResponseWriter(L)
+	req, _ := getRequestAndResponseWriter(L)
 
 	// Get header
-	L.Push(glua.LString(w.Header().Get(key.String())))
+	L.Push(glua.LString(req.Header.Get(key.String())))
 
 	return 1
 }
@@ -462,164 +589,27 @@ func CreateRequestClient(L *glua.LState) int {
 	// Get data table
 	data := L.ToTable(2)
 
-	// Get timeout duration
-	timeout := data.RawGetString("timeout")
-
-	// Timeout duration holder
-	timeoutDuration := time.Duration(0)
-
-	if timeout.Type() == glua.LTString {
-
-		// Parse duration
-		d, err := time.ParseDuration(timeout.String())
-
-		if err != nil {
-			L.RaiseError("Cannot format timeout duration: %v", err)
-			return 0
-		}
-
-		timeoutDuration = d
-	}
-
-	// Get request method
-	method := data.RawGetString("method")
-
-	if method.Type() != glua.LTString {
-		L.RaiseError("Invalid request method type. Expected string")
-		return 0
-	}
-
-	// Get request url
-	requestURL := data.RawGetString("url")
-
-	if requestURL.Type() != glua.LTString {
-		L.RaiseError("Invalid request url type. Expected string")
+	if data == nil {
+		L.ArgError(1, "Invalid request type. Expected table")
 		return 0
 	}
 
-	// Get request data
-	content := data.RawGetString("data")
-
-	// Data holder
-	contentValues := url.Values{}
-	contentString := ""
-
-	// Loop content table
-	if content.Type() == glua.LTTable {
-
-		// Loop content table
-		content.(*glua.LTable).ForEach(func(key glua.LValue, v glua.LValue) {
-
-			// Set field
-			contentValues.Set(key.String(), v.String())
-		})
-
-		// Set content string
-		contentString = contentValues.Encode()
-	}
-
-	// Use raw string
-	if content.Type() == glua.LTString {
-		// Set content string
-		contentString = content.String()
-	}
-
-	// Create client
-	client := &http.Client{
-		Timeout: timeoutDuration,
-	}
-
-	// Create request
-	req, err := http.NewRequest(
-		method.String(),
-		requestURL.String(),
-		bytes.NewBufferString(contentString),
-	)
-
-	if err != nil {
-		L.RaiseError("Cannot create http request: %v", err)
-		return 0
-	}
-
-	// Get request headers
-	headerTable := data.RawGetString("headers")
-
-	if headerTable.Type() == glua.LTTable {
-
-		// Loop header table
-		headerTable.(*glua.LTable).ForEach(func(key glua.LValue, v glua.LValue) {
-
-			// Check valid header
-			if key.Type() == glua.LTString && v.Type() == glua.LTString {
-
-				// Set header
-				req.Header.Set(key.String(), v.String())
-			}
-		})
-	}
-
-	// Get request authentication
-	authTable := data.RawGetString("authentication")
-
-	if authTable.Type() == glua.LTTable {
-
-		// Set request authentication
-		req.SetBasicAuth(
-			authTable.(*glua.LTable).RawGetString("username").String(),
-			authTable.(*glua.LTable).RawGetString("password").String(),
-		)
-	}
-
 	// Execute request
-	resp, err := client.Do(req)
+	resp, err := util.Outbound.Do(outboundRequestFromTable(L, data))
 
 	if err != nil {
 		L.RaiseError("Cannot execute http request: %v", err)
 		return 0
 	}
 
-	// Close response body
-	defer resp.Body.Close()
-
-	// Read response
-	responseContent, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		L.RaiseError("Cannot read http response: %v", err)
-		return 0
-	}
-
-	// Header holder
-	headers := L.NewTable()
-
-	// Loop response header
-	for k, v := range resp.Header {
-
-		if len(v) > 1 {
-
-			h := L.NewTable()
-
-			for _, header := range v {
-
-				h.Append(glua.LString(header))
-			}
-
-			headers.RawSetString(k, h)
-
-			continue
-		}
-
-		headers.RawSetString(k, glua.LString(v[0]))
-	}
-
 	// Push response as string
-	L.Push(glua.LString(string(responseContent)))
+	L.Push(glua.LString(string(resp.Body)))
 
 	// Push headers as table
-	L.Push(headers)
+	L.Push(headerToTable(L, resp.Header))
 
 	// Push status code
-	L.Push(glua.LNumber(resp.StatusCode))
+	L.Push(glua.LNumber(resp.Status))
 
 	return 3
 }
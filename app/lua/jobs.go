@@ -0,0 +1,224 @@
+package lua
+
+import (
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetJobsMetaTable sets the jobs metatable of the given state
+func SetJobsMetaTable(luaState *glua.LState) {
+	// Create and set the jobs metatable
+	jobsMetaTable := luaState.NewTypeMetatable(JobsMetaTableName)
+	luaState.SetGlobal(JobsMetaTableName, jobsMetaTable)
+
+	// Set all jobs metatable functions
+	luaState.SetFuncs(jobsMetaTable, jobsMethods)
+}
+
+// luaJobHandler returns a job handler that executes the job function of the given lua file
+func luaJobHandler(path string) util.JobHandler {
+	return func(job *models.Job, payload map[string]interface{}) error {
+		// Create job state
+		state := NewState()
+		defer state.Close()
+
+		// Execute job file
+		if err := state.DoFile(path); err != nil {
+			return err
+		}
+
+		// Call job function
+		return state.CallByParam(
+			glua.P{
+				Fn:      state.GetGlobal("job"),
+				NRet:    0,
+				Protect: true,
+			},
+			MapToTable(payload),
+			StructToTable(job),
+		)
+	}
+}
+
+// RegisterJobHandler registers a lua file as the handler of the given job name
+func RegisterJobHandler(L *glua.LState) int {
+	// Get job name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid job name type. Expected string")
+		return 0
+	}
+
+	// Get handler path
+	path := L.Get(3)
+
+	// Check valid path
+	if path.Type() != glua.LTString {
+		L.ArgError(2, "Invalid job handler path type. Expected string")
+		return 0
+	}
+
+	// Compile handler file to report errors early
+	if _, err := CompileLua(path.String()); err != nil {
+		L.RaiseError("Cannot compile job handler: %v", err)
+		return 0
+	}
+
+	// Register handler
+	util.Jobs.Register(name.String(), luaJobHandler(path.String()))
+
+	return 0
+}
+
+// checkJob returns the job name, payload and options of the given call
+func checkJob(L *glua.LState) (string, map[string]interface{}, util.JobOptions, bool) {
+	// Get job name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid job name type. Expected string")
+		return "", nil, util.JobOptions{}, false
+	}
+
+	// Get job payload
+	payload := map[string]interface{}{}
+
+	if tbl, ok := L.Get(3).(*glua.LTable); ok {
+		payload = TableToMap(tbl)
+	}
+
+	// Job options holder
+	opts := util.JobOptions{}
+
+	// Get job options
+	if tbl, ok := L.Get(4).(*glua.LTable); ok {
+
+		// Get delay
+		if delay := tbl.RawGetString("delay"); delay.Type() == glua.LTString {
+
+			// Parse delay duration
+			d, err := time.ParseDuration(delay.String())
+
+			if err != nil {
+				L.ArgError(3, "Invalid delay format. Unexpected format")
+				return "", nil, util.JobOptions{}, false
+			}
+
+			opts.Delay = d
+		}
+
+		// Get retries
+		if retries, ok := tbl.RawGetString("retries").(glua.LNumber); ok {
+			opts.Retries = int(retries)
+		}
+
+		// Get idempotency key
+		if key := tbl.RawGetString("key"); key.Type() == glua.LTString {
+			opts.Key = key.String()
+		}
+	}
+
+	return name.String(), payload, opts, true
+}
+
+// EnqueueJob saves a new background job to the queue
+func EnqueueJob(L *glua.LState) int {
+	// Get job
+	name, payload, opts, ok := checkJob(L)
+
+	if !ok {
+		return 0
+	}
+
+	// Save job
+	id, err := util.Jobs.Enqueue(name, payload, opts)
+
+	if err != nil {
+		L.RaiseError("Cannot enqueue job: %v", err)
+		return 0
+	}
+
+	// Push job identifier
+	L.Push(glua.LNumber(id))
+
+	return 1
+}
+
+// DispatchJob enqueues a background job or runs it right away when the job workers are disabled
+func DispatchJob(L *glua.LState) int {
+	// Get job
+	name, payload, opts, ok := checkJob(L)
+
+	if !ok {
+		return 0
+	}
+
+	// Dispatch job
+	if err := util.Jobs.Dispatch(name, payload, opts); err != nil {
+		L.RaiseError("Cannot dispatch job: %v", err)
+		return 0
+	}
+
+	return 0
+}
+
+// GetJob returns a job by its identifier
+func GetJob(L *glua.LState) int {
+	// Get job
+	job, err := models.GetJobByID(L.ToInt64(2))
+
+	if err != nil {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	// Push job as table
+	L.Push(StructToTable(job))
+
+	return 1
+}
+
+// GetJobList returns the latest jobs with the given status
+func GetJobList(L *glua.LState) int {
+	// Get status
+	status := L.OptString(2, models.JobDead)
+
+	// Get limit
+	limit := L.OptInt(3, 50)
+
+	// Get job list
+	jobs, err := models.GetJobsByStatus(status, limit)
+
+	if err != nil {
+		L.RaiseError("Cannot get job list: %v", err)
+		return 0
+	}
+
+	// Create result table
+	tbl := L.NewTable()
+
+	for _, job := range jobs {
+		tbl.Append(StructToTable(job))
+	}
+
+	// Push job list
+	L.Push(tbl)
+
+	return 1
+}
+
+// RetryJob moves a failed job back to the queue
+func RetryJob(L *glua.LState) int {
+	// Retry job
+	if err := util.Jobs.Retry(L.ToInt64(2)); err != nil {
+		L.RaiseError("Cannot retry job: %v", err)
+	}
+
+	return 0
+}
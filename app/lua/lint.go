@@ -0,0 +1,640 @@
+package lua
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var (
+	// lintGlobalsComment matches the comments declaring globals unknown to the linter
+	lintGlobalsComment = regexp.MustCompile(`--\s*lint:\s*globals\s+([^\r\n]+)`)
+
+	// lintRemovedFields module fields replaced by methods
+	lintRemovedFields = map[string]string{
+		"http.body": "http:body()",
+	}
+)
+
+// LintIssue struct used for the problems found by the lua linter
+type LintIssue struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Linter struct used to statically check lua files against the castro bindings
+type Linter struct {
+	globals map[string]bool
+	modules map[string]map[string]bool
+	fields  map[string]map[string]bool
+}
+
+// lintScope holds the local variables of a lua block
+type lintScope struct {
+	parent *lintScope
+	names  map[string]bool
+}
+
+// lintFile holds the state of a single file lint pass
+type lintFile struct {
+	linter  *Linter
+	path    string
+	globals map[string]bool
+	issues  []LintIssue
+}
+
+// String returns the issue using the file:line: message format
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%v:%v: %v", i.File, i.Line, i.Message)
+}
+
+// NewLinter creates a linter using the globals and modules registered by GetApplicationState
+// and the globals declared by the engine directory files
+func NewLinter(engine string) (*Linter, error) {
+	l := &Linter{
+		globals: map[string]bool{},
+		modules: map[string]map[string]bool{},
+		fields:  map[string]map[string]bool{},
+	}
+
+	// Create an application state with the page and widget metatables
+	state := glua.NewState()
+	defer state.Close()
+
+	GetApplicationState(state)
+	SetHTTPMetaTable(state)
+	SetHTTPUserData(state, httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	setWidgetMetaTable(state)
+
+	// Load globals and modules
+	state.G.Global.ForEach(func(k glua.LValue, v glua.LValue) {
+		if k.Type() != glua.LTString {
+			return
+		}
+
+		name := k.String()
+		l.globals[name] = true
+
+		// Castro modules are globals holding their type metatable
+		tbl, ok := v.(*glua.LTable)
+
+		if !ok || state.GetTypeMetatable(name) != tbl {
+			return
+		}
+
+		l.modules[name] = map[string]bool{}
+		l.fields[name] = map[string]bool{}
+
+		tbl.ForEach(func(key glua.LValue, value glua.LValue) {
+			if key.Type() != glua.LTString {
+				return
+			}
+
+			if value.Type() == glua.LTFunction {
+				l.modules[name][key.String()] = true
+			} else {
+				l.fields[name][key.String()] = true
+			}
+		})
+	})
+
+	// Load engine globals
+	files, err := util.GetLuaFiles(engine)
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, file := range files {
+		chunk, err := parseLuaFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name := range declaredGlobals(chunk) {
+			l.globals[name] = true
+		}
+	}
+
+	return l, nil
+}
+
+// LintDirectory lints all the lua files inside the given directory
+func (l *Linter) LintDirectory(dir string) ([]LintIssue, error) {
+	issues := []LintIssue{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".lua") {
+			return nil
+		}
+
+		list, err := l.LintFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		issues = append(issues, list...)
+
+		return nil
+	})
+
+	return issues, err
+}
+
+// LintFile parses and lints the given lua file
+func (l *Linter) LintFile(path string) ([]LintIssue, error) {
+	// Parse file
+	chunk, err := parseLuaFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &lintFile{
+		linter:  l,
+		path:    path,
+		globals: declaredGlobals(chunk),
+		issues:  []LintIssue{},
+	}
+
+	// Add globals declared using lint comments
+	names, err := commentGlobals(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		f.globals[name] = true
+	}
+
+	// Walk file statements
+	f.block(chunk, &lintScope{
+		names: map[string]bool{},
+	})
+
+	// Sort issues by line
+	sort.SliceStable(f.issues, func(i, j int) bool {
+		return f.issues[i].Line < f.issues[j].Line
+	})
+
+	return f.issues, nil
+}
+
+// parseLuaFile parses the given lua file
+func parseLuaFile(path string) ([]ast.Stmt, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Close file
+	defer file.Close()
+
+	return parse.Parse(bufio.NewReader(file), path)
+}
+
+// commentGlobals returns the globals declared using "-- lint: globals a, b" comments. Used for
+// globals the linter cannot see such as the ones created by dofile
+func commentGlobals(path string) ([]string, error) {
+	buff, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, match := range lintGlobalsComment.FindAllStringSubmatch(string(buff), -1) {
+		for _, name := range strings.Split(match[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// declaredGlobals returns all the global variables assigned by the given statements
+func declaredGlobals(stmts []ast.Stmt) map[string]bool {
+	globals := map[string]bool{}
+	walkDeclaredGlobals(stmts, &lintScope{names: map[string]bool{}}, globals)
+	return globals
+}
+
+func walkDeclaredGlobals(stmts []ast.Stmt, scope *lintScope, globals map[string]bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.LocalAssignStmt:
+			walkDeclaredGlobalsExprs(s.Exprs, scope, globals)
+			for _, name := range s.Names {
+				scope.names[name] = true
+			}
+		case *ast.AssignStmt:
+			for _, e := range s.Lhs {
+				if ident, ok := e.(*ast.IdentExpr); ok && !scope.has(ident.Value) {
+					globals[ident.Value] = true
+				}
+			}
+			walkDeclaredGlobalsExprs(s.Rhs, scope, globals)
+		case *ast.FuncCallStmt:
+			walkDeclaredGlobalsExpr(s.Expr, scope, globals)
+		case *ast.FuncDefStmt:
+			if ident, ok := s.Name.Func.(*ast.IdentExpr); ok && !scope.has(ident.Value) {
+				globals[ident.Value] = true
+			}
+			walkDeclaredGlobalsExpr(s.Func, scope, globals)
+		case *ast.ReturnStmt:
+			walkDeclaredGlobalsExprs(s.Exprs, scope, globals)
+		case *ast.DoBlockStmt:
+			walkDeclaredGlobals(s.Stmts, scope.child(), globals)
+		case *ast.WhileStmt:
+			walkDeclaredGlobals(s.Stmts, scope.child(), globals)
+		case *ast.RepeatStmt:
+			walkDeclaredGlobals(s.Stmts, scope.child(), globals)
+		case *ast.IfStmt:
+			walkDeclaredGlobals(s.Then, scope.child(), globals)
+			walkDeclaredGlobals(s.Else, scope.child(), globals)
+		case *ast.NumberForStmt:
+			child := scope.child()
+			child.names[s.Name] = true
+			walkDeclaredGlobals(s.Stmts, child, globals)
+		case *ast.GenericForStmt:
+			walkDeclaredGlobalsExprs(s.Exprs, scope, globals)
+			child := scope.child()
+			for _, name := range s.Names {
+				child.names[name] = true
+			}
+			walkDeclaredGlobals(s.Stmts, child, globals)
+		}
+	}
+}
+
+func walkDeclaredGlobalsExprs(exprs []ast.Expr, scope *lintScope, globals map[string]bool) {
+	for _, e := range exprs {
+		walkDeclaredGlobalsExpr(e, scope, globals)
+	}
+}
+
+// walkDeclaredGlobalsExpr looks for function bodies declaring globals inside the given expression
+func walkDeclaredGlobalsExpr(expr ast.Expr, scope *lintScope, globals map[string]bool) {
+	switch e := expr.(type) {
+	case *ast.FunctionExpr:
+		// Function parameters shadow globals
+		child := scope.child()
+
+		for _, name := range e.ParList.Names {
+			child.names[name] = true
+		}
+
+		walkDeclaredGlobals(e.Stmts, child, globals)
+	case *ast.FuncCallExpr:
+		walkDeclaredGlobalsExpr(e.Func, scope, globals)
+		walkDeclaredGlobalsExprs(e.Args, scope, globals)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			walkDeclaredGlobalsExpr(field.Value, scope, globals)
+		}
+	case *ast.LogicalOpExpr:
+		walkDeclaredGlobalsExpr(e.Lhs, scope, globals)
+		walkDeclaredGlobalsExpr(e.Rhs, scope, globals)
+	}
+}
+
+// child creates a new nested scope
+func (s *lintScope) child() *lintScope {
+	return &lintScope{
+		parent: s,
+		names:  map[string]bool{},
+	}
+}
+
+// has checks if the name is a local variable of the scope
+func (s *lintScope) has(name string) bool {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// report adds a new issue to the file
+func (f *lintFile) report(line int, format string, args ...interface{}) {
+	f.issues = append(f.issues, LintIssue{
+		File:    f.path,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// module returns the castro module name if the expression references one
+func (f *lintFile) module(expr ast.Expr, scope *lintScope) (string, bool) {
+	ident, ok := expr.(*ast.IdentExpr)
+
+	if !ok || scope.has(ident.Value) || f.globals[ident.Value] {
+		return "", false
+	}
+
+	_, ok = f.linter.modules[ident.Value]
+
+	return ident.Value, ok
+}
+
+func (f *lintFile) block(stmts []ast.Stmt, scope *lintScope) {
+	for _, stmt := range stmts {
+		f.stmt(stmt, scope)
+	}
+}
+
+func (f *lintFile) stmt(stmt ast.Stmt, scope *lintScope) {
+	switch s := stmt.(type) {
+	case *ast.LocalAssignStmt:
+		// Local functions can call themselves
+		if len(s.Names) == 1 && len(s.Exprs) == 1 {
+			if _, ok := s.Exprs[0].(*ast.FunctionExpr); ok {
+				scope.names[s.Names[0]] = true
+			}
+		}
+		f.exprs(s.Exprs, scope)
+		for _, name := range s.Names {
+			scope.names[name] = true
+		}
+	case *ast.AssignStmt:
+		for _, e := range s.Lhs {
+			switch lhs := e.(type) {
+			case *ast.IdentExpr:
+				// Assigning a global is always valid
+			case *ast.AttrGetExpr:
+				f.expr(lhs.Object, scope)
+				f.expr(lhs.Key, scope)
+			default:
+				f.expr(lhs, scope)
+			}
+		}
+		f.exprs(s.Rhs, scope)
+	case *ast.FuncCallStmt:
+		f.expr(s.Expr, scope)
+	case *ast.DoBlockStmt:
+		f.block(s.Stmts, scope.child())
+	case *ast.WhileStmt:
+		f.expr(s.Condition, scope)
+		f.block(s.Stmts, scope.child())
+	case *ast.RepeatStmt:
+		// The repeat condition can see the block locals
+		child := scope.child()
+		f.block(s.Stmts, child)
+		f.expr(s.Condition, child)
+	case *ast.IfStmt:
+		f.expr(s.Condition, scope)
+		f.block(s.Then, scope.child())
+		f.block(s.Else, scope.child())
+	case *ast.NumberForStmt:
+		f.expr(s.Init, scope)
+		f.expr(s.Limit, scope)
+		if s.Step != nil {
+			f.expr(s.Step, scope)
+		}
+		child := scope.child()
+		child.names[s.Name] = true
+		f.block(s.Stmts, child)
+	case *ast.GenericForStmt:
+		f.exprs(s.Exprs, scope)
+		child := scope.child()
+		for _, name := range s.Names {
+			child.names[name] = true
+		}
+		f.block(s.Stmts, child)
+	case *ast.FuncDefStmt:
+		switch name := s.Name.Func.(type) {
+		case *ast.IdentExpr:
+			// Defining a global function is always valid
+		case *ast.AttrGetExpr:
+			f.expr(name.Object, scope)
+		}
+		if s.Name.Receiver != nil {
+			f.expr(s.Name.Receiver, scope)
+		}
+		f.function(s.Func, scope, s.Name.Receiver != nil)
+	case *ast.ReturnStmt:
+		f.exprs(s.Exprs, scope)
+	}
+}
+
+func (f *lintFile) exprs(exprs []ast.Expr, scope *lintScope) {
+	for _, e := range exprs {
+		f.expr(e, scope)
+	}
+}
+
+func (f *lintFile) function(fn *ast.FunctionExpr, scope *lintScope, method bool) {
+	child := scope.child()
+
+	if method {
+		child.names["self"] = true
+	}
+
+	for _, name := range fn.ParList.Names {
+		child.names[name] = true
+	}
+
+	f.block(fn.Stmts, child)
+}
+
+func (f *lintFile) expr(expr ast.Expr, scope *lintScope) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if !scope.has(e.Value) && !f.globals[e.Value] && !f.linter.globals[e.Value] {
+			f.report(e.Line(), "undefined global %v", e.Value)
+		}
+	case *ast.AttrGetExpr:
+		f.attr(e, scope)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			if field.Key != nil {
+				f.expr(field.Key, scope)
+			}
+			f.expr(field.Value, scope)
+		}
+	case *ast.FuncCallExpr:
+		f.call(e, scope)
+	case *ast.LogicalOpExpr:
+		f.expr(e.Lhs, scope)
+		f.expr(e.Rhs, scope)
+	case *ast.RelationalOpExpr:
+		f.expr(e.Lhs, scope)
+		f.expr(e.Rhs, scope)
+	case *ast.StringConcatOpExpr:
+		f.expr(e.Lhs, scope)
+		f.expr(e.Rhs, scope)
+	case *ast.ArithmeticOpExpr:
+		f.expr(e.Lhs, scope)
+		f.expr(e.Rhs, scope)
+	case *ast.UnaryMinusOpExpr:
+		f.expr(e.Expr, scope)
+	case *ast.UnaryNotOpExpr:
+		f.expr(e.Expr, scope)
+	case *ast.UnaryLenOpExpr:
+		f.expr(e.Expr, scope)
+	case *ast.FunctionExpr:
+		f.function(e, scope, false)
+	}
+}
+
+// attr checks field access on castro modules
+func (f *lintFile) attr(e *ast.AttrGetExpr, scope *lintScope) {
+	f.expr(e.Object, scope)
+	f.expr(e.Key, scope)
+
+	module, ok := f.module(e.Object, scope)
+
+	if !ok {
+		return
+	}
+
+	key, ok := e.Key.(*ast.StringExpr)
+
+	if !ok {
+		return
+	}
+
+	if replacement, ok := lintRemovedFields[module+"."+key.Value]; ok {
+		f.report(e.Line(), "%v.%v was removed, use %v instead", module, key.Value, replacement)
+		return
+	}
+
+	if !f.linter.modules[module][key.Value] && !f.linter.fields[module][key.Value] {
+		f.report(e.Line(), "unknown field %v.%v", module, key.Value)
+	}
+}
+
+// call checks function calls against the castro module methods and global functions
+func (f *lintFile) call(e *ast.FuncCallExpr, scope *lintScope) {
+	f.exprs(e.Args, scope)
+
+	// Method calls using ':'
+	if e.Receiver != nil {
+		f.expr(e.Receiver, scope)
+
+		module, ok := f.module(e.Receiver, scope)
+
+		if !ok {
+			return
+		}
+
+		if !f.linter.modules[module][e.Method] {
+			if f.linter.fields[module][e.Method] {
+				f.report(e.Line(), "%v.%v is not a method", module, e.Method)
+			} else {
+				f.report(e.Line(), "unknown method %v:%v", module, e.Method)
+			}
+			return
+		}
+
+		if sig, ok := GetMethodSignature(module, e.Method); ok {
+			f.arguments(e, fmt.Sprintf("%v:%v", module, e.Method), sig)
+		}
+
+		return
+	}
+
+	// Function calls using '.'
+	if attr, ok := e.Func.(*ast.AttrGetExpr); ok {
+		if module, ok := f.module(attr.Object, scope); ok {
+			if key, ok := attr.Key.(*ast.StringExpr); ok && f.linter.modules[module][key.Value] {
+				f.expr(attr.Key, scope)
+				f.report(e.Line(), "%v.%v must be called as %v:%v", module, key.Value, module, key.Value)
+				return
+			}
+		}
+	}
+
+	f.expr(e.Func, scope)
+
+	// Global function calls
+	ident, ok := e.Func.(*ast.IdentExpr)
+
+	if !ok || scope.has(ident.Value) || f.globals[ident.Value] {
+		return
+	}
+
+	if sig, ok := GetFunctionSignature(ident.Value); ok {
+		f.arguments(e, ident.Value, sig)
+	}
+}
+
+// arguments checks the number of arguments of a call
+func (f *lintFile) arguments(e *ast.FuncCallExpr, name string, sig *Signature) {
+	n := len(e.Args)
+
+	// Calls expanding multiple values cannot be counted
+	if n > 0 {
+		switch e.Args[n-1].(type) {
+		case *ast.FuncCallExpr, *ast.Comma3Expr:
+			return
+		}
+	}
+
+	if n < sig.MinArgs() {
+		f.report(e.Line(), "not enough arguments in call to %v: expected at least %v got %v", name, sig.MinArgs(), n)
+		return
+	}
+
+	if sig.MaxArgs() >= 0 && n > sig.MaxArgs() {
+		f.report(e.Line(), "too many arguments in call to %v: expected at most %v got %v", name, sig.MaxArgs(), n)
+	}
+}
+
+// newDevelopmentLinter returns a linter when running on development mode
+func newDevelopmentLinter() *Linter {
+	if !util.Config.Configuration.IsDev() {
+		return nil
+	}
+
+	l, err := NewLinter("engine")
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot create lua linter: %v", err)
+		return nil
+	}
+
+	return l
+}
+
+// logFile lints the given file and logs all the issues found
+func (l *Linter) logFile(path string) {
+	if l == nil {
+		return
+	}
+
+	issues, err := l.LintFile(path)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot lint %v: %v", path, err)
+		return
+	}
+
+	for _, issue := range issues {
+		util.Logger.Logger.Warnf("Lua lint: %v", issue)
+	}
+}
@@ -63,9 +63,21 @@ var (
 		"redirect":           Redirect,
 		"render":             RenderTemplate,
 		"write":              WriteResponse,
+		"writeChunk":         WriteChunk,
+		"flush":              FlushResponse,
+		"serveReader":        ServeReader,
+		"body":               GetRequestBody,
+		"query":              GetQueryValue,
+		"form":               GetFormValue,
+		"param":              GetRequestParam,
+		"json":               GetRequestJSON,
+		"request":            GetRequestInfo,
+		"respond":            Respond,
 		"serveFile":          ServeFile,
 		"get":                GetRequest,
 		"setHeader":          SetHeader,
+		"setPolicy":          SetPolicy,
+		"addPolicy":          AddPolicy,
 		"postForm":           PostFormRequest,
 		"getHeader":          GetHeader,
 		"getRemoteAddress":   GetRemoteAddress,
@@ -73,37 +85,64 @@ var (
 		"formFile":           GetFormFile,
 		"parseMultiPartForm": ParseMultiPartForm,
 		"GetRelativeURL":     GetRelativeURL,
+		"all":                AllRequests,
+		"async":              AsyncRequest,
+		"getJSON":            GetJSONRequest,
+		"postJSON":           PostJSONRequest,
 	}
 	httpRegularMethods = map[string]glua.LGFunction{
 		"curl":     CreateRequestClient,
 		"postForm": PostFormRequest,
 		"get":      GetRequest,
+		"all":      AllRequests,
+		"async":    AsyncRequest,
+		"getJSON":  GetJSONRequest,
+		"postJSON": PostJSONRequest,
+	}
+	promiseMethods = map[string]glua.LGFunction{
+		"await": AwaitPromise,
+		"done":  IsPromiseDone,
 	}
 	validatorMethods = map[string]glua.LGFunction{
-		"validate":       Validate,
-		"blackList":      BlackList,
-		"validUsername":  ValidUsername,
-		"validTown":      ValidTown,
-		"validVocation":  ValidVocation,
-		"validGuildName": ValidGuildName,
-		"validGuildRank": ValidGuildRank,
-		"validQRToken":   CheckQRCode,
-		"validGender":    ValidGender,
-		"escapeString":   EscapeString,
+		"validate":          Validate,
+		"blackList":         BlackList,
+		"validUsername":     ValidUsername,
+		"validTown":         ValidTown,
+		"validVocation":     ValidVocation,
+		"validGuildName":    ValidGuildName,
+		"validGuildRank":    ValidGuildRank,
+		"validQRToken":      CheckQRCode,
+		"validGender":       ValidGender,
+		"escapeString":      EscapeString,
+		"validRecoveryCode": ValidRecoveryCode,
+		"rule":              RegisterValidationRule,
 	}
 	sessionMethods = map[string]glua.LGFunction{
-		"isLogged":      IsLogged,
-		"isAdmin":       IsAdmin,
-		"getFlash":      GetFlash,
-		"setFlash":      SetFlash,
-		"set":           SetSessionData,
-		"get":           GetSessionData,
-		"destroy":       DestroySession,
-		"loggedAccount": GetLoggedAccount,
+		"isLogged":              IsLogged,
+		"isAdmin":               IsAdmin,
+		"getFlash":              GetFlash,
+		"setFlash":              SetFlash,
+		"set":                   SetSessionData,
+		"get":                   GetSessionData,
+		"destroy":               DestroySession,
+		"loggedAccount":         GetLoggedAccount,
+		"newRecoveryCodes":      NewRecoveryCodes,
+		"recoveryCodesLeft":     RecoveryCodesLeft,
+		"rememberDevice":        RememberDevice,
+		"isDeviceRemembered":    IsDeviceRemembered,
+		"forgetDevice":          ForgetDevice,
+		"requestTwoFactorReset": RequestTwoFactorReset,
+		"resetTwoFactor":        ResetTwoFactor,
+		"devices":               GetSessionDevices,
+		"revokeDevice":          RevokeSessionDevice,
+		"revokeOtherDevices":    RevokeOtherSessionDevices,
+		"revokeAccount":         RevokeAccountSessions,
 	}
 	captchaMethods = map[string]glua.LGFunction{
 		"isEnabled": IsEnabled,
 		"verify":    VerifyCaptcha,
+		"widget":    GetCaptchaWidget,
+		"provider":  GetCaptchaProvider,
 	}
 	mapMethods = map[string]glua.LGFunction{
 		"houseList":  HouseList,
@@ -151,6 +190,67 @@ var (
 		"unmarshal":     UnmarshalJSON,
 		"unmarshalFile": UnmarshalJSONFile,
 	}
+	csvMethods = map[string]glua.LGFunction{
+		"encode": EncodeCSV,
+		"decode": DecodeCSV,
+		"serve":  ServeCSV,
+	}
+	tomlMethods = map[string]glua.LGFunction{
+		"encode":     EncodeTOML,
+		"decode":     DecodeTOML,
+		"decodeFile": DecodeTOMLFile,
+	}
+	yamlMethods = map[string]glua.LGFunction{
+		"encode":     EncodeYAML,
+		"decode":     DecodeYAML,
+		"decodeFile": DecodeYAMLFile,
+	}
+	htmlMethods = map[string]glua.LGFunction{
+		"sanitize": SanitizeHTML,
+		"policy":   SetSanitizePolicy,
+	}
+	markdownMethods = map[string]glua.LGFunction{
+		"render": RenderMarkdown,
+	}
+	tokenMethods = map[string]glua.LGFunction{
+		"sign":   SignToken,
+		"verify": VerifyToken,
+	}
+	cookieMethods = map[string]glua.LGFunction{
+		"set":    SetSignedCookie,
+		"get":    GetSignedCookie,
+		"delete": DeleteSignedCookie,
+	}
+	securityMethods = map[string]glua.LGFunction{
+		"isLocked":        IsLoginLocked,
+		"captchaRequired": IsLoginCaptchaRequired,
+		"recordLogin":     RecordLogin,
+		"history":         GetLoginHistory,
+		"unlock":          UnlockLogin,
+	}
+	serverMethods = map[string]glua.LGFunction{
+		"status":   GetServerStatus,
+		"isOnline": IsServerOnline,
+	}
+	supervisorMethods = map[string]glua.LGFunction{
+		"isEnabled": IsSupervisorEnabled,
+		"status":    GetSupervisorStatus,
+		"start":     StartSupervisor,
+		"stop":      StopSupervisor,
+		"restart":   RestartSupervisor,
+		"schedule":  ScheduleSupervisorRestart,
+		"cancel":    CancelSupervisorRestart,
+		"broadcast": SupervisorBroadcast,
+		"console":   GetSupervisorConsole,
+	}
+	webAuthnMethods = map[string]glua.LGFunction{
+		"registerOptions": WebAuthnRegisterOptions,
+		"register":        WebAuthnRegister,
+		"loginOptions":    WebAuthnLoginOptions,
+		"login":           WebAuthnLogin,
+		"credentials":     WebAuthnCredentials,
+		"remove":          WebAuthnRemove,
+	}
 	storageMethods = map[string]glua.LGFunction{
 		"get": GetStorageValue,
 		"set": SetStorageValue,
@@ -241,8 +341,64 @@ var (
 	i18nMethods = map[string]glua.LGFunction{
 		"get": GetLanguageIndex,
 	}
+	jobsMethods = map[string]glua.LGFunction{
+		"enqueue":  EnqueueJob,
+		"dispatch": DispatchJob,
+		"get":      GetJob,
+		"list":     GetJobList,
+		"retry":    RetryJob,
+	}
+	busMethods = map[string]glua.LGFunction{
+		"emit":      EmitEvent,
+		"emitAsync": EmitEventAsync,
+		"job":       SubscribeEventJob,
+		"off":       UnsubscribeEvent,
+	}
+	profilerMethods = map[string]glua.LGFunction{
+		"isEnabled": IsProfilerEnabled,
+		"pages":     GetProfiledPages,
+		"top":       GetProfileTop,
+		"pprof":     GetProfilePprof,
+		"reset":     ResetProfile,
+	}
+	testMethods = map[string]glua.LGFunction{
+		"request":        TestRequest,
+		"fixture":        TestFixture,
+		"assert":         TestAssert,
+		"assertEqual":    TestAssertEqual,
+		"assertStatus":   TestAssertStatus,
+		"assertHeader":   TestAssertHeader,
+		"assertTemplate": TestAssertTemplate,
+		"assertArg":      TestAssertArg,
+		"fail":           TestFail,
+		"log":            TestLog,
+		"captcha":        TestCaptcha,
+		"statusServer":   TestStatusServer,
+	}
 )
 
+func init() {
+	// Job, event and validation rule handlers create new application states so they are
+	// registered here to avoid an initialization cycle with GetApplicationState
+	jobsMethods["register"] = RegisterJobHandler
+	busMethods["on"] = SubscribeEvent
+	validatorMethods["check"] = CheckSchema
+
+	// Wrap go bindings so the profiler can sample the states calling them. The go
+	// function names are kept for the stubs documentation
+	for _, module := range stubModules {
+		for method, f := range module.Methods {
+			bindingFunctions[module.Name+":"+method] = functionName(f)
+			module.Methods[method] = profiledBinding(module.Name+":"+method, f)
+		}
+	}
+
+	for name, f := range globalFuncList {
+		bindingFunctions[name] = functionName(f)
+		globalFuncList[name] = profiledBinding(name, f)
+	}
+}
+
 // CompileLua reads the passed lua file from disk and compiles it.
 func CompileLua(filePath string) (*glua.FunctionProto, error) {
 	file, err := os.Open(filePath)
@@ -415,6 +571,48 @@ func GetApplicationState(luaState *glua.LState) {
 	// Create json metatable
 	SetJSONMetaTable(luaState)
 
+	// Create csv metatable
+	SetCSVMetaTable(luaState)
+
+	// Create html metatable
+	SetHTMLMetaTable(luaState)
+
+	// Create markdown metatable
+	SetMarkdownMetaTable(luaState)
+
+	// Create token metatable
+	SetTokenMetaTable(luaState)
+
+	// Create cookie metatable
+	SetCookieMetaTable(luaState)
+
+	// Create security metatable
+	SetSecurityMetaTable(luaState)
+
+	// Create server metatable
+	SetServerMetaTable(luaState)
+
+	// Create supervisor metatable
+	SetSupervisorMetaTable(luaState)
+
+	// Create webauthn metatable
+	SetWebAuthnMetaTable(luaState)
+
+	// Create toml metatable
+	SetTOMLMetaTable(luaState)
+
+	// Create yaml metatable
+	SetYAMLMetaTable(luaState)
+
+	// Create jobs metatable
+	SetJobsMetaTable(luaState)
+
+	// Create bus metatable
+	SetBusMetaTable(luaState)
+
+	// Create profiler metatable
+	SetProfilerMetaTable(luaState)
+
 	// Loop global functions map
 	for funcName, luaFunc := range globalFuncList {
 
@@ -482,6 +680,27 @@ func SetConfigGlobal(L *glua.LState) {
 	// Set CSP Image table
 	L.SetField(cspTable, "Image", StructToTable(&util.Config.Configuration.Security.CSP.Image))
 
+	// Set CSP Object table
+	L.SetField(cspTable, "Object", StructToTable(&util.Config.Configuration.Security.CSP.Object))
+
+	// Set CSP Media table
+	L.SetField(cspTable, "Media", StructToTable(&util.Config.Configuration.Security.CSP.Media))
+
+	// Set CSP Worker table
+	L.SetField(cspTable, "Worker", StructToTable(&util.Config.Configuration.Security.CSP.Worker))
+
+	// Set CSP Manifest table
+	L.SetField(cspTable, "Manifest", StructToTable(&util.Config.Configuration.Security.CSP.Manifest))
+
+	// Set CSP BaseURI table
+	L.SetField(cspTable, "BaseURI", StructToTable(&util.Config.Configuration.Security.CSP.BaseURI))
+
+	// Set CSP FormAction table
+	L.SetField(cspTable, "FormAction", StructToTable(&util.Config.Configuration.Security.CSP.FormAction))
+
+	// Set CSP FrameAncestors table
+	L.SetField(cspTable, "FrameAncestors", StructToTable(&util.Config.Configuration.Security.CSP.FrameAncestors))
+
 	// Set CSP table inside Security table
 	L.SetField(secTable, "CSP", cspTable)
 
@@ -583,6 +802,12 @@ func ExecuteFile(luaState *glua.LState, path string) error {
 	return nil
 }
 
+// IsCsrfExempt checks if the executed page declared the csrf global as false, used by
+// pages receiving requests from other sites such as payment notifications
+func IsCsrfExempt(luaState *glua.LState) bool {
+	return luaState.GetGlobal("csrf") == glua.LFalse
+}
+
 // ExecuteControllerPage executes the given subtopic using call by param
 func ExecuteControllerPage(luaState *glua.LState, method string) error {
 	// Call file function
@@ -3,7 +3,6 @@ package lua
 import (
 	"github.com/raggaer/castro/app/util"
 	"github.com/yuin/gopher-lua"
-	"gopkg.in/gomail.v2"
 )
 
 // SetMailMetaTable sets the mail metatable of the given state
@@ -16,7 +15,7 @@ func SetMailMetaTable(luaState *lua.LState) {
 	luaState.SetFuncs(mailMetaTable, mailMethods)
 }
 
-// SendMail sends a mail to the given direction
+// SendMail queues a mail to the given direction
 func SendMail(L *lua.LState) int {
 	// Get information table
 	tbl := L.Get(2)
@@ -55,31 +54,16 @@ func SendMail(L *lua.LState) int {
 		return 0
 	}
 
-	// Create new gomail object
-	m := gomail.NewMessage()
+	// Queue email
+	err := util.Jobs.Dispatch("mail", map[string]interface{}{
+		"to":      to,
+		"subject": subject,
+		"body":    body,
+	}, util.JobOptions{
+		Key: util.MailJobKey(to, subject, body),
+	})
 
-	// Set from header
-	m.SetHeader("From", util.Config.Configuration.Mail.Username)
-
-	// Set to header
-	m.SetHeader("To", to)
-
-	// Set subject
-	m.SetHeader("Subject", subject)
-
-	// Set body
-	m.SetBody("text/html", body)
-
-	// Create dialer
-	d := gomail.NewPlainDialer(
-		util.Config.Configuration.Mail.Server,
-		util.Config.Configuration.Mail.Port,
-		util.Config.Configuration.Mail.Username,
-		util.Config.Configuration.Mail.Password,
-	)
-
-	// Send email
-	if err := d.DialAndSend(m); err != nil {
+	if err != nil {
 		L.RaiseError("Cannot send email: %v", err)
 		return 0
 	}
@@ -0,0 +1,408 @@
+package lua
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/clbanning/mxj"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// outboundPromise struct used for the requests running in the background
+type outboundPromise struct {
+	done chan struct{}
+	resp *util.OutboundResponse
+	err  error
+}
+
+// newOutboundRequest creates an outbound request counting it against the page request limit
+func newOutboundRequest(L *glua.LState) *util.OutboundRequest {
+	// Get page request counter. States without http user data are not limited
+	if u, ok := L.GetField(L.GetTypeMetatable(HTTPMetaTableName), HTTPOutboundCountName).(*glua.LUserData); ok {
+		count := u.Value.(*int)
+		*count++
+
+		// Get page request limit. Negative values disable the limit
+		limit := util.Config.Configuration.Outbound.PageLimit
+
+		if limit == 0 {
+			limit = 20
+		}
+
+		if limit > 0 && *count > limit {
+			L.RaiseError("Outbound request limit reached. Pages can perform up to %v requests", limit)
+			return nil
+		}
+	}
+
+	return &util.OutboundRequest{
+		Method:  http.MethodGet,
+		Header:  http.Header{},
+		Retries: -1,
+		Origin:  strings.TrimSuffix(L.Where(1), ":"),
+	}
+}
+
+// outboundRequestFromTable converts a lua request table to an outbound request
+func outboundRequestFromTable(L *glua.LState, data *glua.LTable) *util.OutboundRequest {
+	req := newOutboundRequest(L)
+
+	// Get request url
+	requestURL := data.RawGetString("url")
+
+	if requestURL.Type() != glua.LTString {
+		L.RaiseError("Invalid request url type. Expected string")
+		return nil
+	}
+
+	req.URL = requestURL.String()
+
+	// Get request method
+	if method := data.RawGetString("method"); method.Type() == glua.LTString {
+		req.Method = strings.ToUpper(method.String())
+	}
+
+	// Get request headers
+	if headers, ok := data.RawGetString("headers").(*glua.LTable); ok {
+		headers.ForEach(func(key glua.LValue, v glua.LValue) {
+			if key.Type() == glua.LTString && v.Type() == glua.LTString {
+				req.Header.Set(key.String(), v.String())
+			}
+		})
+	}
+
+	// Get request body
+	switch content := data.RawGetString("data").(type) {
+	case *glua.LTable:
+		req.Body = []byte(TableToURLValues(content).Encode())
+
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	case glua.LString:
+		req.Body = []byte(content)
+	}
+
+	// Get request JSON body
+	if content, ok := data.RawGetString("json").(*glua.LTable); ok {
+		buff, err := mxj.Map(TableToMap(content)).Json()
+
+		if err != nil {
+			L.RaiseError("Cannot marshal request json body: %v", err)
+			return nil
+		}
+
+		req.Body = buff
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Get request authentication
+	if auth, ok := data.RawGetString("authentication").(*glua.LTable); ok {
+		req.Username = auth.RawGetString("username").String()
+		req.Password = auth.RawGetString("password").String()
+	}
+
+	// Get request timeout
+	req.Timeout = tableDuration(L, data, "timeout")
+
+	// Get request retries
+	if retries := data.RawGetString("retries"); retries.Type() == glua.LTNumber {
+		req.Retries = int(retries.(glua.LNumber))
+	}
+
+	// Get retry backoff
+	req.Backoff = tableDuration(L, data, "backoff")
+
+	return req
+}
+
+// tableDuration parses the duration string stored at the given table field
+func tableDuration(L *glua.LState, data *glua.LTable, field string) time.Duration {
+	v := data.RawGetString(field)
+
+	if v.Type() != glua.LTString {
+		return 0
+	}
+
+	d, err := time.ParseDuration(v.String())
+
+	if err != nil {
+		L.RaiseError("Cannot format %v duration: %v", field, err)
+		return 0
+	}
+
+	return d
+}
+
+// headerToTable converts the given http header to a lua table
+func headerToTable(L *glua.LState, header http.Header) *glua.LTable {
+	headers := L.NewTable()
+
+	for k, v := range header {
+		if len(v) > 1 {
+			h := L.NewTable()
+
+			for _, value := range v {
+				h.Append(glua.LString(value))
+			}
+
+			headers.RawSetString(k, h)
+			continue
+		}
+
+		headers.RawSetString(k, glua.LString(v[0]))
+	}
+
+	return headers
+}
+
+// outboundResponseToTable converts an outbound response to a lua table. JSON bodies are decoded to the json field
+func outboundResponseToTable(L *glua.LState, resp *util.OutboundResponse) *glua.LTable {
+	tbl := L.NewTable()
+	tbl.RawSetString("status", glua.LNumber(resp.Status))
+	tbl.RawSetString("headers", headerToTable(L, resp.Header))
+	tbl.RawSetString("body", glua.LString(string(resp.Body)))
+
+	// Decode JSON body
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if m, err := mxj.NewMapJson(resp.Body); err == nil {
+			tbl.RawSetString("json", MapToTable(m))
+		}
+	}
+
+	return tbl
+}
+
+// startOutboundRequest executes the given request in the background
+func startOutboundRequest(req *util.OutboundRequest) *outboundPromise {
+	p := &outboundPromise{
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.done)
+		p.resp, p.err = util.Outbound.Do(req)
+	}()
+
+	return p
+}
+
+// AllRequests executes a list of requests concurrently and returns the responses in the same order
+func AllRequests(L *glua.LState) int {
+	// Get request list
+	list := L.Get(2)
+
+	// Check valid request list
+	if list.Type() != glua.LTTable {
+		L.ArgError(1, "Invalid request list type. Expected table")
+		return 0
+	}
+
+	// Start all requests
+	promises := []*outboundPromise{}
+
+	for i := 1; i <= list.(*glua.LTable).Len(); i++ {
+		data, ok := list.(*glua.LTable).RawGetInt(i).(*glua.LTable)
+
+		if !ok {
+			L.RaiseError("Invalid request type at position %v. Expected table", i)
+			return 0
+		}
+
+		promises = append(promises, startOutboundRequest(outboundRequestFromTable(L, data)))
+	}
+
+	// Wait for all responses
+	responses := L.NewTable()
+
+	for _, p := range promises {
+		<-p.done
+
+		if p.err != nil {
+			failed := L.NewTable()
+			failed.RawSetString("error", glua.LString(p.err.Error()))
+			responses.Append(failed)
+			continue
+		}
+
+		responses.Append(outboundResponseToTable(L, p.resp))
+	}
+
+	// Push response list
+	L.Push(responses)
+
+	return 1
+}
+
+// AsyncRequest starts a request in the background and returns a promise
+func AsyncRequest(L *glua.LState) int {
+	// Get request table
+	data := L.Get(2)
+
+	// Check valid request table
+	if data.Type() != glua.LTTable {
+		L.ArgError(1, "Invalid request type. Expected table")
+		return 0
+	}
+
+	// Create promise table
+	tbl := L.NewTable()
+
+	// Set promise user data
+	u := L.NewUserData()
+	u.Value = startOutboundRequest(outboundRequestFromTable(L, data.(*glua.LTable)))
+
+	L.SetField(tbl, "__promise", u)
+
+	// Set all promise functions
+	L.SetFuncs(tbl, promiseMethods)
+
+	// Push promise
+	L.Push(tbl)
+
+	return 1
+}
+
+// getPromiseObject returns the promise of the given promise table
+func getPromiseObject(L *glua.LState) *outboundPromise {
+	tbl := L.ToTable(1)
+
+	if tbl == nil {
+		L.RaiseError("Invalid promise. Use promise:method()")
+		return nil
+	}
+
+	u, ok := L.GetField(tbl, "__promise").(*glua.LUserData)
+
+	if !ok {
+		L.RaiseError("Invalid promise. Use promise:method()")
+		return nil
+	}
+
+	return u.Value.(*outboundPromise)
+}
+
+// AwaitPromise waits for the promise request and returns the response or nil and the error message
+func AwaitPromise(L *glua.LState) int {
+	p := getPromiseObject(L)
+
+	// Wait for the response
+	<-p.done
+
+	if p.err != nil {
+		L.Push(glua.LNil)
+		L.Push(glua.LString(p.err.Error()))
+		return 2
+	}
+
+	L.Push(outboundResponseToTable(L, p.resp))
+
+	return 1
+}
+
+// IsPromiseDone checks if the promise request has finished
+func IsPromiseDone(L *glua.LState) int {
+	p := getPromiseObject(L)
+
+	select {
+	case <-p.done:
+		L.Push(glua.LTrue)
+	default:
+		L.Push(glua.LFalse)
+	}
+
+	return 1
+}
+
+// GetJSONRequest performs a HTTP GET request and decodes the JSON response
+func GetJSONRequest(L *glua.LState) int {
+	// Get url
+	requestURL := L.Get(2)
+
+	// Check valid url
+	if requestURL.Type() != glua.LTString {
+		L.ArgError(1, "Invalid url type. Expected string")
+		return 0
+	}
+
+	// Get request options
+	data := L.NewTable()
+	MergeTableFields(L.OptTable(3, L.NewTable()), data)
+	data.RawSetString("url", requestURL)
+	data.RawSetString("method", glua.LString(http.MethodGet))
+
+	return pushJSONResponse(L, outboundRequestFromTable(L, data))
+}
+
+// PostJSONRequest performs a HTTP POST request with a JSON body and decodes the JSON response
+func PostJSONRequest(L *glua.LState) int {
+	// Get url
+	requestURL := L.Get(2)
+
+	// Check valid url
+	if requestURL.Type() != glua.LTString {
+		L.ArgError(1, "Invalid url type. Expected string")
+		return 0
+	}
+
+	// Get request body
+	body := L.Get(3)
+
+	// Check valid body
+	if body.Type() != glua.LTTable {
+		L.ArgError(2, "Invalid body type. Expected table")
+		return 0
+	}
+
+	// Get request options
+	data := L.NewTable()
+	MergeTableFields(L.OptTable(4, L.NewTable()), data)
+	data.RawSetString("url", requestURL)
+	data.RawSetString("method", glua.LString(http.MethodPost))
+	data.RawSetString("json", body)
+
+	return pushJSONResponse(L, outboundRequestFromTable(L, data))
+}
+
+// pushJSONResponse executes the given request and pushes the decoded body and the status code
+func pushJSONResponse(L *glua.LState, req *util.OutboundRequest) int {
+	req.Header.Set("Accept", "application/json")
+
+	// Execute request
+	resp, err := util.Outbound.Do(req)
+
+	if err != nil {
+		L.RaiseError("Cannot execute http request: %v", err)
+		return 0
+	}
+
+	// Decode response
+	m, err := mxj.NewMapJson(resp.Body)
+
+	if err != nil {
+		L.RaiseError("Cannot decode json response from %v: %v", req.URL, err)
+		return 0
+	}
+
+	L.Push(MapToTable(m))
+	L.Push(glua.LNumber(resp.Status))
+
+	return 2
+}
+
+// outboundFormRequest creates an outbound form request
+func outboundFormRequest(L *glua.LState, method, requestURL string, values url.Values) *util.OutboundRequest {
+	req := newOutboundRequest(L)
+	req.Method = method
+	req.URL = requestURL
+
+	if values != nil {
+		req.Body = []byte(values.Encode())
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return req
+}
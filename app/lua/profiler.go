@@ -0,0 +1,634 @@
+package lua
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// maxProfileDepth maximum number of frames recorded for each sample
+	maxProfileDepth = 64
+
+	// ProfileSamplingNote explains what the profile samples measure. gopher-lua has no
+	// debug.sethook so lua code cannot be interrupted while it runs
+	ProfileSamplingNote = "Samples are only taken when a go binding is called or returns. " +
+		"Time spent running lua code between two binding calls is attributed to the line calling the next binding, " +
+		"so pages that loop without calling bindings show few samples"
+)
+
+// LuaProfiler struct used to sample the lua call stack of pages and widgets
+type LuaProfiler struct {
+	rw    sync.RWMutex
+	pages map[string]*PageProfile
+}
+
+// PageProfile struct used to aggregate the samples of a page or widget
+type PageProfile struct {
+	rw       sync.Mutex
+	Name     string
+	Requests int64
+	Samples  int64
+	Duration time.Duration
+	Interval time.Duration
+	stacks   map[string]*profileStack
+}
+
+// ProfileEntry struct used for the hot spots of a page profile
+type ProfileEntry struct {
+	Name    string
+	Samples int64
+	Percent float64
+	Time    time.Duration
+}
+
+// profileFrame holds a single frame of a sampled call stack
+type profileFrame struct {
+	Function  string
+	File      string
+	Line      int
+	StartLine int
+	Go        bool
+}
+
+// profileStack holds a call stack and the number of times it was sampled
+type profileStack struct {
+	Frames []profileFrame
+	Count  int64
+}
+
+var (
+	// Profiler main application lua profiler
+	Profiler = &LuaProfiler{
+		pages: map[string]*PageProfile{},
+	}
+)
+
+// Start begins sampling the given state if the profiler is enabled and the page is selected.
+// The returned function stops the sampling and must always be called
+func (p *LuaProfiler) Start(L *glua.LState, name string) func() {
+	// Check if page should be profiled
+	if !shouldProfile(name) {
+		return func() {}
+	}
+
+	// Get sampling interval
+	interval := util.Config.Configuration.Profiler.Interval.Duration
+
+	if interval <= 0 {
+		interval = time.Millisecond * 5
+	}
+
+	start := time.Now()
+	session := &profileSession{
+		interval: interval,
+		last:     start,
+		bindings: map[*glua.LState][]string{},
+	}
+
+	// Bindings find the session using the state context
+	parent := L.Context()
+
+	if parent == nil {
+		L.SetContext(context.WithValue(context.Background(), "profiler", session))
+	} else {
+		L.SetContext(context.WithValue(parent, "profiler", session))
+	}
+
+	return func() {
+		if parent == nil {
+			L.RemoveContext()
+		} else {
+			L.SetContext(parent)
+		}
+
+		p.page(name, interval).add(session.stacks, time.Since(start))
+	}
+}
+
+// profileSession struct used to sample a single page or widget execution. Lua states are not
+// thread-safe so samples are taken by the executing goroutine whenever a go binding is called
+// or returns, counting the intervals elapsed since the previous sample
+type profileSession struct {
+	interval time.Duration
+	last     time.Time
+	bindings map[*glua.LState][]string
+	stacks   []*profileStack
+}
+
+// profiledBinding wraps a go binding so profiled states are sampled when it is called
+func profiledBinding(name string, fn glua.LGFunction) glua.LGFunction {
+	return func(L *glua.LState) int {
+		ctx := L.Context()
+
+		if ctx == nil {
+			return fn(L)
+		}
+
+		session, ok := ctx.Value("profiler").(*profileSession)
+
+		if !ok {
+			return fn(L)
+		}
+
+		// Time elapsed before the call was spent on the lua code calling the binding
+		session.bindings[L] = append(session.bindings[L], name)
+		session.sample(L, true)
+
+		defer func() {
+			// Time elapsed during the call was spent inside the binding
+			session.sample(L, false)
+
+			bindings := session.bindings[L]
+			session.bindings[L] = bindings[:len(bindings)-1]
+		}()
+
+		return fn(L)
+	}
+}
+
+// profiledBindingPC code pointer shared by all the profiled binding wrappers
+var profiledBindingPC uintptr
+
+func init() {
+	profiledBindingPC = reflect.ValueOf(profiledBinding("", nil)).Pointer()
+}
+
+// sample records the current call stack once for every interval elapsed since the last sample
+func (s *profileSession) sample(L *glua.LState, caller bool) {
+	elapsed := time.Since(s.last)
+
+	if elapsed < s.interval {
+		return
+	}
+
+	count := int64(elapsed / s.interval)
+	s.last = s.last.Add(time.Duration(count) * s.interval)
+
+	if frames := s.captureStack(L, caller); len(frames) > 0 {
+		s.stacks = append(s.stacks, &profileStack{
+			Frames: frames,
+			Count:  count,
+		})
+	}
+}
+
+// captureStack returns the current call stack of the given state. If caller is set the
+// binding being called is left out of the stack
+func (s *profileSession) captureStack(L *glua.LState, caller bool) []profileFrame {
+	frames := []profileFrame{}
+	bindings := s.bindings[L]
+	level := 0
+
+	if caller {
+		level = 1
+		bindings = bindings[:len(bindings)-1]
+	}
+
+	for ; level < maxProfileDepth; level++ {
+		dbg, ok := L.GetStack(level)
+
+		if !ok {
+			break
+		}
+
+		fn, err := L.GetInfo("Slnf", dbg, glua.LNil)
+
+		if err != nil {
+			break
+		}
+
+		frame := profileFrame{
+			Function:  dbg.Name,
+			File:      dbg.Source,
+			Line:      dbg.CurrentLine,
+			StartLine: dbg.LineDefined,
+		}
+
+		// Name go bindings using their lua name
+		if f, ok := fn.(*glua.LFunction); ok && f.IsG {
+			frame.Go = true
+			frame.Function = functionName(f.GFunction)
+			frame.File = "[go]"
+			frame.Line = 0
+
+			if reflect.ValueOf(f.GFunction).Pointer() == profiledBindingPC && len(bindings) > 0 {
+				frame.Function = bindings[len(bindings)-1]
+				bindings = bindings[:len(bindings)-1]
+			}
+		}
+
+		if frame.Function == "" || frame.Function == "?" {
+			frame.Function = fmt.Sprintf("<%v:%v>", frame.File, frame.StartLine)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
+
+// shouldProfile checks if the given page is selected by the profiler configuration
+func shouldProfile(name string) bool {
+	cfg := util.Config.Configuration.Profiler
+
+	if !cfg.Enabled {
+		return false
+	}
+
+	for _, subtopic := range cfg.Subtopics {
+		if strings.Trim(subtopic, "/") == name {
+			return true
+		}
+	}
+
+	return rand.Float64()*100 < cfg.Sample
+}
+
+// page returns the profile of the given page creating it if needed
+func (p *LuaProfiler) page(name string, interval time.Duration) *PageProfile {
+	// Lock mutex
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if pp, ok := p.pages[name]; ok {
+		return pp
+	}
+
+	pp := &PageProfile{
+		Name:     name,
+		Interval: interval,
+		stacks:   map[string]*profileStack{},
+	}
+
+	p.pages[name] = pp
+
+	return pp
+}
+
+// Get returns the profile of the given page
+func (p *LuaProfiler) Get(name string) (*PageProfile, bool) {
+	// Lock mutex
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	pp, ok := p.pages[name]
+	return pp, ok
+}
+
+// Pages returns all the page profiles sorted by number of samples
+func (p *LuaProfiler) Pages() []*PageProfile {
+	// Lock mutex
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	list := []*PageProfile{}
+	samples := map[*PageProfile]int64{}
+
+	for _, pp := range p.pages {
+		pp.rw.Lock()
+		samples[pp] = pp.Samples
+		pp.rw.Unlock()
+
+		list = append(list, pp)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return samples[list[i]] > samples[list[j]]
+	})
+
+	return list
+}
+
+// Reset removes the profile of the given page. An empty name removes all the profiles
+func (p *LuaProfiler) Reset(name string) {
+	// Lock mutex
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if name == "" {
+		p.pages = map[string]*PageProfile{}
+		return
+	}
+
+	delete(p.pages, name)
+}
+
+// add merges the samples of a single execution into the page profile
+func (pp *PageProfile) add(stacks []*profileStack, d time.Duration) {
+	// Lock mutex
+	pp.rw.Lock()
+	defer pp.rw.Unlock()
+
+	pp.Requests++
+	pp.Duration += d
+
+	for _, s := range stacks {
+		// Create stack key
+		parts := []string{}
+
+		for _, f := range s.Frames {
+			parts = append(parts, fmt.Sprintf("%v@%v:%v", f.Function, f.File, f.Line))
+		}
+
+		key := strings.Join(parts, ";")
+
+		if existing, ok := pp.stacks[key]; ok {
+			existing.Count += s.Count
+		} else {
+			pp.stacks[key] = s
+		}
+
+		pp.Samples += s.Count
+	}
+}
+
+// Top returns the hot lua lines, the hot lua functions and the time spent inside go bindings
+func (pp *PageProfile) Top(limit int) (lines, functions, bindings []ProfileEntry) {
+	// Lock mutex
+	pp.rw.Lock()
+	defer pp.rw.Unlock()
+
+	lineSamples := map[string]int64{}
+	functionSamples := map[string]int64{}
+	bindingSamples := map[string]int64{}
+
+	for _, s := range pp.stacks {
+		if len(s.Frames) == 0 {
+			continue
+		}
+
+		// Attribute go time to the binding and the lua line calling it
+		top := s.Frames[0]
+
+		if top.Go {
+			bindingSamples[top.Function] += s.Count
+		}
+
+		// Get first lua frame
+		for _, f := range s.Frames {
+			if f.Go {
+				continue
+			}
+
+			lineSamples[fmt.Sprintf("%v:%v", f.File, f.Line)] += s.Count
+			break
+		}
+
+		// Count each function once per stack
+		seen := map[string]bool{}
+
+		for _, f := range s.Frames {
+			if f.Go || seen[f.Function] {
+				continue
+			}
+
+			seen[f.Function] = true
+			functionSamples[fmt.Sprintf("%v (%v:%v)", f.Function, f.File, f.StartLine)] += s.Count
+		}
+	}
+
+	return pp.entries(lineSamples, limit), pp.entries(functionSamples, limit), pp.entries(bindingSamples, limit)
+}
+
+// entries converts the sample counts to a sorted list of profile entries
+func (pp *PageProfile) entries(samples map[string]int64, limit int) []ProfileEntry {
+	list := []ProfileEntry{}
+
+	for name, count := range samples {
+		entry := ProfileEntry{
+			Name:    name,
+			Samples: count,
+			Time:    time.Duration(count) * pp.Interval,
+		}
+
+		if pp.Samples > 0 {
+			entry.Percent = float64(count) * 100 / float64(pp.Samples)
+		}
+
+		list = append(list, entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Samples == list[j].Samples {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Samples > list[j].Samples
+	})
+
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list
+}
+
+// WritePprof writes the page profile using the pprof format
+func (pp *PageProfile) WritePprof(w io.Writer) error {
+	// Lock mutex
+	pp.rw.Lock()
+	defer pp.rw.Unlock()
+
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "time", Unit: "nanoseconds"},
+		},
+		PeriodType: &profile.ValueType{
+			Type: "time",
+			Unit: "nanoseconds",
+		},
+		Period:        int64(pp.Interval),
+		DurationNanos: int64(pp.Duration),
+		Comments:      []string{ProfileSamplingNote},
+	}
+
+	functions := map[string]*profile.Function{}
+	locations := map[string]*profile.Location{}
+
+	for _, s := range pp.stacks {
+		sample := &profile.Sample{
+			Value: []int64{s.Count, s.Count * int64(pp.Interval)},
+		}
+
+		for _, f := range s.Frames {
+			// Get function
+			fkey := fmt.Sprintf("%v@%v:%v", f.Function, f.File, f.StartLine)
+			fn, ok := functions[fkey]
+
+			if !ok {
+				fn = &profile.Function{
+					ID:         uint64(len(p.Function) + 1),
+					Name:       f.Function,
+					SystemName: f.Function,
+					Filename:   f.File,
+					StartLine:  int64(f.StartLine),
+				}
+				functions[fkey] = fn
+				p.Function = append(p.Function, fn)
+			}
+
+			// Get location
+			lkey := fmt.Sprintf("%v:%v", fkey, f.Line)
+			loc, ok := locations[lkey]
+
+			if !ok {
+				loc = &profile.Location{
+					ID: uint64(len(p.Location) + 1),
+					Line: []profile.Line{
+						{Function: fn, Line: int64(f.Line)},
+					},
+				}
+				locations[lkey] = loc
+				p.Location = append(p.Location, loc)
+			}
+
+			sample.Location = append(sample.Location, loc)
+		}
+
+		p.Sample = append(p.Sample, sample)
+	}
+
+	return p.Write(w)
+}
+
+// SetProfilerMetaTable sets the profiler metatable of the given state
+func SetProfilerMetaTable(luaState *glua.LState) {
+	// Create and set the profiler metatable
+	profilerMetaTable := luaState.NewTypeMetatable(ProfilerMetaTableName)
+	luaState.SetGlobal(ProfilerMetaTableName, profilerMetaTable)
+
+	// Set all profiler metatable functions
+	luaState.SetFuncs(profilerMetaTable, profilerMethods)
+}
+
+// profileEntriesToTable converts a list of profile entries to a lua table
+func profileEntriesToTable(L *glua.LState, entries []ProfileEntry) *glua.LTable {
+	tbl := L.NewTable()
+
+	for _, entry := range entries {
+		e := L.NewTable()
+		e.RawSetString("name", glua.LString(entry.Name))
+		e.RawSetString("samples", glua.LNumber(entry.Samples))
+		e.RawSetString("percent", glua.LNumber(entry.Percent))
+		e.RawSetString("time", glua.LString(entry.Time.String()))
+		tbl.Append(e)
+	}
+
+	return tbl
+}
+
+// IsProfilerEnabled checks if the lua profiler is enabled
+func IsProfilerEnabled(L *glua.LState) int {
+	L.Push(glua.LBool(util.Config.Configuration.Profiler.Enabled))
+	return 1
+}
+
+// GetProfiledPages returns the list of profiled pages
+func GetProfiledPages(L *glua.LState) int {
+	tbl := L.NewTable()
+
+	for _, pp := range Profiler.Pages() {
+		pp.rw.Lock()
+
+		page := L.NewTable()
+		page.RawSetString("name", glua.LString(pp.Name))
+		page.RawSetString("requests", glua.LNumber(pp.Requests))
+		page.RawSetString("samples", glua.LNumber(pp.Samples))
+		page.RawSetString("interval", glua.LString(pp.Interval.String()))
+
+		if pp.Requests > 0 {
+			page.RawSetString("average", glua.LString((pp.Duration / time.Duration(pp.Requests)).String()))
+		}
+
+		pp.rw.Unlock()
+
+		tbl.Append(page)
+	}
+
+	// Push page list
+	L.Push(tbl)
+
+	return 1
+}
+
+// GetProfileTop returns the hot lines, functions and go bindings of a profiled page
+func GetProfileTop(L *glua.LState) int {
+	// Get page name
+	name := L.Get(2)
+
+	// Check valid page name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid page type. Expected string")
+		return 0
+	}
+
+	pp, ok := Profiler.Get(name.String())
+
+	if !ok {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	// Get hot spots
+	lines, functions, bindings := pp.Top(L.OptInt(3, 20))
+
+	tbl := L.NewTable()
+	tbl.RawSetString("lines", profileEntriesToTable(L, lines))
+	tbl.RawSetString("functions", profileEntriesToTable(L, functions))
+	tbl.RawSetString("bindings", profileEntriesToTable(L, bindings))
+
+	// Push hot spots
+	L.Push(tbl)
+
+	return 1
+}
+
+// GetProfilePprof returns the profile of a page encoded using the pprof format
+func GetProfilePprof(L *glua.LState) int {
+	// Get page name
+	name := L.Get(2)
+
+	// Check valid page name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid page type. Expected string")
+		return 0
+	}
+
+	pp, ok := Profiler.Get(name.String())
+
+	if !ok {
+		L.Push(glua.LNil)
+		return 1
+	}
+
+	// Encode profile
+	buff := &bytes.Buffer{}
+
+	if err := pp.WritePprof(buff); err != nil {
+		L.RaiseError("Cannot encode profile: %v", err)
+		return 0
+	}
+
+	// Push encoded profile
+	L.Push(glua.LString(buff.String()))
+
+	return 1
+}
+
+// ResetProfile removes the profile of a page or all the profiles if no page is given
+func ResetProfile(L *glua.LState) int {
+	Profiler.Reset(L.OptString(2, ""))
+	return 0
+}
@@ -0,0 +1,305 @@
+package lua
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// valuesToLua returns the first value of the given list or all the values as a table
+func valuesToLua(L *glua.LState, values []string, all bool) glua.LValue {
+	if all {
+		return StringSliceToTable(values)
+	}
+
+	if len(values) == 0 {
+		return glua.LNil
+	}
+
+	return glua.LString(values[0])
+}
+
+// wantAllValues checks the all field of the options table at the given position
+func wantAllValues(L *glua.LState, n int) bool {
+	opts, ok := L.Get(n).(*glua.LTable)
+
+	if !ok {
+		return false
+	}
+
+	return glua.LVAsBool(opts.RawGetString("all"))
+}
+
+// GetQueryValue returns a query string value or all the values of a repeated key
+func GetQueryValue(L *glua.LState) int {
+	// Get value name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	L.Push(valuesToLua(L, req.URL.Query()[name.String()], wantAllValues(L, 3)))
+
+	return 1
+}
+
+// GetFormValue returns a POST form value or all the values of a repeated key
+func GetFormValue(L *glua.LState) int {
+	// Get value name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	L.Push(valuesToLua(L, req.PostForm[name.String()], wantAllValues(L, 3)))
+
+	return 1
+}
+
+// GetRequestParam returns a POST form or query string value converted to the given type.
+// The default value is returned when the parameter is missing or cannot be converted
+func GetRequestParam(L *glua.LState) int {
+	// Get param name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid name type. Expected string")
+		return 0
+	}
+
+	// Get param type and default value
+	kind := L.OptString(3, "string")
+	def := L.Get(4)
+
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	// Get raw value
+	values, ok := req.PostForm[name.String()]
+
+	if !ok {
+		values, ok = req.URL.Query()[name.String()]
+	}
+
+	if !ok || len(values) == 0 {
+		L.Push(def)
+		return 1
+	}
+
+	raw := strings.TrimSpace(values[0])
+
+	// Convert value
+	switch kind {
+	case "string":
+		L.Push(glua.LString(values[0]))
+
+	case "int", "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+
+		if err != nil {
+			L.Push(def)
+			return 1
+		}
+
+		L.Push(glua.LNumber(n))
+
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+
+		if err != nil {
+			L.Push(def)
+			return 1
+		}
+
+		L.Push(glua.LNumber(n))
+
+	case "bool", "boolean":
+		if raw == "on" {
+			L.Push(glua.LTrue)
+			return 1
+		}
+
+		b, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			L.Push(def)
+			return 1
+		}
+
+		L.Push(glua.LBool(b))
+
+	default:
+		L.ArgError(2, "Invalid param type. Expected string, int, number or bool")
+		return 0
+	}
+
+	return 1
+}
+
+// jsonValueToLua converts a decoded JSON value to a lua value
+func jsonValueToLua(v interface{}) glua.LValue {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return MapToTable(val)
+	case []interface{}:
+		return MapToTable(map[string]interface{}{"list": val}).RawGetString("list")
+	case float64:
+		return glua.LNumber(val)
+	case string:
+		return glua.LString(val)
+	case bool:
+		return glua.LBool(val)
+	}
+
+	return glua.LNil
+}
+
+// GetRequestJSON decodes the JSON request body
+func GetRequestJSON(L *glua.LState) int {
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	// Check request content type
+	contentType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	if err != nil || (contentType != "application/json" && !strings.HasSuffix(contentType, "+json")) {
+		L.RaiseError("Invalid request content type %v. Expected application/json", req.Header.Get("Content-Type"))
+		return 0
+	}
+
+	// Read request body
+	if GetRequestBody(L) == 0 {
+		return 0
+	}
+
+	body := L.Get(-1).String()
+	L.Pop(1)
+
+	// Decode request body
+	var v interface{}
+
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		L.RaiseError("Cannot decode request json body: %v", err)
+		return 0
+	}
+
+	L.Push(jsonValueToLua(v))
+
+	return 1
+}
+
+// requestScheme returns the scheme used by the client
+func requestScheme(req *http.Request) string {
+	if util.Config.Configuration.SSL.Proxy {
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return proto
+		}
+	}
+
+	if req.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// GetRequestInfo returns the request host, scheme, path, headers and cookies
+func GetRequestInfo(L *glua.LState) int {
+	// Get HTTP request
+	req, _ := getRequestAndResponseWriter(L)
+
+	tbl := L.NewTable()
+	tbl.RawSetString("method", glua.LString(req.Method))
+	tbl.RawSetString("host", glua.LString(req.Host))
+	tbl.RawSetString("scheme", glua.LString(requestScheme(req)))
+	tbl.RawSetString("path", glua.LString(req.URL.Path))
+	tbl.RawSetString("query", glua.LString(req.URL.RawQuery))
+	tbl.RawSetString("headers", headerToTable(L, req.Header))
+
+	// Set request cookies
+	cookies := L.NewTable()
+
+	for _, c := range req.Cookies() {
+		cookies.RawSetString(c.Name, glua.LString(c.Value))
+	}
+
+	tbl.RawSetString("cookies", cookies)
+
+	L.Push(tbl)
+
+	return 1
+}
+
+// Respond writes the response status, headers and body. Table bodies are encoded as JSON
+func Respond(L *glua.LState) int {
+	// Get HTTP response writer
+	_, w := getRequestAndResponseWriter(L)
+
+	// Get status code
+	status := L.Get(2)
+
+	// Check valid status code
+	if status.Type() != glua.LTNumber {
+		L.ArgError(1, "Invalid status type. Expected number")
+		return 0
+	}
+
+	// Set response headers
+	if headers, ok := L.Get(4).(*glua.LTable); ok {
+		headers.ForEach(func(key glua.LValue, v glua.LValue) {
+			w.Header().Set(key.String(), v.String())
+		})
+	}
+
+	// Encode response body
+	var body []byte
+
+	switch v := L.Get(3).(type) {
+	case *glua.LTable:
+		buff, err := json.Marshal(ValueToGo(v))
+
+		if err != nil {
+			L.RaiseError("Cannot encode response json body: %v", err)
+			return 0
+		}
+
+		body = buff
+
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+
+	case *glua.LNilType:
+
+	default:
+		body = []byte(v.String())
+
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(body))
+		}
+	}
+
+	// Write response
+	w.WriteHeader(int(status.(glua.LNumber)))
+	w.Write(body)
+
+	return 0
+}
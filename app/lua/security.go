@@ -0,0 +1,189 @@
+package lua
+
+import (
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetSecurityMetaTable sets the security metatable of the given state
+func SetSecurityMetaTable(luaState *glua.LState) {
+	// Create and set the security metatable
+	securityMetaTable := luaState.NewTypeMetatable(SecurityMetaTableName)
+	luaState.SetGlobal(SecurityMetaTableName, securityMetaTable)
+
+	// Set all security metatable functions
+	luaState.SetFuncs(securityMetaTable, securityMethods)
+}
+
+// checkAccountName returns the account name argument
+func checkAccountName(L *glua.LState) (string, bool) {
+	name := L.Get(2)
+
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid account name type. Expected string")
+		return "", false
+	}
+
+	return name.String(), true
+}
+
+// IsLoginLocked checks if logins to the given account name from the request address are locked.
+// Returns the lock status and the remaining seconds
+func IsLoginLocked(L *glua.LState) int {
+	name, ok := checkAccountName(L)
+
+	if !ok {
+		return 0
+	}
+
+	req, _ := getRequestAndResponseWriter(L)
+
+	status, err := util.LoginLockStatus(name, util.RequestIP(req))
+
+	if err != nil {
+		L.RaiseError("Cannot get login lock status: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LBool(status.Locked))
+	L.Push(glua.LNumber(int64(status.Remaining.Seconds() + 0.5)))
+
+	return 2
+}
+
+// IsLoginCaptchaRequired checks if logins to the given account name from the request address require a captcha answer
+func IsLoginCaptchaRequired(L *glua.LState) int {
+	name, ok := checkAccountName(L)
+
+	if !ok {
+		return 0
+	}
+
+	req, _ := getRequestAndResponseWriter(L)
+
+	required, err := util.LoginCaptchaRequired(name, util.RequestIP(req))
+
+	if err != nil {
+		L.RaiseError("Cannot get login captcha status: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LBool(required))
+
+	return 1
+}
+
+// RecordLogin records a login attempt for the given account name. Successful logins return true
+// when the login comes from a new device, failed logins return the lock status and remaining seconds
+func RecordLogin(L *glua.LState) int {
+	name, ok := checkAccountName(L)
+
+	if !ok {
+		return 0
+	}
+
+	// Get login result
+	success := L.Get(3)
+
+	if success.Type() != glua.LTBool {
+		L.ArgError(2, "Invalid success type. Expected bool")
+		return 0
+	}
+
+	twoFactor := false
+
+	// Get login options
+	if tbl, ok := L.Get(4).(*glua.LTable); ok {
+		twoFactor = glua.LVAsBool(tbl.RawGetString("twoFactor"))
+	}
+
+	req, _ := getRequestAndResponseWriter(L)
+	ip := util.RequestIP(req)
+
+	if glua.LVAsBool(success) {
+		newDevice, err := util.RecordLoginSuccess(name, ip, req.UserAgent(), twoFactor)
+
+		if err != nil {
+			L.RaiseError("Cannot record login: %v", err)
+			return 0
+		}
+
+		L.Push(glua.LBool(newDevice))
+
+		return 1
+	}
+
+	if err := util.RecordFailedLoginHistory(name, ip, req.UserAgent()); err != nil {
+		L.RaiseError("Cannot record login: %v", err)
+		return 0
+	}
+
+	status, err := util.RecordLoginFailure(name, ip)
+
+	if err != nil {
+		L.RaiseError("Cannot record login: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LBool(status.Locked))
+	L.Push(glua.LNumber(int64(status.Remaining.Seconds() + 0.5)))
+
+	return 2
+}
+
+// GetLoginHistory returns the latest login attempts of the given account identifier
+func GetLoginHistory(L *glua.LState) int {
+	// Get account identifier
+	id := L.Get(2)
+
+	if id.Type() != glua.LTNumber {
+		L.ArgError(1, "Invalid account type. Expected number")
+		return 0
+	}
+
+	limit := 20
+
+	if n, ok := L.Get(3).(glua.LNumber); ok && n > 0 {
+		limit = int(n)
+	}
+
+	history, err := models.GetLoginHistory(int64(id.(glua.LNumber)), limit)
+
+	if err != nil {
+		L.RaiseError("Cannot get login history: %v", err)
+		return 0
+	}
+
+	list := L.NewTable()
+
+	for _, h := range history {
+		login := L.NewTable()
+		login.RawSetString("ip", glua.LString(h.IP))
+		login.RawSetString("userAgent", glua.LString(h.User_agent))
+		login.RawSetString("success", glua.LBool(h.Success))
+		login.RawSetString("twoFactor", glua.LBool(h.Two_factor))
+		login.RawSetString("created", glua.LNumber(h.Created_at))
+		list.Append(login)
+	}
+
+	L.Push(list)
+
+	return 1
+}
+
+// UnlockLogin removes the failed login counter of the given account name
+func UnlockLogin(L *glua.LState) int {
+	name, ok := checkAccountName(L)
+
+	if !ok {
+		return 0
+	}
+
+	if err := util.UnlockLogin(name); err != nil {
+		L.RaiseError("Cannot unlock login: %v", err)
+		return 0
+	}
+
+	return 0
+}
@@ -0,0 +1,99 @@
+package lua
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+func TestSecurityBindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		code     string
+	}{
+		{
+			name: "no failures",
+			code: `
+				local locked, remaining = security:isLocked("castro")
+				assert(locked == false and remaining == 0, "locked")
+				assert(security:captchaRequired("castro") == false, "captcha")
+			`,
+		},
+		{
+			name:     "captcha challenge",
+			failures: 2,
+			code: `
+				assert(security:isLocked("castro") == false, "locked")
+				assert(security:captchaRequired("castro") == true, "captcha")
+				assert(security:captchaRequired("other") == true, "captcha by address")
+			`,
+		},
+		{
+			name:     "locked account",
+			failures: 3,
+			code: `
+				local locked, remaining = security:isLocked("Castro")
+				assert(locked == true and remaining > 0 and remaining <= 60, "locked " .. remaining)
+			`,
+		},
+		{
+			name:     "unlocked account",
+			failures: 3,
+			code: `
+				security:unlock("castro")
+				assert(security:isLocked("castro") == false, "locked")
+			`,
+		},
+		{
+			name: "invalid arguments",
+			code: `
+				assert(not pcall(security.isLocked, security, 10), "isLocked")
+				assert(not pcall(security.captchaRequired, security), "captchaRequired")
+				assert(not pcall(security.recordLogin, security, "castro", "yes"), "recordLogin")
+				assert(not pcall(security.unlock, security, {}), "unlock")
+			`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			util.Config.Configuration = &util.Configuration{
+				Captcha: util.CaptchaConfig{Enabled: true},
+				Login: util.LoginConfig{
+					MaxAttempts:   3,
+					IPMaxAttempts: 10,
+					CaptchaAfter:  2,
+					Lockout:       util.StringDuration{Duration: time.Minute},
+				},
+			}
+
+			util.SetLoginAttemptStore(util.NewMemoryLoginAttemptStore())
+			defer util.SetLoginAttemptStore(nil)
+
+			for i := 0; i < test.failures; i++ {
+				if _, err := util.RecordLoginFailure("castro", "192.0.2.1"); err != nil {
+					t.Fatalf("Cannot record login failure: %v", err)
+				}
+			}
+
+			L := glua.NewState()
+			defer L.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/subtopic/login", nil)
+			req.RemoteAddr = "192.0.2.1:1000"
+
+			SetHTTPMetaTable(L)
+			SetHTTPUserData(L, httptest.NewRecorder(), req)
+			SetSecurityMetaTable(L)
+
+			if err := L.DoString(test.code); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package lua
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetServerMetaTable sets the server metatable of the given state
+func SetServerMetaTable(luaState *glua.LState) {
+	// Create and set the server metatable
+	serverMetaTable := luaState.NewTypeMetatable(ServerMetaTableName)
+	luaState.SetGlobal(ServerMetaTableName, serverMetaTable)
+
+	// Set all server metatable functions
+	luaState.SetFuncs(serverMetaTable, serverMethods)
+}
+
+// ServerStatusAddress returns the game server status address. Defaults to the ip and
+// statusProtocolPort values of the server config.lua
+func ServerStatusAddress() string {
+	port := 7171
+
+	if p, ok := Config.GetGlobal("statusProtocolPort").(glua.LNumber); ok {
+		port = int(p)
+	}
+
+	ip := "127.0.0.1"
+
+	if v, ok := Config.GetGlobal("ip").(glua.LString); ok && v != "" {
+		ip = string(v)
+	}
+
+	return util.ServerStatusAddress(net.JoinHostPort(ip, strconv.Itoa(port)))
+}
+
+// GetServerStatus returns the cached game server status. Passing true skips the cache
+func GetServerStatus(L *glua.LState) int {
+	status := util.GetServerStatus(ServerStatusAddress(), L.ToBool(2))
+
+	L.Push(serverStatusToTable(status))
+
+	return 1
+}
+
+// IsServerOnline checks if the game server answers status requests
+func IsServerOnline(L *glua.LState) int {
+	status := util.GetServerStatus(ServerStatusAddress(), false)
+
+	L.Push(glua.LBool(status.Online))
+
+	return 1
+}
+
+// serverStatusToTable converts the given game server status to a lua table
+func serverStatusToTable(status *util.ServerStatus) *glua.LTable {
+	players := &glua.LTable{}
+	players.RawSetString("online", glua.LNumber(status.Players.Online))
+	players.RawSetString("max", glua.LNumber(status.Players.Max))
+	players.RawSetString("peak", glua.LNumber(status.Players.Peak))
+
+	m := &glua.LTable{}
+	m.RawSetString("name", glua.LString(status.Map.Name))
+	m.RawSetString("author", glua.LString(status.Map.Author))
+	m.RawSetString("width", glua.LNumber(status.Map.Width))
+	m.RawSetString("height", glua.LNumber(status.Map.Height))
+
+	t := &glua.LTable{}
+	t.RawSetString("online", glua.LBool(status.Online))
+	t.RawSetString("error", glua.LString(status.Error))
+	t.RawSetString("name", glua.LString(status.Name))
+	t.RawSetString("server", glua.LString(status.Server))
+	t.RawSetString("version", glua.LString(status.Version))
+	t.RawSetString("client", glua.LString(status.Client))
+	t.RawSetString("location", glua.LString(status.Location))
+	t.RawSetString("url", glua.LString(status.URL))
+	t.RawSetString("uptime", glua.LNumber(status.Uptime))
+	t.RawSetString("motd", glua.LString(status.MOTD))
+	t.RawSetString("players", players)
+	t.RawSetString("map", m)
+	t.RawSetString("monsters", glua.LNumber(status.Monsters))
+	t.RawSetString("npcs", glua.LNumber(status.NPCs))
+	t.RawSetString("checkedAt", glua.LNumber(status.CheckedAt))
+
+	return t
+}
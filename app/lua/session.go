@@ -1,8 +1,6 @@
 package lua
 
 import (
-	"net/http"
-
 	"github.com/raggaer/castro/app/models"
 	"github.com/raggaer/castro/app/util"
 	"github.com/yuin/gopher-lua"
@@ -44,23 +42,15 @@ func getSessionData(L *lua.LState) map[string]interface{} {
 // updateSessionData saves a new cookie with the encoded map
 func updateSessionData(L *lua.LState) {
 	// Get response writer from state
-	_, w := getRequestAndResponseWriter(L)
+	req, w := getRequestAndResponseWriter(L)
 
 	// Get session
 	session := getSessionData(L)
 
-	// Encode session map
-	encoded, err := util.SessionStore.Encode(util.Config.Configuration.Cookies.Name, session)
-
-	if err != nil {
-		util.Logger.Logger.Fatalf("Cannot encode cookie value: %v", err)
+	// Save session map
+	if err := util.SaveSession(w, req, session); err != nil {
+		util.Logger.Logger.Errorf("Cannot save session: %v", err)
 	}
-
-	// Create cookie
-	c := util.SessionCookie(encoded)
-
-	// Set cookie
-	http.SetCookie(w, c)
 }
 
 // GetLoggedAccount gets the user account if any
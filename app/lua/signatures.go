@@ -0,0 +1,495 @@
+package lua
+
+import (
+	"strings"
+	"sync"
+)
+
+// Signature describes the parameters and return values of a lua binding
+type Signature struct {
+	Params   []Param
+	Returns  []string
+	Variadic bool
+}
+
+// Param describes a single lua binding parameter
+type Param struct {
+	Name     string
+	Type     string
+	Optional bool
+}
+
+var (
+	// methodSignatures signatures of the module methods. Methods are declared as
+	// "(name: type, optional?: type, ...: type): return, return"
+	methodSignatures = map[string]map[string]string{
+		CryptoMetaTableName: {
+			"sha1":         "(str: string): string",
+			"sha256":       "(str: string): string",
+			"hmacsha256":   "(secret: string, message: string): string",
+			"md5":          "(str: string): string",
+			"randomString": "(length: number): string",
+			"qr":           "(message: string): string",
+			"qrKey":        "(): string",
+		},
+		Base64MetaTableName: {
+			"encode": "(str: string): string",
+			"decode": "(str: string): string",
+		},
+		DatabaseMetaTableName: {
+			"query":       "(query: string, ...: any): table?, boolean",
+			"execute":     "(query: string, ...: any): number?",
+			"singleQuery": "(query: string, ...: any): table?, boolean",
+		},
+		ConfigMetaTableName: {
+			"get":       "(name: string): any",
+			"setCustom": "(key: string, value: any)",
+		},
+		HTTPMetaTableName: {
+			"setCookie":          "(name: string, value: string, expires: number)",
+			"getCookie":          "(name: string): string?",
+			"redirect":           "(destination?: string, status?: number)",
+			"render":             "(template: string, args?: table)",
+			"write":              "(data: string)",
+			"writeChunk":         "(data: string)",
+			"flush":              "()",
+			"serveReader":        "(name: string, reader: function, contentType?: string)",
+			"body":               "(limit?: number): string",
+			"query":              "(name: string, options?: table): any",
+			"form":               "(name: string, options?: table): any",
+			"param":              "(name: string, type?: string, default?: any): any",
+			"json":               "(): any",
+			"request":            "(): table",
+			"respond":            "(status: number, body?: any, headers?: table)",
+			"serveFile":          "(path: string)",
+			"get":                "(url: string): string",
+			"setHeader":          "(key: string, value: string)",
+			"setPolicy":          "(directive: string, sources?: any)",
+			"addPolicy":          "(directive: string, sources: any)",
+			"postForm":           "(url: string, data: table): string",
+			"getHeader":          "(key: string): string",
+			"getRemoteAddress":   "(): string",
+			"curl":               "(options: table): string, table, number",
+			"formFile":           "(name: string): formFile?",
+			"parseMultiPartForm": "(maxMemory?: number)",
+			"GetRelativeURL":     "(): string",
+			"all":                "(requests: table): table",
+			"async":              "(request: table): promise",
+			"getJSON":            "(url: string, options?: table): table, number",
+			"postJSON":           "(url: string, data: table, options?: table): table, number",
+		},
+		ValidatorMetaTableName: {
+			"validate":          "(name: string, value: any): boolean",
+			"blackList":         "(value: string, words: table): boolean",
+			"validUsername":     "(name: string): boolean",
+			"validTown":         "(town: any): boolean",
+			"validVocation":     "(vocation: any, base?: boolean): boolean",
+			"validGuildName":    "(name: string): boolean",
+			"validGuildRank":    "(rank: string): boolean",
+			"validQRToken":      "(token: string, secret: string, account?: number): boolean",
+			"validRecoveryCode": "(account: number, code: string): boolean",
+			"validGender":       "(gender: number): boolean",
+			"escapeString":      "(value: string): string",
+			"check":             "(values: table, schema: table): boolean, table",
+			"rule":              "(name: string, path: string)",
+		},
+		SessionMetaTable: {
+			"isLogged":              "(): boolean",
+			"isAdmin":               "(): boolean",
+			"getFlash":              "(key: string): any",
+			"setFlash":              "(key: string, value: any)",
+			"set":                   "(key: string, value: any)",
+			"get":                   "(key: string): any",
+			"destroy":               "()",
+			"loggedAccount":         "(): table?",
+			"newRecoveryCodes":      "(account: number): table",
+			"recoveryCodesLeft":     "(account: number): number",
+			"rememberDevice":        "(account: number, secret: string)",
+			"isDeviceRemembered":    "(account: number, secret: string): boolean",
+			"forgetDevice":          "()",
+			"requestTwoFactorReset": "(account: number)",
+			"resetTwoFactor":        "(account: number)",
+			"devices":               "(): table",
+			"revokeDevice":          "(id: string): boolean",
+			"revokeOtherDevices":    "(): number",
+			"revokeAccount":         "(name: string): number",
+		},
+		CaptchaMetaTableName: {
+			"isEnabled": "(): boolean",
+			"verify":    "(response?: string): boolean",
+			"widget":    "(): string",
+			"provider":  "(): string",
+		},
+		MapMetaTableName: {
+			"houseList":  "(town?: number): table",
+			"townList":   "(): table",
+			"townByID":   "(id: number): table?",
+			"townByName": "(name: string): table?",
+			"encode":     "()",
+		},
+		XMLMetaTableName: {
+			"vocationList":   "(base?: boolean): table",
+			"vocationByName": "(name: string): table?",
+			"vocationByID":   "(id: number): table?",
+			"marshal":        "(data: table): string",
+			"unmarshal":      "(source: string): table",
+			"unmarshalFile":  "(path: string): table",
+			"monsterList":    "(): table",
+			"monsterByName":  "(name: string): table?",
+		},
+		MailMetaTableName: {
+			"send": "(mail: table)",
+		},
+		CacheMetaTableName: {
+			"get":    "(key: string): any",
+			"set":    "(key: string, value: any, duration?: string)",
+			"delete": "(key: string)",
+		},
+		DebugMetaTableName: {
+			"value": "(value: any)",
+		},
+		URLMetaTableName: {
+			"decode": "(uri: string): string?",
+			"encode": "(uri: string): string",
+		},
+		TimeMetaTableName: {
+			"parseUnix":     "(timestamp: number): table",
+			"parseDuration": "(duration: string): number",
+			"parseDate":     "(date: string, layout: string): number",
+			"newDuration":   "(seconds: number): table",
+		},
+		ReflectMetaTableName: {
+			"getGlobal": "(path: string, name: string): any",
+		},
+		JSONMetaTableName: {
+			"marshal":       "(data: table): string",
+			"unmarshal":     "(source: string): table",
+			"unmarshalFile": "(path: string): table",
+		},
+		CSVMetaTableName: {
+			"encode": "(rows: table, options?: table): string",
+			"decode": "(source: string, options?: table): table",
+			"serve":  "(name: string, rows: any, options?: table)",
+		},
+		HTMLMetaTableName: {
+			"sanitize": "(html: string, policy?: string): string",
+			"policy":   "(name: string, policy: table)",
+		},
+		MarkdownMetaTableName: {
+			"render": "(text: string, policy?: string): string",
+		},
+		TokenMetaTableName: {
+			"sign":   "(purpose: string, payload?: table, ttl?: any, options?: table): string",
+			"verify": "(purpose: string, token: string, options?: table): table?, string?",
+		},
+		CookieMetaTableName: {
+			"set":    "(name: string, value: any, options?: table)",
+			"get":    "(name: string): any",
+			"delete": "(name: string)",
+		},
+		SecurityMetaTableName: {
+			"isLocked":        "(name: string): boolean, number",
+			"captchaRequired": "(name: string): boolean",
+			"recordLogin":     "(name: string, success: boolean, options?: table): boolean, number?",
+			"history":         "(account: number, limit?: number): table",
+			"unlock":          "(name: string)",
+		},
+		ServerMetaTableName: {
+			"status":   "(refresh?: boolean): table",
+			"isOnline": "(): boolean",
+		},
+		SupervisorMetaTableName: {
+			"isEnabled": "(): boolean",
+			"status":    "(): table",
+			"start":     "(): boolean, string?",
+			"stop":      "(): boolean, string?",
+			"restart":   "(): boolean, string?",
+			"schedule":  "(seconds: number, message?: string): boolean, string?",
+			"cancel":    "()",
+			"broadcast": "(message: string): boolean, string?",
+			"console":   "(limit?: number): table",
+		},
+		WebAuthnMetaTableName: {
+			"registerOptions": "(account: number, name: string): table",
+			"register":        "(response: table, name?: string): string?, string?",
+			"loginOptions":    "(account?: number): table",
+			"login":           "(response: table): number?, string?",
+			"credentials":     "(account: number): table",
+			"remove":          "(account: number, id: number): boolean",
+		},
+		TOMLMetaTableName: {
+			"encode":     "(data: table): string",
+			"decode":     "(source: string): table",
+			"decodeFile": "(path: string): table",
+		},
+		YAMLMetaTableName: {
+			"encode":     "(data: table): string",
+			"decode":     "(source: string): any",
+			"decodeFile": "(path: string): any",
+		},
+		StorageMetaTableName: {
+			"get": "(player: number, key: number): table",
+			"set": "(player: number, key: number, value: number)",
+		},
+		PlayerMetaTableName: {
+			"getAccountId":     "(): number",
+			"isOnline":         "(): boolean",
+			"getBankBalance":   "(): number",
+			"setBankBalance":   "(balance: number)",
+			"getStorageValue":  "(key: number): table",
+			"setStorageValue":  "(key: number, value: number)",
+			"getVocation":      "(): table",
+			"getTown":          "(): table",
+			"getGender":        "(): number",
+			"getLevel":         "(): number",
+			"getPremiumEndsAt": "(): number",
+			"getPremiumTime":   "(): number",
+			"getPremiumDays":   "(): number",
+			"getName":          "(): string",
+			"getExperience":    "(): number",
+			"getCapacity":      "(): number",
+			"getCustomField":   "(field: string): string?",
+			"setCustomField":   "(field: string, value: any)",
+			"getGuild":         "(): number",
+		},
+		GuildMetaTableName: {
+			"getOwner":   "(): number",
+			"getMembers": "(): table",
+			"getLeader":  "(): player",
+		},
+		WidgetMetaTableName: {
+			"render": "(template: string, args?: table)",
+		},
+		EventsMetaTableName: {
+			"new": "(handler: function)",
+		},
+		PayPalMetaTableName: {
+			"createPayment":      "(name: string, price: number, custom: string, cancelURL: string, returnURL: string): table",
+			"paymentInformation": "(id: string): table?",
+			"executePayment":     "(id: string, payerID: string): boolean",
+		},
+		ImageMetaTableName: {
+			"new": "(width: number, height: number): goimage",
+		},
+		GoImageMetaTableName: {
+			"writeText":     "(text: string, color: string, size: number, x: number, y: number, font?: string)",
+			"save":          "(path: string)",
+			"setBackground": "(path: string)",
+			"encode":        "(): string",
+		},
+		FileMetaTableName: {
+			"mod":             "(path: string): number",
+			"exists":          "(path: string): boolean",
+			"getDirectories":  "(path: string): table?",
+			"getFiles":        "(path: string): table?",
+			"createDirectory": "(path: string)",
+			"unzip":           "(source: string, destination: string): boolean?, string?",
+		},
+		EnvMetaTableName: {
+			"set": "(key: string, value: string)",
+			"get": "(key: string): string?",
+		},
+		LogMetaTableName: {
+			"error": "(message: any)",
+			"fatal": "(message: any)",
+			"info":  "(message: any)",
+		},
+		GlobalMetaTableName: {
+			"set":    "(key: string, value: table)",
+			"get":    "(key: string): table?",
+			"delete": "(key: string)",
+		},
+		FormFileMetaTableName: {
+			"isValidPNG":       "(): boolean",
+			"isValidExtension": "(contentType: string): boolean",
+			"contentType":      "(): string",
+			"getFile":          "(): string",
+			"saveFile":         "(destination: string)",
+			"saveFileAsPNG":    "(destination: string, width?: number, height?: number)",
+			"SaveFileAsJPEG":   "(destination: string, quality: number, width?: number, height?: number)",
+		},
+		OutfitMetaTableName: {
+			"generate": "(looktype: number, feet: number, legs: number, body: number, head: number, addons: number): string",
+		},
+		ExtensionMetaTableName: {
+			"reload": "()",
+		},
+		I18nMetaTableName: {
+			"get": "(language: string, index: string, ...: any): string?",
+		},
+		JobsMetaTableName: {
+			"register": "(name: string, path: string)",
+			"enqueue":  "(name: string, payload?: table, options?: table): number",
+			"dispatch": "(name: string, payload?: table, options?: table)",
+			"get":      "(id: number): table?",
+			"list":     "(status?: string, limit?: number): table",
+			"retry":    "(id: number)",
+		},
+		BusMetaTableName: {
+			"on":        "(pattern: string, path: string, async?: boolean): number",
+			"emit":      "(topic: string, payload?: table): boolean, string?",
+			"emitAsync": "(topic: string, payload?: table)",
+			"job":       "(pattern: string, name: string): number",
+			"off":       "(id: number)",
+		},
+		ProfilerMetaTableName: {
+			"isEnabled": "(): boolean",
+			"pages":     "(): table",
+			"top":       "(page: string, limit?: number): table?",
+			"pprof":     "(page: string): string?",
+			"reset":     "(page?: string)",
+		},
+		PromiseMetaTableName: {
+			"await": "(): table?, string?",
+			"done":  "(): boolean",
+		},
+		TestMetaTableName: {
+			"request":        "(method: string, path: string, options?: table): table",
+			"fixture":        "(fixture: any)",
+			"assert":         "(value: any, message?: string)",
+			"assertEqual":    "(expected: any, actual: any, message?: string)",
+			"assertStatus":   "(response: table, status: number, message?: string)",
+			"assertHeader":   "(response: table, name: string, value: string, message?: string)",
+			"assertTemplate": "(response: table, template: string, message?: string)",
+			"assertArg":      "(response: table, name: string, value: any, message?: string)",
+			"fail":           "(message?: string)",
+			"log":            "(message: any)",
+			"captcha":        "(valid: boolean)",
+			"statusServer":   "(status?: table)",
+		},
+	}
+
+	// functionSignatures signatures of the global functions
+	functionSignatures = map[string]string{
+		"sleep":   "(milliseconds: number)",
+		"Player":  "(player: any): player?",
+		"Guild":   "(guild: any): guild?",
+		"try":     "(try: function, catch?: function)",
+		"ternary": "(condition: any, a: any, b: any): any",
+	}
+
+	// parsedSignatures cache of the parsed signatures
+	parsedSignatures = map[string]*Signature{}
+	signaturesMutex  = sync.Mutex{}
+)
+
+// GetMethodSignature returns the signature of the given module method
+func GetMethodSignature(module, method string) (*Signature, bool) {
+	methods, ok := methodSignatures[module]
+
+	if !ok {
+		return nil, false
+	}
+
+	src, ok := methods[method]
+
+	if !ok {
+		return nil, false
+	}
+
+	return getSignature(module+":"+method, src), true
+}
+
+// GetFunctionSignature returns the signature of the given global function
+func GetFunctionSignature(name string) (*Signature, bool) {
+	src, ok := functionSignatures[name]
+
+	if !ok {
+		return nil, false
+	}
+
+	return getSignature(name, src), true
+}
+
+// getSignature parses the signature source using the signature cache
+func getSignature(key, src string) *Signature {
+	// Lock mutex
+	signaturesMutex.Lock()
+	defer signaturesMutex.Unlock()
+
+	if s, ok := parsedSignatures[key]; ok {
+		return s
+	}
+
+	s := ParseSignature(src)
+	parsedSignatures[key] = s
+
+	return s
+}
+
+// ParseSignature parses a "(name: type, optional?: type): return" signature
+func ParseSignature(src string) *Signature {
+	s := &Signature{
+		Params:  []Param{},
+		Returns: []string{},
+	}
+
+	// Split parameters and return values
+	end := strings.Index(src, ")")
+
+	if !strings.HasPrefix(src, "(") || end == -1 {
+		return s
+	}
+
+	params := strings.TrimSpace(src[1:end])
+	returns := strings.TrimPrefix(strings.TrimSpace(src[end+1:]), ":")
+
+	// Parse parameters
+	if params != "" {
+		for _, p := range strings.Split(params, ",") {
+
+			// Split name and type
+			parts := strings.SplitN(p, ":", 2)
+			param := Param{
+				Name: strings.TrimSpace(parts[0]),
+				Type: "any",
+			}
+
+			if len(parts) == 2 {
+				param.Type = strings.TrimSpace(parts[1])
+			}
+
+			if param.Name == "..." {
+				s.Variadic = true
+				continue
+			}
+
+			if strings.HasSuffix(param.Name, "?") {
+				param.Name = strings.TrimSuffix(param.Name, "?")
+				param.Optional = true
+			}
+
+			s.Params = append(s.Params, param)
+		}
+	}
+
+	// Parse return values
+	if strings.TrimSpace(returns) != "" {
+		for _, r := range strings.Split(returns, ",") {
+			s.Returns = append(s.Returns, strings.TrimSpace(r))
+		}
+	}
+
+	return s
+}
+
+// MinArgs returns the number of required arguments
+func (s *Signature) MinArgs() int {
+	n := 0
+
+	for _, p := range s.Params {
+		if !p.Optional {
+			n++
+		}
+	}
+
+	return n
+}
+
+// MaxArgs returns the maximum number of arguments or -1 if the signature is variadic
+func (s *Signature) MaxArgs() int {
+	if s.Variadic {
+		return -1
+	}
+	return len(s.Params)
+}
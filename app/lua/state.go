@@ -55,6 +55,10 @@ func (s *compiledStateList) CompileFiles(dir string) error {
 	s.rw.Lock()
 	defer s.rw.Unlock()
 	files := map[string]*glua.FunctionProto{}
+
+	// Lint files on development mode
+	linter := newDevelopmentLinter()
+
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -68,6 +72,7 @@ func (s *compiledStateList) CompileFiles(dir string) error {
 			if err != nil {
 				return err
 			}
+			linter.logFile(path)
 			files[path] = proto
 		}
 		return nil
@@ -94,6 +99,9 @@ func (s *compiledStateList) CompileExtensions(extType string) error {
 	// Close rows
 	defer rows.Close()
 
+	// Lint files on development mode
+	linter := newDevelopmentLinter()
+
 	// Loop rows
 	for rows.Next() {
 
@@ -120,6 +128,8 @@ func (s *compiledStateList) CompileExtensions(extType string) error {
 					return err
 				}
 
+				linter.logFile(path)
+
 				// Set virtual path
 				path := strings.ToLower(strings.Replace(path, dir, extType, -1))
 
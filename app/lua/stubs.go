@@ -0,0 +1,292 @@
+package lua
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+
+	glua "github.com/yuin/gopher-lua"
+)
+
+// stubModule describes a castro module or object table exposed to lua
+type stubModule struct {
+	Name    string
+	Global  bool
+	Methods map[string]glua.LGFunction
+	Fields  map[string]string
+}
+
+var (
+	// stubModules list of the modules and object tables written to the lua stubs
+	stubModules = []stubModule{
+		{Name: Base64MetaTableName, Global: true, Methods: base64Methods},
+		{Name: BusMetaTableName, Global: true, Methods: busMethods},
+		{Name: CacheMetaTableName, Global: true, Methods: cacheMethods},
+		{Name: CaptchaMetaTableName, Global: true, Methods: captchaMethods},
+		{Name: ConfigMetaTableName, Global: true, Methods: configMethods},
+		{Name: CryptoMetaTableName, Global: true, Methods: cryptoMethods},
+		{Name: DatabaseMetaTableName, Global: true, Methods: mysqlMethods},
+		{Name: DebugMetaTableName, Global: true, Methods: debugMethods},
+		{Name: EnvMetaTableName, Global: true, Methods: envMethods},
+		{Name: EventsMetaTableName, Global: true, Methods: eventsMethods},
+		{Name: FileMetaTableName, Global: true, Methods: fileMethods},
+		{Name: GlobalMetaTableName, Global: true, Methods: globalMethods},
+		{Name: HTTPMetaTableName, Global: true, Methods: httpMethods, Fields: map[string]string{
+			HTTPMetaTableMethodName: "string",
+			HTTPGetValuesName:       "table<string, string>",
+			HTTPPostValuesName:      "table<string, string>",
+			HTTPCurrentSubtopic:     "string",
+		}},
+		{Name: I18nMetaTableName, Global: true, Methods: i18nMethods},
+		{Name: ImageMetaTableName, Global: true, Methods: imgMethods},
+		{Name: JobsMetaTableName, Global: true, Methods: jobsMethods},
+		{Name: JSONMetaTableName, Global: true, Methods: jsonMethods},
+		{Name: CSVMetaTableName, Global: true, Methods: csvMethods},
+		{Name: TOMLMetaTableName, Global: true, Methods: tomlMethods},
+		{Name: HTMLMetaTableName, Global: true, Methods: htmlMethods},
+		{Name: MarkdownMetaTableName, Global: true, Methods: markdownMethods},
+		{Name: TokenMetaTableName, Global: true, Methods: tokenMethods},
+		{Name: CookieMetaTableName, Global: true, Methods: cookieMethods},
+		{Name: SecurityMetaTableName, Global: true, Methods: securityMethods},
+		{Name: ServerMetaTableName, Global: true, Methods: serverMethods},
+		{Name: SupervisorMetaTableName, Global: true, Methods: supervisorMethods},
+		{Name: WebAuthnMetaTableName, Global: true, Methods: webAuthnMethods},
+		{Name: YAMLMetaTableName, Global: true, Methods: yamlMethods},
+		{Name: LogMetaTableName, Global: true, Methods: logMethods},
+		{Name: MailMetaTableName, Global: true, Methods: mailMethods},
+		{Name: MapMetaTableName, Global: true, Methods: mapMethods},
+		{Name: OutfitMetaTableName, Global: true, Methods: outfitMethods},
+		{Name: PayPalMetaTableName, Global: true, Methods: paypalMethods},
+		{Name: ProfilerMetaTableName, Global: true, Methods: profilerMethods},
+		{Name: ReflectMetaTableName, Global: true, Methods: reflectMethods},
+		{Name: SessionMetaTable, Global: true, Methods: sessionMethods},
+		{Name: StorageMetaTableName, Global: true, Methods: storageMethods},
+		{Name: TimeMetaTableName, Global: true, Methods: timeMethods},
+		{Name: URLMetaTableName, Global: true, Methods: urlMethods},
+		{Name: ValidatorMetaTableName, Global: true, Methods: validatorMethods},
+		{Name: WidgetMetaTableName, Global: true, Methods: widgetMethods},
+		{Name: XMLMetaTableName, Global: true, Methods: xmlMethods},
+		{Name: FormFileMetaTableName, Methods: formFileMethods},
+		{Name: GoImageMetaTableName, Methods: goimageMethods},
+		{Name: GuildMetaTableName, Methods: guildMethods},
+		{Name: PlayerMetaTableName, Methods: playerMethods},
+		{Name: PromiseMetaTableName, Methods: promiseMethods},
+		{Name: TestMetaTableName, Methods: testMethods},
+	}
+
+	// bindingFunctions go function names of the lua bindings
+	bindingFunctions = map[string]string{}
+
+	// stubGlobals type of the global variables written to the lua stubs
+	stubGlobals = map[string]string{
+		"app":        "table",
+		"serverPath": "string",
+		"logFile":    "string",
+	}
+)
+
+// LoadBindingDocs parses the go files of the given directory and returns the doc comment of every function
+func LoadBindingDocs(dir string) (map[string]string, error) {
+	docs := map[string]string{}
+
+	// Parse package files
+	packages, err := parser.ParseDir(token.NewFileSet(), dir, nil, parser.ParseComments)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+
+				if !ok || fn.Recv != nil || fn.Doc == nil {
+					continue
+				}
+
+				docs[fn.Name.Name] = bindingDoc(fn.Name.Name, fn.Doc.Text())
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// bindingDoc removes the go function name from a doc comment
+func bindingDoc(name, doc string) string {
+	doc = strings.Join(strings.Fields(doc), " ")
+	doc = strings.TrimSpace(strings.TrimPrefix(doc, name))
+
+	if doc == "" {
+		return ""
+	}
+
+	// Capitalize first letter
+	r := []rune(doc)
+	r[0] = unicode.ToUpper(r[0])
+
+	return string(r)
+}
+
+// functionName returns the go name of a lua binding
+func functionName(fn glua.LGFunction) string {
+	if fn == nil {
+		return ""
+	}
+
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// WriteStubs writes LuaLS/EmmyLua annotations for all the castro bindings
+func WriteStubs(out io.Writer, docs map[string]string) error {
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintln(w, "---@meta")
+	fmt.Fprintln(w, "-- Castro lua bindings. Generated by castro stubs, do not edit")
+
+	// Write modules
+	for _, module := range stubModules {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "---@class %v\n", module.Name)
+
+		// Write module fields
+		for _, field := range sortedKeys(module.Fields) {
+			fmt.Fprintf(w, "---@field %v %v\n", field, module.Fields[field])
+		}
+
+		if module.Global {
+			fmt.Fprintf(w, "%v = {}\n", module.Name)
+		} else {
+			fmt.Fprintf(w, "local %v = {}\n", module.Name)
+		}
+
+		// Write module methods
+		methods := []string{}
+
+		for method := range module.Methods {
+			methods = append(methods, method)
+		}
+
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			sig, ok := GetMethodSignature(module.Name, method)
+
+			if !ok {
+				sig = &Signature{Variadic: true}
+			}
+
+			fmt.Fprintln(w)
+			writeStubFunction(w, docs[bindingFunctions[module.Name+":"+method]], sig)
+			fmt.Fprintf(w, "function %v:%v(%v) end\n", module.Name, method, stubParams(sig))
+		}
+	}
+
+	// Write global functions
+	names := []string{}
+
+	for name := range globalFuncList {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		sig, ok := GetFunctionSignature(name)
+
+		if !ok {
+			sig = &Signature{Variadic: true}
+		}
+
+		fmt.Fprintln(w)
+		writeStubFunction(w, docs[bindingFunctions[name]], sig)
+		fmt.Fprintf(w, "function %v(%v) end\n", name, stubParams(sig))
+	}
+
+	// Write global variables
+	for _, name := range sortedKeys(stubGlobals) {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "---@type %v\n", stubGlobals[name])
+		fmt.Fprintf(w, "%v = nil\n", name)
+	}
+
+	return w.Flush()
+}
+
+// writeStubFunction writes the doc comment and annotations of a function
+func writeStubFunction(w io.Writer, doc string, sig *Signature) {
+	if doc != "" {
+		fmt.Fprintf(w, "--- %v\n", doc)
+	}
+
+	for _, p := range sig.Params {
+		name := p.Name
+
+		if p.Optional {
+			name += "?"
+		}
+
+		fmt.Fprintf(w, "---@param %v %v\n", name, p.Type)
+	}
+
+	if sig.Variadic {
+		fmt.Fprintln(w, "---@param ... any")
+	}
+
+	for _, r := range sig.Returns {
+		fmt.Fprintf(w, "---@return %v\n", r)
+	}
+}
+
+// stubParams returns the parameter list of a function
+func stubParams(sig *Signature) string {
+	params := []string{}
+
+	for _, p := range sig.Params {
+		params = append(params, p.Name)
+	}
+
+	if sig.Variadic {
+		params = append(params, "...")
+	}
+
+	return strings.Join(params, ", ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// WriteStubsFile writes the lua stubs to the given path
+func WriteStubsFile(path string, docs map[string]string) error {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	// Close file
+	defer f.Close()
+
+	return WriteStubs(f, docs)
+}
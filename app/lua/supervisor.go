@@ -0,0 +1,172 @@
+package lua
+
+import (
+	"time"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetSupervisorMetaTable sets the supervisor metatable of the given state
+func SetSupervisorMetaTable(luaState *glua.LState) {
+	// Create and set the supervisor metatable
+	supervisorMetaTable := luaState.NewTypeMetatable(SupervisorMetaTableName)
+	luaState.SetGlobal(SupervisorMetaTableName, supervisorMetaTable)
+
+	// Set all supervisor metatable functions
+	luaState.SetFuncs(supervisorMetaTable, supervisorMethods)
+}
+
+// getSupervisor returns the game server supervisor raising an error when it is disabled
+func getSupervisor(L *glua.LState) *util.Supervisor {
+	if util.GameSupervisor == nil {
+		L.RaiseError("Game server supervisor is not enabled")
+		return nil
+	}
+
+	return util.GameSupervisor
+}
+
+// pushSupervisorResult pushes true or false and the error message
+func pushSupervisorResult(L *glua.LState, err error) int {
+	if err != nil {
+		L.Push(glua.LFalse)
+		L.Push(glua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(glua.LTrue)
+	return 1
+}
+
+// IsSupervisorEnabled checks if the game server supervisor is enabled
+func IsSupervisorEnabled(L *glua.LState) int {
+	L.Push(glua.LBool(util.GameSupervisor != nil))
+
+	return 1
+}
+
+// GetSupervisorStatus returns the game server process status
+func GetSupervisorStatus(L *glua.LState) int {
+	s := getSupervisor(L)
+	status := s.Status()
+
+	t := &glua.LTable{}
+	t.RawSetString("state", glua.LString(status.State))
+	t.RawSetString("pid", glua.LNumber(status.PID))
+	t.RawSetString("startedAt", glua.LNumber(status.StartedAt))
+	t.RawSetString("restarts", glua.LNumber(status.Restarts))
+	t.RawSetString("crashes", glua.LNumber(status.Crashes))
+	t.RawSetString("lastExit", glua.LString(status.LastExit))
+	t.RawSetString("lastExitAt", glua.LNumber(status.LastExitAt))
+	t.RawSetString("nextRestart", glua.LNumber(status.NextRestart))
+	t.RawSetString("restartMessage", glua.LString(status.RestartMessage))
+
+	L.Push(t)
+
+	return 1
+}
+
+// StartSupervisor starts the game server process
+func StartSupervisor(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	return pushSupervisorResult(L, s.Start())
+}
+
+// StopSupervisor stops the game server process. The process is stopped on the background
+// since the server can take a while to save
+func StopSupervisor(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	if state := s.Status().State; state != util.SupervisorRunning && state != util.SupervisorCrashed {
+		return pushSupervisorResult(L, util.ErrSupervisorNotRunning)
+	}
+
+	go func() {
+		if err := s.Stop(); err != nil {
+			util.Logger.Logger.Errorf("Cannot stop game server: %v", err)
+		}
+	}()
+
+	return pushSupervisorResult(L, nil)
+}
+
+// RestartSupervisor restarts the game server process on the background
+func RestartSupervisor(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	if s.Status().State == util.SupervisorStopping {
+		return pushSupervisorResult(L, util.ErrSupervisorRunning)
+	}
+
+	go func() {
+		if err := s.Restart(); err != nil {
+			util.Logger.Logger.Errorf("Cannot restart game server: %v", err)
+		}
+	}()
+
+	return pushSupervisorResult(L, nil)
+}
+
+// ScheduleSupervisorRestart restarts the game server after the given number of seconds
+// broadcasting the configured warnings
+func ScheduleSupervisorRestart(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	// Get restart delay
+	seconds := L.Get(2)
+
+	if seconds.Type() != glua.LTNumber {
+		L.ArgError(1, "Invalid seconds type. Expected number")
+		return 0
+	}
+
+	at := time.Now().Add(time.Duration(float64(seconds.(glua.LNumber)) * float64(time.Second)))
+
+	return pushSupervisorResult(L, s.ScheduleRestart(at, L.OptString(3, "")))
+}
+
+// CancelSupervisorRestart cancels the scheduled game server restart
+func CancelSupervisorRestart(L *glua.LState) int {
+	s := getSupervisor(L)
+	s.CancelRestart()
+
+	return 0
+}
+
+// SupervisorBroadcast sends a broadcast message to the players
+func SupervisorBroadcast(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	// Get message
+	message := L.Get(2)
+
+	if message.Type() != glua.LTString {
+		L.ArgError(1, "Invalid message type. Expected string")
+		return 0
+	}
+
+	return pushSupervisorResult(L, s.Broadcast(message.String()))
+}
+
+// GetSupervisorConsole returns the last captured game server output lines
+func GetSupervisorConsole(L *glua.LState) int {
+	s := getSupervisor(L)
+
+	list := &glua.LTable{}
+
+	for _, line := range s.Lines(0, L.OptInt(2, 100)) {
+		t := &glua.LTable{}
+		t.RawSetString("id", glua.LNumber(line.ID))
+		t.RawSetString("time", glua.LNumber(line.Time))
+		t.RawSetString("stream", glua.LString(line.Stream))
+		t.RawSetString("text", glua.LString(line.Text))
+
+		list.Append(t)
+	}
+
+	L.Push(list)
+
+	return 1
+}
@@ -0,0 +1,672 @@
+package lua
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raggaer/castro/app/database"
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// testRequestHeader header used to match rendered templates with test requests
+	testRequestHeader = "X-Castro-Test"
+)
+
+// validFixtureName matches table and column names allowed on fixtures
+var validFixtureName = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
+// TestRunner struct used to execute lua test files against the application handler
+type TestRunner struct {
+	rw      sync.Mutex
+	server  *httptest.Server
+	lastID  int64
+	renders map[string]*testRender
+	captcha *util.FakeCaptchaProvider
+	status  *util.FakeStatusServer
+}
+
+// testRender holds the template rendered by a test request
+type testRender struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// testCase holds the state of a single lua test function
+type testCase struct {
+	runner *TestRunner
+	client *http.Client
+}
+
+// NewTestRunner creates a test runner serving the given handler on a local test server
+func NewTestRunner(handler http.Handler) *TestRunner {
+	r := &TestRunner{
+		server:  httptest.NewServer(handler),
+		renders: map[string]*testRender{},
+		captcha: &util.FakeCaptchaProvider{Valid: true},
+	}
+
+	// Accept captcha answers unless a test says otherwise
+	util.SetCaptchaProvider(r.captcha)
+
+	// Record rendered templates
+	util.TemplateRecorder = func(req *http.Request, name string, args map[string]interface{}) {
+		id := req.Header.Get(testRequestHeader)
+
+		if id == "" {
+			return
+		}
+
+		r.rw.Lock()
+		defer r.rw.Unlock()
+
+		r.renders[id] = &testRender{
+			Name: name,
+			Args: args,
+		}
+	}
+
+	return r
+}
+
+// Close stops the test server
+func (r *TestRunner) Close() {
+	util.TemplateRecorder = nil
+	util.SetCaptchaProvider(nil)
+	r.stopStatusServer()
+	util.SetServerStatusAddress("")
+	r.server.Close()
+}
+
+// RunFile executes all the test functions of the given lua file. Test functions are globals starting with test
+func (r *TestRunner) RunFile(path string) []util.TestResult {
+	// Create test state
+	state := NewState()
+	defer state.Close()
+
+	// Execute test file
+	if err := state.DoFile(path); err != nil {
+		return []util.TestResult{
+			{
+				File:    path,
+				Name:    "load",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	// Get test function names
+	names := []string{}
+
+	state.G.Global.ForEach(func(k glua.LValue, v glua.LValue) {
+		if k.Type() == glua.LTString && strings.HasPrefix(k.String(), "test") && v.Type() == glua.LTFunction {
+			names = append(names, k.String())
+		}
+	})
+
+	sort.Strings(names)
+
+	// Results holder
+	results := []util.TestResult{}
+
+	for _, name := range names {
+
+		// Create test table
+		t, err := r.newTestTable(state)
+
+		if err != nil {
+			results = append(results, util.TestResult{
+				File:    path,
+				Name:    name,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		start := time.Now()
+
+		// Call test function
+		err = state.CallByParam(
+			glua.P{
+				Fn:      state.GetGlobal(name),
+				NRet:    0,
+				Protect: true,
+			},
+			t,
+		)
+
+		// Set test result
+		result := util.TestResult{
+			File:     path,
+			Name:     name,
+			Passed:   err == nil,
+			Duration: time.Since(start),
+		}
+
+		if err != nil {
+			result.Message = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// newTestTable creates the table passed to each test function. Each test uses its own cookie jar
+func (r *TestRunner) newTestTable(L *glua.LState) (*glua.LTable, error) {
+	// Create cookie jar
+	jar, err := cookiejar.New(nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Create test table
+	table := L.NewTable()
+
+	// Set test functions
+	L.SetFuncs(table, testMethods)
+
+	// Set test user data
+	u := L.NewUserData()
+	u.Value = &testCase{
+		runner: r,
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: time.Minute,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	L.SetField(table, "__test", u)
+
+	return table, nil
+}
+
+func getTestCase(L *glua.LState) *testCase {
+	// Get user data field
+	data := L.GetField(L.ToTable(1), "__test").(*glua.LUserData)
+
+	// Return test case
+	return data.Value.(*testCase)
+}
+
+// csrfToken returns the CSRF token stored on the test session cookie
+func (c *testCase) csrfToken() string {
+	// Get server url
+	u, err := url.Parse(c.runner.server.URL)
+
+	if err != nil {
+		return ""
+	}
+
+	for _, cookie := range c.client.Jar.Cookies(u) {
+
+		if cookie.Name != util.SessionCookieName() {
+			continue
+		}
+
+		// Decode session
+		session, err := util.DecodeSessionCookie(cookie.Value)
+
+		if err != nil {
+			return ""
+		}
+
+		if token, ok := session["csrf-token"].(*models.CsrfToken); ok {
+			return token.Token
+		}
+	}
+
+	return ""
+}
+
+// do executes a request against the test server and returns the response table
+func (c *testCase) do(L *glua.LState, method, path string, opts *glua.LTable) (*glua.LTable, error) {
+	// Request body holder
+	body := []byte{}
+	contentType := ""
+
+	// Request headers holder
+	headers := map[string]string{}
+
+	if opts != nil {
+
+		// Set query values
+		if query, ok := opts.RawGetString("query").(*glua.LTable); ok {
+			if strings.Contains(path, "?") {
+				path += "&" + TableToURLValues(query).Encode()
+			} else {
+				path += "?" + TableToURLValues(query).Encode()
+			}
+		}
+
+		// Set form body
+		if form, ok := opts.RawGetString("form").(*glua.LTable); ok {
+			values := TableToURLValues(form)
+
+			// Set session CSRF token
+			if values.Get("_csrf") == "" && method == http.MethodPost {
+				values.Set("_csrf", c.csrfToken())
+			}
+
+			body = []byte(values.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		}
+
+		// Set JSON body
+		if data, ok := opts.RawGetString("json").(*glua.LTable); ok {
+			buff, err := json.Marshal(ValueToGo(data))
+
+			if err != nil {
+				return nil, err
+			}
+
+			body = buff
+			contentType = "application/json"
+		}
+
+		// Set raw body
+		if raw := opts.RawGetString("body"); raw.Type() == glua.LTString {
+			body = []byte(raw.String())
+		}
+
+		// Set request headers
+		if h, ok := opts.RawGetString("headers").(*glua.LTable); ok {
+			h.ForEach(func(k glua.LValue, v glua.LValue) {
+				headers[k.String()] = v.String()
+			})
+		}
+	}
+
+	// Create request
+	req, err := http.NewRequest(method, c.runner.server.URL+path, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	// Set request identifier
+	c.runner.rw.Lock()
+	c.runner.lastID++
+	id := strconv.FormatInt(c.runner.lastID, 10)
+	c.runner.rw.Unlock()
+
+	req.Header.Set(testRequestHeader, id)
+
+	// Execute request
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Close response body
+	defer resp.Body.Close()
+
+	// Read response body
+	content, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Create response table
+	result := L.NewTable()
+	result.RawSetString("status", glua.LNumber(resp.StatusCode))
+	result.RawSetString("body", glua.LString(string(content)))
+	result.RawSetString("location", glua.LString(resp.Header.Get("Location")))
+
+	// Set response headers
+	headerTable := L.NewTable()
+
+	for k := range resp.Header {
+		headerTable.RawSetString(k, glua.LString(resp.Header.Get(k)))
+	}
+
+	result.RawSetString("headers", headerTable)
+
+	// Set rendered template
+	c.runner.rw.Lock()
+	render, ok := c.runner.renders[id]
+	delete(c.runner.renders, id)
+	c.runner.rw.Unlock()
+
+	if ok {
+		result.RawSetString("template", glua.LString(render.Name))
+		result.RawSetString("args", MapToTable(render.Args))
+	}
+
+	return result, nil
+}
+
+// TestRequest executes a request through the application middleware chain
+func TestRequest(L *glua.LState) int {
+	// Get test case
+	c := getTestCase(L)
+
+	// Get method and path
+	method := strings.ToUpper(L.CheckString(2))
+	path := L.CheckString(3)
+
+	// Get request options
+	opts, _ := L.Get(4).(*glua.LTable)
+
+	// Make sure the session has a CSRF token before posting
+	if method == http.MethodPost && c.csrfToken() == "" {
+		if _, err := c.do(L, http.MethodGet, "/", nil); err != nil {
+			L.RaiseError("Cannot create test session: %v", err)
+			return 0
+		}
+	}
+
+	// Execute request
+	result, err := c.do(L, method, path, opts)
+
+	if err != nil {
+		L.RaiseError("Cannot execute test request: %v", err)
+		return 0
+	}
+
+	L.Push(result)
+
+	return 1
+}
+
+// TestFixture loads a SQL file or a table of rows into the test database
+func TestFixture(L *glua.LState) int {
+	// Get fixture
+	fixture := L.Get(2)
+
+	// Execute SQL file
+	if fixture.Type() == glua.LTString {
+
+		// Read file
+		buff, err := ioutil.ReadFile(fixture.String())
+
+		if err != nil {
+			L.RaiseError("Cannot read fixture file: %v", err)
+			return 0
+		}
+
+		if _, err := database.DB.Exec(string(buff)); err != nil {
+			L.RaiseError("Cannot load fixture file: %v", err)
+		}
+
+		return 0
+	}
+
+	// Get rows table
+	tables, ok := fixture.(*glua.LTable)
+
+	if !ok {
+		L.ArgError(1, "Invalid fixture type. Expected string or table")
+		return 0
+	}
+
+	// Insert rows
+	for table, rows := range TableToMap(tables) {
+
+		if !validFixtureName.MatchString(table) {
+			L.RaiseError("Invalid fixture table name: %v", table)
+			return 0
+		}
+
+		list, ok := rows.([]interface{})
+
+		if !ok {
+			L.RaiseError("Invalid fixture rows for table %v. Expected list", table)
+			return 0
+		}
+
+		for _, r := range list {
+
+			row, ok := r.(map[string]interface{})
+
+			if !ok {
+				L.RaiseError("Invalid fixture row for table %v. Expected table", table)
+				return 0
+			}
+
+			// Sort columns
+			columns := []string{}
+
+			for column := range row {
+				if !validFixtureName.MatchString(column) {
+					L.RaiseError("Invalid fixture column name: %v", column)
+					return 0
+				}
+				columns = append(columns, column)
+			}
+
+			sort.Strings(columns)
+
+			// Get values
+			values := []interface{}{}
+
+			for _, column := range columns {
+				values = append(values, row[column])
+			}
+
+			// Insert row
+			query := fmt.Sprintf(
+				"INSERT INTO `%s` (`%s`) VALUES (%s)",
+				table,
+				strings.Join(columns, "`, `"),
+				strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+			)
+
+			if _, err := database.DB.Exec(query, values...); err != nil {
+				L.RaiseError("Cannot insert fixture row into %v: %v", table, err)
+				return 0
+			}
+		}
+	}
+
+	return 0
+}
+
+// testMessage returns the optional assertion message
+func testMessage(L *glua.LState, n int, format string, args ...interface{}) string {
+	if msg := L.Get(n); msg.Type() == glua.LTString {
+		return msg.String()
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// TestAssert fails the test if the given value is false or nil
+func TestAssert(L *glua.LState) int {
+	if !glua.LVAsBool(L.Get(2)) {
+		L.RaiseError("%s", testMessage(L, 3, "assertion failed"))
+	}
+	return 0
+}
+
+// TestAssertEqual fails the test if the given values are different
+func TestAssertEqual(L *glua.LState) int {
+	// Get values
+	expected := L.Get(2)
+	actual := L.Get(3)
+
+	if !L.Equal(expected, actual) {
+		L.RaiseError("%s", testMessage(L, 4, "expected %v got %v", expected, actual))
+	}
+	return 0
+}
+
+// TestAssertStatus fails the test if the response status code is different
+func TestAssertStatus(L *glua.LState) int {
+	// Get response status
+	status := L.CheckTable(2).RawGetString("status")
+
+	if status != glua.LNumber(L.CheckInt(3)) {
+		L.RaiseError("%s", testMessage(L, 4, "expected status %v got %v", L.CheckInt(3), status))
+	}
+	return 0
+}
+
+// TestAssertHeader fails the test if the response header value is different
+func TestAssertHeader(L *glua.LState) int {
+	// Get response headers
+	headers, _ := L.CheckTable(2).RawGetString("headers").(*glua.LTable)
+
+	// Get header value
+	value := ""
+
+	if headers != nil {
+		if v := headers.RawGetString(http.CanonicalHeaderKey(L.CheckString(3))); v.Type() == glua.LTString {
+			value = v.String()
+		}
+	}
+
+	if value != L.CheckString(4) {
+		L.RaiseError("%s", testMessage(L, 5, "expected header %v to be %q got %q", L.CheckString(3), L.CheckString(4), value))
+	}
+	return 0
+}
+
+// TestAssertTemplate fails the test if the response did not render the given template
+func TestAssertTemplate(L *glua.LState) int {
+	// Get rendered template
+	name := L.CheckTable(2).RawGetString("template")
+
+	if name.Type() != glua.LTString || name.String() != L.CheckString(3) {
+		L.RaiseError("%s", testMessage(L, 4, "expected template %v got %v", L.CheckString(3), name))
+	}
+	return 0
+}
+
+// TestAssertArg fails the test if the template argument is different from the given value
+func TestAssertArg(L *glua.LState) int {
+	// Get template args
+	args, ok := L.CheckTable(2).RawGetString("args").(*glua.LTable)
+
+	if !ok {
+		L.RaiseError("%s", testMessage(L, 5, "response did not render a template"))
+		return 0
+	}
+
+	// Get argument value
+	actual := args.RawGetString(L.CheckString(3))
+
+	if !L.Equal(L.Get(4), actual) {
+		L.RaiseError("%s", testMessage(L, 5, "expected template argument %v to be %v got %v", L.CheckString(3), L.Get(4), actual))
+	}
+	return 0
+}
+
+// TestFail fails the test with the given message
+func TestFail(L *glua.LState) int {
+	L.RaiseError("%s", testMessage(L, 2, "test failed"))
+	return 0
+}
+
+// TestLog prints a message to the test output
+func TestLog(L *glua.LState) int {
+	fmt.Printf("# %v\n", L.ToString(2))
+	return 0
+}
+
+// TestCaptcha sets if the captcha answers of the next requests are valid
+func TestCaptcha(L *glua.LState) int {
+	getTestCase(L).runner.captcha.SetValid(L.ToBool(2))
+
+	return 0
+}
+
+// stopStatusServer stops the fake game server status server
+func (r *TestRunner) stopStatusServer() {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	if r.status == nil {
+		return
+	}
+
+	r.status.Close()
+	util.FlushServerStatus(r.status.Address())
+	r.status = nil
+}
+
+// TestStatusServer starts a fake game server status server answering with the given status.
+// Without a status the fake server is stopped so the game server looks offline
+func TestStatusServer(L *glua.LState) int {
+	runner := getTestCase(L).runner
+	tbl, ok := L.Get(2).(*glua.LTable)
+
+	if !ok {
+		runner.stopStatusServer()
+		return 0
+	}
+
+	status := util.ServerStatus{
+		Name:     glua.LVAsString(tbl.RawGetString("name")),
+		Server:   glua.LVAsString(tbl.RawGetString("server")),
+		Version:  glua.LVAsString(tbl.RawGetString("version")),
+		Client:   glua.LVAsString(tbl.RawGetString("client")),
+		Location: glua.LVAsString(tbl.RawGetString("location")),
+		URL:      glua.LVAsString(tbl.RawGetString("url")),
+		Uptime:   int64(glua.LVAsNumber(tbl.RawGetString("uptime"))),
+		MOTD:     glua.LVAsString(tbl.RawGetString("motd")),
+		Monsters: int(glua.LVAsNumber(tbl.RawGetString("monsters"))),
+		NPCs:     int(glua.LVAsNumber(tbl.RawGetString("npcs"))),
+	}
+
+	if players, ok := tbl.RawGetString("players").(*glua.LTable); ok {
+		status.Players.Online = int(glua.LVAsNumber(players.RawGetString("online")))
+		status.Players.Max = int(glua.LVAsNumber(players.RawGetString("max")))
+		status.Players.Peak = int(glua.LVAsNumber(players.RawGetString("peak")))
+	}
+
+	if m, ok := tbl.RawGetString("map").(*glua.LTable); ok {
+		status.Map.Name = glua.LVAsString(m.RawGetString("name"))
+		status.Map.Author = glua.LVAsString(m.RawGetString("author"))
+		status.Map.Width = int(glua.LVAsNumber(m.RawGetString("width")))
+		status.Map.Height = int(glua.LVAsNumber(m.RawGetString("height")))
+	}
+
+	runner.rw.Lock()
+	defer runner.rw.Unlock()
+
+	if runner.status != nil {
+		runner.status.SetStatus(status)
+		util.FlushServerStatus(runner.status.Address())
+		return 0
+	}
+
+	s, err := util.NewFakeStatusServer(status)
+
+	if err != nil {
+		L.RaiseError("Cannot start fake status server: %v", err)
+		return 0
+	}
+
+	runner.status = s
+	util.SetServerStatusAddress(s.Address())
+
+	return 0
+}
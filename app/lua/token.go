@@ -0,0 +1,142 @@
+package lua
+
+import (
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// consumeToken function used to mark single-use tokens as used
+var consumeToken = models.ConsumeToken
+
+// SetTokenMetaTable sets the token metatable of the given state
+func SetTokenMetaTable(luaState *glua.LState) {
+	// Create and set the token metatable
+	tokenMetaTable := luaState.NewTypeMetatable(TokenMetaTableName)
+	luaState.SetGlobal(TokenMetaTableName, tokenMetaTable)
+
+	// Set all token metatable functions
+	luaState.SetFuncs(tokenMetaTable, tokenMethods)
+}
+
+// SignToken signs a payload for the given purpose. The duration can be a number of seconds or a duration string
+func SignToken(L *glua.LState) int {
+	// Get token purpose
+	purpose := L.Get(2)
+
+	// Check valid purpose
+	if purpose.Type() != glua.LTString {
+		L.ArgError(1, "Invalid purpose type. Expected string")
+		return 0
+	}
+
+	// Get token payload
+	payload := L.Get(3)
+
+	// Check valid payload
+	if payload.Type() != glua.LTTable && payload.Type() != glua.LTNil {
+		L.ArgError(2, "Invalid payload type. Expected table")
+		return 0
+	}
+
+	opts := util.TokenOptions{}
+
+	// Get token duration
+	switch ttl := L.Get(4).(type) {
+	case glua.LNumber:
+		opts.TTL = time.Duration(float64(ttl) * float64(time.Second))
+	case glua.LString:
+		d, err := time.ParseDuration(string(ttl))
+
+		if err != nil {
+			L.ArgError(3, "Invalid duration. Expected number or duration string")
+			return 0
+		}
+
+		opts.TTL = d
+	}
+
+	// Get token options
+	if tbl, ok := L.Get(5).(*glua.LTable); ok {
+		opts.Once = glua.LVAsBool(tbl.RawGetString("once"))
+		opts.JWT = glua.LVAsBool(tbl.RawGetString("jwt"))
+	}
+
+	data := map[string]interface{}{}
+
+	if tbl, ok := payload.(*glua.LTable); ok {
+		data = TableToMap(tbl)
+	}
+
+	token, err := util.SignToken(purpose.String(), data, opts)
+
+	if err != nil {
+		L.RaiseError("Cannot sign token: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LString(token))
+
+	return 1
+}
+
+// VerifyToken verifies a token for the given purpose returning its payload. Single-use
+// tokens are consumed unless the consume option is disabled
+func VerifyToken(L *glua.LState) int {
+	// Get token purpose
+	purpose := L.Get(2)
+
+	// Check valid purpose
+	if purpose.Type() != glua.LTString {
+		L.ArgError(1, "Invalid purpose type. Expected string")
+		return 0
+	}
+
+	// Get token
+	token := L.Get(3)
+
+	// Check valid token
+	if token.Type() != glua.LTString {
+		L.Push(glua.LNil)
+		L.Push(glua.LString(util.ErrTokenInvalid.Error()))
+		return 2
+	}
+
+	claims, err := util.VerifyToken(purpose.String(), token.String())
+
+	if err != nil {
+		L.Push(glua.LNil)
+		L.Push(glua.LString(err.Error()))
+		return 2
+	}
+
+	// Get consume option
+	consume := true
+
+	if tbl, ok := L.Get(4).(*glua.LTable); ok {
+		if v := tbl.RawGetString("consume"); v != glua.LNil {
+			consume = glua.LVAsBool(v)
+		}
+	}
+
+	if claims.Once && consume {
+		ok, err := consumeToken(claims.ID, claims.Purpose, claims.Expires)
+
+		if err != nil {
+			L.RaiseError("Cannot consume token: %v", err)
+			return 0
+		}
+
+		if !ok {
+			L.Push(glua.LNil)
+			L.Push(glua.LString("Token already used"))
+			return 2
+		}
+	}
+
+	L.Push(MapToTable(claims.Data))
+
+	return 1
+}
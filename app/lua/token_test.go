@@ -0,0 +1,100 @@
+package lua
+
+import (
+	"testing"
+
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+func TestTokenVerifyConsumesSingleUseTokens(t *testing.T) {
+	util.Config.Configuration = &util.Configuration{
+		Token: util.TokenConfig{
+			Keys: []string{"current-token-key"},
+		},
+	}
+
+	defer func(consume func(string, string, int64) (bool, error)) {
+		consumeToken = consume
+	}(consumeToken)
+
+	// Keep the used token identifiers in memory
+	used := map[string]bool{}
+	consumeToken = func(id, purpose string, expires int64) (bool, error) {
+		if used[id] {
+			return false, nil
+		}
+
+		used[id] = true
+
+		return true, nil
+	}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{
+			name: "single-use token",
+			code: `
+				local t = token:sign("recover", {account = 5}, 60, {once = true})
+
+				local payload, err = token:verify("recover", t)
+				assert(payload ~= nil and payload.account == 5, "first use: " .. tostring(err))
+
+				payload, err = token:verify("recover", t)
+				assert(payload == nil and err == "Token already used", "second use: " .. tostring(err))
+			`,
+		},
+		{
+			name: "check without consuming",
+			code: `
+				local t = token:sign("recover", {account = 5}, 60, {once = true})
+
+				assert(token:verify("recover", t, {consume = false}) ~= nil, "check")
+				assert(token:verify("recover", t, {consume = false}) ~= nil, "second check")
+				assert(token:verify("recover", t) ~= nil, "use")
+				assert(token:verify("recover", t) == nil, "second use")
+			`,
+		},
+		{
+			name: "reusable token",
+			code: `
+				local t = token:sign("recover", {account = 5}, 60)
+
+				assert(token:verify("recover", t) ~= nil, "first use")
+				assert(token:verify("recover", t) ~= nil, "second use")
+			`,
+		},
+		{
+			name: "invalid tokens are not consumed",
+			code: `
+				local t = token:sign("recover", {account = 5}, 60, {once = true})
+
+				local payload, err = token:verify("unsubscribe", t)
+				assert(payload == nil and err == "Invalid token purpose", "purpose: " .. tostring(err))
+
+				payload, err = token:verify("recover", t .. "x")
+				assert(payload == nil and err == "Invalid token", "tampered: " .. tostring(err))
+
+				payload, err = token:verify("recover", 10)
+				assert(payload == nil and err == "Invalid token", "type: " .. tostring(err))
+
+				assert(token:verify("recover", t) ~= nil, "use")
+			`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			L := glua.NewState()
+			defer L.Close()
+
+			SetTokenMetaTable(L)
+
+			if err := L.DoString(test.code); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
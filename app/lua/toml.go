@@ -0,0 +1,102 @@
+package lua
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/BurntSushi/toml"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// SetTOMLMetaTable sets the toml metatable of the given state
+func SetTOMLMetaTable(luaState *glua.LState) {
+	// Create and set the toml metatable
+	tomlMetaTable := luaState.NewTypeMetatable(TOMLMetaTableName)
+	luaState.SetGlobal(TOMLMetaTableName, tomlMetaTable)
+
+	// Set all toml metatable functions
+	luaState.SetFuncs(tomlMetaTable, tomlMethods)
+}
+
+// EncodeTOML encodes the given lua table as toml
+func EncodeTOML(L *glua.LState) int {
+	// Get table
+	tbl := L.Get(2)
+
+	// Check for valid table type
+	if tbl.Type() != glua.LTTable {
+		L.ArgError(1, "Invalid encode object. Expected table")
+		return 0
+	}
+
+	// Toml documents must be tables
+	data, ok := codecValue(ValueToGo(tbl)).(map[string]interface{})
+
+	if !ok {
+		L.ArgError(1, "Invalid encode object. Expected table with string keys")
+		return 0
+	}
+
+	buff := &bytes.Buffer{}
+
+	if err := toml.NewEncoder(buff).Encode(data); err != nil {
+		L.RaiseError("Cannot encode the given table: %v", err)
+		return 0
+	}
+
+	// Push result as string
+	L.Push(glua.LString(buff.String()))
+
+	return 1
+}
+
+// decodeTOML decodes the given toml document and pushes the result table
+func decodeTOML(L *glua.LState, src []byte) int {
+	data := map[string]interface{}{}
+
+	if _, err := toml.Decode(string(src), &data); err != nil {
+		L.RaiseError("Cannot decode the given toml: %v", err)
+		return 0
+	}
+
+	// Push result as table
+	L.Push(MapToTable(data))
+
+	return 1
+}
+
+// DecodeTOML decodes the given string to a lua table
+func DecodeTOML(L *glua.LState) int {
+	// Get string
+	src := L.Get(2)
+
+	// Check for valid string type
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid decode source. Expected string")
+		return 0
+	}
+
+	return decodeTOML(L, []byte(src.String()))
+}
+
+// DecodeTOMLFile decodes the given file to a lua table
+func DecodeTOMLFile(L *glua.LState) int {
+	// Get file location
+	src := L.Get(2)
+
+	// Check for valid string type
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid decode source. Expected string")
+		return 0
+	}
+
+	// Read whole file
+	file, err := ioutil.ReadFile(src.String())
+
+	if err != nil {
+		L.RaiseError("Cannot read the given file: %v", err)
+		return 0
+	}
+
+	return decodeTOML(L, file)
+}
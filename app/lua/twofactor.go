@@ -0,0 +1,211 @@
+package lua
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// checkAccountID returns the account identifier argument at the given position
+func checkAccountID(L *glua.LState, n int) (int64, bool) {
+	id := L.Get(n)
+
+	if id.Type() != glua.LTNumber {
+		L.ArgError(n-1, "Invalid account identifier type. Expected number")
+		return 0, false
+	}
+
+	return int64(id.(glua.LNumber)), true
+}
+
+// ValidRecoveryCode checks and consumes a recovery code of the given account
+func ValidRecoveryCode(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get recovery code
+	code := L.Get(3)
+
+	if code.Type() != glua.LTString || code.String() == "" {
+		L.Push(glua.LFalse)
+		return 1
+	}
+
+	valid, err := models.UseRecoveryCode(id, util.HashRecoveryCode(code.String()))
+
+	if err != nil {
+		L.RaiseError("Cannot use recovery code: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LBool(valid))
+
+	return 1
+}
+
+// NewRecoveryCodes replaces the recovery codes of the given account returning the new codes.
+// Only the hashes are stored so the codes must be shown to the user right away
+func NewRecoveryCodes(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get number of codes
+	n := util.Config.Configuration.TwoFactor.RecoveryCodes
+
+	if n <= 0 {
+		n = 10
+	}
+
+	codes := util.NewRecoveryCodes(n)
+	hashes := make([]string, 0, len(codes))
+
+	for _, c := range codes {
+		hashes = append(hashes, util.HashRecoveryCode(c))
+	}
+
+	if err := models.SetRecoveryCodes(id, hashes); err != nil {
+		L.RaiseError("Cannot save recovery codes: %v", err)
+		return 0
+	}
+
+	L.Push(StringSliceToTable(codes))
+
+	return 1
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of the given account
+func RecoveryCodesLeft(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	n, err := models.RecoveryCodesLeft(id)
+
+	if err != nil {
+		L.RaiseError("Cannot get recovery codes: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LNumber(n))
+
+	return 1
+}
+
+// RememberDevice sets a signed cookie so the device skips the two-factor check
+func RememberDevice(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get two-factor secret
+	secret := L.Get(3)
+
+	if secret.Type() != glua.LTString {
+		L.ArgError(2, "Invalid secret type. Expected string")
+		return 0
+	}
+
+	token, err := util.RememberDeviceToken(id, secret.String())
+
+	if err != nil {
+		L.RaiseError("Cannot remember device: %v", err)
+		return 0
+	}
+
+	_, w := getRequestAndResponseWriter(L)
+
+	http.SetCookie(w, util.NewCookie(util.DeviceCookieName(), token, int(util.RememberDeviceDuration()/time.Second)))
+
+	return 0
+}
+
+// IsDeviceRemembered checks if the current device was remembered for the given account
+func IsDeviceRemembered(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get two-factor secret
+	secret := L.Get(3)
+
+	if secret.Type() != glua.LTString {
+		L.ArgError(2, "Invalid secret type. Expected string")
+		return 0
+	}
+
+	req, _ := getRequestAndResponseWriter(L)
+
+	cookie, err := req.Cookie(util.DeviceCookieName())
+
+	if err != nil {
+		L.Push(glua.LFalse)
+		return 1
+	}
+
+	L.Push(glua.LBool(util.IsDeviceRemembered(cookie.Value, id, secret.String())))
+
+	return 1
+}
+
+// ForgetDevice removes the remembered device cookie
+func ForgetDevice(L *glua.LState) int {
+	_, w := getRequestAndResponseWriter(L)
+
+	http.SetCookie(w, util.NewCookie(util.DeviceCookieName(), "", -1))
+
+	return 0
+}
+
+// RequestTwoFactorReset marks a verified two-factor reset request for the given account
+func RequestTwoFactorReset(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	if err := models.RequestTwoFactorReset(id); err != nil {
+		L.RaiseError("Cannot request two-factor reset: %v", err)
+		return 0
+	}
+
+	return 0
+}
+
+// ResetTwoFactor disables two-factor authentication for the given account
+func ResetTwoFactor(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	if err := models.ResetTwoFactor(id); err != nil {
+		L.RaiseError("Cannot reset two-factor: %v", err)
+		return 0
+	}
+
+	return 0
+}
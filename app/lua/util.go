@@ -3,6 +3,7 @@ package lua
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -68,8 +69,9 @@ func MapToTable(m map[string]interface{}) *lua.LTable {
 			// Create slice table
 			sliceTable := &lua.LTable{}
 
-			// Loop interface slice
-			for _, s := range element.([]interface{}) {
+			// Loop interface slice. Elements are set by position so nil
+			// elements do not shift the following ones
+			for i, s := range element.([]interface{}) {
 
 				// Switch interface type
 				switch s.(type) {
@@ -78,23 +80,28 @@ func MapToTable(m map[string]interface{}) *lua.LTable {
 					// Convert map to table
 					t := MapToTable(s.(map[string]interface{}))
 
-					// Append result
-					sliceTable.Append(t)
+					// Set result
+					sliceTable.RawSetInt(i+1, t)
 
 				case float64:
 
-					// Append result as number
-					sliceTable.Append(lua.LNumber(s.(float64)))
+					// Set result as number
+					sliceTable.RawSetInt(i+1, lua.LNumber(s.(float64)))
 
 				case string:
 
-					// Append result as string
-					sliceTable.Append(lua.LString(s.(string)))
+					// Set result as string
+					sliceTable.RawSetInt(i+1, lua.LString(s.(string)))
 
 				case bool:
 
-					// Append result as bool
-					sliceTable.Append(lua.LBool(s.(bool)))
+					// Set result as bool
+					sliceTable.RawSetInt(i+1, lua.LBool(s.(bool)))
+
+				default:
+
+					// Set remaining types using the generic conversion
+					sliceTable.RawSetInt(i+1, GoToValue(s))
 				}
 			}
 
@@ -277,6 +284,90 @@ func ValueToGo(lv lua.LValue) interface{} {
 	}
 }
 
+// GoToValue converts a decoded go value to a lua value using the same type mapping as MapToTable
+func GoToValue(v interface{}) lua.LValue {
+	switch val := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(val)
+	case string:
+		return lua.LString(val)
+	case []byte:
+		return lua.LString(string(val))
+	case float64:
+		return lua.LNumber(val)
+	case float32:
+		return lua.LNumber(val)
+	case int:
+		return lua.LNumber(val)
+	case int64:
+		return lua.LNumber(val)
+	case uint64:
+		return lua.LNumber(val)
+	case time.Time:
+		return lua.LNumber(val.Unix())
+	case map[string]interface{}:
+		return MapToTable(val)
+	case []map[string]interface{}:
+		tbl := &lua.LTable{}
+
+		for _, m := range val {
+			tbl.Append(MapToTable(m))
+		}
+
+		return tbl
+	case []interface{}:
+		tbl := &lua.LTable{}
+
+		// Set elements by position so nil elements do not shift the following ones
+		for i, e := range val {
+			tbl.RawSetInt(i+1, GoToValue(e))
+		}
+
+		return tbl
+	}
+
+	return lua.LNil
+}
+
+// codecValue prepares a value returned by ValueToGo for text encoders. Whole numbers are
+// encoded as integers and lists of tables as lists of maps
+func codecValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int64(val)
+		}
+
+		return val
+	case map[string]interface{}:
+		for k, e := range val {
+			val[k] = codecValue(e)
+		}
+
+		return val
+	case []interface{}:
+		maps := make([]map[string]interface{}, 0, len(val))
+
+		for i, e := range val {
+			val[i] = codecValue(e)
+
+			if m, ok := val[i].(map[string]interface{}); ok {
+				maps = append(maps, m)
+			}
+		}
+
+		if len(val) > 0 && len(maps) == len(val) {
+			return maps
+		}
+
+		return val
+	}
+
+	return v
+}
+
 // MergeTableFields merges two tables into one
 func MergeTableFields(src *lua.LTable, dest *lua.LTable) {
 	src.ForEach(func(k lua.LValue, v lua.LValue) {
@@ -0,0 +1,72 @@
+package lua
+
+import (
+	"testing"
+
+	glua "github.com/yuin/gopher-lua"
+)
+
+func TestGoToValueKeepsNilPositions(t *testing.T) {
+	tbl, ok := GoToValue([]interface{}{"a", nil, int64(3), nil, true}).(*glua.LTable)
+
+	if !ok {
+		t.Fatal("Expected a table")
+	}
+
+	expected := []glua.LValue{glua.LString("a"), glua.LNil, glua.LNumber(3), glua.LNil, glua.LTrue}
+
+	for i, v := range expected {
+		if got := tbl.RawGetInt(i + 1); got != v {
+			t.Errorf("Element %v: expected %v, got %v", i+1, v, got)
+		}
+	}
+
+	if tbl.Len() != len(expected) {
+		t.Errorf("Expected length %v, got %v", len(expected), tbl.Len())
+	}
+}
+
+func TestMapToTableKeepsNilPositions(t *testing.T) {
+	tbl := MapToTable(map[string]interface{}{
+		"list": []interface{}{nil, 1.0, "b", int64(4)},
+	})
+
+	list, ok := tbl.RawGetString("list").(*glua.LTable)
+
+	if !ok {
+		t.Fatal("Expected a list table")
+	}
+
+	expected := []glua.LValue{glua.LNil, glua.LNumber(1), glua.LString("b"), glua.LNumber(4)}
+
+	for i, v := range expected {
+		if got := list.RawGetInt(i + 1); got != v {
+			t.Errorf("Element %v: expected %v, got %v", i+1, v, got)
+		}
+	}
+}
+
+func TestYAMLKeepsNilPositions(t *testing.T) {
+	L := glua.NewState()
+	defer L.Close()
+
+	SetYAMLMetaTable(L)
+
+	err := L.DoString(`
+		local data = yaml:decode("list: [first, null, third]")
+
+		assert(data.list[1] == "first", "first element")
+		assert(data.list[2] == nil, "second element")
+		assert(data.list[3] == "third", "third element")
+		assert(#data.list == 3, "list length")
+
+		local again = yaml:decode(yaml:encode(data))
+
+		assert(again.list[2] == nil, "encoded second element")
+		assert(again.list[3] == "third", "encoded third element")
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,393 @@
+package lua
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/raggaer/castro/app/database"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// validationRule function used by the declarative validator. Rules receive the field value,
+// the rule argument (the text after the colon) and all the form values
+type validationRule func(L *glua.LState, value, arg string, values map[string]string) (bool, error)
+
+var (
+	// validationRules built-in rules of the declarative validator
+	validationRules = map[string]validationRule{
+		"required": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return strings.TrimSpace(value) != "", nil
+		},
+		"email": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsEmail(value), nil
+		},
+		"url": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsURL(value), nil
+		},
+		"alpha": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsAlpha(value), nil
+		},
+		"alphanumeric": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsAlphanumeric(value), nil
+		},
+		"int": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsInt(value), nil
+		},
+		"number": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return govalidator.IsFloat(value), nil
+		},
+		"min": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			n, err := strconv.Atoi(arg)
+			return utf8.RuneCountInString(value) >= n, err
+		},
+		"max": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			n, err := strconv.Atoi(arg)
+			return utf8.RuneCountInString(value) <= n, err
+		},
+		"in": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			for _, v := range strings.Split(arg, ",") {
+				if strings.TrimSpace(v) == value {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+		"matches": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return regexp.MatchString(arg, value)
+		},
+		"same": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return values[arg] == value, nil
+		},
+		"username": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return isValidUsername(value)
+		},
+		"guildname": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return isValidGuildName(value)
+		},
+		"guildrank": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return isValidGuildRank(value)
+		},
+		"gender": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			return value == "0" || value == "1", nil
+		},
+		"town": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			if id, err := strconv.ParseUint(value, 10, 32); err == nil && isValidTown(glua.LNumber(id)) {
+				return true, nil
+			}
+
+			return isValidTown(glua.LString(value)), nil
+		},
+		"vocation": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			if id, err := strconv.Atoi(value); err == nil && isValidVocation(glua.LNumber(id), false) {
+				return isValidVocation(glua.LNumber(id), arg == "base"), nil
+			}
+
+			return isValidVocation(glua.LString(value), arg == "base"), nil
+		},
+		"unique": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			count, err := countColumnValue(arg, value)
+			return count == 0, err
+		},
+		"exists": func(L *glua.LState, value, arg string, values map[string]string) (bool, error) {
+			count, err := countColumnValue(arg, value)
+			return count > 0, err
+		},
+	}
+
+	// validationMessages default english messages of the built-in rules. Language files
+	// can overwrite them using the validation.<rule> index
+	validationMessages = map[string]string{
+		"required":     "%[1]s is required",
+		"email":        "%[1]s must be a valid email address",
+		"url":          "%[1]s must be a valid url",
+		"alpha":        "%[1]s can only contain letters",
+		"alphanumeric": "%[1]s can only contain letters and numbers",
+		"int":          "%[1]s must be an integer",
+		"number":       "%[1]s must be a number",
+		"min":          "%[1]s must be at least %[2]s characters long",
+		"max":          "%[1]s must be at most %[2]s characters long",
+		"in":           "%[1]s must be one of %[2]s",
+		"matches":      "%[1]s has an invalid format",
+		"same":         "%[1]s must match %[2]s",
+		"username":     "%[1]s can only contain letters and spaces",
+		"guildname":    "%[1]s must be a valid guild name",
+		"guildrank":    "%[1]s must be a valid guild rank",
+		"gender":       "%[1]s must be a valid gender",
+		"town":         "%[1]s must be a valid town",
+		"vocation":     "%[1]s must be a valid vocation",
+		"unique":       "%[1]s is already in use",
+		"exists":       "%[1]s does not exist",
+		"invalid":      "%[1]s is not valid",
+	}
+
+	// customValidationRules compiled rules registered by extensions using validator:rule
+	customValidationRules = map[string]*glua.FunctionProto{}
+	customValidationMutex = sync.RWMutex{}
+
+	// validColumnName regular expression used to check unique and exists rule arguments
+	validColumnName = regexp.MustCompile("^[a-zA-Z0-9_]+\\.[a-zA-Z0-9_]+$")
+)
+
+// countColumnValue counts the rows of table.column matching the given value
+func countColumnValue(column, value string) (int, error) {
+	if !validColumnName.MatchString(column) {
+		return 0, fmt.Errorf("Invalid column %v. Expected table.column", column)
+	}
+
+	parts := strings.Split(column, ".")
+	count := 0
+
+	err := database.DB.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM `%s` WHERE `%s` = ?", parts[0], parts[1]), value)
+
+	return count, err
+}
+
+// validationMessage returns the translated error message of the given rule
+func validationMessage(L *glua.LState, rule, field, arg string) string {
+	// Get request languages
+	languages := []string{}
+
+	if tbl, ok := L.GetField(L.GetTypeMetatable(I18nMetaTableName), "Language").(*glua.LTable); ok {
+		tbl.ForEach(func(_ glua.LValue, v glua.LValue) {
+			languages = append(languages, strings.Split(v.String(), ";")[0])
+		})
+	}
+
+	languages = append(languages, "default")
+
+	// Search rule message on the language files
+	for _, lang := range languages {
+		if file, ok := util.LanguageFiles.Get(lang); ok {
+			if msg, ok := file.Data["validation."+rule]; ok {
+				return fmt.Sprintf(msg, field, arg)
+			}
+		}
+	}
+
+	msg, ok := validationMessages[rule]
+
+	if !ok {
+		msg = validationMessages["invalid"]
+	}
+
+	return fmt.Sprintf(msg, field, arg)
+}
+
+// runCustomRule executes a rule registered by an extension on its own state
+func runCustomRule(proto *glua.FunctionProto, value, arg string, values map[string]string) (bool, string, error) {
+	// Get state from the pool
+	state := Pool.Get()
+	defer Pool.Put(state)
+
+	// Execute rule file
+	if err := DoCompiledFile(state, proto); err != nil {
+		return false, "", err
+	}
+
+	// Remove rule function from the pooled state
+	defer state.SetGlobal("rule", glua.LNil)
+
+	// Convert form values
+	tbl := state.NewTable()
+
+	for k, v := range values {
+		tbl.RawSetString(k, glua.LString(v))
+	}
+
+	// Call rule function
+	if err := state.CallByParam(glua.P{
+		Fn:      state.GetGlobal("rule"),
+		NRet:    2,
+		Protect: true,
+	}, glua.LString(value), glua.LString(arg), tbl); err != nil {
+		return false, "", err
+	}
+
+	valid := glua.LVAsBool(state.Get(-2))
+	msg := state.Get(-1)
+	state.Pop(2)
+
+	if msg.Type() == glua.LTString {
+		return valid, msg.String(), nil
+	}
+
+	return valid, "", nil
+}
+
+// schemaRules returns the rule list of a schema field. Rules can be a table or a pipe separated string
+func schemaRules(v glua.LValue) []string {
+	rules := []string{}
+
+	switch r := v.(type) {
+	case glua.LString:
+		for _, rule := range strings.Split(string(r), "|") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				rules = append(rules, rule)
+			}
+		}
+	case *glua.LTable:
+		for i := 1; i <= r.Len(); i++ {
+			rules = append(rules, r.RawGetInt(i).String())
+		}
+	}
+
+	return rules
+}
+
+// CheckSchema validates a table of values against a schema of rules returning the errors of each field
+func CheckSchema(L *glua.LState) int {
+	// Get values table
+	valuesTable := L.Get(2)
+
+	// Check valid values table
+	if valuesTable.Type() != glua.LTTable && valuesTable.Type() != glua.LTNil {
+		L.ArgError(1, "Invalid values type. Expected table")
+		return 0
+	}
+
+	// Get schema table
+	schema := L.Get(3)
+
+	// Check valid schema table
+	if schema.Type() != glua.LTTable {
+		L.ArgError(2, "Invalid schema type. Expected table")
+		return 0
+	}
+
+	// Convert values to strings
+	values := map[string]string{}
+
+	if tbl, ok := valuesTable.(*glua.LTable); ok {
+		tbl.ForEach(func(k glua.LValue, v glua.LValue) {
+			if _, ok := v.(*glua.LTable); !ok {
+				values[k.String()] = v.String()
+			}
+		})
+	}
+
+	errors := L.NewTable()
+	valid := true
+
+	schema.(*glua.LTable).ForEach(func(k glua.LValue, v glua.LValue) {
+		field := k.String()
+		value := values[field]
+		fieldErrors := L.NewTable()
+
+		for _, rule := range schemaRules(v) {
+			// Split rule name and argument
+			parts := strings.SplitN(rule, ":", 2)
+			name := parts[0]
+			arg := ""
+
+			if len(parts) == 2 {
+				arg = parts[1]
+			}
+
+			// Optional fields skip the remaining rules
+			if name != "required" && value == "" {
+				continue
+			}
+
+			// Check custom rule
+			customValidationMutex.RLock()
+			proto, custom := customValidationRules[name]
+			customValidationMutex.RUnlock()
+
+			if custom {
+				ok, msg, err := runCustomRule(proto, value, arg, values)
+
+				if err != nil {
+					L.RaiseError("Cannot execute %v validation rule: %v", name, err)
+					return
+				}
+
+				if !ok {
+					if msg == "" {
+						msg = validationMessage(L, name, field, arg)
+					}
+
+					fieldErrors.Append(glua.LString(msg))
+				}
+
+				continue
+			}
+
+			// Check built-in rule
+			var ok bool
+			var err error
+
+			if fn, exists := validationRules[name]; exists {
+				ok, err = fn(L, value, arg, values)
+			} else if fn, exists := methods[name]; exists {
+				ok = fn(value)
+			} else {
+				L.RaiseError("Unknown validation rule %v", name)
+				return
+			}
+
+			if err != nil {
+				L.RaiseError("Cannot execute %v validation rule: %v", name, err)
+				return
+			}
+
+			if !ok {
+				fieldErrors.Append(glua.LString(validationMessage(L, name, field, arg)))
+			}
+		}
+
+		if fieldErrors.Len() > 0 {
+			valid = false
+			errors.RawSetString(field, fieldErrors)
+		}
+	})
+
+	// Push validation result and errors
+	L.Push(glua.LBool(valid))
+	L.Push(errors)
+
+	return 2
+}
+
+// RegisterValidationRule registers a custom validation rule. The rule file must declare a
+// rule(value, argument, values) function returning true or false and an optional error message
+func RegisterValidationRule(L *glua.LState) int {
+	// Get rule name
+	name := L.Get(2)
+
+	// Check valid name
+	if name.Type() != glua.LTString {
+		L.ArgError(1, "Invalid rule name type. Expected string")
+		return 0
+	}
+
+	// Get rule path
+	path := L.Get(3)
+
+	// Check valid path
+	if path.Type() != glua.LTString {
+		L.ArgError(2, "Invalid rule path type. Expected string")
+		return 0
+	}
+
+	// Compile rule file
+	proto, err := CompileLua(path.String())
+
+	if err != nil {
+		L.RaiseError("Cannot compile validation rule: %v", err)
+		return 0
+	}
+
+	// Lock mutex
+	customValidationMutex.Lock()
+	defer customValidationMutex.Unlock()
+
+	customValidationRules[name.String()] = proto
+
+	return 0
+}
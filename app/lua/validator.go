@@ -4,9 +4,11 @@ import (
 	"regexp"
 
 	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/dgryski/dgoogauth"
+	"github.com/raggaer/castro/app/models"
 	"github.com/raggaer/castro/app/util"
 	"github.com/yuin/gopher-lua"
 )
@@ -36,7 +38,8 @@ func SetValidatorMetaTable(luaState *lua.LState) {
 	luaState.SetFuncs(validMetaTable, validatorMethods)
 }
 
-// CheckQRCode checks if the given QR token is valid for the given secret key
+// CheckQRCode checks if the given QR token is valid for the given secret key. When an
+// account identifier is given already used tokens are rejected
 func CheckQRCode(L *lua.LState) int {
 	// Get token
 	token := L.ToString(2)
@@ -44,6 +47,26 @@ func CheckQRCode(L *lua.LState) int {
 	// Get secret key
 	secret := L.ToString(3)
 
+	// Check token replay
+	if account, ok := L.Get(4).(lua.LNumber); ok {
+		step, valid := util.TOTPStep(secret, token, time.Now())
+
+		if !valid {
+			L.Push(lua.LBool(false))
+			return 1
+		}
+
+		unused, err := models.UseTOTPStep(int64(account), step)
+
+		if err != nil {
+			L.RaiseError("Cannot save token step: %v", err)
+			return 0
+		}
+
+		L.Push(lua.LBool(unused))
+		return 1
+	}
+
 	// Create two-factor config
 	otpConfig := &dgoogauth.OTPConfig{
 		Secret:      secret,
@@ -101,14 +124,8 @@ func ValidGuildName(L *lua.LState) int {
 		return 0
 	}
 
-	// Check guild name length
-	if len(v.String()) < 5 || len(v.String()) > 20 {
-		L.Push(lua.LBool(false))
-		return 1
-	}
-
-	// Check against regexp
-	match, err := regexp.MatchString("^[a-zA-Z ]+$", v.String())
+	// Check guild name
+	match, err := isValidGuildName(v.String())
 
 	if err != nil {
 		L.RaiseError("Cannot compare string against regexp: %v", err)
@@ -120,6 +137,17 @@ func ValidGuildName(L *lua.LState) int {
 	return 1
 }
 
+// isValidGuildName checks the guild name length and characters
+func isValidGuildName(name string) (bool, error) {
+	// Check guild name length
+	if len(name) < 5 || len(name) > 20 {
+		return false, nil
+	}
+
+	// Check against regexp
+	return regexp.MatchString("^[a-zA-Z ]+$", name)
+}
+
 // ValidGuildRank checks if the given rank is valid
 func ValidGuildRank(L *lua.LState) int {
 	// Get string to validate
@@ -132,14 +160,8 @@ func ValidGuildRank(L *lua.LState) int {
 		return 0
 	}
 
-	// Check guild rank length
-	if len(v.String()) < 5 || len(v.String()) > 15 {
-		L.Push(lua.LBool(false))
-		return 1
-	}
-
-	// Check against regexp
-	match, err := regexp.MatchString("^[a-zA-Z- ]+$", v.String())
+	// Check guild rank
+	match, err := isValidGuildRank(v.String())
 
 	if err != nil {
 		L.RaiseError("Cannot compare string against regexp: %v", err)
@@ -151,6 +173,17 @@ func ValidGuildRank(L *lua.LState) int {
 	return 1
 }
 
+// isValidGuildRank checks the guild rank length and characters
+func isValidGuildRank(rank string) (bool, error) {
+	// Check guild rank length
+	if len(rank) < 5 || len(rank) > 15 {
+		return false, nil
+	}
+
+	// Check against regexp
+	return regexp.MatchString("^[a-zA-Z- ]+$", rank)
+}
+
 // ValidVocation checks if the given vocation exists
 func ValidVocation(L *lua.LState) int {
 	// Get vocation value
@@ -166,11 +199,20 @@ func ValidVocation(L *lua.LState) int {
 		return 0
 	}
 
+	// Push vocation result
+	L.Push(lua.LBool(isValidVocation(voc, base)))
+
+	return 1
+}
+
+// isValidVocation checks if the given vocation exists. Numbers are used as the vocation
+// identifier and strings as the vocation name
+func isValidVocation(voc lua.LValue, base bool) bool {
 	// If vocation is number we assume its the vocation id
 	if voc.Type() == lua.LTNumber {
 
 		// Convert vocation to int
-		vocid := L.ToInt(2)
+		vocid := int(lua.LVAsNumber(voc))
 
 		// Loop vocation list
 		for _, voc := range util.ServerVocationList.List.Vocations {
@@ -178,36 +220,16 @@ func ValidVocation(L *lua.LState) int {
 			// If we find the vocation we are looking for
 			if voc.ID == vocid {
 
-				if base {
-
-					// If its a base vocation return true
-					if voc.FromVoc == voc.ID {
-
-						// Vocation is found push true
-						L.Push(lua.LBool(true))
-
-						return 1
-					}
-
-					L.Push(lua.LBool(false))
-
-					return 1
-				}
-
-				// Vocation is found push true
-				L.Push(lua.LBool(true))
-
-				return 1
+				// If its a base vocation return true
+				return !base || voc.FromVoc == voc.ID
 			}
 		}
 
-		L.Push(lua.LBool(false))
-
-		return 1
+		return false
 	}
 
 	// If vocation is string we assume its the vocation name
-	vocname := L.ToString(2)
+	vocname := voc.String()
 
 	// Loop vocation list
 	for _, voc := range util.ServerVocationList.List.Vocations {
@@ -215,32 +237,12 @@ func ValidVocation(L *lua.LState) int {
 		// If we find the vocation we are looking for
 		if voc.Name == vocname {
 
-			if base {
-
-				// If its a base vocation return true
-				if voc.FromVoc == voc.ID {
-
-					// Vocation is found push true
-					L.Push(lua.LBool(true))
-
-					return 1
-				}
-
-				L.Push(lua.LBool(false))
-
-				return 1
-			}
-
-			// Vocation is found push true
-			L.Push(lua.LBool(true))
-
-			return 1
+			// If its a base vocation return true
+			return !base || voc.FromVoc == voc.ID
 		}
 	}
 
-	L.Push(lua.LBool(false))
-
-	return 1
+	return false
 }
 
 // ValidTown checks if the given town exists
@@ -255,49 +257,46 @@ func ValidTown(L *lua.LState) int {
 		return 0
 	}
 
+	// Push town result
+	L.Push(lua.LBool(isValidTown(town)))
+
+	return 1
+}
+
+// isValidTown checks if the given town exists. Numbers are used as the town identifier
+// and strings as the town name
+func isValidTown(town lua.LValue) bool {
 	// If town is number we assume its the town id
 	if town.Type() == lua.LTNumber {
 
 		// Convert town id to uint32
-		townid := uint32(L.ToInt(2))
+		townid := uint32(lua.LVAsNumber(town))
 
 		// Check if town exists
 		for _, town := range util.OTBMap.Map.Towns {
 
 			// If its the town we are looking for
 			if town.ID == townid {
-
-				// Town is found push true
-				L.Push(lua.LBool(true))
-
-				return 1
+				return true
 			}
 		}
 
-		L.Push(lua.LBool(false))
-
-		return 1
+		return false
 	}
 
 	// If town is string we assume its the town name
-	townName := L.ToString(2)
+	townName := town.String()
 
 	// Check if town exists
 	for _, town := range util.OTBMap.Map.Towns {
 
 		// If its the town we are looking for
 		if town.Name == townName {
-
-			// Town is found push true
-			L.Push(lua.LBool(true))
-
-			return 1
+			return true
 		}
 	}
 
-	L.Push(lua.LBool(false))
-
-	return 1
+	return false
 }
 
 // ValidUsername checks if the given username contains only letters and spaces
@@ -313,7 +312,7 @@ func ValidUsername(L *lua.LState) int {
 	}
 
 	// Check against regexp
-	match, err := regexp.MatchString("^[a-zA-Z ]+$", v.String())
+	match, err := isValidUsername(v.String())
 
 	if err != nil {
 		L.RaiseError("Cannot compare string against regexp: %v", err)
@@ -325,6 +324,11 @@ func ValidUsername(L *lua.LState) int {
 	return 1
 }
 
+// isValidUsername checks if the given name contains only letters and spaces
+func isValidUsername(name string) (bool, error) {
+	return regexp.MatchString("^[a-zA-Z ]+$", name)
+}
+
 // Validate executes the given govalidator func and returns its output
 func Validate(L *lua.LState) int {
 	// Get function name
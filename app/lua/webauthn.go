@@ -0,0 +1,443 @@
+package lua
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	glua "github.com/yuin/gopher-lua"
+)
+
+// webAuthnSessionKey session key used to store the pending ceremony challenge
+const webAuthnSessionKey = "webauthn-challenge"
+
+// SetWebAuthnMetaTable sets the webauthn metatable of the given state
+func SetWebAuthnMetaTable(luaState *glua.LState) {
+	// Create and set the webauthn metatable
+	webAuthnMetaTable := luaState.NewTypeMetatable(WebAuthnMetaTableName)
+	luaState.SetGlobal(WebAuthnMetaTableName, webAuthnMetaTable)
+
+	// Set all webauthn metatable functions
+	luaState.SetFuncs(webAuthnMetaTable, webAuthnMethods)
+}
+
+// webAuthnUserHandle returns the user handle of the given account
+func webAuthnUserHandle(accountID int64) string {
+	return util.EncodeWebAuthn([]byte(strconv.FormatInt(accountID, 10)))
+}
+
+// newWebAuthnChallenge creates a new ceremony challenge and stores it on the session
+func newWebAuthnChallenge(L *glua.LState, ceremony string, accountID int64) string {
+	challenge, err := util.NewWebAuthnChallenge()
+
+	if err != nil {
+		L.RaiseError("Cannot create WebAuthn challenge: %v", err)
+		return ""
+	}
+
+	encoded := util.EncodeWebAuthn(challenge)
+
+	getSessionData(L)[webAuthnSessionKey] = map[string]interface{}{
+		"challenge": encoded,
+		"ceremony":  ceremony,
+		"account":   accountID,
+		"expires":   time.Now().Add(util.Config.Configuration.RelyingParty().Timeout).Unix(),
+	}
+
+	updateSessionData(L)
+
+	return encoded
+}
+
+// consumeWebAuthnChallenge removes the pending ceremony challenge from the session. Challenges
+// can only be used once even if the ceremony fails
+func consumeWebAuthnChallenge(L *glua.LState, ceremony string) ([]byte, int64, bool) {
+	session := getSessionData(L)
+
+	pending, ok := session[webAuthnSessionKey].(map[string]interface{})
+
+	if !ok {
+		return nil, 0, false
+	}
+
+	delete(session, webAuthnSessionKey)
+	updateSessionData(L)
+
+	encoded, _ := pending["challenge"].(string)
+	kind, _ := pending["ceremony"].(string)
+	accountID, _ := pending["account"].(int64)
+	expires, _ := pending["expires"].(int64)
+
+	if kind != ceremony || expires < time.Now().Unix() {
+		return nil, 0, false
+	}
+
+	challenge, err := util.DecodeWebAuthn(encoded)
+
+	if err != nil {
+		return nil, 0, false
+	}
+
+	return challenge, accountID, true
+}
+
+// webAuthnResponseField returns a binary field of a credential response table. Fields are read
+// from the nested response table of a serialized PublicKeyCredential or from the table itself
+func webAuthnResponseField(tbl *glua.LTable, field string) ([]byte, bool) {
+	src := tbl
+
+	if inner, ok := tbl.RawGetString("response").(*glua.LTable); ok {
+		src = inner
+	}
+
+	v, ok := src.RawGetString(field).(glua.LString)
+
+	if !ok {
+		return nil, false
+	}
+
+	data, err := util.DecodeWebAuthn(string(v))
+
+	return data, err == nil
+}
+
+// webAuthnFailure pushes a nil result and the given error message
+func webAuthnFailure(L *glua.LState, msg string) int {
+	L.Push(glua.LNil)
+	L.Push(glua.LString(msg))
+	return 2
+}
+
+// webAuthnCredentialDescriptors returns the credential descriptors of the given account
+func webAuthnCredentialDescriptors(L *glua.LState, accountID int64) *glua.LTable {
+	list := L.NewTable()
+
+	credentials, err := models.GetWebAuthnCredentials(accountID)
+
+	if err != nil {
+		L.RaiseError("Cannot get WebAuthn credentials: %v", err)
+		return list
+	}
+
+	for _, c := range credentials {
+		descriptor := L.NewTable()
+		descriptor.RawSetString("type", glua.LString("public-key"))
+		descriptor.RawSetString("id", glua.LString(c.Credential_id))
+		list.Append(descriptor)
+	}
+
+	return list
+}
+
+// WebAuthnRegisterOptions starts a registration ceremony returning the credential creation options
+func WebAuthnRegisterOptions(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get account name
+	name := L.Get(3)
+
+	if name.Type() != glua.LTString {
+		L.ArgError(2, "Invalid account name type. Expected string")
+		return 0
+	}
+
+	rp := util.Config.Configuration.RelyingParty()
+
+	options := L.NewTable()
+	options.RawSetString("challenge", glua.LString(newWebAuthnChallenge(L, "register", id)))
+	options.RawSetString("timeout", glua.LNumber(rp.Timeout/time.Millisecond))
+	options.RawSetString("attestation", glua.LString("none"))
+
+	rpTable := L.NewTable()
+	rpTable.RawSetString("id", glua.LString(rp.ID))
+	rpTable.RawSetString("name", glua.LString(rp.Name))
+	options.RawSetString("rp", rpTable)
+
+	user := L.NewTable()
+	user.RawSetString("id", glua.LString(webAuthnUserHandle(id)))
+	user.RawSetString("name", name)
+	user.RawSetString("displayName", name)
+	options.RawSetString("user", user)
+
+	params := L.NewTable()
+
+	for _, alg := range util.WebAuthnAlgorithms {
+		param := L.NewTable()
+		param.RawSetString("type", glua.LString("public-key"))
+		param.RawSetString("alg", glua.LNumber(alg))
+		params.Append(param)
+	}
+
+	options.RawSetString("pubKeyCredParams", params)
+	options.RawSetString("excludeCredentials", webAuthnCredentialDescriptors(L, id))
+
+	selection := L.NewTable()
+	selection.RawSetString("residentKey", glua.LString("preferred"))
+	selection.RawSetString("userVerification", glua.LString(rp.UserVerification))
+	options.RawSetString("authenticatorSelection", selection)
+
+	L.Push(options)
+
+	return 1
+}
+
+// WebAuthnRegister finishes a registration ceremony saving the new passkey. Returns the
+// credential identifier or nil and an error message
+func WebAuthnRegister(L *glua.LState) int {
+	// Get credential response
+	response, ok := L.Get(2).(*glua.LTable)
+
+	if !ok {
+		L.ArgError(1, "Invalid credential response type. Expected table")
+		return 0
+	}
+
+	// Get passkey name
+	name := "Passkey"
+
+	if v, ok := L.Get(3).(glua.LString); ok && v != "" {
+		name = string(v)
+	}
+
+	challenge, accountID, ok := consumeWebAuthnChallenge(L, "register")
+
+	if !ok {
+		return webAuthnFailure(L, util.ErrWebAuthnChallenge.Error())
+	}
+
+	clientData, ok := webAuthnResponseField(response, "clientDataJSON")
+
+	if !ok {
+		return webAuthnFailure(L, "Missing client data")
+	}
+
+	attestation, ok := webAuthnResponseField(response, "attestationObject")
+
+	if !ok {
+		return webAuthnFailure(L, "Missing attestation object")
+	}
+
+	credential, err := util.Config.Configuration.RelyingParty().VerifyWebAuthnRegistration(challenge, clientData, attestation)
+
+	if err != nil {
+		return webAuthnFailure(L, err.Error())
+	}
+
+	credentialID := util.EncodeWebAuthn(credential.ID)
+
+	existing, err := models.GetWebAuthnCredential(credentialID)
+
+	if err != nil {
+		L.RaiseError("Cannot get WebAuthn credential: %v", err)
+		return 0
+	}
+
+	if existing != nil {
+		return webAuthnFailure(L, "Passkey already registered")
+	}
+
+	if err := models.CreateWebAuthnCredential(accountID, credentialID, credential.PublicKey, credential.SignCount, name); err != nil {
+		L.RaiseError("Cannot save WebAuthn credential: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LString(credentialID))
+
+	return 1
+}
+
+// WebAuthnLoginOptions starts a login ceremony returning the credential request options. Without
+// an account the ceremony uses discoverable credentials for passwordless login
+func WebAuthnLoginOptions(L *glua.LState) int {
+	var id int64
+
+	if L.Get(2) != glua.LNil {
+		accountID, ok := checkAccountID(L, 2)
+
+		if !ok {
+			return 0
+		}
+
+		id = accountID
+	}
+
+	rp := util.Config.Configuration.RelyingParty()
+
+	options := L.NewTable()
+	options.RawSetString("challenge", glua.LString(newWebAuthnChallenge(L, "login", id)))
+	options.RawSetString("timeout", glua.LNumber(rp.Timeout/time.Millisecond))
+	options.RawSetString("rpId", glua.LString(rp.ID))
+	options.RawSetString("userVerification", glua.LString(rp.UserVerification))
+
+	if id != 0 {
+		options.RawSetString("allowCredentials", webAuthnCredentialDescriptors(L, id))
+	} else {
+		options.RawSetString("allowCredentials", L.NewTable())
+	}
+
+	L.Push(options)
+
+	return 1
+}
+
+// WebAuthnLogin finishes a login ceremony. Returns the account identifier of the passkey
+// or nil and an error message
+func WebAuthnLogin(L *glua.LState) int {
+	// Get credential response
+	response, ok := L.Get(2).(*glua.LTable)
+
+	if !ok {
+		L.ArgError(1, "Invalid credential response type. Expected table")
+		return 0
+	}
+
+	challenge, accountID, ok := consumeWebAuthnChallenge(L, "login")
+
+	if !ok {
+		return webAuthnFailure(L, util.ErrWebAuthnChallenge.Error())
+	}
+
+	rawID, ok := response.RawGetString("rawId").(glua.LString)
+
+	if !ok {
+		rawID, ok = response.RawGetString("id").(glua.LString)
+	}
+
+	if !ok {
+		return webAuthnFailure(L, "Missing credential identifier")
+	}
+
+	decodedID, err := util.DecodeWebAuthn(string(rawID))
+
+	if err != nil {
+		return webAuthnFailure(L, "Invalid credential identifier")
+	}
+
+	stored, err := models.GetWebAuthnCredential(util.EncodeWebAuthn(decodedID))
+
+	if err != nil {
+		L.RaiseError("Cannot get WebAuthn credential: %v", err)
+		return 0
+	}
+
+	if stored == nil || (accountID != 0 && stored.Account_id != accountID) {
+		return webAuthnFailure(L, "Unknown passkey")
+	}
+
+	// Discoverable credentials return the user handle set on registration
+	if handle, ok := webAuthnResponseField(response, "userHandle"); ok && len(handle) > 0 {
+		if util.EncodeWebAuthn(handle) != webAuthnUserHandle(stored.Account_id) {
+			return webAuthnFailure(L, "Unknown passkey")
+		}
+	}
+
+	clientData, ok := webAuthnResponseField(response, "clientDataJSON")
+
+	if !ok {
+		return webAuthnFailure(L, "Missing client data")
+	}
+
+	authData, ok := webAuthnResponseField(response, "authenticatorData")
+
+	if !ok {
+		return webAuthnFailure(L, "Missing authenticator data")
+	}
+
+	signature, ok := webAuthnResponseField(response, "signature")
+
+	if !ok {
+		return webAuthnFailure(L, "Missing signature")
+	}
+
+	signCount, err := util.Config.Configuration.RelyingParty().VerifyWebAuthnAssertion(
+		challenge,
+		&util.WebAuthnCredential{
+			ID:        decodedID,
+			PublicKey: stored.Public_key,
+			SignCount: uint32(stored.Sign_count),
+		},
+		clientData,
+		authData,
+		signature,
+	)
+
+	if err != nil {
+		return webAuthnFailure(L, err.Error())
+	}
+
+	if err := models.UseWebAuthnCredential(stored.ID, signCount); err != nil {
+		L.RaiseError("Cannot update WebAuthn credential: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LNumber(stored.Account_id))
+
+	return 1
+}
+
+// WebAuthnCredentials returns the passkeys of the given account
+func WebAuthnCredentials(L *glua.LState) int {
+	// Get account identifier
+	id, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	credentials, err := models.GetWebAuthnCredentials(id)
+
+	if err != nil {
+		L.RaiseError("Cannot get WebAuthn credentials: %v", err)
+		return 0
+	}
+
+	list := L.NewTable()
+
+	for _, c := range credentials {
+		credential := L.NewTable()
+		credential.RawSetString("id", glua.LNumber(c.ID))
+		credential.RawSetString("name", glua.LString(c.Name))
+		credential.RawSetString("created", glua.LNumber(c.Created_at))
+		credential.RawSetString("lastUsed", glua.LNumber(c.Last_used_at))
+		list.Append(credential)
+	}
+
+	L.Push(list)
+
+	return 1
+}
+
+// WebAuthnRemove removes a passkey of the given account
+func WebAuthnRemove(L *glua.LState) int {
+	// Get account identifier
+	accountID, ok := checkAccountID(L, 2)
+
+	if !ok {
+		return 0
+	}
+
+	// Get passkey identifier
+	id := L.Get(3)
+
+	if id.Type() != glua.LTNumber {
+		L.ArgError(2, "Invalid passkey identifier type. Expected number")
+		return 0
+	}
+
+	removed, err := models.DeleteWebAuthnCredential(accountID, int64(id.(glua.LNumber)))
+
+	if err != nil {
+		L.RaiseError("Cannot remove WebAuthn credential: %v", err)
+		return 0
+	}
+
+	L.Push(glua.LBool(removed))
+
+	return 1
+}
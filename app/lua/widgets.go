@@ -94,7 +94,11 @@ func compileWidgetList(req *http.Request, w http.ResponseWriter, sess map[string
 		SetSessionMetaTableUserData(state, sess)
 
 		// Call widget function
-		if err := ExecuteControllerPage(state, "widget"); err != nil {
+		stopProfile := Profiler.Start(state, "widgets/"+widget.Name)
+		err = ExecuteControllerPage(state, "widget")
+		stopProfile()
+
+		if err != nil {
 			WidgetList.Put(state, filepath.Join("widgets", widget.Name, widget.Name+".lua"))
 			return nil, err
 		}
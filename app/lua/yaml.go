@@ -0,0 +1,118 @@
+package lua
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	glua "github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v2"
+)
+
+// SetYAMLMetaTable sets the yaml metatable of the given state
+func SetYAMLMetaTable(luaState *glua.LState) {
+	// Create and set the yaml metatable
+	yamlMetaTable := luaState.NewTypeMetatable(YAMLMetaTableName)
+	luaState.SetGlobal(YAMLMetaTableName, yamlMetaTable)
+
+	// Set all yaml metatable functions
+	luaState.SetFuncs(yamlMetaTable, yamlMethods)
+}
+
+// yamlValue converts decoded yaml maps to string keyed maps
+func yamlValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+
+		for k, e := range val {
+			m[fmt.Sprint(k)] = yamlValue(e)
+		}
+
+		return m
+	case []interface{}:
+		for i, e := range val {
+			val[i] = yamlValue(e)
+		}
+
+		return val
+	case int:
+		return int64(val)
+	}
+
+	return v
+}
+
+// EncodeYAML encodes the given lua table as yaml
+func EncodeYAML(L *glua.LState) int {
+	// Get table
+	tbl := L.Get(2)
+
+	// Check for valid table type
+	if tbl.Type() != glua.LTTable {
+		L.ArgError(1, "Invalid encode object. Expected table")
+		return 0
+	}
+
+	buff, err := yaml.Marshal(codecValue(ValueToGo(tbl)))
+
+	if err != nil {
+		L.RaiseError("Cannot encode the given table: %v", err)
+		return 0
+	}
+
+	// Push result as string
+	L.Push(glua.LString(string(buff)))
+
+	return 1
+}
+
+// decodeYAML decodes the given yaml document and pushes the result value
+func decodeYAML(L *glua.LState, src []byte) int {
+	var data interface{}
+
+	if err := yaml.Unmarshal(src, &data); err != nil {
+		L.RaiseError("Cannot decode the given yaml: %v", err)
+		return 0
+	}
+
+	// Push result as lua value
+	L.Push(GoToValue(yamlValue(data)))
+
+	return 1
+}
+
+// DecodeYAML decodes the given string to a lua value
+func DecodeYAML(L *glua.LState) int {
+	// Get string
+	src := L.Get(2)
+
+	// Check for valid string type
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid decode source. Expected string")
+		return 0
+	}
+
+	return decodeYAML(L, []byte(src.String()))
+}
+
+// DecodeYAMLFile decodes the given file to a lua value
+func DecodeYAMLFile(L *glua.LState) int {
+	// Get file location
+	src := L.Get(2)
+
+	// Check for valid string type
+	if src.Type() != glua.LTString {
+		L.ArgError(1, "Invalid decode source. Expected string")
+		return 0
+	}
+
+	// Read whole file
+	file, err := ioutil.ReadFile(src.String())
+
+	if err != nil {
+		L.RaiseError("Cannot read the given file: %v", err)
+		return 0
+	}
+
+	return decodeYAML(L, file)
+}
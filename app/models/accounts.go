@@ -43,3 +43,12 @@ func GetAccountByName(name string) (Account, CastroAccount, error) {
 
 	return account, castroAccount, nil
 }
+
+// GetAccountByEmailOrName gets an account by the email address or the account name
+func GetAccountByEmailOrName(value string) (Account, error) {
+	account := Account{}
+
+	err := database.DB.Get(&account, "SELECT id, name, password, premium_ends_at, email, creation, secret FROM accounts WHERE email = ? OR name = ? ORDER BY email = ? DESC LIMIT 1", value, value, value)
+
+	return account, err
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// ClientCharacter struct used for the characters listed on the game client
+type ClientCharacter struct {
+	Name       string
+	Sex        int
+	Level      int
+	Vocation   int
+	Looktype   int
+	Lookhead   int
+	Lookbody   int
+	Looklegs   int
+	Lookfeet   int
+	Lookaddons int
+	Lastlogin  int64
+	World_id   int
+}
+
+// GetClientCharacters returns the characters of the given account that are not pending deletion.
+// The world of each character is only read when the players table has a world_id column
+func GetClientCharacters(accountID int64, worldColumn bool) ([]*ClientCharacter, error) {
+	characters := []*ClientCharacter{}
+	world := "0"
+
+	if worldColumn {
+		world = "world_id"
+	}
+
+	if err := database.DB.Select(
+		&characters,
+		"SELECT name, sex, level, vocation, looktype, lookhead, lookbody, looklegs, lookfeet, lookaddons, lastlogin, "+world+" AS world_id FROM players WHERE account_id = ? AND deletion = 0 ORDER BY name",
+		accountID,
+	); err != nil {
+		return nil, err
+	}
+
+	return characters, nil
+}
+
+// PlayersHaveWorldColumn returns if the players table stores the world of each character
+func PlayersHaveWorldColumn() (bool, error) {
+	count := 0
+
+	if err := database.DB.Get(&count, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'players' AND COLUMN_NAME = 'world_id'"); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetOnlinePlayerCount returns the number of players online
+func GetOnlinePlayerCount() (int, error) {
+	count := 0
+
+	if err := database.DB.Get(&count, "SELECT COUNT(*) FROM players_online"); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetBoostedCreatures returns the race identifiers of the boosted creature and boss saved by
+// the game server. Servers without boosted creatures return zero values
+func GetBoostedCreatures() (int, int, error) {
+	creature, boss := 0, 0
+
+	if err := database.DB.Get(&creature, "SELECT raceid FROM boosted_creature LIMIT 1"); err != nil && err != sql.ErrNoRows {
+		return 0, 0, err
+	}
+
+	if err := database.DB.Get(&boss, "SELECT raceid FROM boosted_boss LIMIT 1"); err != nil && err != sql.ErrNoRows {
+		return creature, 0, err
+	}
+
+	return creature, boss, nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// CSPReport struct used for an aggregated Content-Security-Policy violation
+type CSPReport struct {
+	ID           int64
+	Directive    string
+	Blocked_uri  string
+	Document_uri string
+	Source_file  string
+	Line_number  int64
+	Sample       string
+	Count        int64
+	First_seen   int64
+	Last_seen    int64
+}
+
+// truncateReportField limits a report field to n bytes without splitting a character
+func truncateReportField(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// SaveCSPReport saves a violation report. Reports of the same directive, blocked resource,
+// document and location are aggregated increasing their counter
+func SaveCSPReport(r *CSPReport) error {
+	r.Directive = truncateReportField(r.Directive, 64)
+	r.Blocked_uri = truncateReportField(r.Blocked_uri, 255)
+	r.Document_uri = truncateReportField(r.Document_uri, 255)
+	r.Source_file = truncateReportField(r.Source_file, 255)
+	r.Sample = truncateReportField(r.Sample, 255)
+
+	sum := sha256.Sum256([]byte(r.Directive + "\x00" + r.Blocked_uri + "\x00" + r.Document_uri + "\x00" + r.Source_file + "\x00" + strconv.FormatInt(r.Line_number, 10)))
+	now := time.Now().Unix()
+
+	_, err := database.DB.Exec(
+		"INSERT INTO castro_csp_reports (hash, directive, blocked_uri, document_uri, source_file, line_number, sample, count, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?) ON DUPLICATE KEY UPDATE count = count + 1, last_seen = VALUES(last_seen)",
+		hex.EncodeToString(sum[:]),
+		r.Directive,
+		r.Blocked_uri,
+		r.Document_uri,
+		r.Source_file,
+		r.Line_number,
+		r.Sample,
+		now,
+		now,
+	)
+
+	return err
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateReportField(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		n        int
+		expected string
+	}{
+		{name: "short value", value: "script-src", n: 64, expected: "script-src"},
+		{name: "exact value", value: "abcd", n: 4, expected: "abcd"},
+		{name: "ascii value", value: "abcdef", n: 4, expected: "abcd"},
+		{name: "split two byte character", value: "abcñ", n: 4, expected: "abc"},
+		{name: "split four byte character", value: "a😀", n: 3, expected: "a"},
+		{name: "keep whole character", value: "añb", n: 3, expected: "añ"},
+		{name: "long value", value: strings.Repeat("ñ", 200), n: 255, expected: strings.Repeat("ñ", 127)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := truncateReportField(test.value, test.n)
+
+			if v != test.expected || !utf8.ValidString(v) {
+				t.Fatalf("Expected %q got %q", test.expected, v)
+			}
+		})
+	}
+}
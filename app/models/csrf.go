@@ -1,9 +1,27 @@
 package models
 
-import "time"
+import (
+	"crypto/subtle"
+	"time"
+)
 
 // CsrfToken struct used for the application XSRF tokens
 type CsrfToken struct {
-	Token string
-	At    time.Time
+	Token    string
+	At       time.Time
+	Previous string
+}
+
+// Valid checks if the given value matches the current token or the token it replaced, so
+// forms rendered before the last rotation on other tabs are still accepted
+func (t *CsrfToken) Valid(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(value), []byte(t.Token)) == 1 {
+		return true
+	}
+
+	return t.Previous != "" && subtle.ConstantTimeCompare([]byte(value), []byte(t.Previous)) == 1
 }
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/raggaer/castro/app/database"
+)
+
+const (
+	// JobPending status of a job waiting to be executed
+	JobPending = "pending"
+
+	// JobRunning status of a job claimed by a worker
+	JobRunning = "running"
+
+	// JobDone status of a job that finished successfully
+	JobDone = "done"
+
+	// JobDead status of a job that ran out of attempts
+	JobDead = "dead"
+)
+
+// Job struct used for the background job queue
+type Job struct {
+	ID              int64
+	Name            string
+	Payload         string
+	Status          string
+	Attempts        int
+	Max_attempts    int
+	Idempotency_key sql.NullString
+	Last_error      sql.NullString
+	Run_at          int64
+	Locked_at       int64
+	Created_at      int64
+	Updated_at      int64
+}
+
+// jobColumns list of columns selected for a job
+const jobColumns = "id, name, payload, status, attempts, max_attempts, idempotency_key, last_error, run_at, locked_at, created_at, updated_at"
+
+// CreateJob saves the given job. If a job with the same idempotency key was already enqueued its identifier is returned instead
+func CreateJob(job *Job) (int64, error) {
+	// Insert job
+	result, err := database.DB.Exec(
+		"INSERT INTO castro_jobs (name, payload, status, attempts, max_attempts, idempotency_key, run_at, created_at, updated_at) VALUES (?, ?, ?, 0, ?, ?, ?, ?, ?)",
+		job.Name,
+		job.Payload,
+		JobPending,
+		job.Max_attempts,
+		job.Idempotency_key,
+		job.Run_at,
+		job.Created_at,
+		job.Updated_at,
+	)
+
+	if err != nil {
+
+		// Duplicate idempotency keys mean the job was already enqueued
+		if mErr, ok := err.(*mysql.MySQLError); ok && mErr.Number == 1062 && job.Idempotency_key.Valid {
+			return getJobIDByIdempotencyKey(job.Idempotency_key.String)
+		}
+
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// getJobIDByIdempotencyKey returns the identifier of the job with the given idempotency key
+func getJobIDByIdempotencyKey(key string) (int64, error) {
+	// Identifier holder
+	var id int64
+
+	if err := database.DB.Get(&id, "SELECT id FROM castro_jobs WHERE idempotency_key = ?", key); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetJobByID returns a job by the identifier
+func GetJobByID(id int64) (*Job, error) {
+	// Data holder
+	job := &Job{}
+
+	if err := database.DB.Get(job, "SELECT "+jobColumns+" FROM castro_jobs WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetJobsByStatus returns the latest jobs with the given status
+func GetJobsByStatus(status string, limit int) ([]*Job, error) {
+	// Data holder
+	jobs := []*Job{}
+
+	if err := database.DB.Select(&jobs, "SELECT "+jobColumns+" FROM castro_jobs WHERE status = ? ORDER BY updated_at DESC LIMIT ?", status, limit); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimNextJob marks the next due job as running and returns it. Returns nil if there are no due jobs
+func ClaimNextJob(now time.Time) (*Job, error) {
+	for {
+		// Identifier holder
+		var id int64
+
+		// Get next due job
+		if err := database.DB.Get(&id, "SELECT id FROM castro_jobs WHERE status = ? AND run_at <= ? ORDER BY run_at, id LIMIT 1", JobPending, now.Unix()); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		// Try to claim the job
+		result, err := database.DB.Exec(
+			"UPDATE castro_jobs SET status = ?, attempts = attempts + 1, locked_at = ?, updated_at = ? WHERE id = ? AND status = ?",
+			JobRunning,
+			now.Unix(),
+			now.Unix(),
+			id,
+			JobPending,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := result.RowsAffected()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Another worker claimed the job first
+		if n == 0 {
+			continue
+		}
+
+		return GetJobByID(id)
+	}
+}
+
+// CompleteJob marks the given job as done
+func (j *Job) CompleteJob() error {
+	_, err := database.DB.Exec("UPDATE castro_jobs SET status = ?, last_error = NULL, updated_at = ? WHERE id = ?", JobDone, time.Now().Unix(), j.ID)
+	return err
+}
+
+// FailJob records the job error and schedules the next attempt. If the job has no attempts left it is moved to the dead status
+func (j *Job) FailJob(reason string, next time.Time) error {
+	// Set next status
+	status := JobPending
+
+	if j.Attempts >= j.Max_attempts {
+		status = JobDead
+	}
+
+	_, err := database.DB.Exec(
+		"UPDATE castro_jobs SET status = ?, last_error = ?, run_at = ?, updated_at = ? WHERE id = ?",
+		status,
+		reason,
+		next.Unix(),
+		time.Now().Unix(),
+		j.ID,
+	)
+
+	return err
+}
+
+// RetryJob moves the given job back to the queue resetting its attempts
+func RetryJob(id int64) error {
+	_, err := database.DB.Exec(
+		"UPDATE castro_jobs SET status = ?, attempts = 0, run_at = ?, updated_at = ? WHERE id = ? AND status <> ?",
+		JobPending,
+		time.Now().Unix(),
+		time.Now().Unix(),
+		id,
+		JobRunning,
+	)
+	return err
+}
+
+// ReleaseStaleJobs moves running jobs locked before the given time back to the queue. Jobs without
+// attempts left are moved to the dead status instead. Returns the number of released and dead jobs
+func ReleaseStaleJobs(before time.Time) (int64, int64, error) {
+	// Mark exhausted jobs as dead
+	result, err := database.DB.Exec(
+		"UPDATE castro_jobs SET status = ?, last_error = ?, updated_at = ? WHERE status = ? AND locked_at < ? AND attempts >= max_attempts",
+		JobDead,
+		"Job timed out",
+		time.Now().Unix(),
+		JobRunning,
+		before.Unix(),
+	)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dead, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Move the remaining jobs back to the queue
+	result, err = database.DB.Exec(
+		"UPDATE castro_jobs SET status = ?, last_error = ?, updated_at = ? WHERE status = ? AND locked_at < ?",
+		JobPending,
+		"Job timed out",
+		time.Now().Unix(),
+		JobRunning,
+		before.Unix(),
+	)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	released, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return released, dead, nil
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// LoginAttempt struct used for the failed login counter of an account or address
+type LoginAttempt struct {
+	Key          string
+	Failures     int
+	Locked_until int64
+	Last_failure int64
+}
+
+// LoginHistory struct used for a login attempt of an account
+type LoginHistory struct {
+	ID         int64
+	Account_id int64
+	IP         string
+	Network    string
+	User_agent string
+	Success    bool
+	Two_factor bool
+	Created_at int64
+}
+
+// GetLoginAttempt returns the failed login counter with the given key or nil if missing
+func GetLoginAttempt(key string) (*LoginAttempt, error) {
+	a := &LoginAttempt{}
+
+	if err := database.DB.Get(a, "SELECT `key`, failures, locked_until, last_failure FROM castro_login_attempts WHERE `key` = ?", key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// SaveLoginAttempt saves a failed login counter
+func SaveLoginAttempt(a *LoginAttempt) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO castro_login_attempts (`key`, failures, locked_until, last_failure) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE failures = VALUES(failures), locked_until = VALUES(locked_until), last_failure = VALUES(last_failure)",
+		a.Key,
+		a.Failures,
+		a.Locked_until,
+		a.Last_failure,
+	)
+
+	return err
+}
+
+// DeleteLoginAttempt removes the failed login counter with the given key
+func DeleteLoginAttempt(key string) error {
+	_, err := database.DB.Exec("DELETE FROM castro_login_attempts WHERE `key` = ?", key)
+	return err
+}
+
+// PurgeLoginAttempts removes the unlocked counters without failures since the given timestamp
+func PurgeLoginAttempts(before, now int64) error {
+	_, err := database.DB.Exec("DELETE FROM castro_login_attempts WHERE last_failure < ? AND locked_until < ?", before, now)
+	return err
+}
+
+// CreateLoginHistory saves a login attempt of an account
+func CreateLoginHistory(h *LoginHistory) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO castro_login_history (account_id, ip, network, user_agent, success, two_factor, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		h.Account_id,
+		h.IP,
+		h.Network,
+		truncateUserAgent(h.User_agent),
+		h.Success,
+		h.Two_factor,
+		h.Created_at,
+	)
+
+	return err
+}
+
+// GetLoginHistory returns the latest login attempts of the given account
+func GetLoginHistory(accountID int64, limit int) ([]LoginHistory, error) {
+	list := []LoginHistory{}
+
+	if err := database.DB.Select(
+		&list,
+		"SELECT id, account_id, ip, network, user_agent, success, two_factor, created_at FROM castro_login_history WHERE account_id = ? ORDER BY created_at DESC, id DESC LIMIT ?",
+		accountID,
+		limit,
+	); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// IsKnownLoginDevice checks if the account logged in before from the given network and browser.
+// Returns false as second value when the account has no successful logins
+func IsKnownLoginDevice(accountID int64, network, userAgent string) (bool, bool, error) {
+	total := 0
+
+	if err := database.DB.Get(&total, "SELECT COUNT(*) FROM castro_login_history WHERE account_id = ? AND success = 1", accountID); err != nil {
+		return false, false, err
+	}
+
+	if total == 0 {
+		return false, false, nil
+	}
+
+	known := 0
+
+	if err := database.DB.Get(
+		&known,
+		"SELECT COUNT(*) FROM castro_login_history WHERE account_id = ? AND success = 1 AND network = ? AND user_agent = ?",
+		accountID,
+		network,
+		truncateUserAgent(userAgent),
+	); err != nil {
+		return false, true, err
+	}
+
+	return known > 0, true, nil
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// Session struct used for a server-side session
+type Session struct {
+	ID         string
+	Account    string
+	Data       []byte
+	IP         string
+	User_agent string
+	Created_at int64
+	Last_seen  int64
+}
+
+// truncateUserAgent limits the user agent to the column size
+func truncateUserAgent(ua string) string {
+	if len(ua) > 255 {
+		return ua[:255]
+	}
+
+	return ua
+}
+
+// GetSession returns the session with the given identifier or nil if missing
+func GetSession(id string) (*Session, error) {
+	s := &Session{}
+
+	if err := database.DB.Get(s, "SELECT id, account, data, ip, user_agent, created_at, last_seen FROM castro_sessions WHERE id = ?", id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// CreateSession saves a new session
+func CreateSession(s *Session) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO castro_sessions (id, account, data, ip, user_agent, created_at, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.ID,
+		s.Account,
+		s.Data,
+		s.IP,
+		truncateUserAgent(s.User_agent),
+		s.Created_at,
+		s.Last_seen,
+	)
+
+	return err
+}
+
+// UpdateSession saves an existing session. Returns false if the session does not exist
+func UpdateSession(s *Session) (bool, error) {
+	r, err := database.DB.Exec(
+		"UPDATE castro_sessions SET account = ?, data = ?, ip = ?, user_agent = ?, last_seen = ? WHERE id = ?",
+		s.Account,
+		s.Data,
+		s.IP,
+		truncateUserAgent(s.User_agent),
+		s.Last_seen,
+		s.ID,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	// Rows without changes are not counted as affected
+	n, err := r.RowsAffected()
+
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+
+	existing, err := GetSession(s.ID)
+
+	return existing != nil, err
+}
+
+// DeleteSession removes the session with the given identifier
+func DeleteSession(id string) error {
+	_, err := database.DB.Exec("DELETE FROM castro_sessions WHERE id = ?", id)
+	return err
+}
+
+// GetAccountSessions returns the sessions of the given account
+func GetAccountSessions(account string) ([]*Session, error) {
+	list := []*Session{}
+
+	if err := database.DB.Select(&list, "SELECT id, account, data, ip, user_agent, created_at, last_seen FROM castro_sessions WHERE account = ? ORDER BY last_seen DESC", account); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// DeleteAccountSessions removes all the sessions of the given account except the given one
+func DeleteAccountSessions(account, except string) (int64, error) {
+	r, err := database.DB.Exec("DELETE FROM castro_sessions WHERE account = ? AND id != ?", account, except)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return r.RowsAffected()
+}
+
+// PurgeSessions removes the sessions not seen since the given timestamp
+func PurgeSessions(before int64) error {
+	_, err := database.DB.Exec("DELETE FROM castro_sessions WHERE last_seen < ?", before)
+	return err
+}
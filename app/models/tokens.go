@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/raggaer/castro/app/database"
+)
+
+// ConsumeToken marks a single-use token as used. Returns false if the token was already used
+func ConsumeToken(id, purpose string, expires int64) (bool, error) {
+	// Remove expired tokens
+	if _, err := database.DB.Exec("DELETE FROM castro_token_uses WHERE expires_at < ?", time.Now().Unix()); err != nil {
+		return false, err
+	}
+
+	// Insert token identifier
+	if _, err := database.DB.Exec(
+		"INSERT INTO castro_token_uses (id, purpose, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		id,
+		purpose,
+		expires,
+		time.Now().Unix(),
+	); err != nil {
+
+		// Duplicate identifiers mean the token was already used
+		if mErr, ok := err.(*mysql.MySQLError); ok && mErr.Number == 1062 {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
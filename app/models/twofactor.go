@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// TwoFactor struct used for the two-factor state of an account
+type TwoFactor struct {
+	Account_id         int64
+	Last_step          int64
+	Recovery_codes     string
+	Reset_requested_at int64
+	Updated_at         int64
+}
+
+// createTwoFactor creates the two-factor row of the given account if missing
+func createTwoFactor(accountID int64) error {
+	_, err := database.DB.Exec(
+		"INSERT IGNORE INTO castro_twofactor (account_id, last_step, recovery_codes, reset_requested_at, updated_at) VALUES (?, 0, '[]', 0, ?)",
+		accountID,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// GetTwoFactor returns the two-factor state of the given account
+func GetTwoFactor(accountID int64) (*TwoFactor, error) {
+	t := &TwoFactor{}
+
+	if err := database.DB.Get(t, "SELECT account_id, last_step, recovery_codes, reset_requested_at, updated_at FROM castro_twofactor WHERE account_id = ?", accountID); err != nil {
+		if err == sql.ErrNoRows {
+			return &TwoFactor{Account_id: accountID, Recovery_codes: "[]"}, nil
+		}
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// UseTOTPStep marks the given time step as used. Returns false if the step or a later one was already used
+func UseTOTPStep(accountID, step int64) (bool, error) {
+	if err := createTwoFactor(accountID); err != nil {
+		return false, err
+	}
+
+	r, err := database.DB.Exec(
+		"UPDATE castro_twofactor SET last_step = ?, updated_at = ? WHERE account_id = ? AND last_step < ?",
+		step,
+		time.Now().Unix(),
+		accountID,
+		step,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := r.RowsAffected()
+
+	return n == 1, err
+}
+
+// SetRecoveryCodes replaces the recovery code hashes of the given account
+func SetRecoveryCodes(accountID int64, hashes []string) error {
+	if err := createTwoFactor(accountID); err != nil {
+		return err
+	}
+
+	buff, err := json.Marshal(hashes)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec("UPDATE castro_twofactor SET recovery_codes = ?, updated_at = ? WHERE account_id = ?", string(buff), time.Now().Unix(), accountID)
+
+	return err
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of the given account
+func RecoveryCodesLeft(accountID int64) (int, error) {
+	t, err := GetTwoFactor(accountID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	hashes := []string{}
+
+	if err := json.Unmarshal([]byte(t.Recovery_codes), &hashes); err != nil {
+		return 0, err
+	}
+
+	return len(hashes), nil
+}
+
+// UseRecoveryCode removes the given recovery code hash. Returns false if the code does not exist
+func UseRecoveryCode(accountID int64, hash string) (bool, error) {
+	tx, err := database.DB.Beginx()
+
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	// Lock two-factor row
+	codes := ""
+
+	if err := tx.Get(&codes, "SELECT recovery_codes FROM castro_twofactor WHERE account_id = ? FOR UPDATE", accountID); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	hashes := []string{}
+
+	if err := json.Unmarshal([]byte(codes), &hashes); err != nil {
+		return false, err
+	}
+
+	// Remove used code
+	left := make([]string, 0, len(hashes))
+
+	for _, h := range hashes {
+		if h != hash {
+			left = append(left, h)
+		}
+	}
+
+	if len(left) == len(hashes) {
+		return false, nil
+	}
+
+	buff, err := json.Marshal(left)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec("UPDATE castro_twofactor SET recovery_codes = ?, updated_at = ? WHERE account_id = ?", string(buff), time.Now().Unix(), accountID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// RequestTwoFactorReset marks a verified two-factor reset request for the given account
+func RequestTwoFactorReset(accountID int64) error {
+	if err := createTwoFactor(accountID); err != nil {
+		return err
+	}
+
+	_, err := database.DB.Exec("UPDATE castro_twofactor SET reset_requested_at = ?, updated_at = ? WHERE account_id = ?", time.Now().Unix(), time.Now().Unix(), accountID)
+
+	return err
+}
+
+// ResetTwoFactor disables two-factor authentication of the given account removing its recovery codes
+func ResetTwoFactor(accountID int64) error {
+	tx, err := database.DB.Beginx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE accounts SET secret = NULL WHERE id = ?", accountID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM castro_twofactor WHERE account_id = ?", accountID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
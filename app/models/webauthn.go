@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/raggaer/castro/app/database"
+)
+
+// WebAuthnCredential struct used for a passkey registered to an account
+type WebAuthnCredential struct {
+	ID            int64
+	Account_id    int64
+	Credential_id string
+	Public_key    []byte
+	Sign_count    int64
+	Name          string
+	Created_at    int64
+	Last_used_at  int64
+}
+
+// CreateWebAuthnCredential saves a new passkey for the given account
+func CreateWebAuthnCredential(accountID int64, credentialID string, publicKey []byte, signCount uint32, name string) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO castro_webauthn_credentials (account_id, credential_id, public_key, sign_count, name, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		accountID,
+		credentialID,
+		publicKey,
+		signCount,
+		name,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// GetWebAuthnCredentials returns all the passkeys of the given account
+func GetWebAuthnCredentials(accountID int64) ([]WebAuthnCredential, error) {
+	credentials := []WebAuthnCredential{}
+
+	if err := database.DB.Select(
+		&credentials,
+		"SELECT id, account_id, credential_id, public_key, sign_count, name, created_at, last_used_at FROM castro_webauthn_credentials WHERE account_id = ? ORDER BY id ASC",
+		accountID,
+	); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// GetWebAuthnCredential returns the passkey with the given credential identifier or nil if missing
+func GetWebAuthnCredential(credentialID string) (*WebAuthnCredential, error) {
+	c := &WebAuthnCredential{}
+
+	if err := database.DB.Get(
+		c,
+		"SELECT id, account_id, credential_id, public_key, sign_count, name, created_at, last_used_at FROM castro_webauthn_credentials WHERE credential_id = ?",
+		credentialID,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// UseWebAuthnCredential updates the signature counter of a passkey after a successful login
+func UseWebAuthnCredential(id int64, signCount uint32) error {
+	_, err := database.DB.Exec(
+		"UPDATE castro_webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?",
+		signCount,
+		time.Now().Unix(),
+		id,
+	)
+
+	return err
+}
+
+// DeleteWebAuthnCredential removes a passkey of the given account
+func DeleteWebAuthnCredential(accountID, id int64) (bool, error) {
+	r, err := database.DB.Exec("DELETE FROM castro_webauthn_credentials WHERE id = ? AND account_id = ?", id, accountID)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := r.RowsAffected()
+
+	return n == 1, err
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dchest/uniuri"
+	"github.com/raggaer/castro/app/database"
+	"github.com/raggaer/castro/app/lua"
+	"github.com/raggaer/castro/app/util"
+)
+
+// StartTest loads the application using a throwaway database schema. The returned
+// function drops the schema and must be called once the tests finish
+func StartTest(keep bool) (func(), error) {
+	// Load application logger
+	loadAppLogger()
+
+	// Load application config
+	loadAppConfig()
+
+	loadLUAConfig()
+
+	// Create test schema
+	schema, err := createTestSchema()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop schema function
+	cleanup := func() {
+		if keep {
+			fmt.Printf(">> Keeping test schema %v\n", schema)
+			return
+		}
+
+		if _, err := database.DB.Exec("DROP DATABASE " + schema); err != nil {
+			util.Logger.Logger.Errorf("Cannot drop test schema %v: %v", schema, err)
+		}
+	}
+
+	// Load application resources
+	loadApplication()
+
+	return cleanup, nil
+}
+
+// createTestSchema creates a new database with the server and castro tables and connects to it
+func createTestSchema() (schema string, err error) {
+	// Connect to the configured database server
+	conn, err := database.Open(lua.Config.GetGlobal("mysqlUser").String(),
+		lua.Config.GetGlobal("mysqlPass").String(),
+		lua.Config.GetGlobal("mysqlHost").String(),
+		lua.Config.GetGlobal("mysqlPort").String(),
+		lua.Config.GetGlobal("mysqlDatabase").String(),
+		"",
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Close server connection
+	defer conn.Close()
+
+	// Create schema
+	schema = "castro_test_" + strings.ToLower(uniuri.NewLen(8))
+
+	if _, err := conn.Exec("CREATE DATABASE " + schema); err != nil {
+		return "", err
+	}
+
+	// Drop the schema if it cannot be installed
+	defer func() {
+		if err != nil {
+			conn.Exec("DROP DATABASE " + schema)
+		}
+	}()
+
+	// Connect to the test schema
+	if database.DB, err = database.Open(lua.Config.GetGlobal("mysqlUser").String(),
+		lua.Config.GetGlobal("mysqlPass").String(),
+		lua.Config.GetGlobal("mysqlHost").String(),
+		lua.Config.GetGlobal("mysqlPort").String(),
+		schema,
+		"&multiStatements=true",
+	); err != nil {
+		return schema, err
+	}
+
+	// Install server tables
+	if buff, err := ioutil.ReadFile(filepath.Join(util.Config.Configuration.Datapack, "schema.sql")); err == nil {
+		if _, err := database.DB.Exec(string(buff)); err != nil {
+			return schema, fmt.Errorf("Cannot install server schema: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return schema, err
+	}
+
+	// Get all castro tables
+	tables, err := ioutil.ReadDir("install")
+
+	if err != nil {
+		return schema, err
+	}
+
+	// Install castro tables
+	for _, table := range tables {
+
+		// Read file
+		buff, err := ioutil.ReadFile(filepath.Join("install", table.Name()))
+
+		if err != nil {
+			return schema, err
+		}
+
+		if _, err := database.DB.Exec(string(buff)); err != nil {
+			return schema, fmt.Errorf("Cannot install table %v: %v", table.Name(), err)
+		}
+	}
+
+	return schema, nil
+}
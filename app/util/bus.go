@@ -0,0 +1,188 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event struct used for the messages delivered by the event bus
+type Event struct {
+	Topic   string
+	Payload map[string]interface{}
+	At      time.Time
+}
+
+// EventHandler function used to react to event bus messages
+type EventHandler func(e *Event) error
+
+// EventBus struct used for in-process publish/subscribe between pages, widgets and jobs
+type EventBus struct {
+	rw            sync.RWMutex
+	lastID        int64
+	subscriptions map[int64]*eventSubscription
+}
+
+type eventSubscription struct {
+	Pattern string
+	Handler EventHandler
+	Async   bool
+}
+
+var (
+	// Bus main application event bus
+	Bus = &EventBus{
+		subscriptions: map[int64]*eventSubscription{},
+	}
+)
+
+// On subscribes the given handler to all topics matching the pattern. Async handlers run on their own goroutine
+func (b *EventBus) On(pattern string, async bool, handler EventHandler) int64 {
+	// Lock mutex
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	b.lastID++
+
+	b.subscriptions[b.lastID] = &eventSubscription{
+		Pattern: pattern,
+		Handler: handler,
+		Async:   async,
+	}
+
+	return b.lastID
+}
+
+// Off removes the given subscription
+func (b *EventBus) Off(id int64) {
+	// Lock mutex
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	delete(b.subscriptions, id)
+}
+
+// Listen returns a channel receiving all events matching the pattern and a function to stop listening.
+// Events are dropped if the channel buffer is full so slow listeners never block emitters
+func (b *EventBus) Listen(pattern string, size int) (<-chan *Event, func()) {
+	// Create event channel
+	ch := make(chan *Event, size)
+
+	// Subscribe channel to the bus
+	id := b.On(pattern, false, func(e *Event) error {
+		select {
+		case ch <- e:
+		default:
+		}
+		return nil
+	})
+
+	return ch, func() {
+		b.Off(id)
+	}
+}
+
+// Emit delivers the event to all matching subscriptions. Synchronous handlers run
+// before Emit returns and their errors are returned. A failing handler never stops the delivery to the rest
+func (b *EventBus) Emit(topic string, payload map[string]interface{}) []error {
+	// Create event
+	e := &Event{
+		Topic:   topic,
+		Payload: payload,
+		At:      time.Now(),
+	}
+
+	// Errors holder
+	errs := []error{}
+
+	for _, sub := range b.matching(topic) {
+
+		// Run async handlers on their own goroutine
+		if sub.Async {
+			go func(sub *eventSubscription) {
+				if err := deliverEvent(sub, e); err != nil {
+					Logger.Logger.Errorf("Event handler for %v failed: %v", topic, err)
+				}
+			}(sub)
+			continue
+		}
+
+		if err := deliverEvent(sub, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// EmitAsync delivers the event to all matching subscriptions without waiting for any handler
+func (b *EventBus) EmitAsync(topic string, payload map[string]interface{}) {
+	// Create event
+	e := &Event{
+		Topic:   topic,
+		Payload: payload,
+		At:      time.Now(),
+	}
+
+	for _, sub := range b.matching(topic) {
+		go func(sub *eventSubscription) {
+			if err := deliverEvent(sub, e); err != nil {
+				Logger.Logger.Errorf("Event handler for %v failed: %v", topic, err)
+			}
+		}(sub)
+	}
+}
+
+// matching returns the subscriptions whose pattern matches the topic
+func (b *EventBus) matching(topic string) []*eventSubscription {
+	// Lock mutex
+	b.rw.RLock()
+	defer b.rw.RUnlock()
+
+	list := []*eventSubscription{}
+
+	for _, sub := range b.subscriptions {
+		if MatchTopic(sub.Pattern, topic) {
+			list = append(list, sub)
+		}
+	}
+
+	return list
+}
+
+// deliverEvent runs the subscription handler isolating panics
+func deliverEvent(sub *eventSubscription, e *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Event handler panic: %v", r)
+		}
+	}()
+
+	return sub.Handler(e)
+}
+
+// MatchTopic checks if a dot separated topic matches the given pattern. A '*' segment
+// matches exactly one segment and a trailing '#' segment matches any number of segments
+func MatchTopic(pattern, topic string) bool {
+	p := strings.Split(pattern, ".")
+	t := strings.Split(topic, ".")
+
+	for i, segment := range p {
+
+		// Match the rest of the topic
+		if segment == "#" && i == len(p)-1 {
+			return true
+		}
+
+		if i >= len(t) {
+			return false
+		}
+
+		if segment != "*" && segment != t[i] {
+			return false
+		}
+	}
+
+	return len(p) == len(t)
+}
@@ -1,41 +1,297 @@
 package util
 
 import (
-	"gopkg.in/square/go-jose.v1/json"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"io/ioutil"
+	"math/bits"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
 )
 
-const captchaURL = "https://www.google.com/recaptcha/api/siteverify"
+// CaptchaConfig struct used for the TOML configuration file
+type CaptchaConfig struct {
+	Enabled    bool
+	Provider   string
+	Public     string
+	Secret     string
+	Length     int
+	Difficulty int
+	Expiration StringDuration
+}
+
+// CaptchaProvider interface used by the captcha services
+type CaptchaProvider interface {
+	// Widget returns the HTML rendered inside the forms protected by the captcha
+	Widget() (template.HTML, error)
+
+	// Verify checks the captcha answer sent on the given request form
+	Verify(req *http.Request, answer string) (bool, error)
+
+	// PolicySources returns the Content-Security-Policy sources required by the widget
+	PolicySources() map[string][]string
+}
+
+// RemoteCaptchaProvider captcha provider verified by an external service
+type RemoteCaptchaProvider struct {
+	VerifyURL string
+	Script    string
+	Class     string
+	Field     string
+	Sources   map[string][]string
+}
+
+// ImageCaptchaProvider captcha provider that asks users to type the characters of a generated image
+type ImageCaptchaProvider struct{}
 
+// ProofOfWorkCaptchaProvider captcha provider that asks browsers to solve a hash puzzle
+type ProofOfWorkCaptchaProvider struct{}
+
+// FakeCaptchaProvider captcha provider used by tests. Answers are valid when Valid is true
+type FakeCaptchaProvider struct {
+	Valid bool
+	rw    sync.RWMutex
+}
+
+// captchaChallenge struct used for the encrypted challenges of the self-hosted providers
+type captchaChallenge struct {
+	ID         string
+	Answer     string
+	Difficulty int
+	Expires    int64
+}
+
+// captchaResponse struct used for the remote providers verification response
 type captchaResponse struct {
-	Success  bool   `json:"success"`
-	Hostname string `json:"hostname"`
+	Success bool `json:"success"`
 }
 
-// CaptchaConfig struct used for the TOML configuration file
-type CaptchaConfig struct {
-	Enabled bool
-	Public  string
-	Secret  string
-}
-
-// VerifyCaptcha checks if the given captcha answer is valid
-func VerifyCaptcha(answer string) (bool, error) {
-	// Post form to google service
-	resp, err := http.PostForm(captchaURL,
-		url.Values{
-			"secret": {
-				Config.Configuration.Captcha.Secret,
+const (
+	// CaptchaImagePath path of the image captcha endpoint
+	CaptchaImagePath = "/captcha/image"
+
+	// captchaIDField form field holding the challenge of the self-hosted providers
+	captchaIDField = "captcha-id"
+
+	// captchaAnswerField form field holding the answer of the self-hosted providers
+	captchaAnswerField = "captcha-answer"
+
+	// captchaAlphabet characters used by the image captcha. Similar characters are excluded
+	captchaAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	// ErrCaptchaChallenge error returned when a challenge is invalid, expired or already used
+	ErrCaptchaChallenge = errors.New("Invalid captcha challenge")
+
+	// captchaOverride provider used instead of the configured one
+	captchaOverride   CaptchaProvider
+	captchaOverrideRw sync.RWMutex
+
+	// usedCaptchaChallenges identifiers of the solved challenges
+	usedCaptchaChallenges = map[string]int64{}
+	usedCaptchaRw         sync.Mutex
+
+	// remoteCaptchaProviders captcha services verified by an external service
+	remoteCaptchaProviders = map[string]*RemoteCaptchaProvider{
+		"recaptcha": {
+			VerifyURL: "https://www.google.com/recaptcha/api/siteverify",
+			Script:    "https://www.google.com/recaptcha/api.js",
+			Class:     "g-recaptcha",
+			Field:     "g-recaptcha-response",
+			Sources: map[string][]string{
+				"script-src": {"https://www.google.com", "https://www.gstatic.com"},
+				"frame-src":  {"https://www.google.com"},
 			},
-			"response": {
-				answer,
+		},
+		"hcaptcha": {
+			VerifyURL: "https://hcaptcha.com/siteverify",
+			Script:    "https://js.hcaptcha.com/1/api.js",
+			Class:     "h-captcha",
+			Field:     "h-captcha-response",
+			Sources: map[string][]string{
+				"script-src":  {"https://hcaptcha.com", "https://*.hcaptcha.com"},
+				"frame-src":   {"https://hcaptcha.com", "https://*.hcaptcha.com"},
+				"style-src":   {"https://hcaptcha.com", "https://*.hcaptcha.com"},
+				"connect-src": {"https://hcaptcha.com", "https://*.hcaptcha.com"},
 			},
 		},
-	)
+		"turnstile": {
+			VerifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+			Script:    "https://challenges.cloudflare.com/turnstile/v0/api.js",
+			Class:     "cf-turnstile",
+			Field:     "cf-turnstile-response",
+			Sources: map[string][]string{
+				"script-src": {"https://challenges.cloudflare.com"},
+				"frame-src":  {"https://challenges.cloudflare.com"},
+			},
+		},
+	}
+)
+
+// SetCaptchaProvider replaces the configured captcha provider. Used by tests to set a fake
+// provider, passing nil restores the configured provider
+func SetCaptchaProvider(p CaptchaProvider) {
+	captchaOverrideRw.Lock()
+	defer captchaOverrideRw.Unlock()
+
+	captchaOverride = p
+}
+
+// Captcha returns the configured captcha provider
+func Captcha() (CaptchaProvider, error) {
+	captchaOverrideRw.RLock()
+	p := captchaOverride
+	captchaOverrideRw.RUnlock()
+
+	if p != nil {
+		return p, nil
+	}
+
+	return NewCaptchaProvider(Config.Configuration.Captcha.Provider)
+}
+
+// NewCaptchaProvider returns the captcha provider with the given name. Defaults to reCAPTCHA
+func NewCaptchaProvider(name string) (CaptchaProvider, error) {
+	name = strings.ToLower(name)
+
+	switch name {
+	case "":
+		return remoteCaptchaProviders["recaptcha"], nil
+	case "image":
+		return &ImageCaptchaProvider{}, nil
+	case "pow":
+		return &ProofOfWorkCaptchaProvider{}, nil
+	}
+
+	if p, ok := remoteCaptchaProviders[name]; ok {
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("Unknown captcha provider %v", name)
+}
+
+// CaptchaWidget returns the widget of the configured captcha provider
+func CaptchaWidget() (template.HTML, error) {
+	p, err := Captcha()
+
+	if err != nil {
+		return "", err
+	}
+
+	return p.Widget()
+}
+
+// VerifyCaptcha checks the captcha answer of the given request using the configured provider.
+// Remote providers read the answer from the request form unless an answer is given
+func VerifyCaptcha(req *http.Request, answer string) (bool, error) {
+	p, err := Captcha()
+
+	if err != nil {
+		return false, err
+	}
+
+	return p.Verify(req, answer)
+}
+
+// captchaExpiration returns the time a self-hosted challenge can be solved
+func captchaExpiration() time.Duration {
+	if d := Config.Configuration.Captcha.Expiration.Duration; d > 0 {
+		return d
+	}
+
+	return time.Minute * 10
+}
+
+// newCaptchaChallenge encodes a new self-hosted challenge
+func newCaptchaChallenge(answer string, difficulty int) (string, error) {
+	return SessionStore.Encode("captcha", captchaChallenge{
+		ID:         uniuri.NewLen(24),
+		Answer:     answer,
+		Difficulty: difficulty,
+		Expires:    time.Now().Add(captchaExpiration()).Unix(),
+	})
+}
+
+// decodeCaptchaChallenge decodes a self-hosted challenge checking its expiration
+func decodeCaptchaChallenge(value string) (*captchaChallenge, error) {
+	c := &captchaChallenge{}
+
+	if err := SessionStore.Decode("captcha", value, c); err != nil {
+		return nil, ErrCaptchaChallenge
+	}
+
+	if c.Expires < time.Now().Unix() {
+		return nil, ErrCaptchaChallenge
+	}
+
+	return c, nil
+}
+
+// useCaptchaChallenge marks the given challenge as solved. Returns false if it was already used
+func useCaptchaChallenge(c *captchaChallenge) bool {
+	usedCaptchaRw.Lock()
+	defer usedCaptchaRw.Unlock()
+
+	now := time.Now().Unix()
+
+	// Remove expired challenges
+	for id, expires := range usedCaptchaChallenges {
+		if expires < now {
+			delete(usedCaptchaChallenges, id)
+		}
+	}
+
+	if _, ok := usedCaptchaChallenges[c.ID]; ok {
+		return false
+	}
+
+	usedCaptchaChallenges[c.ID] = c.Expires
+
+	return true
+}
+
+// Widget returns the remote provider widget
+func (r *RemoteCaptchaProvider) Widget() (template.HTML, error) {
+	return template.HTML(fmt.Sprintf(
+		`<div class="%s" data-sitekey="%s"></div><script src="%s" async defer></script>`,
+		template.HTMLEscapeString(r.Class),
+		template.HTMLEscapeString(Config.Configuration.Captcha.Public),
+		template.HTMLEscapeString(r.Script),
+	)), nil
+}
+
+// Verify checks the answer using the remote provider verification service
+func (r *RemoteCaptchaProvider) Verify(req *http.Request, answer string) (bool, error) {
+	if answer == "" && req != nil {
+		answer = req.FormValue(r.Field)
+	}
+
+	if answer == "" {
+		return false, nil
+	}
+
+	values := url.Values{
+		"secret":   {Config.Configuration.Captcha.Secret},
+		"response": {answer},
+	}
+
+	if req != nil {
+		values.Set("remoteip", RequestIP(req))
+	}
+
+	// Post form to the provider service
+	resp, err := http.PostForm(r.VerifyURL, values)
 
-	// Check for errors
 	if err != nil {
 		return false, err
 	}
@@ -46,22 +302,200 @@ func VerifyCaptcha(answer string) (bool, error) {
 	// Read all content from response body
 	body, err := ioutil.ReadAll(resp.Body)
 
-	// Check for errors
 	if err != nil {
 		return false, err
 	}
 
-	captchaResp := captchaResponse{
-		Success:  false,
-		Hostname: "",
-	}
+	captchaResp := captchaResponse{}
 
 	// Unmarshal body to json struct
 	if err := json.Unmarshal(body, &captchaResp); err != nil {
-
 		return false, err
 	}
 
-	// Return success status
 	return captchaResp.Success, nil
 }
+
+// PolicySources returns the sources required by the remote provider widget
+func (r *RemoteCaptchaProvider) PolicySources() map[string][]string {
+	return r.Sources
+}
+
+// Widget returns the image captcha widget with a new challenge
+func (i *ImageCaptchaProvider) Widget() (template.HTML, error) {
+	length := Config.Configuration.Captcha.Length
+
+	if length <= 0 {
+		length = 5
+	}
+
+	challenge, err := newCaptchaChallenge(uniuri.NewLenChars(length, []byte(captchaAlphabet)), 0)
+
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="%s" value="%s"><img src="%s?id=%s" alt="Captcha" class="captcha-image"><input type="text" class="form-control" name="%s" autocomplete="off" placeholder="Type the characters of the image">`,
+		captchaIDField,
+		template.HTMLEscapeString(challenge),
+		CaptchaImagePath,
+		url.QueryEscape(challenge),
+		captchaAnswerField,
+	)), nil
+}
+
+// Verify checks the characters typed by the user
+func (i *ImageCaptchaProvider) Verify(req *http.Request, answer string) (bool, error) {
+	if req == nil {
+		return false, nil
+	}
+
+	c, err := decodeCaptchaChallenge(req.FormValue(captchaIDField))
+
+	if err != nil {
+		return false, nil
+	}
+
+	if answer == "" {
+		answer = req.FormValue(captchaAnswerField)
+	}
+
+	answer = strings.ToUpper(strings.TrimSpace(answer))
+
+	if subtle.ConstantTimeCompare([]byte(answer), []byte(c.Answer)) != 1 {
+		return false, nil
+	}
+
+	return useCaptchaChallenge(c), nil
+}
+
+// PolicySources returns the sources required by the image captcha widget
+func (i *ImageCaptchaProvider) PolicySources() map[string][]string {
+	return nil
+}
+
+// CaptchaImage returns the characters of the given image captcha challenge
+func CaptchaImage(challenge string) (string, error) {
+	c, err := decodeCaptchaChallenge(challenge)
+
+	if err != nil {
+		return "", err
+	}
+
+	if c.Answer == "" {
+		return "", ErrCaptchaChallenge
+	}
+
+	return c.Answer, nil
+}
+
+// Widget returns the proof-of-work widget with a new challenge
+func (p *ProofOfWorkCaptchaProvider) Widget() (template.HTML, error) {
+	difficulty := proofOfWorkDifficulty()
+
+	challenge, err := newCaptchaChallenge("", difficulty)
+
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="%s" value="%s" data-captcha-pow="%d"><input type="hidden" name="%s" value=""><script src="/js/captcha.js"></script>`,
+		captchaIDField,
+		template.HTMLEscapeString(challenge),
+		difficulty,
+		captchaAnswerField,
+	)), nil
+}
+
+// Verify checks the proof-of-work solution. The SHA-256 hash of the challenge, a colon and the
+// solution must start with the challenge difficulty amount of zero bits
+func (p *ProofOfWorkCaptchaProvider) Verify(req *http.Request, answer string) (bool, error) {
+	if req == nil {
+		return false, nil
+	}
+
+	challenge := req.FormValue(captchaIDField)
+
+	c, err := decodeCaptchaChallenge(challenge)
+
+	if err != nil {
+		return false, nil
+	}
+
+	if answer == "" {
+		answer = req.FormValue(captchaAnswerField)
+	}
+
+	if answer == "" || len(answer) > 32 {
+		return false, nil
+	}
+
+	if proofOfWorkZeroBits(sha256.Sum256([]byte(challenge+":"+answer))) < c.Difficulty {
+		return false, nil
+	}
+
+	return useCaptchaChallenge(c), nil
+}
+
+// PolicySources returns the sources required by the proof-of-work widget
+func (p *ProofOfWorkCaptchaProvider) PolicySources() map[string][]string {
+	return nil
+}
+
+// proofOfWorkDifficulty returns the configured amount of leading zero bits
+func proofOfWorkDifficulty() int {
+	d := Config.Configuration.Captcha.Difficulty
+
+	if d <= 0 {
+		return 16
+	}
+
+	if d > 32 {
+		return 32
+	}
+
+	return d
+}
+
+// proofOfWorkZeroBits returns the amount of leading zero bits of the given hash
+func proofOfWorkZeroBits(sum [32]byte) int {
+	n := 0
+
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+
+		n += 8
+	}
+
+	return n
+}
+
+// Widget returns an empty widget
+func (f *FakeCaptchaProvider) Widget() (template.HTML, error) {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="fake">`, captchaAnswerField)), nil
+}
+
+// Verify returns the fake provider result
+func (f *FakeCaptchaProvider) Verify(req *http.Request, answer string) (bool, error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+
+	return f.Valid, nil
+}
+
+// SetValid sets the fake provider result
+func (f *FakeCaptchaProvider) SetValid(valid bool) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+
+	f.Valid = valid
+}
+
+// PolicySources returns the sources required by the fake widget
+func (f *FakeCaptchaProvider) PolicySources() map[string][]string {
+	return nil
+}
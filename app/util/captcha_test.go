@@ -0,0 +1,291 @@
+package util
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupCaptchaTest sets the configuration and cookie store used by the captcha providers
+func setupCaptchaTest(captcha CaptchaConfig) {
+	Config.Configuration = &Configuration{
+		Captcha: captcha,
+	}
+
+	SessionStore = NewCookieStore([]CookieKeyPair{
+		{
+			HashKey:  "captcha-test-hash-key-0123456789",
+			BlockKey: "captcha-test-block-key-012345678",
+		},
+	})
+}
+
+// captchaRequest returns a form request holding the given values
+func captchaRequest(values url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	return req
+}
+
+func TestRemoteCaptchaProviders(t *testing.T) {
+	for _, name := range []string{"hcaptcha", "turnstile", "recaptcha"} {
+		t.Run(name, func(t *testing.T) {
+			setupCaptchaTest(CaptchaConfig{
+				Provider: name,
+				Secret:   "secret",
+			})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.FormValue("secret") != "secret" {
+					t.Errorf("Unexpected secret %v", req.FormValue("secret"))
+				}
+
+				if req.FormValue("remoteip") != "10.0.0.1" {
+					t.Errorf("Unexpected remote ip %v", req.FormValue("remoteip"))
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"success": ` + strconv.FormatBool(req.FormValue("response") == "valid") + `}`))
+			}))
+
+			defer server.Close()
+
+			p := *remoteCaptchaProviders[name]
+			p.VerifyURL = server.URL
+
+			tests := []struct {
+				answer string
+				valid  bool
+			}{
+				{"valid", true},
+				{"invalid", false},
+				{"", false},
+			}
+
+			for _, test := range tests {
+				valid, err := p.Verify(captchaRequest(url.Values{p.Field: {test.answer}}), "")
+
+				if err != nil {
+					t.Fatalf("Cannot verify answer %q: %v", test.answer, err)
+				}
+
+				if valid != test.valid {
+					t.Fatalf("Expected answer %q to be %v", test.answer, test.valid)
+				}
+			}
+
+			// The answer argument takes precedence over the request form
+			if valid, err := p.Verify(captchaRequest(url.Values{p.Field: {"invalid"}}), "valid"); err != nil || !valid {
+				t.Fatalf("Expected answer argument to be valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoteCaptchaProviderErrors(t *testing.T) {
+	setupCaptchaTest(CaptchaConfig{
+		Provider: "hcaptcha",
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+
+	p := *remoteCaptchaProviders["hcaptcha"]
+	p.VerifyURL = server.URL
+
+	if valid, err := p.Verify(nil, "valid"); err == nil || valid {
+		t.Fatalf("Expected invalid response error")
+	}
+
+	server.Close()
+
+	if valid, err := p.Verify(nil, "valid"); err == nil || valid {
+		t.Fatalf("Expected closed server error")
+	}
+}
+
+func TestImageCaptchaProvider(t *testing.T) {
+	setupCaptchaTest(CaptchaConfig{
+		Provider: "image",
+		Length:   6,
+	})
+
+	p := &ImageCaptchaProvider{}
+
+	challenge, err := newCaptchaChallenge("ABC234", 0)
+
+	if err != nil {
+		t.Fatalf("Cannot create challenge: %v", err)
+	}
+
+	if answer, err := CaptchaImage(challenge); err != nil || answer != "ABC234" {
+		t.Fatalf("Unexpected image answer %q: %v", answer, err)
+	}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {"ABC235"}}), ""); valid {
+		t.Fatalf("Expected wrong answer to be invalid")
+	}
+
+	// Answers are case insensitive and trimmed
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {" abc234 "}}), ""); !valid {
+		t.Fatalf("Expected answer to be valid")
+	}
+
+	// Challenges can only be solved once
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {"ABC234"}}), ""); valid {
+		t.Fatalf("Expected used challenge to be invalid")
+	}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {"tampered"}, captchaAnswerField: {"ABC234"}}), ""); valid {
+		t.Fatalf("Expected tampered challenge to be invalid")
+	}
+
+	widget, err := p.Widget()
+
+	if err != nil || !strings.Contains(string(widget), CaptchaImagePath) {
+		t.Fatalf("Unexpected widget %v: %v", widget, err)
+	}
+}
+
+// solveProofOfWork returns a solution for the given challenge and difficulty
+func solveProofOfWork(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		answer := strconv.Itoa(i)
+
+		if proofOfWorkZeroBits(sha256.Sum256([]byte(challenge+":"+answer))) >= difficulty {
+			return answer
+		}
+	}
+}
+
+func TestProofOfWorkCaptchaProvider(t *testing.T) {
+	setupCaptchaTest(CaptchaConfig{
+		Provider:   "pow",
+		Difficulty: 8,
+	})
+
+	p := &ProofOfWorkCaptchaProvider{}
+
+	challenge, err := newCaptchaChallenge("", proofOfWorkDifficulty())
+
+	if err != nil {
+		t.Fatalf("Cannot create challenge: %v", err)
+	}
+
+	answer := solveProofOfWork(challenge, 8)
+
+	// Find an answer that does not reach the difficulty
+	wrong := ""
+
+	for i := 0; wrong == ""; i++ {
+		if a := "x" + strconv.Itoa(i); proofOfWorkZeroBits(sha256.Sum256([]byte(challenge+":"+a))) < 8 {
+			wrong = a
+		}
+	}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {wrong}}), ""); valid {
+		t.Fatalf("Expected answer below the difficulty to be invalid")
+	}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {answer}}), ""); !valid {
+		t.Fatalf("Expected answer to be valid")
+	}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {answer}}), ""); valid {
+		t.Fatalf("Expected used challenge to be invalid")
+	}
+}
+
+func TestProofOfWorkDifficulty(t *testing.T) {
+	tests := []struct {
+		configured int
+		expected   int
+	}{
+		{0, 16},
+		{-1, 16},
+		{8, 8},
+		{32, 32},
+		{64, 32},
+	}
+
+	for _, test := range tests {
+		setupCaptchaTest(CaptchaConfig{
+			Difficulty: test.configured,
+		})
+
+		if d := proofOfWorkDifficulty(); d != test.expected {
+			t.Fatalf("Expected difficulty %v for %v got %v", test.expected, test.configured, d)
+		}
+	}
+
+	if n := proofOfWorkZeroBits([32]byte{0, 0, 0x10}); n != 19 {
+		t.Fatalf("Expected 19 zero bits got %v", n)
+	}
+}
+
+func TestCaptchaChallengeExpiration(t *testing.T) {
+	setupCaptchaTest(CaptchaConfig{
+		Provider: "pow",
+	})
+
+	if d := captchaExpiration(); d != time.Minute*10 {
+		t.Fatalf("Expected default expiration got %v", d)
+	}
+
+	challenge, err := SessionStore.Encode("captcha", captchaChallenge{
+		ID:         "expired",
+		Difficulty: 1,
+		Expires:    time.Now().Add(-time.Second).Unix(),
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot encode challenge: %v", err)
+	}
+
+	if _, err := decodeCaptchaChallenge(challenge); err != ErrCaptchaChallenge {
+		t.Fatalf("Expected %v got %v", ErrCaptchaChallenge, err)
+	}
+
+	p := &ProofOfWorkCaptchaProvider{}
+
+	if valid, _ := p.Verify(captchaRequest(url.Values{captchaIDField: {challenge}, captchaAnswerField: {solveProofOfWork(challenge, 1)}}), ""); valid {
+		t.Fatalf("Expected expired challenge to be invalid")
+	}
+}
+
+func TestFakeCaptchaProvider(t *testing.T) {
+	setupCaptchaTest(CaptchaConfig{
+		Provider: "image",
+	})
+
+	fake := &FakeCaptchaProvider{}
+
+	SetCaptchaProvider(fake)
+	defer SetCaptchaProvider(nil)
+
+	if valid, err := VerifyCaptcha(nil, ""); err != nil || valid {
+		t.Fatalf("Expected fake provider to be invalid")
+	}
+
+	fake.SetValid(true)
+
+	if valid, err := VerifyCaptcha(nil, ""); err != nil || !valid {
+		t.Fatalf("Expected fake provider to be valid")
+	}
+
+	SetCaptchaProvider(nil)
+
+	if p, err := Captcha(); err != nil {
+		t.Fatalf("Cannot get configured provider: %v", err)
+	} else if _, ok := p.(*ImageCaptchaProvider); !ok {
+		t.Fatalf("Expected image provider got %T", p)
+	}
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// captchaImageScale scale applied to the font glyphs
+	captchaImageScale = 3
+
+	// captchaImageHeight height of the generated captcha images
+	captchaImageHeight = 60
+)
+
+// GenerateCaptchaImage renders the given characters to a PNG image. Characters are scaled,
+// displaced and covered with noise so they are hard to read for machines
+func GenerateCaptchaImage(text string) ([]byte, error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	face := basicfont.Face7x13
+	glyphWidth := face.Advance * captchaImageScale
+
+	img := image.NewRGBA(image.Rect(0, 0, glyphWidth*len(text)+20, captchaImageHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{245, 245, 245, 255}), image.ZP, draw.Src)
+
+	// Draw background noise
+	for i := 0; i < img.Bounds().Dx()*img.Bounds().Dy()/6; i++ {
+		shade := uint8(150 + r.Intn(90))
+		img.Set(r.Intn(img.Bounds().Dx()), r.Intn(img.Bounds().Dy()), color.RGBA{shade, shade, shade, 255})
+	}
+
+	for i, c := range text {
+		// Draw the glyph to a small image
+		glyph := image.NewAlpha(image.Rect(0, 0, face.Advance, face.Height))
+		d := &font.Drawer{
+			Dst:  glyph,
+			Src:  image.Opaque,
+			Face: face,
+			Dot:  fixed.P(0, face.Ascent),
+		}
+		d.DrawString(string(c))
+
+		ink := color.RGBA{uint8(r.Intn(100)), uint8(r.Intn(100)), uint8(r.Intn(100)), 255}
+		offsetX := 10 + i*glyphWidth + r.Intn(7) - 3
+		offsetY := (captchaImageHeight-face.Height*captchaImageScale)/2 + r.Intn(11) - 5
+		skew := r.Intn(5) - 2
+
+		// Scale the glyph applying a small skew
+		for y := 0; y < face.Height*captchaImageScale; y++ {
+			shift := skew * (face.Height*captchaImageScale/2 - y) / (face.Height * captchaImageScale / 2)
+
+			for x := 0; x < face.Advance*captchaImageScale; x++ {
+				if glyph.AlphaAt(x/captchaImageScale, y/captchaImageScale).A == 0 {
+					continue
+				}
+
+				img.Set(offsetX+x+shift, offsetY+y, ink)
+			}
+		}
+	}
+
+	// Draw noise lines across the characters
+	for i := 0; i < 4; i++ {
+		ink := color.RGBA{uint8(r.Intn(120)), uint8(r.Intn(120)), uint8(r.Intn(120)), 255}
+		y := float64(r.Intn(captchaImageHeight))
+		slope := (r.Float64() - 0.5) * 0.8
+
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.Set(x, int(y), ink)
+			y += slope
+		}
+	}
+
+	buff := &bytes.Buffer{}
+
+	if err := png.Encode(buff, img); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
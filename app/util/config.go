@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,12 +20,94 @@ type StaticConfig struct {
 
 // CookieConfig struct used for the cookies configuration options
 type CookieConfig struct {
-	Name     string
-	MaxAge   int
+	Name       string
+	MaxAge     int
+	HashKey    string
+	BlockKey   string
+	Keys       []CookieKeyPair
+	SameSite   string
+	HostPrefix bool
+}
+
+// CookieKeyPair struct used for a cookie signing and encryption key pair
+type CookieKeyPair struct {
 	HashKey  string
 	BlockKey string
 }
 
+// SessionConfig struct used for the session storage options
+type SessionConfig struct {
+	Backend string
+	Purge   StringDuration
+}
+
+// CSRFConfig struct used for the cross-site request forgery protection options
+type CSRFConfig struct {
+	Lifetime StringDuration
+	Header   string
+}
+
+// LoginConfig struct used for the login brute-force protection options
+type LoginConfig struct {
+	MaxAttempts   int
+	IPMaxAttempts int
+	Lockout       StringDuration
+	MaxLockout    StringDuration
+	Window        StringDuration
+	CaptchaAfter  int
+	Notify        bool
+}
+
+// ClientLoginConfig struct used for the game client login webservice options
+type ClientLoginConfig struct {
+	Enabled         bool
+	Path            string
+	Worlds          []ClientWorld
+	Events          []ClientEvent
+	BoostedCreature int
+	BoostedBoss     int
+}
+
+// ClientWorld struct used for the worlds listed on the game client
+type ClientWorld struct {
+	ID       int
+	Name     string
+	Address  string
+	Port     int
+	Location string
+	PvpType  string
+	Preview  bool
+}
+
+// ClientEvent struct used for the game client event schedule
+type ClientEvent struct {
+	Name        string
+	Description string
+	Start       string
+	End         string
+	ColorLight  string
+	ColorDark   string
+	Seasonal    bool
+}
+
+// SupervisorConfig struct used for the game server process supervisor options
+type SupervisorConfig struct {
+	Enabled     bool
+	Executable  string
+	Args        []string
+	Directory   string
+	LogFile     string
+	Buffer      int
+	AutoStart   bool
+	AutoRestart bool
+	Backoff     StringDuration
+	MaxBackoff  StringDuration
+	StopTimeout StringDuration
+	Broadcast   string
+	Warnings    []string
+	Schedule    []string
+}
+
 // MapWatchConfig map watcher goroutine configuration options
 type MapWatchConfig struct {
 	Enabled bool
@@ -98,6 +181,85 @@ type FortumoConfig struct {
 	Secret  string
 }
 
+// JobsConfig struct used for the background job queue options
+type JobsConfig struct {
+	Enabled bool
+	Workers int
+	Retries int
+	Poll    StringDuration
+	Backoff StringDuration
+	Timeout StringDuration
+}
+
+// BusConfig struct used for the event bus options
+type BusConfig struct {
+	Public    []string
+	KeepAlive StringDuration
+}
+
+// ProfilerConfig struct used for the lua profiler options
+type ProfilerConfig struct {
+	Enabled   bool
+	Interval  StringDuration
+	Sample    float64
+	Subtopics []string
+}
+
+// OutboundConfig struct used for the outbound http client options
+type OutboundConfig struct {
+	Concurrency  int
+	Timeout      StringDuration
+	Retries      int
+	Backoff      StringDuration
+	IdleConns    int
+	Allow        []string
+	Deny         []string
+	AllowPrivate bool
+	MaxBodySize  int64
+	MaxRedirects int
+	PageLimit    int
+}
+
+// SanitizePolicyConfig struct used to declare html allowlist policies
+type SanitizePolicyConfig struct {
+	Base       string
+	Elements   []string
+	Attributes map[string][]string
+	Schemes    []string
+	NoFollow   bool
+}
+
+// SanitizerConfig struct used for the html sanitizer options
+type SanitizerConfig struct {
+	Default  string
+	Policies map[string]SanitizePolicyConfig
+}
+
+// TokenConfig struct used for the signed token options
+type TokenConfig struct {
+	Keys   []string
+	TTL    StringDuration
+	Issuer string
+}
+
+// TwoFactorConfig struct used for the two-factor authentication options
+type TwoFactorConfig struct {
+	EnforceAdmin  bool
+	Remember      StringDuration
+	RecoveryCodes int
+	AllowedPaths  []string
+}
+
+// WebAuthnConfig struct used for the passkey options
+type WebAuthnConfig struct {
+	Enabled          bool
+	RPID             string
+	RPName           string
+	Origins          []string
+	UserVerification string
+	Timeout          StringDuration
+}
+
 // ContentSecurityPolicyType struct used for CSP fields
 type ContentSecurityPolicyType struct {
 	Default []string
@@ -106,14 +268,24 @@ type ContentSecurityPolicyType struct {
 
 // ContentSecurityPolicyConfig struct used for CSP headers
 type ContentSecurityPolicyConfig struct {
-	Default []string
-	Enabled bool
-	Frame   ContentSecurityPolicyType
-	Script  ContentSecurityPolicyType
-	Font    ContentSecurityPolicyType
-	Image   ContentSecurityPolicyType
-	Connect ContentSecurityPolicyType
-	Style   ContentSecurityPolicyType
+	Default                 []string
+	Enabled                 bool
+	Report                  bool
+	ReportLimit             int64
+	UpgradeInsecureRequests bool
+	Frame                   ContentSecurityPolicyType
+	Script                  ContentSecurityPolicyType
+	Font                    ContentSecurityPolicyType
+	Image                   ContentSecurityPolicyType
+	Connect                 ContentSecurityPolicyType
+	Style                   ContentSecurityPolicyType
+	Object                  ContentSecurityPolicyType
+	Media                   ContentSecurityPolicyType
+	Worker                  ContentSecurityPolicyType
+	Manifest                ContentSecurityPolicyType
+	BaseURI                 ContentSecurityPolicyType
+	FormAction              ContentSecurityPolicyType
+	FrameAncestors          ContentSecurityPolicyType
 }
 
 // SecurityConfig struct used for the security of the application
@@ -125,6 +297,9 @@ type SecurityConfig struct {
 	ContentType       string
 	ReferrerPolicy    string
 	CrossDomainPolicy string
+	PermissionsPolicy string
+	OpenerPolicy      string
+	ResourcePolicy    string
 	CSP               ContentSecurityPolicyConfig
 }
 
@@ -143,6 +318,7 @@ type Configuration struct {
 	Template     string
 	Mode         string
 	Port         int
+	WriteTimeout StringDuration
 	URL          string
 	Datapack     string
 	MapWatch     MapWatchConfig
@@ -156,9 +332,23 @@ type Configuration struct {
 	Fortumo      FortumoConfig
 	Shop         ShopConfig
 	Cookies      CookieConfig
+	Session      SessionConfig
+	CSRF         CSRFConfig
+	Login        LoginConfig
+	ClientLogin  ClientLoginConfig
+	Status       StatusConfig
+	Supervisor   SupervisorConfig
 	Cache        CacheConfig
 	RateLimit    RateLimiterConfig
 	Static       StaticConfig
+	Jobs         JobsConfig
+	Bus          BusConfig
+	Profiler     ProfilerConfig
+	Outbound     OutboundConfig
+	Sanitizer    SanitizerConfig
+	Token        TokenConfig
+	TwoFactor    TwoFactorConfig
+	WebAuthn     WebAuthnConfig
 	Custom       map[string]interface{}
 }
 
@@ -220,6 +410,22 @@ func LoadConfig(path string) error {
 		return err
 	}
 
+	// Build the security policy
+	SecurityPolicy = NewContentSecurityPolicy(Config.Configuration.Security.CSP)
+
+	// Allow the captcha widget sources
+	if Config.Configuration.Captcha.Enabled {
+		provider, err := NewCaptchaProvider(Config.Configuration.Captcha.Provider)
+
+		if err != nil {
+			return err
+		}
+
+		for directive, sources := range provider.PolicySources() {
+			SecurityPolicy = SecurityPolicy.Add(directive, sources...)
+		}
+	}
+
 	return nil
 }
 
@@ -233,47 +439,51 @@ func (c Configuration) IsLog() bool {
 	return c.Mode == "log"
 }
 
-// CSP returns a valid Content-Security-Policy header value
-func (c Configuration) CSP() string {
-	// Set default-src field
-	buff := getCSPField("default-src", c.Security.CSP.Default, nil)
-
-	// Set frame-src field
-	buff += getCSPField("frame-src", c.Security.CSP.Frame.Default, c.Security.CSP.Frame.SRC)
-
-	// Set script-src field
-	buff += getCSPField("script-src", c.Security.CSP.Script.Default, c.Security.CSP.Script.SRC)
+// IsPublic checks if the given topic pattern can be streamed to visitors
+func (b BusConfig) IsPublic(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
 
-	// Set font-src field
-	buff += getCSPField("font-src", c.Security.CSP.Font.Default, c.Security.CSP.Font.SRC)
+	for _, p := range b.Public {
+		if p == pattern {
+			return true
+		}
 
-	// Set connect-src field
-	buff += getCSPField("connect-src", c.Security.CSP.Connect.Default, c.Security.CSP.Connect.SRC)
+		// Multi-segment wildcards must be declared as public explicitly
+		if !strings.Contains(pattern, "#") && MatchTopic(p, pattern) {
+			return true
+		}
+	}
 
-	// Set style-src field
-	buff += getCSPField("style-src", c.Security.CSP.Style.Default, c.Security.CSP.Style.SRC)
+	return false
+}
 
-	// Set img-src field
-	buff += getCSPField("img-src", c.Security.CSP.Image.Default, c.Security.CSP.Image.SRC)
+// KeepAliveInterval returns the time between the keep-alive comments of an event stream
+func (b BusConfig) KeepAliveInterval() time.Duration {
+	if b.KeepAlive.Duration <= 0 {
+		return time.Second * 15
+	}
 
-	return buff
+	return b.KeepAlive.Duration
 }
 
-func getCSPField(name string, def []string, src []string) string {
-	// Data holder
-	buff := name
-
-	// Loop default values
-	for _, d := range def {
-		buff += " '" + d + "' "
+// ReportsPerMinute returns the number of violation reports accepted from a single address each minute
+func (c ContentSecurityPolicyConfig) ReportsPerMinute() int64 {
+	if c.ReportLimit <= 0 {
+		return 30
 	}
 
-	// Loop src values
-	for _, s := range src {
-		buff += " " + s + " "
+	return c.ReportLimit
+}
+
+// ServerWriteTimeout returns the http server write timeout
+func (c Configuration) ServerWriteTimeout() time.Duration {
+	if c.WriteTimeout.Duration <= 0 {
+		return time.Second * 10
 	}
 
-	return buff + ";"
+	return c.WriteTimeout.Duration
 }
 
 // IsSSL returns if the server is behind SSL
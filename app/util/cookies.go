@@ -0,0 +1,131 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+)
+
+// CookieStore struct used to sign and encrypt cookies using rotating key pairs
+type CookieStore struct {
+	codecs []securecookie.Codec
+}
+
+// hostPrefix prefix of the cookies locked to the current host
+const hostPrefix = "__Host-"
+
+// KeyPairs returns the configured cookie key pairs. The first pair encodes new cookies and
+// the remaining pairs are only used to decode cookies encoded before a rotation. The
+// HashKey and BlockKey pair is always accepted so it can be rotated into the Keys list
+func (c CookieConfig) KeyPairs() []CookieKeyPair {
+	pairs := []CookieKeyPair{}
+
+	for _, pair := range c.Keys {
+		if pair.HashKey != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	legacy := CookieKeyPair{
+		HashKey:  c.HashKey,
+		BlockKey: c.BlockKey,
+	}
+
+	for _, pair := range pairs {
+		if pair == legacy {
+			return pairs
+		}
+	}
+
+	if legacy.HashKey != "" {
+		pairs = append(pairs, legacy)
+	}
+
+	return pairs
+}
+
+// NewCookieStore creates a cookie store using the given key pairs
+func NewCookieStore(pairs []CookieKeyPair) *CookieStore {
+	keys := make([][]byte, 0, len(pairs)*2)
+
+	for _, pair := range pairs {
+		keys = append(keys, []byte(pair.HashKey), []byte(pair.BlockKey))
+	}
+
+	return &CookieStore{
+		codecs: securecookie.CodecsFromPairs(keys...),
+	}
+}
+
+// Encode signs and encrypts the given value using the newest key pair
+func (c *CookieStore) Encode(name string, value interface{}) (string, error) {
+	return securecookie.EncodeMulti(name, value, c.codecs...)
+}
+
+// Decode decodes the given cookie value trying every key pair
+func (c *CookieStore) Decode(name, value string, dst interface{}) error {
+	return securecookie.DecodeMulti(name, value, dst, c.codecs...)
+}
+
+// DecodeStale decodes the given cookie value trying every key pair. Returns true when the
+// value was encoded with an old key pair and should be encoded again
+func (c *CookieStore) DecodeStale(name, value string, dst interface{}) (bool, error) {
+	if len(c.codecs) == 0 {
+		return false, c.Decode(name, value, dst)
+	}
+
+	if err := c.codecs[0].Decode(name, value, dst); err == nil {
+		return false, nil
+	}
+
+	for _, codec := range c.codecs[1:] {
+		if err := codec.Decode(name, value, dst); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, c.Decode(name, value, dst)
+}
+
+// CookieName returns the name used for the given cookie. Cookies use the __Host- prefix
+// under TLS so they can only be set by the current host over a secure connection
+func (c Configuration) CookieName(name string) string {
+	if c.Cookies.HostPrefix && c.IsSSL() && !strings.HasPrefix(name, hostPrefix) {
+		return hostPrefix + name
+	}
+
+	return name
+}
+
+// CookieSameSite returns the configured SameSite cookie attribute
+func (c Configuration) CookieSameSite() http.SameSite {
+	switch strings.ToLower(c.Cookies.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+
+	return http.SameSiteDefaultMode
+}
+
+// NewCookie returns a cookie with the application security attributes
+func NewCookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     Config.Configuration.CookieName(name),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   Config.Configuration.IsSSL(),
+		HttpOnly: true,
+		SameSite: Config.Configuration.CookieSameSite(),
+	}
+}
+
+// SessionCookieName returns the name of the session cookie
+func SessionCookieName() string {
+	return Config.Configuration.CookieName(Config.Configuration.Cookies.Name)
+}
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCookieKeyPairs(t *testing.T) {
+	current := CookieKeyPair{HashKey: "current-hash-key", BlockKey: "current-block-key"}
+	legacy := CookieKeyPair{HashKey: "legacy-hash-key", BlockKey: "legacy-block-key"}
+
+	tests := []struct {
+		name     string
+		config   CookieConfig
+		expected []CookieKeyPair
+	}{
+		{
+			name:     "legacy pair",
+			config:   CookieConfig{HashKey: legacy.HashKey, BlockKey: legacy.BlockKey},
+			expected: []CookieKeyPair{legacy},
+		},
+		{
+			name:     "rotated pair",
+			config:   CookieConfig{HashKey: legacy.HashKey, BlockKey: legacy.BlockKey, Keys: []CookieKeyPair{current}},
+			expected: []CookieKeyPair{current, legacy},
+		},
+		{
+			name:     "legacy pair in the list",
+			config:   CookieConfig{HashKey: legacy.HashKey, BlockKey: legacy.BlockKey, Keys: []CookieKeyPair{current, legacy}},
+			expected: []CookieKeyPair{current, legacy},
+		},
+		{
+			name:     "empty pairs",
+			config:   CookieConfig{Keys: []CookieKeyPair{{}, current}},
+			expected: []CookieKeyPair{current},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pairs := test.config.KeyPairs()
+
+			if len(pairs) != len(test.expected) {
+				t.Fatalf("Expected pairs %v got %v", test.expected, pairs)
+			}
+
+			for i := range pairs {
+				if pairs[i] != test.expected[i] {
+					t.Fatalf("Expected pairs %v got %v", test.expected, pairs)
+				}
+			}
+		})
+	}
+}
+
+func TestCookieStoreRotation(t *testing.T) {
+	current := CookieKeyPair{HashKey: "current-hash-key", BlockKey: "current-block-key-0123456789abcd"}
+	previous := CookieKeyPair{HashKey: "previous-hash-key", BlockKey: "previous-block-key-0123456789abc"}
+	removed := CookieKeyPair{HashKey: "removed-hash-key", BlockKey: "removed-block-key-0123456789abcd"}
+
+	store := NewCookieStore([]CookieKeyPair{current, previous})
+
+	encode := func(pair CookieKeyPair, name string) string {
+		value, err := NewCookieStore([]CookieKeyPair{pair}).Encode(name, "value")
+
+		if err != nil {
+			t.Fatalf("Cannot encode cookie: %v", err)
+		}
+
+		return value
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		stale bool
+		valid bool
+	}{
+		{name: "current key", value: encode(current, "castro"), valid: true},
+		{name: "previous key", value: encode(previous, "castro"), stale: true, valid: true},
+		{name: "removed key", value: encode(removed, "castro"), valid: false},
+		{name: "other cookie name", value: encode(current, "other"), valid: false},
+		{name: "tampered value", value: encode(current, "castro") + "x", valid: false},
+		{name: "empty value", value: "", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := ""
+			stale, err := store.DecodeStale("castro", test.value, &value)
+
+			if valid := err == nil; valid != test.valid || stale != test.stale {
+				t.Fatalf("Expected valid %v and stale %v got %v %v", test.valid, test.stale, err, stale)
+			}
+
+			if test.valid && value != "value" {
+				t.Fatalf("Expected decoded value got %q", value)
+			}
+		})
+	}
+}
+
+func TestNewCookieAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Configuration
+		cookie   string
+		secure   bool
+		sameSite http.SameSite
+	}{
+		{
+			name:     "plain http",
+			config:   Configuration{Cookies: CookieConfig{HostPrefix: true, SameSite: "lax"}},
+			cookie:   "castro",
+			sameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:     "ssl",
+			config:   Configuration{SSL: SSLConfig{Enabled: true}, Cookies: CookieConfig{HostPrefix: true, SameSite: "Strict"}},
+			cookie:   "__Host-castro",
+			secure:   true,
+			sameSite: http.SameSiteStrictMode,
+		},
+		{
+			name:     "ssl proxy without host prefix",
+			config:   Configuration{SSL: SSLConfig{Proxy: true}, Cookies: CookieConfig{SameSite: "none"}},
+			cookie:   "castro",
+			secure:   true,
+			sameSite: http.SameSiteNoneMode,
+		},
+		{
+			name:     "unknown same site",
+			config:   Configuration{Cookies: CookieConfig{SameSite: "relaxed"}},
+			cookie:   "castro",
+			sameSite: http.SameSiteDefaultMode,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Config.Configuration = &test.config
+
+			c := NewCookie("castro", "value", 60)
+
+			if c.Name != test.cookie || c.Secure != test.secure || c.SameSite != test.sameSite || !c.HttpOnly || c.Path != "/" {
+				t.Fatalf("Unexpected cookie %+v", c)
+			}
+
+			// Prefixed names are not prefixed again
+			if name := Config.Configuration.CookieName(c.Name); name != c.Name {
+				t.Fatalf("Expected name %v got %v", c.Name, name)
+			}
+		})
+	}
+}
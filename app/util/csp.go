@@ -0,0 +1,218 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// ContentSecurityPolicy struct used for an immutable Content-Security-Policy. Policies are
+// built once from the configuration file and copied when a page needs to override them
+type ContentSecurityPolicy struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// RequestSecurityPolicy struct used for the policy of a single request. Pages can
+// replace the policy before the response is written
+type RequestSecurityPolicy struct {
+	Policy *ContentSecurityPolicy
+	Nonce  string
+}
+
+// CSPReportPath path of the violation report endpoint
+const CSPReportPath = "/csp-report"
+
+// cspKeywords source keywords that must be quoted
+var cspKeywords = map[string]bool{
+	"self":             true,
+	"none":             true,
+	"unsafe-inline":    true,
+	"unsafe-eval":      true,
+	"unsafe-hashes":    true,
+	"strict-dynamic":   true,
+	"report-sample":    true,
+	"wasm-unsafe-eval": true,
+}
+
+// SecurityPolicy policy built from the configuration file
+var SecurityPolicy *ContentSecurityPolicy
+
+// NewNonce returns a new random nonce value
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// NewContentSecurityPolicy creates a policy from the given configuration
+func NewContentSecurityPolicy(c ContentSecurityPolicyConfig) *ContentSecurityPolicy {
+	p := &ContentSecurityPolicy{}
+
+	p = p.With("default-src", c.Default...)
+
+	for _, d := range []struct {
+		name string
+		t    ContentSecurityPolicyType
+	}{
+		{"frame-src", c.Frame},
+		{"script-src", c.Script},
+		{"font-src", c.Font},
+		{"connect-src", c.Connect},
+		{"style-src", c.Style},
+		{"img-src", c.Image},
+		{"object-src", c.Object},
+		{"media-src", c.Media},
+		{"worker-src", c.Worker},
+		{"manifest-src", c.Manifest},
+		{"base-uri", c.BaseURI},
+		{"form-action", c.FormAction},
+		{"frame-ancestors", c.FrameAncestors},
+	} {
+		if len(d.t.Default) > 0 || len(d.t.SRC) > 0 {
+			p = p.With(d.name, append(append([]string{}, d.t.Default...), d.t.SRC...)...)
+		}
+	}
+
+	if c.UpgradeInsecureRequests {
+		p = p.With("upgrade-insecure-requests")
+	}
+
+	if c.Report {
+		p = p.With("report-uri", CSPReportPath)
+		p = p.With("report-to", "csp")
+	}
+
+	return p
+}
+
+// With returns a copy of the policy replacing the given directive sources
+func (p *ContentSecurityPolicy) With(name string, sources ...string) *ContentSecurityPolicy {
+	c := p.clone()
+	name = strings.ToLower(name)
+
+	for i, d := range c.directives {
+		if d.name == name {
+			c.directives[i].sources = sources
+			return c
+		}
+	}
+
+	c.directives = append(c.directives, cspDirective{
+		name:    name,
+		sources: sources,
+	})
+
+	return c
+}
+
+// Add returns a copy of the policy adding the given sources to a directive
+func (p *ContentSecurityPolicy) Add(name string, sources ...string) *ContentSecurityPolicy {
+	return p.With(name, append(p.Sources(name), sources...)...)
+}
+
+// Without returns a copy of the policy removing the given directive
+func (p *ContentSecurityPolicy) Without(name string) *ContentSecurityPolicy {
+	c := &ContentSecurityPolicy{}
+	name = strings.ToLower(name)
+
+	for _, d := range p.directives {
+		if d.name != name {
+			c.directives = append(c.directives, d)
+		}
+	}
+
+	return c
+}
+
+// Sources returns the sources of the given directive
+func (p *ContentSecurityPolicy) Sources(name string) []string {
+	name = strings.ToLower(name)
+
+	for _, d := range p.directives {
+		if d.name == name {
+			return append([]string{}, d.sources...)
+		}
+	}
+
+	return nil
+}
+
+// Header returns the header value of the policy using the given nonce for the script-src directive
+func (p *ContentSecurityPolicy) Header(nonce string) string {
+	parts := make([]string, 0, len(p.directives))
+	hasScript := false
+
+	for _, d := range p.directives {
+		sources := d.sources
+
+		if d.name == "script-src" && nonce != "" {
+			sources = append(append([]string{}, sources...), "nonce-"+nonce)
+			hasScript = true
+		}
+
+		parts = append(parts, cspDirectiveValue(d.name, sources))
+	}
+
+	// Scripts fall back to default-src
+	if !hasScript && nonce != "" {
+		parts = append(parts, cspDirectiveValue("script-src", append(p.Sources("default-src"), "nonce-"+nonce)))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func (p *ContentSecurityPolicy) clone() *ContentSecurityPolicy {
+	c := &ContentSecurityPolicy{
+		directives: make([]cspDirective, len(p.directives)),
+	}
+
+	copy(c.directives, p.directives)
+
+	return c
+}
+
+func cspDirectiveValue(name string, sources []string) string {
+	parts := []string{name}
+
+	for _, s := range sources {
+		s = strings.Trim(s, "'")
+
+		// The none keyword can not be used with other sources
+		if s == "none" && len(sources) > 1 {
+			continue
+		}
+
+		if cspKeywords[s] || strings.HasPrefix(s, "nonce-") || strings.HasPrefix(s, "sha256-") || strings.HasPrefix(s, "sha384-") || strings.HasPrefix(s, "sha512-") {
+			s = "'" + s + "'"
+		}
+
+		parts = append(parts, s)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// SetHeader sets the Content-Security-Policy header of the given response
+func (r *RequestSecurityPolicy) SetHeader(w http.ResponseWriter) {
+	if !Config.Configuration.Security.CSP.Enabled {
+		return
+	}
+
+	nonce := r.Nonce
+
+	if !Config.Configuration.Security.NonceEnabled {
+		nonce = ""
+	}
+
+	w.Header().Set("Content-Security-Policy", r.Policy.Header(nonce))
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewNonce(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 100; i++ {
+		nonce, err := NewNonce()
+
+		if err != nil {
+			t.Fatalf("Cannot create nonce: %v", err)
+		}
+
+		if b, err := base64.StdEncoding.DecodeString(nonce); err != nil || len(b) != 16 {
+			t.Fatalf("Expected 16 random bytes got %q", nonce)
+		}
+
+		if seen[nonce] {
+			t.Fatalf("Duplicated nonce %v", nonce)
+		}
+
+		seen[nonce] = true
+	}
+}
+
+func TestSecurityPolicyNonce(t *testing.T) {
+	config := ContentSecurityPolicyConfig{
+		Enabled: true,
+		Default: []string{"self"},
+		Script: ContentSecurityPolicyType{
+			SRC: []string{"https://cdn.example.com"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		policy       *ContentSecurityPolicy
+		nonceEnabled bool
+		enabled      bool
+		expected     string
+	}{
+		{
+			name:         "script directive",
+			policy:       NewContentSecurityPolicy(config),
+			nonceEnabled: true,
+			enabled:      true,
+			expected:     "default-src 'self'; script-src https://cdn.example.com 'nonce-abc'",
+		},
+		{
+			name:         "default directive fallback",
+			policy:       NewContentSecurityPolicy(config).Without("script-src"),
+			nonceEnabled: true,
+			enabled:      true,
+			expected:     "default-src 'self'; script-src 'self' 'nonce-abc'",
+		},
+		{
+			name:         "none source",
+			policy:       NewContentSecurityPolicy(ContentSecurityPolicyConfig{Default: []string{"none"}}),
+			nonceEnabled: true,
+			enabled:      true,
+			expected:     "default-src 'none'; script-src 'nonce-abc'",
+		},
+		{
+			name:     "nonce disabled",
+			policy:   NewContentSecurityPolicy(config),
+			enabled:  true,
+			expected: "default-src 'self'; script-src https://cdn.example.com",
+		},
+		{
+			name:         "policy disabled",
+			policy:       NewContentSecurityPolicy(config),
+			nonceEnabled: true,
+			expected:     "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Config.Configuration = &Configuration{
+				Security: SecurityConfig{
+					NonceEnabled: test.nonceEnabled,
+					CSP:          ContentSecurityPolicyConfig{Enabled: test.enabled},
+				},
+			}
+
+			w := httptest.NewRecorder()
+			r := &RequestSecurityPolicy{Policy: test.policy, Nonce: "abc"}
+			r.SetHeader(w)
+
+			if header := w.Header().Get("Content-Security-Policy"); header != test.expected {
+				t.Fatalf("Expected header %q got %q", test.expected, header)
+			}
+		})
+	}
+}
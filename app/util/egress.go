@@ -0,0 +1,222 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// EgressPolicy struct used to restrict the addresses reachable by outbound requests
+type EgressPolicy struct {
+	AllowPrivate bool
+	allowHosts   []string
+	allowNets    []*net.IPNet
+	denyHosts    []string
+	denyNets     []*net.IPNet
+}
+
+// EgressError error returned when an outbound request is blocked by the egress policy
+type EgressError struct {
+	Host   string
+	Reason string
+}
+
+var (
+	// privateNets address ranges blocked unless explicitly allowed
+	privateNets = parseNets([]string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	})
+)
+
+// Error returns the egress error message
+func (e *EgressError) Error() string {
+	return fmt.Sprintf("Outbound request to %v blocked by egress policy: %v", e.Host, e.Reason)
+}
+
+// NewEgressPolicy creates an egress policy from the given allow and deny lists. Entries
+// can be host names, wildcard host names (*.example.com), addresses or CIDR ranges
+func NewEgressPolicy(allow, deny []string, allowPrivate bool) *EgressPolicy {
+	p := &EgressPolicy{
+		AllowPrivate: allowPrivate,
+	}
+
+	p.allowHosts, p.allowNets = splitEgressList(allow)
+	p.denyHosts, p.denyNets = splitEgressList(deny)
+
+	return p
+}
+
+// splitEgressList splits a policy list into host names and address ranges
+func splitEgressList(list []string) ([]string, []*net.IPNet) {
+	hosts := []string{}
+	nets := []*net.IPNet{}
+
+	for _, entry := range list {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+
+		if entry == "" {
+			continue
+		}
+
+		// Parse CIDR range
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+
+		// Parse single address
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		hosts = append(hosts, entry)
+	}
+
+	return hosts, nets
+}
+
+// parseNets parses a list of CIDR ranges
+func parseNets(list []string) []*net.IPNet {
+	nets := []*net.IPNet{}
+
+	for _, entry := range list {
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
+
+// matchHost checks if the host matches any of the given host names
+func matchHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchIP checks if the address is inside any of the given ranges
+func matchIP(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckHost checks if the given host name is allowed before resolving it
+func (p *EgressPolicy) CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if matchHost(host, p.denyHosts) {
+		return &EgressError{Host: host, Reason: "host is denied"}
+	}
+
+	return nil
+}
+
+// CheckIP checks if the given resolved address of host is allowed
+func (p *EgressPolicy) CheckIP(host string, ip net.IP) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if matchIP(ip, p.denyNets) {
+		return &EgressError{Host: host, Reason: fmt.Sprintf("address %v is denied", ip)}
+	}
+
+	// Explicitly allowed hosts and ranges skip the remaining checks
+	allowed := matchHost(host, p.allowHosts) || matchIP(ip, p.allowNets)
+
+	if allowed {
+		return nil
+	}
+
+	if len(p.allowHosts) > 0 || len(p.allowNets) > 0 {
+		return &EgressError{Host: host, Reason: "host is not in the allow list"}
+	}
+
+	if !p.AllowPrivate && matchIP(ip, privateNets) {
+		return &EgressError{Host: host, Reason: fmt.Sprintf("address %v is private", ip)}
+	}
+
+	return nil
+}
+
+// DialContext resolves the address and connects to the first address allowed by the policy.
+// Connecting to the checked address prevents DNS rebinding between the check and the dial
+func (p *EgressPolicy) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.CheckHost(host); err != nil {
+			return nil, err
+		}
+
+		// Resolve host addresses
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+
+		for _, a := range addrs {
+			if err := p.CheckIP(host, a.IP); err != nil {
+				lastErr = err
+				continue
+			}
+
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a.IP.String(), port))
+
+			if err == nil {
+				return conn, nil
+			}
+
+			lastErr = err
+		}
+
+		if lastErr == nil {
+			lastErr = fmt.Errorf("Cannot resolve %v", host)
+		}
+
+		return nil, lastErr
+	}
+}
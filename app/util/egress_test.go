@@ -0,0 +1,123 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOutboundEgressPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if to := req.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, req, to, http.StatusFound)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	tests := []struct {
+		name    string
+		config  OutboundConfig
+		url     string
+		blocked bool
+	}{
+		{
+			name:    "private address",
+			url:     "http://127.0.0.1:" + port,
+			blocked: true,
+		},
+		{
+			name:    "private address resolved by dns",
+			url:     "http://localhost:" + port,
+			blocked: true,
+		},
+		{
+			name:   "allowed private address",
+			config: OutboundConfig{AllowPrivate: true},
+			url:    "http://127.0.0.1:" + port,
+		},
+		{
+			name:    "denied range resolved by dns",
+			config:  OutboundConfig{AllowPrivate: true, Deny: []string{"127.0.0.0/8"}},
+			url:     "http://localhost:" + port,
+			blocked: true,
+		},
+		{
+			name:    "redirect to a denied address",
+			config:  OutboundConfig{AllowPrivate: true, Deny: []string{"127.0.0.2"}},
+			url:     "http://127.0.0.1:" + port + "/?to=http://127.0.0.2:" + port + "/",
+			blocked: true,
+		},
+		{
+			name:    "redirect to a host outside the allow list",
+			config:  OutboundConfig{Allow: []string{"localhost"}},
+			url:     "http://localhost:" + port + "/?to=http://127.0.0.1:" + port + "/",
+			blocked: true,
+		},
+		{
+			name:   "redirect inside the allow list",
+			config: OutboundConfig{Allow: []string{"localhost", "127.0.0.1"}},
+			url:    "http://localhost:" + port + "/?to=http://127.0.0.1:" + port + "/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Config.Configuration = &Configuration{Outbound: test.config}
+
+			resp, err := (&OutboundClient{}).Do(&OutboundRequest{
+				URL:     test.url,
+				Retries: 0,
+				Origin:  "test",
+			})
+
+			var egressErr *EgressError
+
+			if blocked := errors.As(err, &egressErr); blocked != test.blocked {
+				t.Fatalf("Expected request to be blocked %v got %v", test.blocked, err)
+			}
+
+			if !test.blocked && (err != nil || string(resp.Body) != "ok") {
+				t.Fatalf("Expected ok response got %v", err)
+			}
+		})
+	}
+}
+
+func TestEgressPolicyCheckIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *EgressPolicy
+		host    string
+		ip      string
+		blocked bool
+	}{
+		{name: "public address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "93.184.216.34"},
+		{name: "loopback address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "127.0.0.1", blocked: true},
+		{name: "private address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "192.168.1.10", blocked: true},
+		{name: "link-local metadata address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "169.254.169.254", blocked: true},
+		{name: "mapped loopback address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "::ffff:127.0.0.1", blocked: true},
+		{name: "unique local address", policy: NewEgressPolicy(nil, nil, false), host: "example.com", ip: "fd00::1", blocked: true},
+		{name: "allowed private address", policy: NewEgressPolicy(nil, nil, true), host: "example.com", ip: "10.0.0.1"},
+		{name: "allowed host", policy: NewEgressPolicy([]string{"*.example.com"}, nil, false), host: "api.example.com", ip: "10.0.0.1"},
+		{name: "host outside the allow list", policy: NewEgressPolicy([]string{"*.example.com"}, nil, false), host: "example.org", ip: "93.184.216.34", blocked: true},
+		{name: "denied range", policy: NewEgressPolicy(nil, []string{"93.184.0.0/16"}, false), host: "example.com", ip: "93.184.216.34", blocked: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.CheckIP(test.host, net.ParseIP(test.ip))
+
+			if blocked := err != nil; blocked != test.blocked {
+				t.Fatalf("Expected %v to be blocked %v got %v", test.ip, test.blocked, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package util
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+)
+
+// JobHandler function used to process a background job payload
+type JobHandler func(job *models.Job, payload map[string]interface{}) error
+
+// JobOptions struct used when enqueuing a background job
+type JobOptions struct {
+	Delay   time.Duration
+	Retries int
+	Key     string
+}
+
+// JobQueue struct used to register job handlers and run the queue workers
+type JobQueue struct {
+	rw       sync.RWMutex
+	handlers map[string]JobHandler
+	wake     chan struct{}
+	started  bool
+}
+
+var (
+	// Jobs main application background job queue
+	Jobs = &JobQueue{
+		handlers: map[string]JobHandler{
+			"mail":    mailJobHandler,
+			"webhook": webhookJobHandler,
+		},
+		wake: make(chan struct{}, 1),
+	}
+
+	// maxJobBackoff maximum time a failed job waits before the next attempt
+	maxJobBackoff = time.Hour * 6
+)
+
+// Register sets the handler for the given job name
+func (q *JobQueue) Register(name string, handler JobHandler) {
+	// Lock mutex
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	q.handlers[name] = handler
+}
+
+// Handler returns the handler for the given job name
+func (q *JobQueue) Handler(name string) (JobHandler, bool) {
+	// Lock mutex
+	q.rw.RLock()
+	defer q.rw.RUnlock()
+
+	h, ok := q.handlers[name]
+	return h, ok
+}
+
+// Enqueue saves a new job to the queue and returns its identifier
+func (q *JobQueue) Enqueue(name string, payload map[string]interface{}, opts JobOptions) (int64, error) {
+	// Encode payload
+	buff, err := json.Marshal(payload)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Set default retries
+	if opts.Retries <= 0 {
+		opts.Retries = Config.Configuration.Jobs.Retries
+	}
+
+	now := time.Now()
+
+	// Create job
+	job := &models.Job{
+		Name:         name,
+		Payload:      string(buff),
+		Max_attempts: opts.Retries + 1,
+		Idempotency_key: sql.NullString{
+			String: opts.Key,
+			Valid:  opts.Key != "",
+		},
+		Run_at:     now.Add(opts.Delay).Unix(),
+		Created_at: now.Unix(),
+		Updated_at: now.Unix(),
+	}
+
+	id, err := models.CreateJob(job)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Wake up an idle worker
+	if opts.Delay <= 0 {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return id, nil
+}
+
+// Dispatch enqueues the given job when the queue workers are enabled. Otherwise the job
+// handler runs right away so side effects are not left waiting for a worker
+func (q *JobQueue) Dispatch(name string, payload map[string]interface{}, opts JobOptions) error {
+	if Config.Configuration.Jobs.Enabled {
+		_, err := q.Enqueue(name, payload, opts)
+		return err
+	}
+
+	// Encode payload so the handler receives the same values a worker would
+	buff, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	return q.execute(&models.Job{
+		Name:         name,
+		Payload:      string(buff),
+		Status:       models.JobRunning,
+		Attempts:     1,
+		Max_attempts: 1,
+		Idempotency_key: sql.NullString{
+			String: opts.Key,
+			Valid:  opts.Key != "",
+		},
+		Run_at:     now.Unix(),
+		Created_at: now.Unix(),
+		Updated_at: now.Unix(),
+	})
+}
+
+// Retry moves a failed job back to the queue
+func (q *JobQueue) Retry(id int64) error {
+	if err := models.RetryJob(id); err != nil {
+		return err
+	}
+
+	// Wake up an idle worker
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start runs the queue workers using the job configuration
+func (q *JobQueue) Start() {
+	// Lock mutex
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	// Workers can only be started once
+	if q.started {
+		return
+	}
+	q.started = true
+
+	// Set worker defaults
+	workers := Config.Configuration.Jobs.Workers
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	poll := Config.Configuration.Jobs.Poll.Duration
+
+	if poll <= 0 {
+		poll = time.Second * 5
+	}
+
+	timeout := Config.Configuration.Jobs.Timeout.Duration
+
+	if timeout <= 0 {
+		timeout = time.Minute * 10
+	}
+
+	// Run workers
+	for i := 0; i < workers; i++ {
+		go q.worker(poll)
+	}
+
+	// Run stale job watcher
+	go q.releaseStaleJobs(timeout)
+}
+
+func (q *JobQueue) worker(poll time.Duration) {
+	// Create poll ticker
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		// Process all due jobs
+		for q.runNextJob() {
+		}
+
+		// Wait for new jobs
+		select {
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// runNextJob claims and executes the next due job. Returns false if there was nothing to run
+func (q *JobQueue) runNextJob() bool {
+	// Claim next job
+	job, err := models.ClaimNextJob(time.Now())
+
+	if err != nil {
+		Logger.Logger.Errorf("Cannot claim background job: %v", err)
+		return false
+	}
+
+	if job == nil {
+		return false
+	}
+
+	// Execute job handler
+	if err := q.execute(job); err != nil {
+
+		// Record failure
+		if err := job.FailJob(err.Error(), time.Now().Add(jobBackoff(job.Attempts))); err != nil {
+			Logger.Logger.Errorf("Cannot save background job %v failure: %v", job.ID, err)
+		}
+
+		Logger.Logger.Errorf("Background job %v (%v) failed on attempt %v/%v: %v", job.ID, job.Name, job.Attempts, job.Max_attempts, err)
+
+		// Let listeners know about dead jobs
+		if job.Attempts >= job.Max_attempts {
+			Bus.EmitAsync("jobs.dead", map[string]interface{}{
+				"id":    job.ID,
+				"name":  job.Name,
+				"error": err.Error(),
+			})
+		}
+
+		return true
+	}
+
+	// Mark job as done
+	if err := job.CompleteJob(); err != nil {
+		Logger.Logger.Errorf("Cannot mark background job %v as done: %v", job.ID, err)
+	}
+
+	return true
+}
+
+// execute runs the job handler recovering from panics
+func (q *JobQueue) execute(job *models.Job) (err error) {
+	// Get job handler
+	handler, ok := q.Handler(job.Name)
+
+	if !ok {
+		return fmt.Errorf("No handler registered for job %v", job.Name)
+	}
+
+	// Decode payload
+	payload := map[string]interface{}{}
+
+	if job.Payload != "" {
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+	}
+
+	// Recover from handler panics
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Job handler panic: %v", r)
+		}
+	}()
+
+	return handler(job, payload)
+}
+
+func (q *JobQueue) releaseStaleJobs(timeout time.Duration) {
+	// Create watcher ticker
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Move stale jobs back to the queue
+			n, dead, err := models.ReleaseStaleJobs(time.Now().Add(-timeout))
+
+			if err != nil {
+				Logger.Logger.Errorf("Cannot release stale background jobs: %v", err)
+				continue
+			}
+
+			if n > 0 {
+				Logger.Logger.Infof("Released %v stale background jobs", n)
+			}
+
+			if dead > 0 {
+				Logger.Logger.Errorf("%v stale background jobs ran out of attempts", dead)
+			}
+		}
+	}
+}
+
+// jobBackoff returns the time to wait before the next attempt of a job
+func jobBackoff(attempts int) time.Duration {
+	// Get base backoff
+	base := Config.Configuration.Jobs.Backoff.Duration
+
+	if base <= 0 {
+		base = time.Second * 30
+	}
+
+	// Double the backoff for each attempt
+	d := base
+
+	for i := 1; i < attempts; i++ {
+		d *= 2
+
+		if d >= maxJobBackoff {
+			return maxJobBackoff
+		}
+	}
+
+	return d
+}
+
+// mailJobHandler sends an email from the job payload
+func mailJobHandler(job *models.Job, payload map[string]interface{}) error {
+	// Get payload fields
+	to, ok := payload["to"].(string)
+
+	if !ok {
+		return errors.New("Missing 'to' payload field")
+	}
+
+	subject, _ := payload["subject"].(string)
+	body, _ := payload["body"].(string)
+
+	return SendMail(to, subject, body)
+}
+
+// webhookJobHandler posts the job payload body as JSON to the payload url
+func webhookJobHandler(job *models.Job, payload map[string]interface{}) error {
+	// Get webhook url
+	url, ok := payload["url"].(string)
+
+	if !ok {
+		return errors.New("Missing 'url' payload field")
+	}
+
+	// Encode webhook body
+	buff, err := json.Marshal(payload["body"])
+
+	if err != nil {
+		return err
+	}
+
+	// Set idempotency header so receivers can discard duplicated deliveries
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	if job.Idempotency_key.Valid {
+		header.Set("Idempotency-Key", job.Idempotency_key.String)
+	}
+
+	// Send the webhook through the outbound client so the egress policy applies.
+	// Failed deliveries are retried by the job queue
+	resp, err := Outbound.Do(&OutboundRequest{
+		Method:  http.MethodPost,
+		URL:     url,
+		Header:  header,
+		Body:    buff,
+		Timeout: time.Second * 30,
+		Retries: 0,
+		Origin:  fmt.Sprintf("job %v", job.ID),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Check response status
+	if resp.Status < 200 || resp.Status > 299 {
+		return fmt.Errorf("Webhook returned status %v", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/raggaer/castro/app/models"
+)
+
+func TestJobDispatchWithoutWorkers(t *testing.T) {
+	Config.Configuration = &Configuration{}
+
+	q := &JobQueue{
+		handlers: map[string]JobHandler{},
+		wake:     make(chan struct{}, 1),
+	}
+
+	var (
+		ran     *models.Job
+		payload map[string]interface{}
+	)
+
+	q.Register("test", func(job *models.Job, p map[string]interface{}) error {
+		ran = job
+		payload = p
+
+		if p["fail"] == true {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+
+	// The handler runs right away with the encoded payload
+	if err := q.Dispatch("test", map[string]interface{}{"points": 10}, JobOptions{Key: "key"}); err != nil {
+		t.Fatalf("Cannot dispatch job: %v", err)
+	}
+
+	if ran == nil || ran.Name != "test" || ran.Idempotency_key.String != "key" {
+		t.Fatalf("Unexpected dispatched job %+v", ran)
+	}
+
+	if points, ok := payload["points"].(float64); !ok || points != 10 {
+		t.Fatalf("Expected encoded payload got %#v", payload["points"])
+	}
+
+	// Handler errors are returned to the caller
+	if err := q.Dispatch("test", map[string]interface{}{"fail": true}, JobOptions{}); err == nil || err.Error() != "failed" {
+		t.Fatalf("Expected handler error got %v", err)
+	}
+
+	if err := q.Dispatch("missing", nil, JobOptions{}); err == nil {
+		t.Fatalf("Expected missing handler error")
+	}
+}
+
+func TestMailJobKey(t *testing.T) {
+	key := MailJobKey("test@castro.test", "Welcome", "Hello")
+
+	tests := []struct {
+		to, subject, body string
+		same              bool
+	}{
+		{"test@castro.test", "Welcome", "Hello", true},
+		{"other@castro.test", "Welcome", "Hello", false},
+		{"test@castro.test", "Welcome!", "Hello", false},
+		{"test@castro.test", "Welcome", "Hello!", false},
+		{"test@castro.test", "Welcome\nHello", "", false},
+	}
+
+	for _, test := range tests {
+		if same := MailJobKey(test.to, test.subject, test.body) == key; same != test.same {
+			t.Fatalf("Expected key of %q %q %q to match %v", test.to, test.subject, test.body, test.same)
+		}
+	}
+
+	if !strings.HasPrefix(key, "test@castro.test:") {
+		t.Fatalf("Expected key to start with the recipient got %v", key)
+	}
+
+	// Long recipients are hashed to fit the idempotency key column
+	if key := MailJobKey(strings.Repeat("a", 250)+"@castro.test", "Welcome", "Hello"); len(key) > 255 {
+		t.Fatalf("Expected key of at most 255 characters got %v", len(key))
+	}
+}
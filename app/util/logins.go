@@ -0,0 +1,403 @@
+package util
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+)
+
+// LoginLock struct used for the lockout status of a login attempt
+type LoginLock struct {
+	Locked    bool
+	Remaining time.Duration
+}
+
+// LoginAttemptStore interface used to load and save the failed login counters
+type LoginAttemptStore interface {
+	// Get returns the counter of the given key or nil if there is no counter
+	Get(key string) (*models.LoginAttempt, error)
+
+	// Save creates or updates the given counter
+	Save(a *models.LoginAttempt) error
+
+	// Delete removes the counter of the given key
+	Delete(key string) error
+}
+
+// databaseLoginAttemptStore login attempt store saved on the castro_login_attempts table
+type databaseLoginAttemptStore struct{}
+
+// MemoryLoginAttemptStore login attempt store used by tests
+type MemoryLoginAttemptStore struct {
+	rw       sync.RWMutex
+	attempts map[string]models.LoginAttempt
+}
+
+var (
+	// loginAttemptOverride store used instead of the database when set
+	loginAttemptOverride   LoginAttemptStore
+	loginAttemptOverrideRw sync.RWMutex
+)
+
+// SetLoginAttemptStore replaces the database login attempt store. Used by tests to set a
+// memory store, passing nil restores the database store
+func SetLoginAttemptStore(s LoginAttemptStore) {
+	loginAttemptOverrideRw.Lock()
+	defer loginAttemptOverrideRw.Unlock()
+
+	loginAttemptOverride = s
+}
+
+// loginAttempts returns the login attempt store
+func loginAttempts() LoginAttemptStore {
+	loginAttemptOverrideRw.RLock()
+	defer loginAttemptOverrideRw.RUnlock()
+
+	if loginAttemptOverride != nil {
+		return loginAttemptOverride
+	}
+
+	return databaseLoginAttemptStore{}
+}
+
+func (databaseLoginAttemptStore) Get(key string) (*models.LoginAttempt, error) {
+	return models.GetLoginAttempt(key)
+}
+
+func (databaseLoginAttemptStore) Save(a *models.LoginAttempt) error {
+	return models.SaveLoginAttempt(a)
+}
+
+func (databaseLoginAttemptStore) Delete(key string) error {
+	return models.DeleteLoginAttempt(key)
+}
+
+// NewMemoryLoginAttemptStore creates an empty memory login attempt store
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		attempts: map[string]models.LoginAttempt{},
+	}
+}
+
+// Get returns a copy of the counter of the given key
+func (m *MemoryLoginAttemptStore) Get(key string) (*models.LoginAttempt, error) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	a, ok := m.attempts[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &a, nil
+}
+
+// Save stores a copy of the given counter
+func (m *MemoryLoginAttemptStore) Save(a *models.LoginAttempt) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	m.attempts[a.Key] = *a
+
+	return nil
+}
+
+// Delete removes the counter of the given key
+func (m *MemoryLoginAttemptStore) Delete(key string) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+// loginAttemptKeys returns the failed login counter keys of an account name and address
+func loginAttemptKeys(name, ip string) (string, string) {
+	return "account:" + strings.ToLower(name), "ip:" + ip
+}
+
+// LoginNetwork returns the network of the given address used to detect new login locations.
+// IPv4 addresses use their /24 network and IPv6 addresses their /48 network
+func LoginNetwork(ip string) string {
+	addr := net.ParseIP(ip)
+
+	if addr == nil {
+		return ip
+	}
+
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+
+	return addr.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// loginLockout returns the lockout duration for the given amount of failures. The lockout
+// doubles for every failure over the limit
+func loginLockout(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+
+	base := Config.Configuration.Login.Lockout.Duration
+
+	if base <= 0 {
+		base = time.Minute
+	}
+
+	max := Config.Configuration.Login.MaxLockout.Duration
+
+	if max <= 0 {
+		max = time.Hour
+	}
+
+	d := base
+
+	for i := limit; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// getLoginAttempt returns the failed login counter of the given key. Counters without
+// failures during the configured window are reset
+func getLoginAttempt(key string, now time.Time) (*models.LoginAttempt, error) {
+	a, err := loginAttempts().Get(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	window := Config.Configuration.Login.Window.Duration
+
+	if window <= 0 {
+		window = time.Minute * 15
+	}
+
+	if a == nil || (a.Locked_until < now.Unix() && a.Last_failure < now.Add(-window).Unix()) {
+		return &models.LoginAttempt{
+			Key: key,
+		}, nil
+	}
+
+	return a, nil
+}
+
+// LoginLockStatus returns the lockout status of the given account name and address
+func LoginLockStatus(name, ip string) (LoginLock, error) {
+	now := time.Now()
+	status := LoginLock{}
+
+	accountKey, ipKey := loginAttemptKeys(name, ip)
+
+	for _, key := range []string{accountKey, ipKey} {
+		a, err := getLoginAttempt(key, now)
+
+		if err != nil {
+			return status, err
+		}
+
+		if remaining := time.Unix(a.Locked_until, 0).Sub(now); remaining > status.Remaining {
+			status.Locked = true
+			status.Remaining = remaining
+		}
+	}
+
+	return status, nil
+}
+
+// LoginCaptchaRequired checks if the given account name or address failed enough logins to
+// require a captcha answer
+func LoginCaptchaRequired(name, ip string) (bool, error) {
+	limit := Config.Configuration.Login.CaptchaAfter
+
+	if limit <= 0 || !Config.Configuration.Captcha.Enabled {
+		return false, nil
+	}
+
+	now := time.Now()
+	accountKey, ipKey := loginAttemptKeys(name, ip)
+
+	for _, key := range []string{accountKey, ipKey} {
+		a, err := getLoginAttempt(key, now)
+
+		if err != nil {
+			return false, err
+		}
+
+		if a.Failures >= limit {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RecordLoginFailure increases the failed login counters of the given account name and address
+// returning the resulting lockout status
+func RecordLoginFailure(name, ip string) (LoginLock, error) {
+	now := time.Now()
+	status := LoginLock{}
+	accountKey, ipKey := loginAttemptKeys(name, ip)
+
+	for _, c := range []struct {
+		key   string
+		limit int
+	}{
+		{accountKey, Config.Configuration.Login.MaxAttempts},
+		{ipKey, Config.Configuration.Login.IPMaxAttempts},
+	} {
+		a, err := getLoginAttempt(c.key, now)
+
+		if err != nil {
+			return status, err
+		}
+
+		a.Failures++
+		a.Last_failure = now.Unix()
+
+		if lockout := loginLockout(a.Failures, c.limit); lockout > 0 {
+			a.Locked_until = now.Add(lockout).Unix()
+
+			if lockout > status.Remaining {
+				status.Locked = true
+				status.Remaining = lockout
+			}
+		}
+
+		if err := loginAttempts().Save(a); err != nil {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// RecordLoginSuccess resets the failed login counter of the given account name and saves the
+// login on the account history. Returns true when the login comes from a new device or location
+func RecordLoginSuccess(name, ip, userAgent string, twoFactor bool) (bool, error) {
+	accountKey, _ := loginAttemptKeys(name, ip)
+
+	// The address counter is not reset so attackers can not reset it using their own account
+	if err := loginAttempts().Delete(accountKey); err != nil {
+		return false, err
+	}
+
+	account, _, err := models.GetAccountByName(name)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	network := LoginNetwork(ip)
+
+	known, hasHistory, err := models.IsKnownLoginDevice(account.ID, network, userAgent)
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := models.CreateLoginHistory(&models.LoginHistory{
+		Account_id: account.ID,
+		IP:         ip,
+		Network:    network,
+		User_agent: userAgent,
+		Success:    true,
+		Two_factor: twoFactor,
+		Created_at: time.Now().Unix(),
+	}); err != nil {
+		return false, err
+	}
+
+	// The first login of an account is never reported
+	if known || !hasHistory {
+		return false, nil
+	}
+
+	if Config.Configuration.Login.Notify && Config.Configuration.Mail.Enabled && account.Email != "" {
+		if err := notifyNewLoginDevice(account, ip, userAgent); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// RecordFailedLoginHistory saves a failed login on the history of the given account name
+func RecordFailedLoginHistory(name, ip, userAgent string) error {
+	account, _, err := models.GetAccountByName(name)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		return err
+	}
+
+	return models.CreateLoginHistory(&models.LoginHistory{
+		Account_id: account.ID,
+		IP:         ip,
+		Network:    LoginNetwork(ip),
+		User_agent: userAgent,
+		Success:    false,
+		Created_at: time.Now().Unix(),
+	})
+}
+
+// UnlockLogin removes the failed login counter of the given account name
+func UnlockLogin(name string) error {
+	accountKey, _ := loginAttemptKeys(name, "")
+	return loginAttempts().Delete(accountKey)
+}
+
+// PurgeLoginAttempts removes the expired failed login counters
+func PurgeLoginAttempts() error {
+	window := Config.Configuration.Login.Window.Duration
+
+	if window <= 0 {
+		window = time.Minute * 15
+	}
+
+	now := time.Now()
+
+	return models.PurgeLoginAttempts(now.Add(-window).Unix(), now.Unix())
+}
+
+// notifyNewLoginDevice queues an email telling the account owner about a login from a new device
+func notifyNewLoginDevice(account models.Account, ip, userAgent string) error {
+	body := fmt.Sprintf(
+		"<p>Your account <b>%s</b> was accessed from a new device or location.</p><p>Address: %s<br>Browser: %s<br>Time: %s</p><p>If this was not you change your password and review your active devices at <a href=\"%s/subtopic/account/devices\">%s</a>.</p>",
+		html.EscapeString(account.Name),
+		html.EscapeString(ip),
+		html.EscapeString(userAgent),
+		time.Now().Format(time.RFC1123),
+		html.EscapeString(strings.TrimSuffix(Config.Configuration.URL, "/")),
+		html.EscapeString(Config.Configuration.URL),
+	)
+
+	_, err := Jobs.Enqueue("mail", map[string]interface{}{
+		"to":      account.Email,
+		"subject": "New login to your account",
+		"body":    body,
+	}, JobOptions{})
+
+	return err
+}
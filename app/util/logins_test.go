@@ -0,0 +1,200 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+)
+
+func TestLoginLockout(t *testing.T) {
+	Config.Configuration = &Configuration{
+		Login: LoginConfig{
+			Lockout:    StringDuration{Duration: time.Minute},
+			MaxLockout: StringDuration{Duration: time.Minute * 10},
+		},
+	}
+
+	tests := []struct {
+		failures, limit int
+		expected        time.Duration
+	}{
+		{failures: 4, limit: 5, expected: 0},
+		{failures: 5, limit: 5, expected: time.Minute},
+		{failures: 6, limit: 5, expected: time.Minute * 2},
+		{failures: 8, limit: 5, expected: time.Minute * 8},
+		{failures: 9, limit: 5, expected: time.Minute * 10},
+		{failures: 100, limit: 5, expected: time.Minute * 10},
+		{failures: 100, limit: 0, expected: 0},
+	}
+
+	for _, test := range tests {
+		if lockout := loginLockout(test.failures, test.limit); lockout != test.expected {
+			t.Errorf("Expected lockout of %v failures over %v to be %v got %v", test.failures, test.limit, test.expected, lockout)
+		}
+	}
+}
+
+func TestLoginNetwork(t *testing.T) {
+	tests := []struct {
+		ip, expected string
+	}{
+		{"203.0.113.54", "203.0.113.0/24"},
+		{"203.0.113.200", "203.0.113.0/24"},
+		{"::ffff:203.0.113.54", "203.0.113.0/24"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::/48"},
+		{"invalid", "invalid"},
+	}
+
+	for _, test := range tests {
+		if network := LoginNetwork(test.ip); network != test.expected {
+			t.Errorf("Expected network of %v to be %v got %v", test.ip, test.expected, network)
+		}
+	}
+}
+
+func TestLoginProtection(t *testing.T) {
+	type attempt struct {
+		name, ip string
+	}
+
+	tests := []struct {
+		name     string
+		failures []attempt
+		// stale counters are moved out of the failure window before checking
+		stale   bool
+		check   attempt
+		locked  bool
+		captcha bool
+	}{
+		{
+			name:     "below the limits",
+			failures: []attempt{{"castro", "192.0.2.1"}, {"castro", "192.0.2.2"}},
+			check:    attempt{"castro", "192.0.2.3"},
+			captcha:  true,
+		},
+		{
+			name:     "account limit from several addresses",
+			failures: []attempt{{"castro", "192.0.2.1"}, {"Castro", "192.0.2.2"}, {"CASTRO", "192.0.2.3"}},
+			check:    attempt{"castro", "192.0.2.4"},
+			locked:   true,
+			captcha:  true,
+		},
+		{
+			name:     "other account",
+			failures: []attempt{{"castro", "192.0.2.1"}, {"castro", "192.0.2.2"}, {"castro", "192.0.2.3"}},
+			check:    attempt{"other", "192.0.2.4"},
+		},
+		{
+			name:     "address limit on several accounts",
+			failures: []attempt{{"a", "192.0.2.1"}, {"b", "192.0.2.1"}, {"c", "192.0.2.1"}, {"d", "192.0.2.1"}, {"e", "192.0.2.1"}},
+			check:    attempt{"other", "192.0.2.1"},
+			locked:   true,
+			captcha:  true,
+		},
+		{
+			name:     "expired failures",
+			failures: []attempt{{"castro", "192.0.2.1"}, {"castro", "192.0.2.2"}, {"castro", "192.0.2.3"}},
+			stale:    true,
+			check:    attempt{"castro", "192.0.2.4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Config.Configuration = &Configuration{
+				Captcha: CaptchaConfig{Enabled: true},
+				Login: LoginConfig{
+					MaxAttempts:   3,
+					IPMaxAttempts: 5,
+					CaptchaAfter:  2,
+					Window:        StringDuration{Duration: time.Minute},
+				},
+			}
+
+			store := NewMemoryLoginAttemptStore()
+			SetLoginAttemptStore(store)
+			defer SetLoginAttemptStore(nil)
+
+			for _, f := range test.failures {
+				if _, err := RecordLoginFailure(f.name, f.ip); err != nil {
+					t.Fatalf("Cannot record login failure: %v", err)
+				}
+			}
+
+			if test.stale {
+				for key, a := range store.attempts {
+					a.Last_failure -= 120
+					a.Locked_until -= 3600
+					store.attempts[key] = a
+				}
+			}
+
+			lock, err := LoginLockStatus(test.check.name, test.check.ip)
+
+			if err != nil {
+				t.Fatalf("Cannot get lock status: %v", err)
+			}
+
+			if lock.Locked != test.locked || (lock.Locked && lock.Remaining <= 0) {
+				t.Fatalf("Expected locked %v got %+v", test.locked, lock)
+			}
+
+			captcha, err := LoginCaptchaRequired(test.check.name, test.check.ip)
+
+			if err != nil {
+				t.Fatalf("Cannot get captcha status: %v", err)
+			}
+
+			if captcha != test.captcha {
+				t.Fatalf("Expected captcha %v got %v", test.captcha, captcha)
+			}
+		})
+	}
+}
+
+func TestUnlockLoginKeepsAddressCounter(t *testing.T) {
+	Config.Configuration = &Configuration{
+		Login: LoginConfig{
+			MaxAttempts:   1,
+			IPMaxAttempts: 1,
+		},
+	}
+
+	SetLoginAttemptStore(NewMemoryLoginAttemptStore())
+	defer SetLoginAttemptStore(nil)
+
+	if lock, err := RecordLoginFailure("castro", "192.0.2.1"); err != nil || !lock.Locked {
+		t.Fatalf("Expected login to be locked got %+v %v", lock, err)
+	}
+
+	if err := UnlockLogin("Castro"); err != nil {
+		t.Fatalf("Cannot unlock login: %v", err)
+	}
+
+	tests := []struct {
+		ip     string
+		locked bool
+	}{
+		{"192.0.2.2", false},
+		{"192.0.2.1", true},
+	}
+
+	for _, test := range tests {
+		if lock, err := LoginLockStatus("castro", test.ip); err != nil || lock.Locked != test.locked {
+			t.Fatalf("Expected %v to be locked %v got %+v %v", test.ip, test.locked, lock, err)
+		}
+	}
+}
+
+func TestMemoryLoginAttemptStoreCopies(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	a := &models.LoginAttempt{Key: "account:castro", Failures: 1}
+
+	store.Save(a)
+	a.Failures = 5
+
+	if saved, _ := store.Get("account:castro"); saved == nil || saved.Failures != 1 {
+		t.Fatalf("Expected saved counter to be a copy got %+v", saved)
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SendMail sends a HTML email using the configured SMTP server
+func SendMail(to, subject, body string) error {
+	// Create new gomail object
+	m := gomail.NewMessage()
+
+	// Set from header
+	m.SetHeader("From", Config.Configuration.Mail.Username)
+
+	// Set to header
+	m.SetHeader("To", to)
+
+	// Set subject
+	m.SetHeader("Subject", subject)
+
+	// Set body
+	m.SetBody("text/html", body)
+
+	// Create dialer
+	d := gomail.NewPlainDialer(
+		Config.Configuration.Mail.Server,
+		Config.Configuration.Mail.Port,
+		Config.Configuration.Mail.Username,
+		Config.Configuration.Mail.Password,
+	)
+
+	// Send email
+	return d.DialAndSend(m)
+}
+
+// MailJobKey returns the idempotency key of a mail job so the same message is only
+// queued once for every recipient
+func MailJobKey(to, subject, body string) string {
+	sum := sha256.Sum256([]byte(subject + "\n" + body))
+	key := to + ":" + hex.EncodeToString(sum[:])
+
+	// Idempotency keys are limited to 255 characters
+	if len(key) > 255 {
+		sum = sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+
+	return key
+}
@@ -0,0 +1,240 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OutboundRequest struct used for the outbound http requests made by lua scripts.
+// Zero timeout and backoff values and negative retries use the configuration defaults
+type OutboundRequest struct {
+	Method   string
+	URL      string
+	Header   http.Header
+	Body     []byte
+	Username string
+	Password string
+	Timeout  time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Origin   string
+}
+
+// OutboundResponse struct used for the result of an outbound http request
+type OutboundResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// OutboundClient struct used to share a keep-alive transport between all outbound requests
+type OutboundClient struct {
+	once        sync.Once
+	client      *http.Client
+	limit       chan struct{}
+	policy      *EgressPolicy
+	maxBodySize int64
+}
+
+var (
+	// Outbound main application outbound http client
+	Outbound = &OutboundClient{}
+
+	// errTooManyRedirects error returned when a request exceeds the redirect limit
+	errTooManyRedirects = errors.New("Too many redirects")
+)
+
+// init creates the shared transport, the egress policy and the concurrency limiter
+func (c *OutboundClient) init() {
+	c.once.Do(func() {
+		cfg := Config.Configuration.Outbound
+
+		// Get concurrency limit
+		concurrency := cfg.Concurrency
+
+		if concurrency <= 0 {
+			concurrency = 8
+		}
+
+		// Get idle connections per host
+		idle := cfg.IdleConns
+
+		if idle <= 0 {
+			idle = 16
+		}
+
+		// Get response size limit
+		c.maxBodySize = cfg.MaxBodySize
+
+		if c.maxBodySize <= 0 {
+			c.maxBodySize = 10 << 20
+		}
+
+		// Get redirect limit. Negative values disable redirects
+		redirects := cfg.MaxRedirects
+
+		if redirects == 0 {
+			redirects = 5
+		}
+
+		c.policy = NewEgressPolicy(cfg.Allow, cfg.Deny, cfg.AllowPrivate)
+		c.limit = make(chan struct{}, concurrency)
+		c.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: c.policy.DialContext(&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}),
+				MaxIdleConns:          idle * 4,
+				MaxIdleConnsPerHost:   idle,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > redirects {
+					return errTooManyRedirects
+				}
+
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("Invalid redirect scheme %v", req.URL.Scheme)
+				}
+
+				return nil
+			},
+		}
+	})
+}
+
+// Do executes the given request retrying failed attempts using an exponential backoff
+func (c *OutboundClient) Do(r *OutboundRequest) (*OutboundResponse, error) {
+	c.init()
+
+	// Wait for a free slot
+	c.limit <- struct{}{}
+	defer func() {
+		<-c.limit
+	}()
+
+	// Get request defaults
+	cfg := Config.Configuration.Outbound
+
+	if r.Timeout <= 0 {
+		r.Timeout = cfg.Timeout.Duration
+	}
+
+	if r.Retries < 0 {
+		r.Retries = cfg.Retries
+	}
+
+	if r.Backoff <= 0 {
+		r.Backoff = cfg.Backoff.Duration
+	}
+
+	var resp *OutboundResponse
+	var err error
+
+	start := time.Now()
+
+	for attempt := 0; attempt <= r.Retries; attempt++ {
+		// Wait before retrying
+		if attempt > 0 {
+			time.Sleep(r.Backoff * time.Duration(1<<uint(attempt-1)))
+		}
+
+		resp, err = c.do(r)
+
+		// Policy errors are never retried
+		var egressErr *EgressError
+
+		if errors.As(err, &egressErr) {
+			break
+		}
+
+		// Retry network errors and server errors
+		if err == nil && resp.Status < 500 && resp.Status != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	// Log outbound request
+	if err != nil {
+		Logger.Logger.Warnf("Outbound %v %v from %v failed after %v: %v", r.Method, r.URL, r.Origin, time.Since(start), err)
+		return nil, err
+	}
+
+	Logger.Logger.Infof("Outbound %v %v from %v: %v (%v)", r.Method, r.URL, r.Origin, resp.Status, time.Since(start))
+
+	return resp, nil
+}
+
+// do executes a single request attempt
+func (c *OutboundClient) do(r *OutboundRequest) (*OutboundResponse, error) {
+	if r.URL == "" {
+		return nil, errors.New("Missing request url")
+	}
+
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+
+	// Create request
+	req, err := http.NewRequest(r.Method, r.URL, bytes.NewReader(r.Body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+
+	if r.Username != "" || r.Password != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	// Set request timeout
+	client := c.client
+
+	if r.Timeout > 0 {
+		client = &http.Client{
+			Transport:     c.client.Transport,
+			CheckRedirect: c.client.CheckRedirect,
+			Timeout:       r.Timeout,
+		}
+	}
+
+	// Execute request
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Close response body
+	defer resp.Body.Close()
+
+	// Read response up to the size limit
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxBodySize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > c.maxBodySize {
+		return nil, fmt.Errorf("Response body exceeds the %v bytes limit", c.maxBodySize)
+	}
+
+	return &OutboundResponse{
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   body,
+	}, nil
+}
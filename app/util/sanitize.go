@@ -0,0 +1,199 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// SanitizerList struct used to store the named html sanitizer policies
+type SanitizerList struct {
+	once     sync.Once
+	rw       sync.RWMutex
+	policies map[string]*bluemonday.Policy
+}
+
+var (
+	// Sanitizer main application html sanitizer
+	Sanitizer = &SanitizerList{}
+
+	// safeStyle regular expression of the inline styles allowed by the article policy
+	safeStyle = regexp.MustCompile(`^(\s*(color|background-color|text-align|text-decoration|font-size|font-family|font-weight|font-style|float|width|height|margin(-[a-z]+)?|padding(-[a-z]+)?)\s*:\s*[#a-zA-Z0-9 .,%'"-]+;?)*\s*$`)
+
+	// youtubeEmbed regular expression of the iframes allowed by the article policy
+	youtubeEmbed = regexp.MustCompile(`^https://www\.youtube(-nocookie)?\.com/embed/[a-zA-Z0-9_-]+(\?[a-zA-Z0-9=&_-]*)?$`)
+
+	// basePolicies built-in sanitizer policies
+	basePolicies = map[string]func() *bluemonday.Policy{
+		"strict": bluemonday.StrictPolicy,
+		"comment": func() *bluemonday.Policy {
+			p := bluemonday.NewPolicy()
+			p.AllowElements("b", "i", "u", "s", "em", "strong", "del", "code", "pre", "br", "p", "blockquote")
+			p.AllowLists()
+			p.AllowStandardURLs()
+			p.AllowAttrs("href").OnElements("a")
+			p.RequireNoFollowOnLinks(true)
+			return p
+		},
+		"ugc": func() *bluemonday.Policy {
+			p := bluemonday.UGCPolicy()
+			p.RequireNoFollowOnLinks(true)
+			return p
+		},
+		"article": func() *bluemonday.Policy {
+			p := bluemonday.UGCPolicy()
+			p.AllowStyling()
+			p.AllowAttrs("style").Matching(safeStyle).Globally()
+			p.AllowAttrs("target").Matching(regexp.MustCompile("^_blank$")).OnElements("a")
+			p.AllowAttrs("src").Matching(youtubeEmbed).OnElements("iframe")
+			p.AllowAttrs("allowfullscreen", "width", "height").OnElements("iframe")
+			p.AllowElements("iframe")
+			return p
+		},
+	}
+)
+
+// init creates the built-in policies and the policies declared on the configuration file
+func (s *SanitizerList) init() {
+	s.once.Do(func() {
+		s.rw.Lock()
+		defer s.rw.Unlock()
+
+		s.policies = map[string]*bluemonday.Policy{}
+
+		for name, fn := range basePolicies {
+			s.policies[name] = fn()
+		}
+
+		for name, cfg := range Config.Configuration.Sanitizer.Policies {
+			p, err := NewSanitizePolicy(cfg)
+
+			if err != nil {
+				Logger.Logger.Errorf("Cannot create sanitizer policy %v: %v", name, err)
+				continue
+			}
+
+			s.policies[name] = p
+		}
+	})
+}
+
+// NewSanitizePolicy creates a sanitizer policy from the given declaration. Policies
+// extend one of the built-in policies or start from an empty allowlist
+func NewSanitizePolicy(cfg SanitizePolicyConfig) (*bluemonday.Policy, error) {
+	var p *bluemonday.Policy
+
+	if cfg.Base == "" {
+		p = bluemonday.NewPolicy()
+	} else {
+		fn, ok := basePolicies[cfg.Base]
+
+		if !ok {
+			return nil, fmt.Errorf("Unknown base policy %v", cfg.Base)
+		}
+
+		p = fn()
+	}
+
+	if len(cfg.Elements) > 0 {
+		p.AllowElements(cfg.Elements...)
+	}
+
+	// Sort elements to keep the policy creation deterministic
+	elements := make([]string, 0, len(cfg.Attributes))
+
+	for element := range cfg.Attributes {
+		elements = append(elements, element)
+	}
+
+	sort.Strings(elements)
+
+	for _, element := range elements {
+		attrs := cfg.Attributes[element]
+
+		if len(attrs) == 0 {
+			continue
+		}
+
+		if element == "*" {
+			p.AllowAttrs(attrs...).Globally()
+			continue
+		}
+
+		p.AllowAttrs(attrs...).OnElements(element)
+	}
+
+	if len(cfg.Schemes) > 0 {
+		p.AllowURLSchemes(cfg.Schemes...)
+		p.RequireParseableURLs(true)
+	}
+
+	if cfg.NoFollow {
+		p.RequireNoFollowOnLinks(true)
+	}
+
+	return p, nil
+}
+
+// Set registers a sanitizer policy
+func (s *SanitizerList) Set(name string, p *bluemonday.Policy) {
+	s.init()
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.policies[name] = p
+}
+
+// Exists checks if the given policy exists
+func (s *SanitizerList) Exists(name string) bool {
+	s.init()
+
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	_, ok := s.policies[name]
+
+	return ok
+}
+
+// Sanitize sanitizes the given html using the given policy. An empty policy
+// name uses the configured default policy
+func (s *SanitizerList) Sanitize(html, policy string) (string, error) {
+	s.init()
+
+	if policy == "" {
+		policy = Config.Configuration.Sanitizer.Default
+	}
+
+	if policy == "" {
+		policy = "ugc"
+	}
+
+	s.rw.RLock()
+	p, ok := s.policies[policy]
+	s.rw.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("Unknown sanitizer policy %v", policy)
+	}
+
+	return p.Sanitize(html), nil
+}
+
+// RenderMarkdown renders the given markdown text and sanitizes the result using the given policy
+func (s *SanitizerList) RenderMarkdown(text, policy string) (string, error) {
+	// Normalize line endings
+	src := bytes.Replace([]byte(text), []byte("\r\n"), []byte("\n"), -1)
+
+	out := blackfriday.Run(src, blackfriday.WithExtensions(
+		blackfriday.CommonExtensions|blackfriday.HardLineBreak,
+	))
+
+	return s.Sanitize(string(out), policy)
+}
@@ -0,0 +1,334 @@
+package util
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusConfig struct used for the game server status protocol options
+type StatusConfig struct {
+	Address string
+	Timeout StringDuration
+	Cache   StringDuration
+}
+
+// ServerStatus struct used for the game server status
+type ServerStatus struct {
+	Online    bool
+	Error     string
+	Name      string
+	Server    string
+	Version   string
+	Client    string
+	Location  string
+	URL       string
+	Uptime    int64
+	MOTD      string
+	Players   ServerStatusPlayers
+	Map       ServerStatusMap
+	Monsters  int
+	NPCs      int
+	CheckedAt int64
+}
+
+// ServerStatusPlayers struct used for the game server player counters
+type ServerStatusPlayers struct {
+	Online int
+	Max    int
+	Peak   int
+}
+
+// ServerStatusMap struct used for the game server map information
+type ServerStatusMap struct {
+	Name   string
+	Author string
+	Width  int
+	Height int
+}
+
+// tsqpDocument struct used for the status protocol XML response
+type tsqpDocument struct {
+	XMLName    xml.Name `xml:"tsqp"`
+	ServerInfo struct {
+		Uptime     int64  `xml:"uptime,attr"`
+		ServerName string `xml:"servername,attr"`
+		Location   string `xml:"location,attr"`
+		URL        string `xml:"url,attr"`
+		Server     string `xml:"server,attr"`
+		Version    string `xml:"version,attr"`
+		Client     string `xml:"client,attr"`
+	} `xml:"serverinfo"`
+	Players struct {
+		Online int `xml:"online,attr"`
+		Max    int `xml:"max,attr"`
+		Peak   int `xml:"peak,attr"`
+	} `xml:"players"`
+	Monsters struct {
+		Total int `xml:"total,attr"`
+	} `xml:"monsters"`
+	NPCs struct {
+		Total int `xml:"total,attr"`
+	} `xml:"npcs"`
+	Map struct {
+		Name   string `xml:"name,attr"`
+		Author string `xml:"author,attr"`
+		Width  int    `xml:"width,attr"`
+		Height int    `xml:"height,attr"`
+	} `xml:"map"`
+	MOTD string `xml:"motd"`
+}
+
+// FakeStatusServer status protocol server used by tests
+type FakeStatusServer struct {
+	rw       sync.RWMutex
+	listener net.Listener
+	status   ServerStatus
+}
+
+// statusInfoRequest status protocol info request. Packet length, protocol identifier,
+// request type and the info string
+var statusInfoRequest = []byte{0x06, 0x00, 0xFF, 0xFF, 'i', 'n', 'f', 'o'}
+
+var (
+	// ErrStatusResponse error returned when the game server sends an invalid status response
+	ErrStatusResponse = errors.New("Invalid status response")
+
+	// statusAddressOverride address used instead of the configured one
+	statusAddressOverride   string
+	statusAddressOverrideRw sync.RWMutex
+)
+
+const (
+	// statusCacheKey prefix of the cached game server status
+	statusCacheKey = "castro-server-status:"
+
+	// maxStatusResponse maximum size of a status response
+	maxStatusResponse = 64 * 1024
+)
+
+// SetServerStatusAddress replaces the configured status address. Used by tests to point
+// the status client to a fake server, passing an empty address restores the configured one
+func SetServerStatusAddress(address string) {
+	statusAddressOverrideRw.Lock()
+	defer statusAddressOverrideRw.Unlock()
+
+	statusAddressOverride = address
+}
+
+// ServerStatusAddress returns the status address to use. The override and the configured
+// address take precedence over the given default address
+func ServerStatusAddress(defaultAddress string) string {
+	statusAddressOverrideRw.RLock()
+	defer statusAddressOverrideRw.RUnlock()
+
+	if statusAddressOverride != "" {
+		return statusAddressOverride
+	}
+
+	if Config.Configuration.Status.Address != "" {
+		return Config.Configuration.Status.Address
+	}
+
+	return defaultAddress
+}
+
+// QueryServerStatus sends a status protocol info request to the given address
+func QueryServerStatus(address string, timeout time.Duration) (*ServerStatus, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(statusInfoRequest); err != nil {
+		return nil, err
+	}
+
+	// The server closes the connection after writing the document
+	body, err := ioutil.ReadAll(io.LimitReader(conn, maxStatusResponse))
+
+	if err != nil && len(body) == 0 {
+		return nil, err
+	}
+
+	doc := tsqpDocument{}
+
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, ErrStatusResponse
+	}
+
+	return &ServerStatus{
+		Online:   true,
+		Name:     doc.ServerInfo.ServerName,
+		Server:   doc.ServerInfo.Server,
+		Version:  doc.ServerInfo.Version,
+		Client:   doc.ServerInfo.Client,
+		Location: doc.ServerInfo.Location,
+		URL:      doc.ServerInfo.URL,
+		Uptime:   doc.ServerInfo.Uptime,
+		MOTD:     strings.TrimSpace(doc.MOTD),
+		Players: ServerStatusPlayers{
+			Online: doc.Players.Online,
+			Max:    doc.Players.Max,
+			Peak:   doc.Players.Peak,
+		},
+		Map: ServerStatusMap{
+			Name:   doc.Map.Name,
+			Author: doc.Map.Author,
+			Width:  doc.Map.Width,
+			Height: doc.Map.Height,
+		},
+		Monsters:  doc.Monsters.Total,
+		NPCs:      doc.NPCs.Total,
+		CheckedAt: time.Now().Unix(),
+	}, nil
+}
+
+// GetServerStatus returns the status of the game server at the given address. Results are
+// cached, unreachable servers are returned as offline with the error message
+func GetServerStatus(address string, force bool) *ServerStatus {
+	key := statusCacheKey + address
+
+	if !force {
+		if v, found := Cache.Get(key); found {
+			if status, ok := v.(*ServerStatus); ok {
+				return status
+			}
+		}
+	}
+
+	timeout := Config.Configuration.Status.Timeout.Duration
+
+	if timeout <= 0 {
+		timeout = time.Second * 3
+	}
+
+	status, err := QueryServerStatus(address, timeout)
+
+	if err != nil {
+		status = &ServerStatus{
+			Error:     err.Error(),
+			CheckedAt: time.Now().Unix(),
+		}
+	}
+
+	expiration := Config.Configuration.Status.Cache.Duration
+
+	if expiration <= 0 {
+		expiration = time.Minute
+	}
+
+	Cache.Set(key, status, expiration)
+
+	return status
+}
+
+// FlushServerStatus removes the cached status of the game server at the given address
+func FlushServerStatus(address string) {
+	Cache.Delete(statusCacheKey + address)
+}
+
+// NewFakeStatusServer starts a status protocol server on a random local port answering
+// info requests with the given status
+func NewFakeStatusServer(status ServerStatus) (*FakeStatusServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FakeStatusServer{
+		listener: l,
+		status:   status,
+	}
+
+	go s.serve()
+
+	return s, nil
+}
+
+// Address returns the address of the fake server
+func (s *FakeStatusServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+// SetStatus replaces the status sent by the fake server
+func (s *FakeStatusServer) SetStatus(status ServerStatus) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.status = status
+}
+
+// Close stops the fake server
+func (s *FakeStatusServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *FakeStatusServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *FakeStatusServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	request := make([]byte, len(statusInfoRequest))
+
+	if _, err := io.ReadFull(conn, request); err != nil || string(request) != string(statusInfoRequest) {
+		return
+	}
+
+	s.rw.RLock()
+	status := s.status
+	s.rw.RUnlock()
+
+	doc := tsqpDocument{}
+	doc.ServerInfo.Uptime = status.Uptime
+	doc.ServerInfo.ServerName = status.Name
+	doc.ServerInfo.Location = status.Location
+	doc.ServerInfo.URL = status.URL
+	doc.ServerInfo.Server = status.Server
+	doc.ServerInfo.Version = status.Version
+	doc.ServerInfo.Client = status.Client
+	doc.Players.Online = status.Players.Online
+	doc.Players.Max = status.Players.Max
+	doc.Players.Peak = status.Players.Peak
+	doc.Monsters.Total = status.Monsters
+	doc.NPCs.Total = status.NPCs
+	doc.Map.Name = status.Map.Name
+	doc.Map.Author = status.Map.Author
+	doc.Map.Width = status.Map.Width
+	doc.Map.Height = status.Map.Height
+	doc.MOTD = status.MOTD
+
+	body, err := xml.Marshal(doc)
+
+	if err != nil {
+		return
+	}
+
+	conn.Write([]byte(xml.Header))
+	conn.Write(body)
+}
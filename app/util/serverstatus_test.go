@@ -0,0 +1,273 @@
+package util
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	c "github.com/patrickmn/go-cache"
+)
+
+// setupStatusTest sets the configuration and cache used by the status client
+func setupStatusTest(status StatusConfig) {
+	Config.Configuration = &Configuration{
+		Status: status,
+	}
+
+	Cache = c.New(time.Minute, time.Minute)
+}
+
+// rawStatusServer starts a server answering info requests with the given response.
+// Connections are left open without an answer when response is empty
+func rawStatusServer(t *testing.T, response string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				request := make([]byte, len(statusInfoRequest))
+
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+
+				if response == "" {
+					io.Copy(ioutil.Discard, conn)
+					return
+				}
+
+				conn.Write([]byte(response))
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestQueryServerStatusParsesDocument(t *testing.T) {
+	l := rawStatusServer(t, `<?xml version="1.0"?>
+<tsqp version="1.0">
+	<serverinfo uptime="3600" ip="127.0.0.1" servername="Castro" port="7171" location="Europe" url="https://castro.test" server="TFS" version="1.3" client="10.98"/>
+	<owner name="admin" email="admin@castro.test"/>
+	<players online="12" max="100" peak="42"/>
+	<monsters total="5000"/>
+	<npcs total="120"/>
+	<rates experience="5" skill="3" loot="2" magic="3" spawn="1"/>
+	<map name="forgotten" author="Komic" width="2048" height="2048"/>
+	<motd>
+		Welcome to Castro
+	</motd>
+</tsqp>`)
+
+	defer l.Close()
+
+	status, err := QueryServerStatus(l.Addr().String(), time.Second)
+
+	if err != nil {
+		t.Fatalf("Cannot query status: %v", err)
+	}
+
+	expected := ServerStatus{
+		Online:   true,
+		Name:     "Castro",
+		Server:   "TFS",
+		Version:  "1.3",
+		Client:   "10.98",
+		Location: "Europe",
+		URL:      "https://castro.test",
+		Uptime:   3600,
+		MOTD:     "Welcome to Castro",
+		Players: ServerStatusPlayers{
+			Online: 12,
+			Max:    100,
+			Peak:   42,
+		},
+		Map: ServerStatusMap{
+			Name:   "forgotten",
+			Author: "Komic",
+			Width:  2048,
+			Height: 2048,
+		},
+		Monsters:  5000,
+		NPCs:      120,
+		CheckedAt: status.CheckedAt,
+	}
+
+	if *status != expected {
+		t.Fatalf("Expected status %+v got %+v", expected, *status)
+	}
+}
+
+func TestQueryServerStatusFakeServer(t *testing.T) {
+	server, err := NewFakeStatusServer(ServerStatus{
+		Name:    "Castro",
+		MOTD:    "Hello",
+		Players: ServerStatusPlayers{Online: 3, Max: 10, Peak: 5},
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot start fake status server: %v", err)
+	}
+
+	defer server.Close()
+
+	status, err := QueryServerStatus(server.Address(), time.Second)
+
+	if err != nil {
+		t.Fatalf("Cannot query status: %v", err)
+	}
+
+	if !status.Online || status.Name != "Castro" || status.MOTD != "Hello" || status.Players.Online != 3 || status.Players.Peak != 5 {
+		t.Fatalf("Unexpected status %+v", *status)
+	}
+}
+
+func TestQueryServerStatusErrors(t *testing.T) {
+	// Invalid document
+	l := rawStatusServer(t, "not a status document")
+
+	if _, err := QueryServerStatus(l.Addr().String(), time.Second); err != ErrStatusResponse {
+		t.Fatalf("Expected %v got %v", ErrStatusResponse, err)
+	}
+
+	l.Close()
+
+	// Server not answering
+	l = rawStatusServer(t, "")
+	defer l.Close()
+
+	start := time.Now()
+
+	_, err := QueryServerStatus(l.Addr().String(), time.Millisecond*200)
+
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("Expected timeout error got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Fatalf("Query took %v with a 200ms timeout", elapsed)
+	}
+
+	// Server not listening
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+
+	address := closed.Addr().String()
+	closed.Close()
+
+	if _, err := QueryServerStatus(address, time.Second); err == nil {
+		t.Fatalf("Expected connection error")
+	}
+}
+
+func TestGetServerStatusCache(t *testing.T) {
+	setupStatusTest(StatusConfig{
+		Timeout: StringDuration{Duration: time.Second},
+		Cache:   StringDuration{Duration: time.Minute},
+	})
+
+	server, err := NewFakeStatusServer(ServerStatus{
+		Players: ServerStatusPlayers{Online: 1},
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot start fake status server: %v", err)
+	}
+
+	defer server.Close()
+
+	if status := GetServerStatus(server.Address(), false); status.Players.Online != 1 {
+		t.Fatalf("Expected 1 player online got %v", status.Players.Online)
+	}
+
+	server.SetStatus(ServerStatus{
+		Players: ServerStatusPlayers{Online: 2},
+	})
+
+	// Cached status
+	if status := GetServerStatus(server.Address(), false); status.Players.Online != 1 {
+		t.Fatalf("Expected cached status got %v players online", status.Players.Online)
+	}
+
+	// Forced refresh
+	if status := GetServerStatus(server.Address(), true); status.Players.Online != 2 {
+		t.Fatalf("Expected forced status got %v players online", status.Players.Online)
+	}
+
+	server.SetStatus(ServerStatus{
+		Players: ServerStatusPlayers{Online: 3},
+	})
+
+	FlushServerStatus(server.Address())
+
+	if status := GetServerStatus(server.Address(), false); status.Players.Online != 3 {
+		t.Fatalf("Expected flushed status got %v players online", status.Players.Online)
+	}
+
+	// Offline servers are cached with the error message
+	server.Close()
+	FlushServerStatus(server.Address())
+
+	status := GetServerStatus(server.Address(), false)
+
+	if status.Online || status.Error == "" {
+		t.Fatalf("Expected offline status got %+v", *status)
+	}
+
+	if cached := GetServerStatus(server.Address(), false); cached != status {
+		t.Fatalf("Expected offline status to be cached")
+	}
+}
+
+func TestGetServerStatusTimeout(t *testing.T) {
+	setupStatusTest(StatusConfig{
+		Timeout: StringDuration{Duration: time.Millisecond * 200},
+	})
+
+	l := rawStatusServer(t, "")
+	defer l.Close()
+
+	status := GetServerStatus(l.Addr().String(), false)
+
+	if status.Online || status.Error == "" || status.CheckedAt == 0 {
+		t.Fatalf("Expected offline status got %+v", *status)
+	}
+}
+
+func TestServerStatusAddress(t *testing.T) {
+	setupStatusTest(StatusConfig{})
+
+	if address := ServerStatusAddress("127.0.0.1:7171"); address != "127.0.0.1:7171" {
+		t.Fatalf("Expected default address got %v", address)
+	}
+
+	Config.Configuration.Status.Address = "127.0.0.1:7172"
+
+	if address := ServerStatusAddress("127.0.0.1:7171"); address != "127.0.0.1:7172" {
+		t.Fatalf("Expected configured address got %v", address)
+	}
+
+	SetServerStatusAddress("127.0.0.1:7173")
+	defer SetServerStatusAddress("")
+
+	if address := ServerStatusAddress("127.0.0.1:7171"); address != "127.0.0.1:7173" {
+		t.Fatalf("Expected override address got %v", address)
+	}
+}
@@ -1,21 +1,477 @@
 package util
 
 import (
-	"github.com/gorilla/securecookie"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/raggaer/castro/app/models"
 )
 
-// SessionStore main application session storage
-var SessionStore *securecookie.SecureCookie
+// SessionBackend interface used for the server-side session storages
+type SessionBackend interface {
+	// Get returns the session with the given identifier or nil if missing
+	Get(id string) (*models.Session, error)
+
+	// Create saves a new session
+	Create(s *models.Session) error
+
+	// Update saves an existing session. Returns false if the session was revoked
+	Update(s *models.Session) (bool, error)
+
+	// Delete removes the session with the given identifier
+	Delete(id string) error
+
+	// List returns the sessions of the given account
+	List(account string) ([]*models.Session, error)
+
+	// DeleteAccount removes all the sessions of the given account except the given one
+	DeleteAccount(account, except string) (int64, error)
+
+	// Purge removes the sessions not seen since the given timestamp
+	Purge(before int64) error
+}
+
+// DatabaseSessionBackend session backend that keeps sessions on the castro_sessions table
+type DatabaseSessionBackend struct{}
+
+// MemorySessionBackend session backend that keeps sessions on memory
+type MemorySessionBackend struct {
+	rw       sync.RWMutex
+	sessions map[string]models.Session
+}
+
+var (
+	// SessionStore main application session storage
+	SessionStore *CookieStore
+
+	// Sessions server-side session backend. Sessions are stored on the cookie when nil
+	Sessions SessionBackend
+)
 
 // SessionCookie returns a session cookie pointer
 func SessionCookie(v string) *http.Cookie {
-	return &http.Cookie{
-		Name:     Config.Configuration.Cookies.Name,
-		Value:    v,
-		Path:     "/",
-		Secure:   Config.Configuration.IsSSL(),
-		MaxAge:   Config.Configuration.Cookies.MaxAge,
-		HttpOnly: true,
+	return NewCookie(Config.Configuration.Cookies.Name, v, Config.Configuration.Cookies.MaxAge)
+}
+
+// SessionLifetime returns the duration a session lives without being used
+func SessionLifetime() time.Duration {
+	return time.Duration(Config.Configuration.Cookies.MaxAge) * time.Second
+}
+
+// SessionHandle returns the public handle of a session. Session identifiers are
+// never exposed so handles are used to list and revoke sessions
+func SessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RequestIP returns the address of the client of the given request
+func RequestIP(req *http.Request) string {
+	if Config.Configuration.SSL.Proxy {
+		if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		return req.RemoteAddr
 	}
+
+	return host
+}
+
+// EncodeSessionData encodes a session map
+func EncodeSessionData(data map[string]interface{}) ([]byte, error) {
+	buff := &bytes.Buffer{}
+
+	if err := gob.NewEncoder(buff).Encode(data); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// DecodeSessionData decodes a session map
+func DecodeSessionData(data []byte) (map[string]interface{}, error) {
+	v := map[string]interface{}{}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// DecodeSessionCookie decodes the session map of the given cookie value
+func DecodeSessionCookie(value string) (map[string]interface{}, error) {
+	v := map[string]interface{}{}
+
+	if Sessions == nil {
+		err := SessionStore.Decode(Config.Configuration.Cookies.Name, value, &v)
+		return v, err
+	}
+
+	id := ""
+
+	if err := SessionStore.Decode(Config.Configuration.Cookies.Name, value, &id); err != nil {
+		return nil, err
+	}
+
+	s, err := Sessions.Get(id)
+
+	if err != nil || s == nil {
+		return v, err
+	}
+
+	return DecodeSessionData(s.Data)
+}
+
+// NewServerSession creates a new server-side session for the given request
+func NewServerSession(req *http.Request, data map[string]interface{}) (*models.Session, error) {
+	encoded, err := EncodeSessionData(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+
+	s := &models.Session{
+		ID:         uniuri.NewLen(48),
+		Account:    sessionAccount(data),
+		Data:       encoded,
+		IP:         RequestIP(req),
+		User_agent: req.UserAgent(),
+		Created_at: now,
+		Last_seen:  now,
+	}
+
+	return s, Sessions.Create(s)
+}
+
+// sessionAccount returns the name of the account logged on the given session map
+func sessionAccount(data map[string]interface{}) string {
+	if logged, _ := data["logged"].(bool); logged {
+		account, _ := data["loggedAccount"].(string)
+		return account
+	}
+
+	return ""
+}
+
+// SessionPending checks if the server-side session of the given request was not saved yet.
+// New sessions are only created the first time they are saved so requests that never write
+// the session do not create one
+func SessionPending(req *http.Request) bool {
+	if Sessions == nil {
+		return false
+	}
+
+	id, ok := req.Context().Value("session-id").(*string)
+
+	return ok && *id == ""
+}
+
+// PersistSession saves the session of the given request if it was not saved yet
+func PersistSession(w http.ResponseWriter, req *http.Request) error {
+	if !SessionPending(req) {
+		return nil
+	}
+
+	data, ok := req.Context().Value("session").(map[string]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	return SaveSession(w, req, data)
+}
+
+// LoadServerSession returns the server-side session of the given request or nil if
+// the request has no session or the session was revoked or expired
+func LoadServerSession(req *http.Request) (*models.Session, error) {
+	cookie, err := req.Cookie(SessionCookieName())
+
+	if err != nil {
+		return nil, nil
+	}
+
+	id := ""
+
+	// Cookies created before enabling server-side sessions are ignored
+	if err := SessionStore.Decode(Config.Configuration.Cookies.Name, cookie.Value, &id); err != nil {
+		return nil, nil
+	}
+
+	s, err := Sessions.Get(id)
+
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	if s.Last_seen < time.Now().Add(-SessionLifetime()).Unix() {
+		return nil, Sessions.Delete(id)
+	}
+
+	return s, nil
+}
+
+// ServerSessionCookie returns the cookie of the given server-side session
+func ServerSessionCookie(id string) (*http.Cookie, error) {
+	encoded, err := SessionStore.Encode(Config.Configuration.Cookies.Name, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return SessionCookie(encoded), nil
+}
+
+// SaveSession saves the session map of the given request. Server-side sessions are saved to the
+// session backend, otherwise the whole map is encoded on the session cookie
+func SaveSession(w http.ResponseWriter, req *http.Request, data map[string]interface{}) error {
+	if Sessions == nil {
+		encoded, err := SessionStore.Encode(Config.Configuration.Cookies.Name, data)
+
+		if err != nil {
+			return err
+		}
+
+		http.SetCookie(w, SessionCookie(encoded))
+
+		return nil
+	}
+
+	id, ok := req.Context().Value("session-id").(*string)
+
+	if !ok {
+		return nil
+	}
+
+	// Create the session the first time it is saved
+	if *id == "" {
+		s, err := NewServerSession(req, data)
+
+		if err != nil {
+			return err
+		}
+
+		*id = s.ID
+
+		c, err := ServerSessionCookie(s.ID)
+
+		if err != nil {
+			return err
+		}
+
+		http.SetCookie(w, c)
+
+		return nil
+	}
+
+	s, err := Sessions.Get(*id)
+
+	if err != nil {
+		return err
+	}
+
+	// Revoked sessions are not created again
+	if s == nil {
+		return nil
+	}
+
+	s.Data, err = EncodeSessionData(data)
+
+	if err != nil {
+		return err
+	}
+
+	account := sessionAccount(data)
+
+	s.IP = RequestIP(req)
+	s.User_agent = req.UserAgent()
+	s.Last_seen = time.Now().Unix()
+
+	// Rotate the session identifier on login to prevent session fixation
+	if account != "" && account != s.Account {
+		if err := Sessions.Delete(s.ID); err != nil {
+			return err
+		}
+
+		s.ID = uniuri.NewLen(48)
+		s.Account = account
+		s.Created_at = s.Last_seen
+
+		if err := Sessions.Create(s); err != nil {
+			return err
+		}
+
+		*id = s.ID
+
+	} else {
+
+		s.Account = account
+
+		if _, err := Sessions.Update(s); err != nil {
+			return err
+		}
+	}
+
+	c, err := ServerSessionCookie(s.ID)
+
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, c)
+
+	return nil
+}
+
+// NewMemorySessionBackend creates and returns a new memory session backend
+func NewMemorySessionBackend() *MemorySessionBackend {
+	return &MemorySessionBackend{
+		sessions: map[string]models.Session{},
+	}
+}
+
+// Get returns the session with the given identifier or nil if missing
+func (m *MemorySessionBackend) Get(id string) (*models.Session, error) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	s, ok := m.sessions[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &s, nil
+}
+
+// Create saves a new session
+func (m *MemorySessionBackend) Create(s *models.Session) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	m.sessions[s.ID] = *s
+
+	return nil
+}
+
+// Update saves an existing session. Returns false if the session was revoked
+func (m *MemorySessionBackend) Update(s *models.Session) (bool, error) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	if _, ok := m.sessions[s.ID]; !ok {
+		return false, nil
+	}
+
+	m.sessions[s.ID] = *s
+
+	return true, nil
+}
+
+// Delete removes the session with the given identifier
+func (m *MemorySessionBackend) Delete(id string) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	delete(m.sessions, id)
+
+	return nil
+}
+
+// List returns the sessions of the given account
+func (m *MemorySessionBackend) List(account string) ([]*models.Session, error) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	list := []*models.Session{}
+
+	for _, s := range m.sessions {
+		if s.Account == account {
+			session := s
+			list = append(list, &session)
+		}
+	}
+
+	return list, nil
+}
+
+// DeleteAccount removes all the sessions of the given account except the given one
+func (m *MemorySessionBackend) DeleteAccount(account, except string) (int64, error) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	n := int64(0)
+
+	for id, s := range m.sessions {
+		if s.Account == account && id != except {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Purge removes the sessions not seen since the given timestamp
+func (m *MemorySessionBackend) Purge(before int64) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	for id, s := range m.sessions {
+		if s.Last_seen < before {
+			delete(m.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the session with the given identifier or nil if missing
+func (d *DatabaseSessionBackend) Get(id string) (*models.Session, error) {
+	return models.GetSession(id)
+}
+
+// Create saves a new session
+func (d *DatabaseSessionBackend) Create(s *models.Session) error {
+	return models.CreateSession(s)
+}
+
+// Update saves an existing session. Returns false if the session was revoked
+func (d *DatabaseSessionBackend) Update(s *models.Session) (bool, error) {
+	return models.UpdateSession(s)
+}
+
+// Delete removes the session with the given identifier
+func (d *DatabaseSessionBackend) Delete(id string) error {
+	return models.DeleteSession(id)
+}
+
+// List returns the sessions of the given account
+func (d *DatabaseSessionBackend) List(account string) ([]*models.Session, error) {
+	return models.GetAccountSessions(account)
+}
+
+// DeleteAccount removes all the sessions of the given account except the given one
+func (d *DatabaseSessionBackend) DeleteAccount(account, except string) (int64, error) {
+	return models.DeleteAccountSessions(account, except)
+}
+
+// Purge removes the sessions not seen since the given timestamp
+func (d *DatabaseSessionBackend) Purge(before int64) error {
+	return models.PurgeSessions(before)
 }
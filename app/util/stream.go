@@ -0,0 +1,29 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ResponseControllerHandler stores the response controller of the server response writer on the
+// request context. Middleware response writers do not expose the connection deadlines so the
+// controller must be created before them
+func ResponseControllerHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), "response-controller", http.NewResponseController(w))
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// DisableWriteDeadline removes the server write deadline of the given request so long-lived
+// streams are not closed by the server write timeout
+func DisableWriteDeadline(w http.ResponseWriter, req *http.Request) error {
+	rc, ok := req.Context().Value("response-controller").(*http.ResponseController)
+
+	if !ok {
+		rc = http.NewResponseController(w)
+	}
+
+	return rc.SetWriteDeadline(time.Time{})
+}
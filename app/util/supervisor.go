@@ -0,0 +1,640 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Supervisor struct used to run and watch the game server process
+type Supervisor struct {
+	rw         sync.Mutex
+	config     SupervisorConfig
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	done       chan struct{}
+	state      string
+	stopping   bool
+	startedAt  time.Time
+	restarts   int
+	crashes    int
+	lastExit   string
+	lastExitAt time.Time
+	backoff    time.Duration
+	retry      *time.Timer
+	lines      []ConsoleLine
+	head       int
+	lastLine   int64
+	log        *os.File
+	scheduled  *supervisorSchedule
+}
+
+// ConsoleLine struct used for the captured game server output
+type ConsoleLine struct {
+	ID     int64
+	Time   int64
+	Stream string
+	Text   string
+}
+
+// SupervisorStatus struct used for the game server process status
+type SupervisorStatus struct {
+	State          string
+	PID            int
+	StartedAt      int64
+	Restarts       int
+	Crashes        int
+	LastExit       string
+	LastExitAt     int64
+	NextRestart    int64
+	RestartMessage string
+}
+
+// supervisorSchedule holds the timers of a scheduled restart
+type supervisorSchedule struct {
+	at      time.Time
+	message string
+	timers  []*time.Timer
+}
+
+const (
+	// SupervisorStopped state of a process that is not running
+	SupervisorStopped = "stopped"
+
+	// SupervisorRunning state of a running process
+	SupervisorRunning = "running"
+
+	// SupervisorStopping state of a process being stopped
+	SupervisorStopping = "stopping"
+
+	// SupervisorCrashed state of a process that exited without being stopped
+	SupervisorCrashed = "crashed"
+)
+
+var (
+	// GameSupervisor game server process supervisor. Nil when the supervisor is disabled
+	GameSupervisor *Supervisor
+
+	// ErrSupervisorRunning error returned when starting a running process
+	ErrSupervisorRunning = errors.New("Game server is already running")
+
+	// ErrSupervisorNotRunning error returned when stopping a process that is not running
+	ErrSupervisorNotRunning = errors.New("Game server is not running")
+
+	// defaultRestartWarnings time before a scheduled restart the warnings are broadcasted
+	defaultRestartWarnings = []string{"15m", "5m", "1m"}
+)
+
+// NewSupervisor creates a game server supervisor using the given configuration
+func NewSupervisor(config SupervisorConfig) *Supervisor {
+	size := config.Buffer
+
+	if size <= 0 {
+		size = 500
+	}
+
+	return &Supervisor{
+		config: config,
+		state:  SupervisorStopped,
+		lines:  make([]ConsoleLine, 0, size),
+	}
+}
+
+// Run starts the game server if auto-start is enabled and schedules the daily restarts
+func (s *Supervisor) Run(autoStart bool) error {
+	if err := s.scheduleDaily(); err != nil {
+		return err
+	}
+
+	if !autoStart {
+		return nil
+	}
+
+	return s.Start()
+}
+
+// Start starts the game server process
+func (s *Supervisor) Start() error {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if s.state == SupervisorRunning || s.state == SupervisorStopping {
+		return ErrSupervisorRunning
+	}
+
+	// Cancel pending crash restarts
+	if s.retry != nil {
+		s.retry.Stop()
+		s.retry = nil
+	}
+
+	if s.config.Executable == "" {
+		return errors.New("Missing supervisor executable")
+	}
+
+	cmd := exec.Command(s.config.Executable, s.config.Args...)
+	cmd.Dir = s.config.Directory
+
+	if cmd.Dir == "" {
+		cmd.Dir = Config.Configuration.Datapack
+	}
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+
+	if err != nil {
+		return err
+	}
+
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return err
+	}
+
+	// Open console log file
+	if s.log == nil && s.config.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(s.config.LogFile), 0755); err != nil {
+			return err
+		}
+
+		s.log, err = os.OpenFile(s.config.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.done = make(chan struct{})
+	s.state = SupervisorRunning
+	s.stopping = false
+	s.startedAt = time.Now()
+
+	// Capture process output. Wait must be called after all the output is read
+	capture := &sync.WaitGroup{}
+	capture.Add(2)
+
+	go s.capture(stdout, "stdout", capture)
+	go s.capture(stderr, "stderr", capture)
+	go s.wait(cmd, s.done, capture)
+
+	s.emitState()
+
+	return nil
+}
+
+// Stop stops the game server process. The process is killed if it does not exit
+// before the configured stop timeout
+func (s *Supervisor) Stop() error {
+	s.rw.Lock()
+
+	// Crashed processes waiting for a restart only need the restart cancelled
+	if s.state == SupervisorCrashed {
+		if s.retry != nil {
+			s.retry.Stop()
+			s.retry = nil
+		}
+
+		s.state = SupervisorStopped
+		s.emitState()
+		s.rw.Unlock()
+
+		return nil
+	}
+
+	if s.state != SupervisorRunning {
+		s.rw.Unlock()
+		return ErrSupervisorNotRunning
+	}
+
+	s.stopping = true
+	s.state = SupervisorStopping
+	s.emitState()
+
+	process := s.cmd.Process
+	done := s.done
+
+	s.rw.Unlock()
+
+	timeout := s.config.StopTimeout.Duration
+
+	if timeout <= 0 {
+		timeout = time.Second * 30
+	}
+
+	// Ask the process to shutdown. Signals are not supported on every platform
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		process.Kill()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.consoleLine("castro", "Game server did not stop in time. Killing process")
+		process.Kill()
+		<-done
+	}
+
+	return nil
+}
+
+// Restart stops the game server process if running and starts it again
+func (s *Supervisor) Restart() error {
+	if err := s.Stop(); err != nil && err != ErrSupervisorNotRunning {
+		return err
+	}
+
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	s.rw.Lock()
+	s.restarts++
+	s.rw.Unlock()
+
+	return nil
+}
+
+// Broadcast sends a message to the players. The message is written to the process
+// input using the configured broadcast format and emitted on the event bus
+func (s *Supervisor) Broadcast(message string) error {
+	s.consoleLine("castro", "Broadcast: "+message)
+
+	Bus.EmitAsync("supervisor.broadcast", map[string]interface{}{
+		"message": message,
+	})
+
+	if s.config.Broadcast == "" {
+		return nil
+	}
+
+	s.rw.Lock()
+	running := s.state == SupervisorRunning
+	stdin := s.stdin
+	s.rw.Unlock()
+
+	if !running {
+		return ErrSupervisorNotRunning
+	}
+
+	_, err := io.WriteString(stdin, strings.Replace(s.config.Broadcast, "{message}", message, -1)+"\n")
+
+	return err
+}
+
+// ScheduleRestart restarts the game server at the given time broadcasting the configured
+// warnings before the restart. Replaces any other scheduled restart
+func (s *Supervisor) ScheduleRestart(at time.Time, message string) error {
+	return s.schedule(at, message)
+}
+
+// CancelRestart cancels the scheduled restart
+func (s *Supervisor) CancelRestart() {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.cancelSchedule()
+	s.emitState()
+}
+
+// Status returns the game server process status
+func (s *Supervisor) Status() SupervisorStatus {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	status := SupervisorStatus{
+		State:    s.state,
+		Restarts: s.restarts,
+		Crashes:  s.crashes,
+		LastExit: s.lastExit,
+	}
+
+	if s.state == SupervisorRunning || s.state == SupervisorStopping {
+		status.PID = s.cmd.Process.Pid
+		status.StartedAt = s.startedAt.Unix()
+	}
+
+	if !s.lastExitAt.IsZero() {
+		status.LastExitAt = s.lastExitAt.Unix()
+	}
+
+	if s.scheduled != nil {
+		status.NextRestart = s.scheduled.at.Unix()
+		status.RestartMessage = s.scheduled.message
+	}
+
+	return status
+}
+
+// Lines returns the captured output lines newer than the given line identifier. Only the
+// last limit lines are returned when limit is greater than zero
+func (s *Supervisor) Lines(since int64, limit int) []ConsoleLine {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	lines := []ConsoleLine{}
+
+	for i := 0; i < len(s.lines); i++ {
+		l := s.lines[(s.head+i)%len(s.lines)]
+
+		if l.ID > since {
+			lines = append(lines, l)
+		}
+	}
+
+	if limit > 0 && len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+
+	return lines
+}
+
+func (s *Supervisor) capture(r io.Reader, stream string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		s.consoleLine(stream, scanner.Text())
+	}
+}
+
+func (s *Supervisor) wait(cmd *exec.Cmd, done chan struct{}, capture *sync.WaitGroup) {
+	capture.Wait()
+	err := cmd.Wait()
+
+	s.rw.Lock()
+
+	s.lastExitAt = time.Now()
+	s.lastExit = "exit status 0"
+
+	if err != nil {
+		s.lastExit = err.Error()
+	}
+
+	uptime := s.lastExitAt.Sub(s.startedAt)
+	crashed := !s.stopping
+	lastExit := s.lastExit
+
+	if crashed {
+		s.crashes++
+		s.state = SupervisorCrashed
+
+		if s.config.AutoRestart {
+			backoff := s.crashBackoff(uptime)
+			s.retry = time.AfterFunc(backoff, func() {
+				if err := s.Start(); err != nil {
+					Logger.Logger.Errorf("Cannot restart crashed game server: %v", err)
+				}
+			})
+		}
+	} else {
+		s.state = SupervisorStopped
+	}
+
+	s.emitState()
+	s.rw.Unlock()
+
+	close(done)
+
+	// A restarted process may already be running so only the copied exit is used
+	if crashed {
+		s.consoleLine("castro", fmt.Sprintf("Game server crashed after %v: %v", uptime.Round(time.Second), lastExit))
+		Logger.Logger.Errorf("Game server crashed after %v: %v", uptime.Round(time.Second), lastExit)
+
+		Bus.EmitAsync("supervisor.crash", map[string]interface{}{
+			"exit":   lastExit,
+			"uptime": int64(uptime.Seconds()),
+		})
+	}
+}
+
+// crashBackoff returns the time to wait before restarting a crashed process. The wait doubles
+// with every crash and is reset when the process ran longer than the maximum backoff
+func (s *Supervisor) crashBackoff(uptime time.Duration) time.Duration {
+	base := s.config.Backoff.Duration
+
+	if base <= 0 {
+		base = time.Second * 5
+	}
+
+	max := s.config.MaxBackoff.Duration
+
+	if max <= 0 {
+		max = time.Minute * 5
+	}
+
+	if s.backoff <= 0 || uptime > max {
+		s.backoff = base
+	} else {
+		s.backoff *= 2
+	}
+
+	if s.backoff > max {
+		s.backoff = max
+	}
+
+	return s.backoff
+}
+
+// consoleLine saves an output line on the ring buffer and the log file
+func (s *Supervisor) consoleLine(stream, text string) {
+	s.rw.Lock()
+
+	s.lastLine++
+	line := ConsoleLine{
+		ID:     s.lastLine,
+		Time:   time.Now().Unix(),
+		Stream: stream,
+		Text:   text,
+	}
+
+	if len(s.lines) < cap(s.lines) {
+		s.lines = append(s.lines, line)
+	} else {
+		s.lines[s.head] = line
+		s.head = (s.head + 1) % len(s.lines)
+	}
+
+	if s.log != nil {
+		fmt.Fprintf(s.log, "%s [%s] %s\n", time.Unix(line.Time, 0).Format("2006-01-02 15:04:05"), stream, text)
+	}
+
+	s.rw.Unlock()
+
+	Bus.EmitAsync("supervisor.console", map[string]interface{}{
+		"id":     line.ID,
+		"time":   line.Time,
+		"stream": line.Stream,
+		"text":   line.Text,
+	})
+}
+
+// emitState emits the process state on the event bus. Must be called with the lock held
+func (s *Supervisor) emitState() {
+	Bus.EmitAsync("supervisor.state", map[string]interface{}{
+		"state": s.state,
+	})
+}
+
+func (s *Supervisor) schedule(at time.Time, message string) error {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	now := time.Now()
+
+	if !at.After(now) {
+		return errors.New("Restart time must be in the future")
+	}
+
+	s.cancelSchedule()
+
+	warnings := s.config.Warnings
+
+	if len(warnings) == 0 {
+		warnings = defaultRestartWarnings
+	}
+
+	schedule := &supervisorSchedule{
+		at:      at,
+		message: message,
+	}
+
+	for _, w := range warnings {
+		before, err := time.ParseDuration(w)
+
+		if err != nil {
+			return fmt.Errorf("Invalid restart warning %v: %v", w, err)
+		}
+
+		if at.Add(-before).Before(now) {
+			continue
+		}
+
+		text := "Server restart in " + restartWarningTime(before)
+
+		if message != "" {
+			text += ". " + message
+		}
+
+		schedule.timers = append(schedule.timers, time.AfterFunc(at.Add(-before).Sub(now), func() {
+			if err := s.Broadcast(text); err != nil {
+				Logger.Logger.Errorf("Cannot broadcast restart warning: %v", err)
+			}
+		}))
+	}
+
+	schedule.timers = append(schedule.timers, time.AfterFunc(at.Sub(now), func() {
+		s.rw.Lock()
+
+		// Only run the restart if it was not replaced
+		if s.scheduled != schedule {
+			s.rw.Unlock()
+			return
+		}
+
+		s.scheduled = nil
+		s.rw.Unlock()
+
+		if err := s.Restart(); err != nil {
+			Logger.Logger.Errorf("Cannot run scheduled game server restart: %v", err)
+		}
+
+		if err := s.scheduleDaily(); err != nil {
+			Logger.Logger.Errorf("Cannot schedule daily game server restart: %v", err)
+		}
+	}))
+
+	s.scheduled = schedule
+	s.emitState()
+
+	return nil
+}
+
+// cancelSchedule stops the scheduled restart timers. Must be called with the lock held
+func (s *Supervisor) cancelSchedule() {
+	if s.scheduled == nil {
+		return
+	}
+
+	for _, t := range s.scheduled.timers {
+		t.Stop()
+	}
+
+	s.scheduled = nil
+}
+
+// scheduleDaily schedules the next configured daily restart unless a restart is already scheduled
+func (s *Supervisor) scheduleDaily() error {
+	if len(s.config.Schedule) == 0 {
+		return nil
+	}
+
+	s.rw.Lock()
+	scheduled := s.scheduled != nil
+	s.rw.Unlock()
+
+	if scheduled {
+		return nil
+	}
+
+	now := time.Now()
+	var next time.Time
+
+	for _, clock := range s.config.Schedule {
+		t, err := time.ParseInLocation("15:04", clock, time.Local)
+
+		if err != nil {
+			return fmt.Errorf("Invalid daily restart time %v: %v", clock, err)
+		}
+
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return s.schedule(next, "Daily restart")
+}
+
+// restartWarningTime returns a readable representation of the time left for a restart
+func restartWarningTime(d time.Duration) string {
+	if d >= time.Minute && d%time.Minute == 0 {
+		if d == time.Minute {
+			return "1 minute"
+		}
+
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+
+	if d == time.Second {
+		return "1 second"
+	}
+
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
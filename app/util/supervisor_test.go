@@ -0,0 +1,302 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	// dummyServerPath path of the dummy game server built for the supervisor tests
+	dummyServerPath string
+	dummyServerErr  error
+	dummyServerOnce sync.Once
+)
+
+func TestMain(m *testing.M) {
+	Logger.Logger = CreateLogger(ioutil.Discard)
+
+	code := m.Run()
+
+	if dummyServerPath != "" {
+		os.RemoveAll(filepath.Dir(dummyServerPath))
+	}
+
+	os.Exit(code)
+}
+
+// buildDummyServer builds the dummy game server once for all the supervisor tests
+func buildDummyServer(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("Skipping supervisor test in short mode")
+	}
+
+	dummyServerOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "castro-dummyserver")
+
+		if err != nil {
+			dummyServerErr = err
+			return
+		}
+
+		dummyServerPath = filepath.Join(dir, "dummyserver")
+
+		if runtime.GOOS == "windows" {
+			dummyServerPath += ".exe"
+		}
+
+		out, err := exec.Command("go", "build", "-o", dummyServerPath, "github.com/raggaer/castro/tools/dummyserver").CombinedOutput()
+
+		if err != nil {
+			dummyServerErr = fmt.Errorf("%v: %s", err, out)
+		}
+	})
+
+	if dummyServerErr != nil {
+		t.Fatalf("Cannot build dummy server: %v", dummyServerErr)
+	}
+
+	return dummyServerPath
+}
+
+// newTestSupervisor creates a supervisor running the dummy game server with the given arguments
+func newTestSupervisor(t *testing.T, config SupervisorConfig) *Supervisor {
+	config.Executable = buildDummyServer(t)
+	config.Directory = t.TempDir()
+
+	s := NewSupervisor(config)
+
+	t.Cleanup(func() {
+		s.Stop()
+	})
+
+	return s
+}
+
+// waitSupervisor waits until the given condition is true
+func waitSupervisor(t *testing.T, s *Supervisor, what string, cond func(SupervisorStatus) bool) SupervisorStatus {
+	deadline := time.Now().Add(time.Second * 10)
+
+	for time.Now().Before(deadline) {
+		if status := s.Status(); cond(status) {
+			return status
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("Timeout waiting for %v. Status %+v", what, s.Status())
+
+	return SupervisorStatus{}
+}
+
+// waitConsoleLine waits until the supervisor captured a line containing the given text
+func waitConsoleLine(t *testing.T, s *Supervisor, text string) {
+	deadline := time.Now().Add(time.Second * 10)
+
+	for time.Now().Before(deadline) {
+		for _, l := range s.Lines(0, 0) {
+			if strings.Contains(l.Text, text) {
+				return
+			}
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("Timeout waiting for console line %q", text)
+}
+
+func TestSupervisorStartStop(t *testing.T) {
+	s := newTestSupervisor(t, SupervisorConfig{
+		Args:      []string{"-interval", "50ms", "-shutdown", "10ms"},
+		Broadcast: "broadcast {message}",
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Cannot start supervisor: %v", err)
+	}
+
+	waitConsoleLine(t, s, "Dummy Server Online!")
+
+	status := s.Status()
+
+	if status.State != SupervisorRunning || status.PID == 0 || status.StartedAt == 0 {
+		t.Fatalf("Unexpected running status %+v", status)
+	}
+
+	if err := s.Start(); err != ErrSupervisorRunning {
+		t.Fatalf("Expected %v got %v", ErrSupervisorRunning, err)
+	}
+
+	if err := s.Broadcast("hello"); err != nil {
+		t.Fatalf("Cannot broadcast: %v", err)
+	}
+
+	waitConsoleLine(t, s, "Input: broadcast hello")
+	waitConsoleLine(t, s, "Uptime")
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Cannot stop supervisor: %v", err)
+	}
+
+	waitConsoleLine(t, s, "Shutdown complete")
+
+	status = s.Status()
+
+	if status.State != SupervisorStopped || status.Crashes != 0 || status.LastExitAt == 0 {
+		t.Fatalf("Unexpected stopped status %+v", status)
+	}
+
+	if err := s.Stop(); err != ErrSupervisorNotRunning {
+		t.Fatalf("Expected %v got %v", ErrSupervisorNotRunning, err)
+	}
+
+	// The process can be started again after a stop
+	if err := s.Restart(); err != nil {
+		t.Fatalf("Cannot restart supervisor: %v", err)
+	}
+
+	if status := s.Status(); status.State != SupervisorRunning || status.Restarts != 1 {
+		t.Fatalf("Unexpected restarted status %+v", status)
+	}
+}
+
+func TestSupervisorStopTimeout(t *testing.T) {
+	s := newTestSupervisor(t, SupervisorConfig{
+		Args:        []string{"-shutdown", "1m"},
+		StopTimeout: StringDuration{Duration: time.Millisecond * 200},
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Cannot start supervisor: %v", err)
+	}
+
+	waitConsoleLine(t, s, "Dummy Server Online!")
+
+	start := time.Now()
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Cannot stop supervisor: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Fatalf("Stop took %v with a 200ms timeout", elapsed)
+	}
+
+	if status := s.Status(); status.State != SupervisorStopped || status.Crashes != 0 {
+		t.Fatalf("Unexpected stopped status %+v", status)
+	}
+}
+
+func TestSupervisorCrashRestart(t *testing.T) {
+	s := newTestSupervisor(t, SupervisorConfig{
+		Args:        []string{"-crash", "100ms"},
+		AutoRestart: true,
+		Backoff:     StringDuration{Duration: time.Millisecond * 100},
+		MaxBackoff:  StringDuration{Duration: time.Second * 10},
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Cannot start supervisor: %v", err)
+	}
+
+	waitSupervisor(t, s, "first crash", func(status SupervisorStatus) bool {
+		return status.Crashes >= 1
+	})
+
+	waitConsoleLine(t, s, "Segmentation fault (dummy crash)")
+	waitConsoleLine(t, s, "Game server crashed")
+
+	// The process is started again after the backoff
+	status := waitSupervisor(t, s, "second crash", func(status SupervisorStatus) bool {
+		return status.Crashes >= 2
+	})
+
+	if !strings.Contains(status.LastExit, "139") {
+		t.Fatalf("Expected crash exit code got %v", status.LastExit)
+	}
+
+	// Stopping a crashed process cancels the pending restart
+	waitSupervisor(t, s, "crashed state", func(status SupervisorStatus) bool {
+		return status.State == SupervisorCrashed
+	})
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Cannot stop crashed supervisor: %v", err)
+	}
+
+	crashes := s.Status().Crashes
+
+	time.Sleep(time.Second)
+
+	if status := s.Status(); status.State != SupervisorStopped || status.Crashes != crashes {
+		t.Fatalf("Expected no restart after stop. Status %+v", status)
+	}
+}
+
+func TestSupervisorCrashWithoutRestart(t *testing.T) {
+	s := newTestSupervisor(t, SupervisorConfig{
+		Args:    []string{"-crash", "50ms"},
+		Backoff: StringDuration{Duration: time.Millisecond * 10},
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Cannot start supervisor: %v", err)
+	}
+
+	waitSupervisor(t, s, "crash", func(status SupervisorStatus) bool {
+		return status.State == SupervisorCrashed
+	})
+
+	time.Sleep(time.Millisecond * 200)
+
+	if status := s.Status(); status.State != SupervisorCrashed || status.Crashes != 1 {
+		t.Fatalf("Expected crashed process to stay down. Status %+v", status)
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("Cannot start crashed supervisor: %v", err)
+	}
+}
+
+func TestSupervisorCrashBackoff(t *testing.T) {
+	s := NewSupervisor(SupervisorConfig{
+		Backoff:    StringDuration{Duration: time.Second},
+		MaxBackoff: StringDuration{Duration: time.Second * 10},
+	})
+
+	// The backoff doubles with every quick crash up to the maximum
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+
+	for _, e := range expected {
+		if backoff := s.crashBackoff(time.Second); backoff != e*time.Second {
+			t.Fatalf("Expected backoff %v got %v", e*time.Second, backoff)
+		}
+	}
+
+	// Processes running longer than the maximum backoff reset it
+	if backoff := s.crashBackoff(time.Minute); backoff != time.Second {
+		t.Fatalf("Expected reset backoff got %v", backoff)
+	}
+
+	// Default backoff values
+	s = NewSupervisor(SupervisorConfig{})
+
+	if backoff := s.crashBackoff(0); backoff != time.Second*5 {
+		t.Fatalf("Expected default backoff got %v", backoff)
+	}
+
+	s.backoff = time.Minute * 4
+
+	if backoff := s.crashBackoff(0); backoff != time.Minute*5 {
+		t.Fatalf("Expected default maximum backoff got %v", backoff)
+	}
+}
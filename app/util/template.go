@@ -24,6 +24,9 @@ var (
 	// FuncMap holds the main FuncMap definition
 	FuncMap template.FuncMap
 
+	// TemplateRecorder is called with every rendered page template when set. Used by the lua test runner
+	TemplateRecorder func(req *http.Request, name string, args map[string]interface{})
+
 	// TemplateHooks holds the hook types available
 	TemplateHooks = [...]string{
 		"head",
@@ -297,9 +300,19 @@ func (t Tmpl) RenderTemplate(w http.ResponseWriter, req *http.Request, name stri
 	// Set token value
 	args["csrfToken"] = tkn.Token
 
+	// Save new sessions so the rendered token can be verified
+	if err := PersistSession(w, req); err != nil {
+		Logger.Logger.Errorf("Cannot save session: %v", err)
+	}
+
 	// Set microtime value
 	args["microtime"] = fmt.Sprintf("%9.4f seconds", time.Since(microtime).Seconds())
 
+	// Record rendered template
+	if TemplateRecorder != nil {
+		TemplateRecorder(req, name, args)
+	}
+
 	// Render template and log error
 	if err := t.Tmpl.ExecuteTemplate(w, name, args); err != nil {
 		Logger.Logger.Error(err.Error())
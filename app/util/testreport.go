@@ -0,0 +1,142 @@
+package util
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TestResult struct used for the result of a lua test function
+type TestResult struct {
+	File     string
+	Name     string
+	Passed   bool
+	Message  string
+	Duration time.Duration
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteTAP writes the given test results using the Test Anything Protocol
+func WriteTAP(w io.Writer, results []TestResult) error {
+	if _, err := fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results)); err != nil {
+		return err
+	}
+
+	for i, r := range results {
+
+		// Set result status
+		status := "ok"
+
+		if !r.Passed {
+			status = "not ok"
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %d - %s: %s\n", status, i+1, r.File, r.Name); err != nil {
+			return err
+		}
+
+		if r.Passed {
+			continue
+		}
+
+		// Write failure diagnostics as YAML
+		if _, err := fmt.Fprintf(w, "  ---\n  message: %q\n  duration_ms: %d\n  ...\n", r.Message, r.Duration.Nanoseconds()/int64(time.Millisecond)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJUnit writes the given test results as a JUnit XML report. Each file is a test suite
+func WriteJUnit(w io.Writer, results []TestResult) error {
+	// Report holder
+	report := junitTestSuites{}
+	suites := map[string]int{}
+
+	for _, r := range results {
+
+		// Get file suite
+		i, ok := suites[r.File]
+
+		if !ok {
+			report.Suites = append(report.Suites, junitTestSuite{
+				Name: r.File,
+			})
+			i = len(report.Suites) - 1
+			suites[r.File] = i
+		}
+
+		// Create test case
+		c := junitTestCase{
+			Name:      r.Name,
+			ClassName: strings.TrimSuffix(r.File, ".lua"),
+			Time:      fmt.Sprintf("%.3f", r.Duration.Seconds()),
+		}
+
+		if !r.Passed {
+			c.Failure = &junitFailure{
+				Message: r.Message,
+				Text:    r.Message,
+			}
+			report.Suites[i].Failures++
+		}
+
+		report.Suites[i].Tests++
+		report.Suites[i].Cases = append(report.Suites[i].Cases, c)
+	}
+
+	// Set suite durations
+	for i := range report.Suites {
+		total := time.Duration(0)
+
+		for _, r := range results {
+			if r.File == report.Suites[i].Name {
+				total += r.Duration
+			}
+		}
+
+		report.Suites[i].Time = fmt.Sprintf("%.3f", total.Seconds())
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	// Encode report
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
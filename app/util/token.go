@@ -0,0 +1,264 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+// TokenOptions struct used for the options of a signed token
+type TokenOptions struct {
+	TTL  time.Duration
+	Once bool
+	JWT  bool
+}
+
+// TokenClaims holds the decoded claims of a verified token
+type TokenClaims struct {
+	Purpose string
+	ID      string
+	Once    bool
+	Issued  int64
+	Expires int64
+	Data    map[string]interface{}
+}
+
+// tokenKey struct used to store a signing key and its identifier
+type tokenKey struct {
+	ID     string
+	Secret []byte
+}
+
+var (
+	// ErrTokenInvalid error returned when a token is malformed or its signature is wrong
+	ErrTokenInvalid = errors.New("Invalid token")
+
+	// ErrTokenExpired error returned when a token is expired
+	ErrTokenExpired = errors.New("Token expired")
+
+	// ErrTokenPurpose error returned when a token was signed for a different purpose
+	ErrTokenPurpose = errors.New("Invalid token purpose")
+
+	// reservedClaims claims managed by the token signer
+	reservedClaims = []string{"aud", "iss", "iat", "exp", "jti", "once"}
+)
+
+// tokenKeys returns the configured signing keys. The first key signs new tokens and
+// the remaining keys are only used to verify tokens signed before a rotation
+func tokenKeys() []tokenKey {
+	secrets := Config.Configuration.Token.Keys
+
+	// Fallback to keys derived from the cookie key pairs so tokens are
+	// never signed with an empty or a cookie secret
+	if len(secrets) == 0 {
+		for _, pair := range Config.Configuration.Cookies.KeyPairs() {
+			secrets = append(secrets, deriveTokenSecret(pair.HashKey))
+		}
+	}
+
+	keys := make([]tokenKey, 0, len(secrets))
+
+	for _, secret := range secrets {
+		sum := sha256.Sum256([]byte(secret))
+
+		keys = append(keys, tokenKey{
+			ID:     hex.EncodeToString(sum[:4]),
+			Secret: []byte(secret),
+		})
+	}
+
+	return keys
+}
+
+// deriveTokenSecret derives a token signing secret from a cookie hash key
+func deriveTokenSecret(hashKey string) string {
+	mac := hmac.New(sha256.New, []byte(hashKey))
+	mac.Write([]byte("castro-token"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// findTokenKey returns the key with the given identifier
+func findTokenKey(id string) (tokenKey, bool) {
+	for _, k := range tokenKeys() {
+		if hmac.Equal([]byte(k.ID), []byte(id)) {
+			return k, true
+		}
+	}
+
+	return tokenKey{}, false
+}
+
+// tokenSignature returns the encoded HMAC-SHA256 signature of the given data
+func tokenSignature(key tokenKey, data string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(data))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignToken signs the given payload for the given purpose. Tokens use the castro format
+// v1.<key>.<claims>.<signature> or the JWT format with the HS256 algorithm
+func SignToken(purpose string, data map[string]interface{}, opts TokenOptions) (string, error) {
+	keys := tokenKeys()
+
+	if len(keys) == 0 || len(keys[0].Secret) == 0 {
+		return "", errors.New("Missing token signing key")
+	}
+
+	key := keys[0]
+
+	// Get token duration
+	ttl := opts.TTL
+
+	if ttl <= 0 {
+		ttl = Config.Configuration.Token.TTL.Duration
+	}
+
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	// Create token claims
+	claims := map[string]interface{}{}
+
+	for k, v := range data {
+		claims[k] = v
+	}
+
+	now := time.Now()
+
+	claims["aud"] = purpose
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["jti"] = uniuri.NewLen(24)
+
+	if opts.Once {
+		claims["once"] = true
+	}
+
+	if Config.Configuration.Token.Issuer != "" {
+		claims["iss"] = Config.Configuration.Token.Issuer
+	}
+
+	body, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+
+	if opts.JWT {
+		header, err := json.Marshal(map[string]string{
+			"alg": "HS256",
+			"typ": "JWT",
+			"kid": key.ID,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + encoded
+
+		return unsigned + "." + tokenSignature(key, unsigned), nil
+	}
+
+	unsigned := "v1." + key.ID + "." + encoded
+
+	return unsigned + "." + tokenSignature(key, unsigned), nil
+}
+
+// VerifyToken checks the signature, purpose and expiration of the given token
+// in any of the supported formats
+func VerifyToken(purpose, token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+
+	var keyID, unsigned, encoded, signature string
+
+	switch len(parts) {
+	case 4:
+		if parts[0] != "v1" {
+			return nil, ErrTokenInvalid
+		}
+
+		keyID, encoded, signature = parts[1], parts[2], parts[3]
+		unsigned = strings.Join(parts[:3], ".")
+
+	case 3:
+		headerBuff, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+		if err != nil {
+			return nil, ErrTokenInvalid
+		}
+
+		header := map[string]string{}
+
+		if err := json.Unmarshal(headerBuff, &header); err != nil || header["alg"] != "HS256" {
+			return nil, ErrTokenInvalid
+		}
+
+		keyID, encoded, signature = header["kid"], parts[1], parts[2]
+		unsigned = strings.Join(parts[:2], ".")
+
+	default:
+		return nil, ErrTokenInvalid
+	}
+
+	// Check token signature
+	key, ok := findTokenKey(keyID)
+
+	if !ok || !hmac.Equal([]byte(tokenSignature(key, unsigned)), []byte(signature)) {
+		return nil, ErrTokenInvalid
+	}
+
+	// Decode token claims
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	data := map[string]interface{}{}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	claims := &TokenClaims{
+		Data: data,
+	}
+
+	claims.Purpose, _ = data["aud"].(string)
+	claims.ID, _ = data["jti"].(string)
+	claims.Once, _ = data["once"].(bool)
+
+	if iat, ok := data["iat"].(float64); ok {
+		claims.Issued = int64(iat)
+	}
+
+	if exp, ok := data["exp"].(float64); ok {
+		claims.Expires = int64(exp)
+	}
+
+	for _, c := range reservedClaims {
+		delete(data, c)
+	}
+
+	if claims.Purpose != purpose {
+		return nil, ErrTokenPurpose
+	}
+
+	if claims.Expires <= time.Now().Unix() {
+		return nil, ErrTokenExpired
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,242 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signTestClaims signs the given claims with the first configured key
+func signTestClaims(t *testing.T, claims map[string]interface{}) string {
+	body, err := json.Marshal(claims)
+
+	if err != nil {
+		t.Fatalf("Cannot encode claims: %v", err)
+	}
+
+	key := tokenKeys()[0]
+	unsigned := "v1." + key.ID + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	return unsigned + "." + tokenSignature(key, unsigned)
+}
+
+// tamperClaims replaces the claims segment of a token keeping its signature
+func tamperClaims(t *testing.T, token string, claims map[string]interface{}) string {
+	parts := strings.Split(token, ".")
+	body, err := json.Marshal(claims)
+
+	if err != nil {
+		t.Fatalf("Cannot encode claims: %v", err)
+	}
+
+	parts[len(parts)-2] = base64.RawURLEncoding.EncodeToString(body)
+
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyToken(t *testing.T) {
+	Config.Configuration = &Configuration{
+		Token: TokenConfig{
+			Keys: []string{"current-token-key", "previous-token-key"},
+		},
+	}
+
+	sign := func(purpose string, opts TokenOptions) string {
+		token, err := SignToken(purpose, map[string]interface{}{"account": 10}, opts)
+
+		if err != nil {
+			t.Fatalf("Cannot sign token: %v", err)
+		}
+
+		return token
+	}
+
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name  string
+		token func() string
+		err   error
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return sign("reset", TokenOptions{}) },
+		},
+		{
+			name:  "valid jwt",
+			token: func() string { return sign("reset", TokenOptions{JWT: true}) },
+		},
+		{
+			name: "previous key",
+			token: func() string {
+				Config.Configuration.Token.Keys = []string{"previous-token-key"}
+				defer func() {
+					Config.Configuration.Token.Keys = []string{"current-token-key", "previous-token-key"}
+				}()
+
+				return sign("reset", TokenOptions{})
+			},
+		},
+		{
+			name: "removed key",
+			token: func() string {
+				Config.Configuration.Token.Keys = []string{"removed-token-key"}
+				defer func() {
+					Config.Configuration.Token.Keys = []string{"current-token-key", "previous-token-key"}
+				}()
+
+				return sign("reset", TokenOptions{})
+			},
+			err: ErrTokenInvalid,
+		},
+		{
+			name:  "wrong purpose",
+			token: func() string { return sign("verify", TokenOptions{}) },
+			err:   ErrTokenPurpose,
+		},
+		{
+			name: "expired token",
+			token: func() string {
+				return signTestClaims(t, map[string]interface{}{"aud": "reset", "iat": now - 120, "exp": now - 60})
+			},
+			err: ErrTokenExpired,
+		},
+		{
+			name: "token without expiration",
+			token: func() string {
+				return signTestClaims(t, map[string]interface{}{"aud": "reset", "iat": now})
+			},
+			err: ErrTokenExpired,
+		},
+		{
+			name: "tampered claims",
+			token: func() string {
+				return tamperClaims(t, sign("reset", TokenOptions{}), map[string]interface{}{"aud": "reset", "account": 1, "exp": now + 60})
+			},
+			err: ErrTokenInvalid,
+		},
+		{
+			name: "tampered jwt claims",
+			token: func() string {
+				return tamperClaims(t, sign("reset", TokenOptions{JWT: true}), map[string]interface{}{"aud": "reset", "account": 1, "exp": now + 60})
+			},
+			err: ErrTokenInvalid,
+		},
+		{
+			name: "tampered signature",
+			token: func() string {
+				token := sign("reset", TokenOptions{})
+				last := "A"
+
+				if strings.HasSuffix(token, last) {
+					last = "B"
+				}
+
+				return token[:len(token)-1] + last
+			},
+			err: ErrTokenInvalid,
+		},
+		{
+			name: "unsigned jwt",
+			token: func() string {
+				parts := strings.Split(sign("reset", TokenOptions{JWT: true}), ".")
+				parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+				return parts[0] + "." + parts[1] + "."
+			},
+			err: ErrTokenInvalid,
+		},
+		{
+			name:  "malformed token",
+			token: func() string { return "v1.token" },
+			err:   ErrTokenInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := VerifyToken("reset", test.token())
+
+			if err != test.err {
+				t.Fatalf("Expected error %v got %v", test.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if account, ok := claims.Data["account"].(float64); !ok || account != 10 {
+				t.Fatalf("Expected account claim got %v", claims.Data)
+			}
+
+			// Reserved claims are not part of the payload
+			if _, ok := claims.Data["exp"]; ok || claims.Expires <= now {
+				t.Fatalf("Unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestSignTokenOnce(t *testing.T) {
+	Config.Configuration = &Configuration{
+		Token: TokenConfig{
+			Keys: []string{"current-token-key"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		opts TokenOptions
+	}{
+		{name: "reusable token", opts: TokenOptions{}},
+		{name: "single-use token", opts: TokenOptions{Once: true}},
+	}
+
+	ids := map[string]bool{}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := SignToken("reset", nil, test.opts)
+
+			if err != nil {
+				t.Fatalf("Cannot sign token: %v", err)
+			}
+
+			claims, err := VerifyToken("reset", token)
+
+			if err != nil {
+				t.Fatalf("Cannot verify token: %v", err)
+			}
+
+			// Single-use tokens need a unique identifier to be consumed
+			if claims.Once != test.opts.Once || claims.ID == "" || ids[claims.ID] {
+				t.Fatalf("Unexpected claims %+v", claims)
+			}
+
+			ids[claims.ID] = true
+		})
+	}
+}
+
+func TestTokenKeysFromCookieKeys(t *testing.T) {
+	Config.Configuration = &Configuration{
+		Cookies: CookieConfig{
+			HashKey: "cookie-hash-key",
+		},
+	}
+
+	keys := tokenKeys()
+
+	// Tokens are never signed with the cookie hash key itself
+	if len(keys) != 1 || string(keys[0].Secret) == "cookie-hash-key" || len(keys[0].Secret) == 0 {
+		t.Fatalf("Unexpected derived keys %+v", keys)
+	}
+
+	Config.Configuration.Cookies.HashKey = ""
+
+	if _, err := SignToken("reset", nil, TokenOptions{}); err == nil {
+		t.Fatalf("Expected missing key error")
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/dgryski/dgoogauth"
+)
+
+const (
+	// twoFactorDevicePurpose purpose of the remembered device tokens
+	twoFactorDevicePurpose = "twofa-device"
+
+	// recoveryCodeChars characters used to generate recovery codes
+	recoveryCodeChars = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+// TOTPStep checks the given authenticator code against the previous, current and next
+// time steps. Returns the matched step so callers can reject already used steps
+func TOTPStep(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+
+	if len(code) != 6 {
+		return 0, false
+	}
+
+	value, err := strconv.Atoi(code)
+
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / 30
+
+	for step := current - 1; step <= current+1; step++ {
+		if dgoogauth.ComputeCode(secret, step) == value {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// NewRecoveryCodes generates the given number of recovery codes
+func NewRecoveryCodes(n int) []string {
+	codes := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		code := uniuri.NewLenChars(10, []byte(recoveryCodeChars))
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes
+}
+
+// HashRecoveryCode returns the stored hash of the given recovery code
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// secretFingerprint returns a short hash of a two-factor secret. Remembered devices
+// store the fingerprint so they are forgotten when the secret changes
+func secretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// DeviceCookieName returns the name of the remembered device cookie
+func DeviceCookieName() string {
+	return SessionCookieName() + "-device"
+}
+
+// RememberDeviceDuration returns how long a device skips the two-factor check
+func RememberDeviceDuration() time.Duration {
+	if d := Config.Configuration.TwoFactor.Remember.Duration; d > 0 {
+		return d
+	}
+
+	return 30 * 24 * time.Hour
+}
+
+// RememberDeviceToken returns a signed remembered device token for the given account
+func RememberDeviceToken(accountID int64, secret string) (string, error) {
+	return SignToken(twoFactorDevicePurpose, map[string]interface{}{
+		"account": accountID,
+		"key":     secretFingerprint(secret),
+	}, TokenOptions{
+		TTL: RememberDeviceDuration(),
+	})
+}
+
+// IsDeviceRemembered checks if the given remembered device token belongs to the account
+func IsDeviceRemembered(token string, accountID int64, secret string) bool {
+	claims, err := VerifyToken(twoFactorDevicePurpose, token)
+
+	if err != nil {
+		return false
+	}
+
+	account, ok := claims.Data["account"].(float64)
+
+	if !ok || int64(account) != accountID {
+		return false
+	}
+
+	key, _ := claims.Data["key"].(string)
+
+	return key == secretFingerprint(secret)
+}
@@ -0,0 +1,479 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// WebAuthnRelyingParty struct used for the relying party options of the WebAuthn ceremonies
+type WebAuthnRelyingParty struct {
+	ID               string
+	Name             string
+	Origins          []string
+	UserVerification string
+	Timeout          time.Duration
+}
+
+// WebAuthnCredential struct used for a registered public key credential
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// webAuthnClientData struct used to decode the client data of a ceremony
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// webAuthnAuthData struct used for the decoded authenticator data
+type webAuthnAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// webAuthnAttestation struct used to decode an attestation object
+type webAuthnAttestation struct {
+	Format    string          `cbor:"fmt"`
+	Statement cbor.RawMessage `cbor:"attStmt"`
+	AuthData  []byte          `cbor:"authData"`
+}
+
+// webAuthnPackedStatement struct used to decode a packed attestation statement
+type webAuthnPackedStatement struct {
+	Alg int64    `cbor:"alg"`
+	Sig []byte   `cbor:"sig"`
+	X5C [][]byte `cbor:"x5c"`
+}
+
+const (
+	// webAuthnUserPresent authenticator data flag set when the user was present
+	webAuthnUserPresent = 0x01
+
+	// webAuthnUserVerified authenticator data flag set when the user was verified
+	webAuthnUserVerified = 0x04
+
+	// webAuthnAttested authenticator data flag set when credential data is included
+	webAuthnAttested = 0x40
+
+	// COSE algorithm identifiers
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+var (
+	// ErrWebAuthnChallenge error returned when the ceremony challenge does not match
+	ErrWebAuthnChallenge = errors.New("Invalid WebAuthn challenge")
+
+	// ErrWebAuthnOrigin error returned when the ceremony origin is not allowed
+	ErrWebAuthnOrigin = errors.New("Invalid WebAuthn origin")
+
+	// ErrWebAuthnSignature error returned when a signature is not valid
+	ErrWebAuthnSignature = errors.New("Invalid WebAuthn signature")
+
+	// ErrWebAuthnCloned error returned when the signature counter did not increase
+	ErrWebAuthnCloned = errors.New("WebAuthn signature counter did not increase. The authenticator may be cloned")
+
+	// WebAuthnAlgorithms supported COSE algorithms in order of preference
+	WebAuthnAlgorithms = []int64{coseES256, coseEdDSA, coseRS256}
+)
+
+// RelyingParty returns the relying party options. The identifier and origin default to the
+// configured application URL
+func (c Configuration) RelyingParty() WebAuthnRelyingParty {
+	rp := WebAuthnRelyingParty{
+		ID:               c.WebAuthn.RPID,
+		Name:             c.WebAuthn.RPName,
+		Origins:          c.WebAuthn.Origins,
+		UserVerification: c.WebAuthn.UserVerification,
+		Timeout:          c.WebAuthn.Timeout.Duration,
+	}
+
+	if u, err := url.Parse(c.URL); err == nil && u.Host != "" {
+		if rp.ID == "" {
+			rp.ID = u.Hostname()
+		}
+
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+
+	if rp.Name == "" {
+		rp.Name = "Castro"
+	}
+
+	if rp.UserVerification == "" {
+		rp.UserVerification = "preferred"
+	}
+
+	if rp.Timeout <= 0 {
+		rp.Timeout = time.Minute * 5
+	}
+
+	return rp
+}
+
+// NewWebAuthnChallenge returns a new random ceremony challenge
+func NewWebAuthnChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// EncodeWebAuthn encodes binary WebAuthn data using unpadded base64url
+func EncodeWebAuthn(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeWebAuthn decodes base64url WebAuthn data with or without padding
+func DecodeWebAuthn(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
+
+// verifyClientData checks the type, challenge and origin of the given client data
+func (rp WebAuthnRelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	data := webAuthnClientData{}
+
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("Invalid WebAuthn client data: %v", err)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("Invalid WebAuthn ceremony type %v", data.Type)
+	}
+
+	received, err := DecodeWebAuthn(data.Challenge)
+
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return ErrWebAuthnChallenge
+	}
+
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+
+	return ErrWebAuthnOrigin
+}
+
+// verifyAuthData checks the relying party hash and the user flags of the given authenticator data
+func (rp WebAuthnRelyingParty) verifyAuthData(data *webAuthnAuthData) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+
+	if subtle.ConstantTimeCompare(hash[:], data.RPIDHash) != 1 {
+		return errors.New("Invalid WebAuthn relying party")
+	}
+
+	if data.Flags&webAuthnUserPresent == 0 {
+		return errors.New("WebAuthn user not present")
+	}
+
+	if rp.UserVerification == "required" && data.Flags&webAuthnUserVerified == 0 {
+		return errors.New("WebAuthn user not verified")
+	}
+
+	return nil
+}
+
+// parseWebAuthnAuthData decodes the given authenticator data
+func parseWebAuthnAuthData(raw []byte) (*webAuthnAuthData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("Invalid WebAuthn authenticator data")
+	}
+
+	data := &webAuthnAuthData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if data.Flags&webAuthnAttested == 0 {
+		return data, nil
+	}
+
+	// Attested credential data
+	if len(raw) < 55 {
+		return nil, errors.New("Invalid WebAuthn attested credential data")
+	}
+
+	data.AAGUID = raw[37:53]
+	length := int(binary.BigEndian.Uint16(raw[53:55]))
+
+	if len(raw) < 55+length {
+		return nil, errors.New("Invalid WebAuthn credential identifier")
+	}
+
+	data.CredentialID = raw[55 : 55+length]
+
+	// The public key is followed by optional extensions so only the first item is read
+	var key cbor.RawMessage
+
+	decoder := cbor.NewDecoder(bytes.NewReader(raw[55+length:]))
+
+	if err := decoder.Decode(&key); err != nil {
+		return nil, fmt.Errorf("Invalid WebAuthn public key: %v", err)
+	}
+
+	data.PublicKey = key
+
+	return data, nil
+}
+
+// parseCOSEKey decodes a COSE public key returning its algorithm and the parsed key
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	key := map[int]interface{}{}
+
+	if err := cbor.Unmarshal(raw, &key); err != nil {
+		return 0, nil, fmt.Errorf("Invalid COSE key: %v", err)
+	}
+
+	alg, _ := coseInt(key[3])
+	x, _ := key[-2].([]byte)
+
+	switch alg {
+	case coseES256:
+		y, _ := key[-3].([]byte)
+
+		if crv, _ := coseInt(key[-1]); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("Invalid ES256 COSE key")
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errors.New("Invalid ES256 COSE key point")
+		}
+
+		return alg, pub, nil
+
+	case coseEdDSA:
+		if crv, _ := coseInt(key[-1]); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("Invalid EdDSA COSE key")
+		}
+
+		return alg, ed25519.PublicKey(x), nil
+
+	case coseRS256:
+		n, _ := key[-1].([]byte)
+		e := new(big.Int).SetBytes(x)
+
+		if len(n) == 0 || !e.IsInt64() || e.Int64() < 3 {
+			return 0, nil, errors.New("Invalid RS256 COSE key")
+		}
+
+		return alg, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(e.Int64()),
+		}, nil
+	}
+
+	return 0, nil, fmt.Errorf("Unsupported COSE algorithm %v", alg)
+}
+
+// coseInt converts a decoded COSE integer value
+func coseInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	}
+
+	return 0, false
+}
+
+// verifyCOSESignature checks the signature of the given data using a public key
+func verifyCOSESignature(alg int64, pub crypto.PublicKey, data, sig []byte) error {
+	hash := sha256.Sum256(data)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if alg == coseES256 && ecdsa.VerifyASN1(key, hash[:], sig) {
+			return nil
+		}
+
+	case ed25519.PublicKey:
+		if alg == coseEdDSA && ed25519.Verify(key, data, sig) {
+			return nil
+		}
+
+	case *rsa.PublicKey:
+		if alg == coseRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) == nil {
+			return nil
+		}
+	}
+
+	return ErrWebAuthnSignature
+}
+
+// verifyPackedAttestation checks a packed attestation statement. Statements with a certificate
+// chain are verified against the leaf certificate, the chain itself is not trusted
+func verifyPackedAttestation(raw []byte, authData []byte, clientDataHash []byte, credentialAlg int64, credentialKey crypto.PublicKey) error {
+	stmt := webAuthnPackedStatement{}
+
+	if err := cbor.Unmarshal(raw, &stmt); err != nil {
+		return fmt.Errorf("Invalid packed attestation: %v", err)
+	}
+
+	signed := append(append([]byte{}, authData...), clientDataHash...)
+
+	// Self attestation
+	if len(stmt.X5C) == 0 {
+		if stmt.Alg != credentialAlg {
+			return errors.New("Invalid packed attestation algorithm")
+		}
+
+		return verifyCOSESignature(stmt.Alg, credentialKey, signed, stmt.Sig)
+	}
+
+	cert, err := x509.ParseCertificate(stmt.X5C[0])
+
+	if err != nil {
+		return fmt.Errorf("Invalid attestation certificate: %v", err)
+	}
+
+	algorithms := map[int64]x509.SignatureAlgorithm{
+		coseES256: x509.ECDSAWithSHA256,
+		coseEdDSA: x509.PureEd25519,
+		coseRS256: x509.SHA256WithRSA,
+	}
+
+	algorithm, ok := algorithms[stmt.Alg]
+
+	if !ok {
+		return fmt.Errorf("Unsupported attestation algorithm %v", stmt.Alg)
+	}
+
+	if err := cert.CheckSignature(algorithm, signed, stmt.Sig); err != nil {
+		return ErrWebAuthnSignature
+	}
+
+	return nil
+}
+
+// VerifyWebAuthnRegistration verifies the response of a registration ceremony returning
+// the new credential. Only the none and packed attestation formats are supported
+func (rp WebAuthnRelyingParty) VerifyWebAuthnRegistration(challenge, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attestation := webAuthnAttestation{}
+
+	if err := cbor.Unmarshal(attestationObject, &attestation); err != nil {
+		return nil, fmt.Errorf("Invalid WebAuthn attestation object: %v", err)
+	}
+
+	data, err := parseWebAuthnAuthData(attestation.AuthData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyAuthData(data); err != nil {
+		return nil, err
+	}
+
+	if data.Flags&webAuthnAttested == 0 {
+		return nil, errors.New("Missing WebAuthn attested credential data")
+	}
+
+	alg, pub, err := parseCOSEKey(data.PublicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	switch attestation.Format {
+	case "none":
+	case "packed":
+		if err := verifyPackedAttestation(attestation.Statement, attestation.AuthData, clientDataHash[:], alg, pub); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported attestation format %v", attestation.Format)
+	}
+
+	return &WebAuthnCredential{
+		ID:        data.CredentialID,
+		PublicKey: data.PublicKey,
+		SignCount: data.SignCount,
+		AAGUID:    data.AAGUID,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion verifies the response of a login ceremony for the given credential
+// returning the new signature counter
+func (rp WebAuthnRelyingParty) VerifyWebAuthnAssertion(challenge []byte, credential *WebAuthnCredential, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	data, err := parseWebAuthnAuthData(authenticatorData)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := rp.verifyAuthData(data); err != nil {
+		return 0, err
+	}
+
+	alg, pub, err := parseCOSEKey(credential.PublicKey)
+
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	if err := verifyCOSESignature(alg, pub, append(append([]byte{}, authenticatorData...), clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always report zero
+	if (data.SignCount != 0 || credential.SignCount != 0) && data.SignCount <= credential.SignCount {
+		return 0, ErrWebAuthnCloned
+	}
+
+	return data.SignCount, nil
+}
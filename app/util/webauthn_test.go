@@ -0,0 +1,330 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// softAuthenticator software WebAuthn authenticator used to drive the ceremonies
+type softAuthenticator struct {
+	t            *testing.T
+	alg          int64
+	ecdsaKey     *ecdsa.PrivateKey
+	ed25519Key   ed25519.PrivateKey
+	credentialID []byte
+	counter      uint32
+}
+
+// newSoftAuthenticator creates a software authenticator for the given COSE algorithm
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	a := &softAuthenticator{
+		t:            t,
+		alg:          alg,
+		credentialID: make([]byte, 16),
+	}
+
+	rand.Read(a.credentialID)
+
+	switch alg {
+	case coseES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		if err != nil {
+			t.Fatalf("Cannot generate ES256 key: %v", err)
+		}
+
+		a.ecdsaKey = key
+
+	case coseEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			t.Fatalf("Cannot generate EdDSA key: %v", err)
+		}
+
+		a.ed25519Key = key
+	}
+
+	return a
+}
+
+// coseKey returns the COSE encoded public key of the authenticator
+func (a *softAuthenticator) coseKey() []byte {
+	key := map[int]interface{}{}
+
+	switch a.alg {
+	case coseES256:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+
+		a.ecdsaKey.X.FillBytes(x)
+		a.ecdsaKey.Y.FillBytes(y)
+
+		key = map[int]interface{}{1: 2, 3: a.alg, -1: 1, -2: x, -3: y}
+
+	case coseEdDSA:
+		key = map[int]interface{}{1: 1, 3: a.alg, -1: 6, -2: []byte(a.ed25519Key.Public().(ed25519.PublicKey))}
+	}
+
+	raw, err := cbor.Marshal(key)
+
+	if err != nil {
+		a.t.Fatalf("Cannot encode COSE key: %v", err)
+	}
+
+	return raw
+}
+
+// sign signs the given data using the authenticator key
+func (a *softAuthenticator) sign(data []byte) []byte {
+	if a.alg == coseEdDSA {
+		return ed25519.Sign(a.ed25519Key, data)
+	}
+
+	hash := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.ecdsaKey, hash[:])
+
+	if err != nil {
+		a.t.Fatalf("Cannot sign data: %v", err)
+	}
+
+	return sig
+}
+
+// authData returns the authenticator data for the given relying party
+func (a *softAuthenticator) authData(rpID string, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	flags := byte(webAuthnUserPresent | webAuthnUserVerified)
+
+	if attested {
+		flags |= webAuthnAttested
+	}
+
+	data := append([]byte{}, hash[:]...)
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.counter)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+
+	return data
+}
+
+// clientData returns the client data of a ceremony
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte, origin string) []byte {
+	raw, err := json.Marshal(webAuthnClientData{
+		Type:      ceremony,
+		Challenge: EncodeWebAuthn(challenge),
+		Origin:    origin,
+	})
+
+	if err != nil {
+		a.t.Fatalf("Cannot encode client data: %v", err)
+	}
+
+	return raw
+}
+
+// create returns the client data and attestation object of a registration ceremony
+func (a *softAuthenticator) create(rpID, origin, format string, challenge []byte) ([]byte, []byte) {
+	clientData := a.clientData("webauthn.create", challenge, origin)
+	authData := a.authData(rpID, true)
+
+	stmt := map[string]interface{}{}
+
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientData)
+
+		stmt = map[string]interface{}{
+			"alg": a.alg,
+			"sig": a.sign(append(append([]byte{}, authData...), clientDataHash[:]...)),
+		}
+	}
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      format,
+		"attStmt":  stmt,
+		"authData": authData,
+	})
+
+	if err != nil {
+		a.t.Fatalf("Cannot encode attestation object: %v", err)
+	}
+
+	return clientData, attestation
+}
+
+// get returns the client data, authenticator data and signature of a login ceremony
+func (a *softAuthenticator) get(rpID, origin string, challenge []byte) ([]byte, []byte, []byte) {
+	a.counter++
+
+	clientData := a.clientData("webauthn.get", challenge, origin)
+	authData := a.authData(rpID, false)
+	clientDataHash := sha256.Sum256(clientData)
+
+	return clientData, authData, a.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+}
+
+func testRelyingParty() WebAuthnRelyingParty {
+	return WebAuthnRelyingParty{
+		ID:               "castro.test",
+		Name:             "Castro",
+		Origins:          []string{"https://castro.test"},
+		UserVerification: "preferred",
+	}
+}
+
+func testChallenge(t *testing.T) []byte {
+	challenge, err := NewWebAuthnChallenge()
+
+	if err != nil {
+		t.Fatalf("Cannot create challenge: %v", err)
+	}
+
+	return challenge
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	rp := testRelyingParty()
+
+	tests := []struct {
+		name   string
+		alg    int64
+		format string
+	}{
+		{"ES256 packed", coseES256, "packed"},
+		{"ES256 none", coseES256, "none"},
+		{"EdDSA packed", coseEdDSA, "packed"},
+		{"EdDSA none", coseEdDSA, "none"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, test.alg)
+
+			challenge := testChallenge(t)
+			clientData, attestation := authenticator.create(rp.ID, rp.Origins[0], test.format, challenge)
+
+			credential, err := rp.VerifyWebAuthnRegistration(challenge, clientData, attestation)
+
+			if err != nil {
+				t.Fatalf("Cannot verify registration: %v", err)
+			}
+
+			if string(credential.ID) != string(authenticator.credentialID) {
+				t.Fatalf("Unexpected credential identifier %x", credential.ID)
+			}
+
+			for i := 0; i < 2; i++ {
+				challenge := testChallenge(t)
+				clientData, authData, sig := authenticator.get(rp.ID, rp.Origins[0], challenge)
+
+				count, err := rp.VerifyWebAuthnAssertion(challenge, credential, clientData, authData, sig)
+
+				if err != nil {
+					t.Fatalf("Cannot verify assertion: %v", err)
+				}
+
+				if count != authenticator.counter {
+					t.Fatalf("Expected counter %v got %v", authenticator.counter, count)
+				}
+
+				credential.SignCount = count
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationChallengeMismatch(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t, coseES256)
+
+	clientData, attestation := authenticator.create(rp.ID, rp.Origins[0], "packed", testChallenge(t))
+
+	if _, err := rp.VerifyWebAuthnRegistration(testChallenge(t), clientData, attestation); err != ErrWebAuthnChallenge {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnChallenge, err)
+	}
+}
+
+func TestWebAuthnRegistrationWrongOrigin(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t, coseEdDSA)
+
+	challenge := testChallenge(t)
+	clientData, attestation := authenticator.create(rp.ID, "https://evil.test", "none", challenge)
+
+	if _, err := rp.VerifyWebAuthnRegistration(challenge, clientData, attestation); err != ErrWebAuthnOrigin {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnOrigin, err)
+	}
+}
+
+func TestWebAuthnAssertionErrors(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t, coseES256)
+
+	challenge := testChallenge(t)
+	clientData, attestation := authenticator.create(rp.ID, rp.Origins[0], "packed", challenge)
+
+	credential, err := rp.VerifyWebAuthnRegistration(challenge, clientData, attestation)
+
+	if err != nil {
+		t.Fatalf("Cannot verify registration: %v", err)
+	}
+
+	// Challenge mismatch
+	clientData, authData, sig := authenticator.get(rp.ID, rp.Origins[0], testChallenge(t))
+
+	if _, err := rp.VerifyWebAuthnAssertion(testChallenge(t), credential, clientData, authData, sig); err != ErrWebAuthnChallenge {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnChallenge, err)
+	}
+
+	// Wrong origin
+	challenge = testChallenge(t)
+	clientData, authData, sig = authenticator.get(rp.ID, "https://evil.test", challenge)
+
+	if _, err := rp.VerifyWebAuthnAssertion(challenge, credential, clientData, authData, sig); err != ErrWebAuthnOrigin {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnOrigin, err)
+	}
+
+	// Tampered signature
+	challenge = testChallenge(t)
+	clientData, authData, sig = authenticator.get(rp.ID, rp.Origins[0], challenge)
+	authData[len(authData)-1]++
+
+	if _, err := rp.VerifyWebAuthnAssertion(challenge, credential, clientData, authData, sig); err != ErrWebAuthnSignature {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnSignature, err)
+	}
+
+	// Non-increasing counter
+	challenge = testChallenge(t)
+	clientData, authData, sig = authenticator.get(rp.ID, rp.Origins[0], challenge)
+
+	count, err := rp.VerifyWebAuthnAssertion(challenge, credential, clientData, authData, sig)
+
+	if err != nil {
+		t.Fatalf("Cannot verify assertion: %v", err)
+	}
+
+	credential.SignCount = count
+	authenticator.counter--
+
+	challenge = testChallenge(t)
+	clientData, authData, sig = authenticator.get(rp.ID, rp.Origins[0], challenge)
+
+	if _, err := rp.VerifyWebAuthnAssertion(challenge, credential, clientData, authData, sig); err != ErrWebAuthnCloned {
+		t.Fatalf("Expected %v got %v", ErrWebAuthnCloned, err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/raggaer/castro/app"
+	"github.com/raggaer/castro/app/lua"
+	"github.com/raggaer/castro/app/util"
+)
+
+// command function used for the castro command line commands
+type command func(args []string) error
+
+var (
+	// commands list of the available command line commands
+	commands = map[string]command{}
+
+	// testDirectories default directories searched for lua test files
+	testDirectories = []string{"pages", "widgets", "engine", "extensions", "tests"}
+
+	// lintDirectories default directories checked by the lua linter
+	lintDirectories = []string{"pages", "widgets", "engine", "extensions", "migrations"}
+)
+
+func init() {
+	commands["test"] = testCommand
+	commands["lint"] = lintCommand
+	commands["stubs"] = stubsCommand
+}
+
+// runCommand executes the given command line command
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+
+	if !ok {
+		// Get command names
+		names := []string{}
+
+		for n := range commands {
+			names = append(names, n)
+		}
+
+		sort.Strings(names)
+
+		return fmt.Errorf("Unknown command %v. Available commands: %v", name, strings.Join(names, ", "))
+	}
+
+	return cmd(args)
+}
+
+// testCommand runs all the *_test.lua files against a throwaway database schema
+func testCommand(args []string) error {
+	// Parse command flags
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	format := flags.String("format", "tap", "Report format (tap or junit)")
+	out := flags.String("out", "", "Report output file (defaults to stdout)")
+	keep := flags.Bool("keep", false, "Keep the test database schema")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != "tap" && *format != "junit" {
+		return fmt.Errorf("Invalid report format %v. Expected tap or junit", *format)
+	}
+
+	// Get test directories
+	dirs := flags.Args()
+
+	if len(dirs) == 0 {
+		dirs = testDirectories
+	}
+
+	// Discover test files
+	files := []string{}
+
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && strings.HasSuffix(info.Name(), "_test.lua") {
+				files = append(files, path)
+			}
+
+			return nil
+		})
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Load application using a test schema
+	cleanup, err := app.StartTest(*keep)
+
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	// Create test runner
+	runner := lua.NewTestRunner(newApplicationHandler())
+	defer runner.Close()
+
+	// Run test files
+	results := []util.TestResult{}
+
+	for _, file := range files {
+		results = append(results, runner.RunFile(file)...)
+	}
+
+	// Get report writer
+	var w io.Writer = os.Stdout
+
+	if *out != "" {
+		f, err := os.Create(*out)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	// Write report
+	if *format == "junit" {
+		err = util.WriteJUnit(w, results)
+	} else {
+		err = util.WriteTAP(w, results)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Count failed tests
+	failed := 0
+
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v tests failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// lintCommand statically checks the lua files against the castro bindings
+func lintCommand(args []string) error {
+	// Get lint directories
+	dirs := args
+
+	if len(dirs) == 0 {
+		dirs = lintDirectories
+	}
+
+	// Lint files
+	issues, err := app.Lint(dirs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("Found %v lint issues", len(issues))
+	}
+
+	return nil
+}
+
+// stubsCommand writes the LuaLS/EmmyLua annotations of the castro bindings
+func stubsCommand(args []string) error {
+	// Parse command flags
+	flags := flag.NewFlagSet("stubs", flag.ContinueOnError)
+	out := flags.String("out", filepath.Join("stubs", "castro.lua"), "Stubs output file")
+	src := flags.String("src", filepath.Join("app", "lua"), "Lua bindings source directory used for the doc comments")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Load binding doc comments
+	docs, err := lua.LoadBindingDocs(*src)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		fmt.Printf(">> Bindings source not found at %v. Writing stubs without doc comments\n", *src)
+		docs = map[string]string{}
+	}
+
+	// Create output directory
+	if err := os.MkdirAll(filepath.Dir(*out), 0755); err != nil {
+		return err
+	}
+
+	if err := lua.WriteStubsFile(*out, docs); err != nil {
+		return err
+	}
+
+	fmt.Printf(">> Lua stubs written to %v\n", *out)
+
+	return nil
+}
@@ -2,6 +2,10 @@
 
 require "extensionhooks"
 
+-- Shop background jobs
+jobs:register("shop.points", "engine/jobs/shoppoints.lua")
+jobs:register("shop.delivery", "engine/jobs/shopdelivery.lua")
+
 if app.Mode == "dev" then
     print(">> Running on development mode. Never have development mode open to the public")
 end
@@ -28,7 +32,7 @@ end
 executeHook("onStartup")
 
 if app.CheckUpdates and app.Version ~= "" then
-    local commitData = json:unmarshal(http:get("https://api.github.com/repos/Raggaer/castro/commits"))
+    local commitData = http:getJSON("https://api.github.com/repos/Raggaer/castro/commits")
     local outdated = 0
 
     for k, v in pairs(commitData.object) do
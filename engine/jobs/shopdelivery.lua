@@ -0,0 +1,4 @@
+-- Saves the shop offers bought by a character so the game server can deliver them
+function job(payload)
+    db:execute("INSERT INTO castro_shop_checkout (offer, amount, player, given) VALUES (?, ?, ?, 0)", payload.offers, payload.amount, payload.player)
+end
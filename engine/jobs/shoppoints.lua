@@ -0,0 +1,4 @@
+-- Credits the shop points bought through a payment provider
+function job(payload)
+    db:execute("UPDATE castro_accounts a, accounts b SET a.points = points + ? WHERE a.account_id = b.id AND b.name = ?", payload.points, payload.account)
+end
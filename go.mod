@@ -7,8 +7,9 @@ require (
 	github.com/clbanning/mxj v1.8.4
 	github.com/dchest/uniuri v0.0.0-20160212164326-8902c56451e9
 	github.com/dgryski/dgoogauth v0.0.0-20190221195224-5a805980a5f3
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-sql-driver/mysql v1.4.1
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/google/pprof v0.0.0-20181206194817-3ea8567a2e57
 	github.com/gorilla/securecookie v1.1.1
 	github.com/jinzhu/gorm v1.9.10
 	github.com/jmoiron/sqlx v1.2.0
@@ -17,28 +18,38 @@ require (
 	github.com/julienschmidt/httprouter v1.2.0
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
 	github.com/kataras/go-errors v0.0.3
-	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
-	github.com/lib/pq v1.2.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.0.2
-	github.com/mattn/go-sqlite3 v1.11.0 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.2
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/patrickmn/go-cache v2.1.0+incompatible
-	github.com/pkg/errors v0.8.1 // indirect
 	github.com/raggaer/otmap v0.0.0-20170404205416-106b5485ec0f
+	github.com/russross/blackfriday/v2 v2.0.1
 	github.com/sirupsen/logrus v1.4.2
 	github.com/skip2/go-qrcode v0.0.0-20190110000554-dc11ecdae0a9
-	github.com/stretchr/testify v1.3.0 // indirect
 	github.com/ulule/limiter v2.2.2+incompatible
 	github.com/urfave/negroni v1.0.0
 	github.com/yuin/gopher-lua v0.0.0-20190514113301-1cd887cd7036
 	golang.org/x/crypto v0.0.0-20190909091759-094676da4a83
-	golang.org/x/image v0.0.0-20190902063713-cb417be4ba39 // indirect
+	golang.org/x/image v0.0.0-20190902063713-cb417be4ba39
 	golang.org/x/net v0.0.0-20190909003024-a7b16738d86b
+	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
+	gopkg.in/square/go-jose.v1 v1.1.2
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
+	github.com/lib/pq v1.2.0 // indirect
+	github.com/mattn/go-sqlite3 v1.11.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	github.com/stretchr/testify v1.3.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/sys v0.0.0-20190909082730-f460065e899a // indirect
+	golang.org/x/text v0.3.2 // indirect
 	google.golang.org/appengine v1.6.2 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
-	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
-	gopkg.in/square/go-jose.v1 v1.1.2
 )
 
-go 1.13
+go 1.20
@@ -145,30 +145,51 @@ var (
 			URL:      "/install/captcha",
 			Optional: true,
 			Description: template.HTML(`
-			<p>You can configure your Google reCAPTCHA credentials. reCAPTCHA offers an easy way to stop bots at saturaing your database</p>
+			<p>You can configure your captcha service. Captchas offer an easy way to stop bots at saturaing your database</p>
+			<p>Castro supports Google reCAPTCHA, hCaptcha and Cloudflare Turnstile. If you prefer not to depend on a third party service you can use the <b>image</b> or proof-of-work (<b>pow</b>) providers, they do not need any keys</p>
 			<p>By default if captcha is enabled it will appear on the registration form, you can use lua bindings to add captcha security to any other form of the website</p>
 			<p>To setup your captcha service head to <a href="https://www.google.com/recaptcha/admin#list">Google reCAPTCHA</a> and create a new application, make sure to select <b>reCAPTCHA v2</b> as your application type. You can also learn how to integreate captchas on Castro by heading to the <a href="https://docs.castroaac.org/docs/lua/captcha">documentation page</a></p>
 			`),
 			Form: []installationFormField{
+				{
+					Name:        "provider",
+					Type:        "text",
+					Placeholder: "recaptcha",
+					HelperText:  "Captcha provider: recaptcha, hcaptcha, turnstile, image or pow",
+				},
 				{
 					Name:        "public",
 					Type:        "text",
 					Placeholder: "Captcha public key",
-					HelperText:  "Google reCAPTCHA public key",
+					HelperText:  "Captcha service public (site) key",
 				},
 				{
 					Name:        "private",
 					Type:        "text",
 					Placeholder: "Captcha private key",
-					HelperText:  "Google reCAPTCHA private key",
+					HelperText:  "Captcha service private (secret) key",
 				},
 			},
 			Post: func(res http.ResponseWriter, req *http.Request, s installationStep) error {
 				// Update fields
+				provider := req.FormValue("provider")
+
+				if provider == "" {
+					provider = "recaptcha"
+				}
+
+				if _, err := util.NewCaptchaProvider(provider); err != nil {
+					return err
+				}
+
 				installationConfigFile.Captcha = util.CaptchaConfig{
-					Public:  req.FormValue("public"),
-					Secret:  req.FormValue("private"),
-					Enabled: true,
+					Provider:   provider,
+					Public:     req.FormValue("public"),
+					Secret:     req.FormValue("private"),
+					Enabled:    true,
+					Length:     5,
+					Difficulty: 16,
+					Expiration: util.NewStringDuration("10m"),
 				}
 
 				return nil
@@ -239,6 +260,7 @@ var (
 		Template:     "views/default",
 		Mode:         "dev",
 		Port:         80,
+		WriteTimeout: util.NewStringDuration("10s"),
 		URL:          "localhost",
 		Datapack:     "",
 		Static: util.StaticConfig{
@@ -254,15 +276,107 @@ var (
 			Check:   util.NewStringDuration("1h"),
 		},
 		Cookies: util.CookieConfig{
-			Name:     fmt.Sprintf("castro-%v", uniuri.NewLen(5)),
-			MaxAge:   1000000,
-			HashKey:  uniuri.NewLen(32),
-			BlockKey: uniuri.NewLen(32),
+			Name:       fmt.Sprintf("castro-%v", uniuri.NewLen(5)),
+			MaxAge:     1000000,
+			HashKey:    uniuri.NewLen(32),
+			BlockKey:   uniuri.NewLen(32),
+			SameSite:   "lax",
+			HostPrefix: true,
+		},
+		CSRF: util.CSRFConfig{
+			Lifetime: util.NewStringDuration("1h"),
+			Header:   "X-CSRF-Token",
+		},
+		Login: util.LoginConfig{
+			MaxAttempts:   5,
+			IPMaxAttempts: 20,
+			Lockout:       util.NewStringDuration("1m"),
+			MaxLockout:    util.NewStringDuration("1h"),
+			Window:        util.NewStringDuration("15m"),
+			CaptchaAfter:  3,
+			Notify:        true,
+		},
+		ClientLogin: util.ClientLoginConfig{
+			Enabled: false,
+			Path:    "/login.php",
+		},
+		Status: util.StatusConfig{
+			Timeout: util.NewStringDuration("3s"),
+			Cache:   util.NewStringDuration("1m"),
+		},
+		Supervisor: util.SupervisorConfig{
+			Enabled:     false,
+			LogFile:     "logs/gameserver.log",
+			Buffer:      500,
+			AutoRestart: true,
+			Backoff:     util.NewStringDuration("5s"),
+			MaxBackoff:  util.NewStringDuration("5m"),
+			StopTimeout: util.NewStringDuration("30s"),
+			Warnings:    []string{"15m", "5m", "1m"},
+		},
+		Session: util.SessionConfig{
+			Backend: "database",
+			Purge:   util.NewStringDuration("1h"),
 		},
 		Cache: util.CacheConfig{
 			Default: util.NewStringDuration("5m"),
 			Purge:   util.NewStringDuration("1m"),
 		},
+		Jobs: util.JobsConfig{
+			Enabled: true,
+			Workers: 2,
+			Retries: 5,
+			Poll:    util.NewStringDuration("5s"),
+			Backoff: util.NewStringDuration("30s"),
+			Timeout: util.NewStringDuration("10m"),
+		},
+		Bus: util.BusConfig{
+			Public:    []string{},
+			KeepAlive: util.NewStringDuration("15s"),
+		},
+		Profiler: util.ProfilerConfig{
+			Enabled:   false,
+			Interval:  util.NewStringDuration("5ms"),
+			Sample:    1,
+			Subtopics: []string{},
+		},
+		Outbound: util.OutboundConfig{
+			Concurrency:  8,
+			Timeout:      util.NewStringDuration("10s"),
+			Retries:      0,
+			Backoff:      util.NewStringDuration("500ms"),
+			IdleConns:    16,
+			Allow:        []string{},
+			Deny:         []string{},
+			AllowPrivate: false,
+			MaxBodySize:  10485760,
+			MaxRedirects: 5,
+			PageLimit:    20,
+		},
+		Sanitizer: util.SanitizerConfig{
+			Default:  "ugc",
+			Policies: map[string]util.SanitizePolicyConfig{},
+		},
+		Token: util.TokenConfig{
+			Keys:   []string{uniuri.NewLen(32)},
+			TTL:    util.NewStringDuration("1h"),
+			Issuer: "",
+		},
+		TwoFactor: util.TwoFactorConfig{
+			EnforceAdmin:  true,
+			Remember:      util.NewStringDuration("720h"),
+			RecoveryCodes: 10,
+			AllowedPaths: []string{
+				"/subtopic/account/twofa",
+				"/subtopic/logout",
+			},
+		},
+		WebAuthn: util.WebAuthnConfig{
+			Enabled:          true,
+			RPName:           "Castro",
+			UserVerification: "preferred",
+			Timeout:          util.NewStringDuration("5m"),
+		},
 		RateLimit: util.RateLimiterConfig{
 			Number:  100,
 			Enabled: false,
@@ -276,8 +390,13 @@ var (
 			ContentType:       "nosniff",
 			ReferrerPolicy:    "origin",
 			CrossDomainPolicy: "none",
+			PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=()",
+			OpenerPolicy:      "same-origin",
+			ResourcePolicy:    "same-site",
 			CSP: util.ContentSecurityPolicyConfig{
-				Default: []string{"none"},
+				Default:     []string{"none"},
+				Report:      true,
+				ReportLimit: 30,
 				Frame: util.ContentSecurityPolicyType{
 					SRC: []string{"http://pay.fortumo.com", "https://www.google.com"},
 				},
@@ -300,6 +419,19 @@ var (
 					Default: []string{"self"},
 					SRC:     []string{"https://assets.fortumo.com", "https://*.githubusercontent.com", "data:"},
 				},
+				Object: util.ContentSecurityPolicyType{
+					Default: []string{"none"},
+				},
+				BaseURI: util.ContentSecurityPolicyType{
+					Default: []string{"self"},
+				},
+				FormAction: util.ContentSecurityPolicyType{
+					Default: []string{"self"},
+					SRC:     []string{"https://www.paypal.com", "https://www.sandbox.paypal.com", "https://www.paygol.com"},
+				},
+				FrameAncestors: util.ContentSecurityPolicyType{
+					Default: []string{"none"},
+				},
 			},
 		},
 	}
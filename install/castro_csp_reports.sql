@@ -0,0 +1,16 @@
+CREATE TABLE `castro_csp_reports` (
+  `id` INT(11) NOT NULL AUTO_INCREMENT,
+  `hash` CHAR(64) NOT NULL,
+  `directive` VARCHAR(64) NOT NULL,
+  `blocked_uri` VARCHAR(255) NOT NULL,
+  `document_uri` VARCHAR(255) NOT NULL,
+  `source_file` VARCHAR(255) NOT NULL DEFAULT '',
+  `line_number` INT(11) NOT NULL DEFAULT 0,
+  `sample` VARCHAR(255) NOT NULL DEFAULT '',
+  `count` INT(11) NOT NULL DEFAULT 1,
+  `first_seen` BIGINT(20) NOT NULL,
+  `last_seen` BIGINT(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `hash` (`hash`),
+  KEY `last_seen` (`last_seen`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
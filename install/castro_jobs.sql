@@ -0,0 +1,17 @@
+CREATE TABLE `castro_jobs` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL,
+  `payload` LONGTEXT,
+  `status` VARCHAR(20) NOT NULL DEFAULT 'pending',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `max_attempts` INT NOT NULL DEFAULT 1,
+  `idempotency_key` VARCHAR(255) DEFAULT NULL,
+  `last_error` TEXT,
+  `run_at` BIGINT(20) NOT NULL,
+  `locked_at` BIGINT(20) NOT NULL DEFAULT 0,
+  `created_at` BIGINT(20) NOT NULL,
+  `updated_at` BIGINT(20) NOT NULL,
+  UNIQUE KEY (`idempotency_key`),
+  KEY `status_run_at` (`status`, `run_at`),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE `castro_login_attempts` (
+  `key` VARCHAR(128) NOT NULL,
+  `failures` INT(11) NOT NULL DEFAULT 0,
+  `locked_until` BIGINT(20) NOT NULL DEFAULT 0,
+  `last_failure` BIGINT(20) NOT NULL,
+  PRIMARY KEY (`key`),
+  KEY `last_failure` (`last_failure`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
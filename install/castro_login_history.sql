@@ -0,0 +1,12 @@
+CREATE TABLE `castro_login_history` (
+  `id` INT(11) NOT NULL AUTO_INCREMENT,
+  `account_id` INT(11) NOT NULL,
+  `ip` VARCHAR(64) NOT NULL,
+  `network` VARCHAR(64) NOT NULL,
+  `user_agent` VARCHAR(255) NOT NULL,
+  `success` TINYINT(1) NOT NULL,
+  `two_factor` TINYINT(1) NOT NULL DEFAULT 0,
+  `created_at` BIGINT(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `account_id` (`account_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
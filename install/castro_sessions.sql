@@ -0,0 +1,12 @@
+CREATE TABLE `castro_sessions` (
+  `id` VARCHAR(64) NOT NULL,
+  `account` VARCHAR(255) NOT NULL DEFAULT '',
+  `data` BLOB NOT NULL,
+  `ip` VARCHAR(64) NOT NULL,
+  `user_agent` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT(20) NOT NULL,
+  `last_seen` BIGINT(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `account` (`account`),
+  KEY `last_seen` (`last_seen`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE `castro_token_uses` (
+  `id` VARCHAR(64) NOT NULL,
+  `purpose` VARCHAR(100) NOT NULL,
+  `expires_at` BIGINT(20) NOT NULL,
+  `created_at` BIGINT(20) NOT NULL,
+  KEY `expires_at` (`expires_at`),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
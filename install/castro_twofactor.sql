@@ -0,0 +1,8 @@
+CREATE TABLE `castro_twofactor` (
+  `account_id` INT(11) NOT NULL,
+  `last_step` BIGINT(20) NOT NULL DEFAULT 0,
+  `recovery_codes` TEXT NOT NULL,
+  `reset_requested_at` BIGINT(20) NOT NULL DEFAULT 0,
+  `updated_at` BIGINT(20) NOT NULL,
+  PRIMARY KEY (`account_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE `castro_webauthn_credentials` (
+  `id` INT(11) NOT NULL AUTO_INCREMENT,
+  `account_id` INT(11) NOT NULL,
+  `credential_id` VARCHAR(255) NOT NULL,
+  `public_key` BLOB NOT NULL,
+  `sign_count` BIGINT(20) NOT NULL DEFAULT 0,
+  `name` VARCHAR(255) NOT NULL,
+  `created_at` BIGINT(20) NOT NULL,
+  `last_used_at` BIGINT(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `credential_id` (`credential_id`),
+  KEY `account_id` (`account_id`),
+  FOREIGN KEY (`account_id`) REFERENCES `accounts` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 
 	"crypto/tls"
 	"encoding/gob"
@@ -12,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gorilla/securecookie"
 	"github.com/julienschmidt/httprouter"
 	"github.com/raggaer/castro/app"
 	"github.com/raggaer/castro/app/controllers"
@@ -53,76 +53,27 @@ Compiled at: %v
 		return
 	}
 
-	// Run main app entry point
-	app.Start()
-
-	// Create rate-limiter instance
-	rate := limiter.Rate{
-		Period: util.Config.Configuration.RateLimit.Time.Duration,
-		Limit:  util.Config.Configuration.RateLimit.Number,
-	}
-
-	// Create rate-limiter storage
-	store := memory.NewStore()
-
-	// Create rate-limiter
-	limiter := limiter.New(store, rate)
-
-	// Declare our new http router
-	router := httprouter.New()
-
-	// Declare application endpoints
-	router.GET("/", controllers.LuaPage)
-	router.POST("/", controllers.LuaPage)
-	router.POST("/subtopic/*filepath", controllers.LuaPage)
-	router.GET("/subtopic/*filepath", controllers.LuaPage)
-	router.GET("/extensions/:id/static/*filepath", controllers.ExtensionStatic)
-	router.POST("/nocsrf/*filepath", controllers.LuaPage)
-	router.NotFound = http.HandlerFunc(PageNotFound)
-
-	// Register pprof router only on development mode
-	if util.Config.Configuration.IsDev() {
-		router.GET("/pprof/heap", wrapHandler(pprof.Handler("heap")))
-	}
-
-	// Create the session storage
-	util.SessionStore = securecookie.New(
-		[]byte(util.Config.Configuration.Cookies.HashKey),
-		[]byte(util.Config.Configuration.Cookies.BlockKey),
-	)
-
-	// Create the middleware negroni instance with some application middleware
-	n := negroni.New(
-		newRateLimitHandler(limiter),
-		newSecurityHandler(),
-		newSessionHandler(),
-		newMicrotimeHandler(),
-		newCsrfHandler(),
-		newI18nHandler(),
-	)
-
-	// Use static handler if enabled
-	if util.Config.Configuration.Static.Enabled {
-		n.Use(negroni.NewStatic(http.Dir(util.Config.Configuration.Static.Directory)))
-	}
+	// Run command line commands
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
 
-	// Use negroni logger only in development mode
-	if util.Config.Configuration.IsDev() || util.Config.Configuration.IsLog() {
-		n.Use(negroni.NewLogger())
+		return
 	}
 
-	// Disable httprouter not found handler
-	router.HandleMethodNotAllowed = false
+	// Run main app entry point
+	app.Start()
 
-	// Tell negroni to use our http router
-	n.UseHandler(router)
+	// Create application handler
+	n := newApplicationHandler()
 
 	// Create castro server
 	server := http.Server{
 		Addr:         fmt.Sprintf(":%v", util.Config.Configuration.Port),
 		Handler:      n,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: util.Config.Configuration.ServerWriteTimeout(),
 	}
 
 	// Check if Castro should run on SSL mode
@@ -178,6 +129,91 @@ Compiled at: %v
 	}
 }
 
+// newApplicationHandler creates the application router wrapped with all the middleware
+func newApplicationHandler() http.Handler {
+	// Create rate-limiter instance
+	rate := limiter.Rate{
+		Period: util.Config.Configuration.RateLimit.Time.Duration,
+		Limit:  util.Config.Configuration.RateLimit.Number,
+	}
+
+	// Create rate-limiter storage
+	store := memory.NewStore()
+
+	// Create rate-limiter
+	limiter := limiter.New(store, rate)
+
+	// Declare our new http router
+	router := httprouter.New()
+
+	// Declare application endpoints
+	router.GET("/", controllers.LuaPage)
+	router.POST("/", controllers.LuaPage)
+	router.POST("/subtopic/*filepath", controllers.LuaPage)
+	router.GET("/subtopic/*filepath", controllers.LuaPage)
+	router.POST(controllers.LegacyCsrfPrefix+"*filepath", controllers.LuaPage)
+	router.GET("/extensions/:id/static/*filepath", controllers.ExtensionStatic)
+	router.GET("/events", controllers.EventStream)
+	router.POST(util.CSPReportPath, controllers.CSPReport)
+	router.GET(util.CaptchaImagePath, controllers.CaptchaImage)
+	router.GET("/health", controllers.Health)
+	router.GET(controllers.SupervisorConsolePath, controllers.SupervisorConsole)
+
+	// Register the game client login webservice
+	if util.Config.Configuration.ClientLogin.Enabled {
+		path := util.Config.Configuration.ClientLogin.Path
+
+		if path == "" {
+			path = "/login.php"
+		}
+
+		if err := controllers.CheckClientLogin(); err != nil {
+			util.Logger.Logger.Fatalf("Cannot start the client login webservice: %v", err)
+		}
+
+		router.POST(path, controllers.ClientLogin)
+	}
+
+	router.NotFound = http.HandlerFunc(PageNotFound)
+
+	// Register pprof router only on development mode
+	if util.Config.Configuration.IsDev() {
+		router.GET("/pprof/heap", wrapHandler(pprof.Handler("heap")))
+	}
+
+	// Create the session storage
+	util.SessionStore = util.NewCookieStore(util.Config.Configuration.Cookies.KeyPairs())
+
+	// Create the middleware negroni instance with some application middleware
+	n := negroni.New(
+		newRateLimitHandler(limiter),
+		newSecurityHandler(),
+		newSessionHandler(),
+		newMicrotimeHandler(),
+		newCsrfHandler(),
+		newTwoFactorHandler(),
+		newI18nHandler(),
+	)
+
+	// Use static handler if enabled
+	if util.Config.Configuration.Static.Enabled {
+		n.Use(negroni.NewStatic(http.Dir(util.Config.Configuration.Static.Directory)))
+	}
+
+	// Use negroni logger only in development mode
+	if util.Config.Configuration.IsDev() || util.Config.Configuration.IsLog() {
+		n.Use(negroni.NewLogger())
+	}
+
+	// Disable httprouter not found handler
+	router.HandleMethodNotAllowed = false
+
+	// Tell negroni to use our http router
+	n.UseHandler(router)
+
+	return util.ResponseControllerHandler(n)
+}
+
 // wrapHandler converts a normal http handler to a httprouter handler
 func wrapHandler(h http.Handler) httprouter.Handle {
 	return func(rw http.ResponseWriter, req *http.Request, ps httprouter.Params) {
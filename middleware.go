@@ -1,11 +1,14 @@
 package main
 
 import (
+	"errors"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/dchest/uniuri"
+	"github.com/raggaer/castro/app/controllers"
 	"github.com/raggaer/castro/app/models"
 	"github.com/raggaer/castro/app/util"
 	"github.com/ulule/limiter"
@@ -32,6 +35,15 @@ type rateLimitHandler struct {
 // i18nHandler used to detect user language
 type i18nHandler struct{}
 
+// twoFactorHandler used to enforce two-factor authentication for admin accounts
+type twoFactorHandler struct{}
+
+// twoFactorExemptPaths paths an admin without two-factor authentication can always visit
+var twoFactorExemptPaths = []string{
+	"/subtopic/account/twofa",
+	"/subtopic/logout",
+}
+
 // newI18nHandler creates and returns a new i18nHandler instance
 func newI18nHandler() *i18nHandler {
 	return &i18nHandler{}
@@ -98,23 +110,30 @@ func newSecurityHandler() *securityHandler {
 }
 
 func (s *securityHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
-	// Retrieve nonce value from cache
-	nonce, ok := util.Cache.Get("nonce")
+	// Create new nonce value
+	nonce, err := util.NewNonce()
 
-	if !ok {
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot create nonce value: %v", err)
+		http.Error(w, "Cannot create nonce value", 500)
+		return
+	}
 
-		// Create new nonce value
-		nonce = uniuri.NewLen(3)
+	// Get security policy
+	policy := util.SecurityPolicy
 
-		// Save new nonce to cache
-		util.Cache.Set("nonce", nonce, time.Minute*20)
+	if policy == nil {
+		policy = util.NewContentSecurityPolicy(util.Config.Configuration.Security.CSP)
 	}
 
-	// Set nonce header value
-	util.Config.Configuration.Security.CSP.Script.Default = append(util.Config.Configuration.Security.CSP.Script.Default, "nonce-"+nonce.(string))
+	csp := &util.RequestSecurityPolicy{
+		Policy: policy,
+		Nonce:  nonce,
+	}
 
-	// Create new context with cookie value
+	// Create new context with nonce and policy values
 	ctx := context.WithValue(req.Context(), "nonce", nonce)
+	ctx = context.WithValue(ctx, "csp", csp)
 
 	// Set Strict-Transport-Security header if SSL
 	if util.Config.Configuration.IsSSL() {
@@ -141,12 +160,30 @@ func (s *securityHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, ne
 	// Set X-Permitted-Cross-Domain-Policies header
 	w.Header().Set("X-Permitted-Cross-Domain-Policies", util.Config.Configuration.Security.CrossDomainPolicy)
 
+	// Set Permissions-Policy header
+	if util.Config.Configuration.Security.PermissionsPolicy != "" {
+		w.Header().Set("Permissions-Policy", util.Config.Configuration.Security.PermissionsPolicy)
+	}
+
+	// Set Cross-Origin-Opener-Policy header
+	if util.Config.Configuration.Security.OpenerPolicy != "" {
+		w.Header().Set("Cross-Origin-Opener-Policy", util.Config.Configuration.Security.OpenerPolicy)
+	}
+
+	// Set Cross-Origin-Resource-Policy header
+	if util.Config.Configuration.Security.ResourcePolicy != "" {
+		w.Header().Set("Cross-Origin-Resource-Policy", util.Config.Configuration.Security.ResourcePolicy)
+	}
+
 	if util.Config.Configuration.Security.CSP.Enabled {
+
+		// Set Reporting-Endpoints header
+		if util.Config.Configuration.Security.CSP.Report {
+			w.Header().Set("Reporting-Endpoints", `csp="`+strings.TrimSuffix(util.Config.Configuration.URL, "/")+util.CSPReportPath+`"`)
+		}
+
 		// Set Content-Security-Policy header
-		w.Header().Set(
-			"Content-Security-Policy",
-			util.Config.Configuration.CSP(),
-		)
+		csp.SetHeader(w)
 	}
 
 	// Run next handler
@@ -159,74 +196,130 @@ func newSessionHandler() *sessionHandler {
 }
 
 func (s *sessionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	// Use the server-side session backend if enabled
+	if util.Sessions != nil {
+		s.serveServerSession(w, req, next)
+		return
+	}
+
+	// Cookie data holder
+	v := make(map[string]interface{})
+
 	// Get application cookie
-	cookie, err := req.Cookie(util.Config.Configuration.Cookies.Name)
+	cookie, err := req.Cookie(util.SessionCookieName())
+
+	// Re-encode cookies issued with an old key pair
+	stale := false
+
+	if err == nil {
+
+		// Decode cookie
+		stale, err = util.SessionStore.DecodeStale(util.Config.Configuration.Cookies.Name, cookie.Value, &v)
+
+		if err != nil {
+			util.Logger.Logger.Warnf("Cannot decode cookie value. Issuing a new session: %v", err)
+		}
+
+		// Check issuer
+		if issuer, _ := v["issuer"].(string); err == nil && issuer != "Castro" {
+			err = errors.New("invalid issuer")
+		}
+	}
 
 	if err != nil {
 
-		// Cookie data
-		v := make(map[string]interface{})
+		// Start a new session
+		v = map[string]interface{}{
+			"issuer": "Castro",
+		}
+
+		stale = true
+	}
 
-		// Set issuer field
-		v["issuer"] = "Castro"
+	if stale {
 
 		// Encode cookie value
 		encoded, err := util.SessionStore.Encode(util.Config.Configuration.Cookies.Name, v)
 
 		if err != nil {
 			util.Logger.Logger.Errorf("Cannot encode cookie value: %v", err)
+			http.Error(w, "Cannot create session", 500)
 			return
 		}
 
-		// Create cookie
-		c := &http.Cookie{
-			Name:     util.Config.Configuration.Cookies.Name,
-			Value:    encoded,
-			Path:     "/",
-			MaxAge:   util.Config.Configuration.Cookies.MaxAge,
-			Secure:   util.Config.Configuration.IsSSL(),
-			HttpOnly: true,
-		}
-
 		// Set cookie
-		http.SetCookie(w, c)
+		http.SetCookie(w, util.SessionCookie(encoded))
+	}
+
+	// Create new context with cookie value
+	ctx := context.WithValue(req.Context(), "session", v)
 
-		// Create new context with cookie value
-		ctx := context.WithValue(req.Context(), "session", v)
+	// Run next handler
+	next(w, req.WithContext(ctx))
+}
 
-		// Run next handler
-		next(w, req.WithContext(ctx))
+// serveServerSession loads the server-side session of the request. The cookie only
+// holds the session identifier so sessions can be listed and revoked
+func (s *sessionHandler) serveServerSession(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	session, err := util.LoadServerSession(req)
 
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot load session: %v", err)
+		http.Error(w, "Cannot load session", 500)
 		return
 	}
 
-	// Cookie data holder
-	v := make(map[string]interface{})
+	// Session data holder
+	v := map[string]interface{}{}
 
-	// Decode cookie
-	if err := util.SessionStore.Decode(
-		util.Config.Configuration.Cookies.Name,
-		cookie.Value,
-		&v,
-	); err != nil {
-		util.Logger.Logger.Errorf("Cannot decode cookie value: %v", err)
-		return
-	}
+	// Session identifier. Empty until a new session is saved
+	id := ""
 
-	// Get issuer
-	issuer, ok := v["issuer"].(string)
+	if session != nil {
 
-	if !ok {
-		return
+		// Decode session data
+		v, err = util.DecodeSessionData(session.Data)
+
+		if err != nil {
+			util.Logger.Logger.Warnf("Cannot decode session. Issuing a new session: %v", err)
+
+			// Drop the broken session and its cookie
+			if err := util.Sessions.Delete(session.ID); err != nil {
+				util.Logger.Logger.Errorf("Cannot delete session: %v", err)
+			}
+
+			http.SetCookie(w, util.NewCookie(util.Config.Configuration.Cookies.Name, "", -1))
+
+			session = nil
+		}
 	}
 
-	// Check issuer
-	if issuer != "Castro" {
-		return
+	if session == nil {
+
+		// Start a new session. The session is created the first time it is saved
+		v = map[string]interface{}{
+			"issuer": "Castro",
+		}
+
+	} else {
+
+		id = session.ID
+
+		// Update last seen time at most once per minute
+		if time.Now().Unix()-session.Last_seen > 60 || session.IP != util.RequestIP(req) {
+			session.Last_seen = time.Now().Unix()
+			session.IP = util.RequestIP(req)
+			session.User_agent = req.UserAgent()
+
+			if _, err := util.Sessions.Update(session); err != nil {
+				util.Logger.Logger.Errorf("Cannot update session: %v", err)
+			}
+		}
 	}
 
-	// Create new context with cookie value
+	// Create new context with session value and identifier
 	ctx := context.WithValue(req.Context(), "session", v)
+	ctx = context.WithValue(ctx, "session-id", &id)
 
 	// Run next handler
 	next(w, req.WithContext(ctx))
@@ -238,100 +331,90 @@ func newCsrfHandler() *csrfHandler {
 }
 
 func (c *csrfHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
-	// Skip nocsrf routes
-	if strings.HasPrefix(req.URL.Path, "/nocsrf") {
-
-		// Run next handler
-		next(w, req)
-		return
-	}
-
 	// Get session
 	session, ok := req.Context().Value("session").(map[string]interface{})
 
 	if !ok {
+		util.Logger.Logger.Error("Cannot get session as map")
+		controllers.ErrorPage(w, req, http.StatusForbidden)
 		return
 	}
 
+	// Token lifetime
+	lifetime := util.Config.Configuration.CSRF.Lifetime.Duration
+
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+
 	// Get token
 	token, ok := session["csrf-token"].(*models.CsrfToken)
 
-	if !ok {
+	// Check if the request token is valid. Pages can still accept invalid tokens
+	valid := !csrfUnsafeMethod(req.Method) || (ok && token.Valid(csrfRequestToken(req)))
 
-		// Check if request is valid
-		if req.Method == http.MethodPost {
-			return
-		}
+	if !ok || time.Since(token.At) > lifetime {
 
-		// Create token
-		tkn := models.CsrfToken{
+		// Create a new token keeping the current one valid until the next rotation
+		tkn := &models.CsrfToken{
 			Token: uniuri.New(),
 			At:    time.Now(),
 		}
 
-		// Set session value
-		session["csrf-token"] = &tkn
-
-		// Encode session
-		encoded, err := util.SessionStore.Encode(util.Config.Configuration.Cookies.Name, session)
-
-		if err != nil {
-			util.Logger.Logger.Errorf("Cannot encode session: %v", err)
-		}
-
-		// Create cookie
-		c := &http.Cookie{
-			Name:     util.Config.Configuration.Cookies.Name,
-			Value:    encoded,
-			Path:     "/",
-			MaxAge:   util.Config.Configuration.Cookies.MaxAge,
-			Secure:   util.Config.Configuration.IsSSL(),
-			HttpOnly: true,
+		if ok {
+			tkn.Previous = token.Token
 		}
 
-		// Set cookie
-		http.SetCookie(w, c)
-
-		// Create context
-		ctx := context.WithValue(req.Context(), "csrf-token", &tkn)
+		token = tkn
 
-		// Run next handler
-		next(w, req.WithContext(ctx))
+		// Set session value
+		session["csrf-token"] = token
 
-		return
+		// Save session. New sessions are saved once the token is rendered
+		if !util.SessionPending(req) {
+			if err := util.SaveSession(w, req, session); err != nil {
+				util.Logger.Logger.Errorf("Cannot save session: %v", err)
+			}
+		}
 	}
 
-	// Check if valid token
-	if req.Method == http.MethodPost && (req.FormValue("_csrf") != token.Token && req.URL.Query().Get("_csrf") != token.Token) {
-		return
-	}
+	// Create context
+	ctx := context.WithValue(req.Context(), "csrf-token", token)
+	ctx = context.WithValue(ctx, "csrf-valid", valid)
 
-	// Check if token  is old
-	if time.Now().Before(token.At) {
+	// Run next handler
+	next(w, req.WithContext(ctx))
+}
 
-		// Create new token
-		token.Token = uniuri.New()
-		token.At = time.Now()
+// csrfUnsafeMethod checks if the given method requires a CSRF token
+func csrfUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
 
-		// Encode session
-		encoded, err := util.SessionStore.Encode(util.Config.Configuration.Cookies.Name, session)
+	return true
+}
 
-		if err != nil {
-			util.Logger.Logger.Errorf("Cannot encode session: %v", err)
-		}
+// csrfRequestToken returns the CSRF token sent on the request header or urlencoded form. Tokens
+// are never read from the query string so they do not leak on logs and referers. Multipart
+// forms are not parsed here so the page size limits still apply
+func csrfRequestToken(req *http.Request) string {
+	header := util.Config.Configuration.CSRF.Header
 
-		// Create cookie
-		c := util.SessionCookie(encoded)
+	if header == "" {
+		header = "X-CSRF-Token"
+	}
 
-		// Set cookie
-		http.SetCookie(w, c)
+	if token := req.Header.Get(header); token != "" {
+		return token
 	}
 
-	// Create context
-	ctx := context.WithValue(req.Context(), "csrf-token", token)
+	if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
 
-	// Run next handler
-	next(w, req.WithContext(ctx))
+	return req.PostFormValue("_csrf")
 }
 
 // newMicrotimeHandler creates and returns a new microtimeHandler instance
@@ -347,3 +430,88 @@ func (m *microtimeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, n
 	// Execute next handler
 	next(w, req.WithContext(ctx))
 }
+
+// newTwoFactorHandler creates and returns a new twoFactorHandler instance
+func newTwoFactorHandler() *twoFactorHandler {
+	return &twoFactorHandler{}
+}
+
+// ServeHTTP redirects admin accounts without two-factor authentication to the enable page
+func (t *twoFactorHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	// Check if enforcement is enabled
+	if !util.Config.Configuration.TwoFactor.EnforceAdmin {
+		next(w, req)
+		return
+	}
+
+	// Only page routes are checked so static files are still served
+	if !isTwoFactorPage(req.URL.Path) {
+		next(w, req)
+		return
+	}
+
+	// Get session
+	session, ok := req.Context().Value("session").(map[string]interface{})
+
+	if !ok {
+		next(w, req)
+		return
+	}
+
+	// Only logged admin sessions are checked
+	if logged, _ := session["logged"].(bool); !logged {
+		next(w, req)
+		return
+	}
+
+	if admin, _ := session["admin"].(bool); !admin {
+		next(w, req)
+		return
+	}
+
+	// Skip allowed paths
+	for _, path := range util.Config.Configuration.TwoFactor.AllowedPaths {
+		if strings.HasPrefix(req.URL.Path, path) {
+			next(w, req)
+			return
+		}
+	}
+
+	// Get logged account
+	name, _ := session["loggedAccount"].(string)
+
+	account, castroAccount, err := models.GetAccountByName(name)
+
+	if err != nil {
+		util.Logger.Logger.Errorf("Cannot get account by name: %v", err)
+		http.Error(w, "Cannot get account", 500)
+		return
+	}
+
+	if castroAccount.Admin && !account.Secret.Valid {
+		http.Redirect(w, req, "/subtopic/account/twofa/enable", http.StatusFound)
+		return
+	}
+
+	next(w, req)
+}
+
+// isTwoFactorPage checks if the given path is a page where two-factor authentication is enforced
+func isTwoFactorPage(path string) bool {
+	// Legacy routes serve the same pages
+	if strings.HasPrefix(path, controllers.LegacyCsrfPrefix) {
+		path = "/subtopic/" + strings.TrimPrefix(path, controllers.LegacyCsrfPrefix)
+	}
+
+	if path != "/" && !strings.HasPrefix(path, "/subtopic/") {
+		return false
+	}
+
+	for _, exempt := range twoFactorExemptPaths {
+		if strings.HasPrefix(path, exempt) {
+			return false
+		}
+	}
+
+	return true
+}
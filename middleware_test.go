@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raggaer/castro/app/models"
+	"github.com/raggaer/castro/app/util"
+	"github.com/urfave/negroni"
+)
+
+// setupSessionTest sets the configuration and stores used by the session middleware
+func setupSessionTest() {
+	gob.Register(&models.CsrfToken{})
+
+	util.Logger.Logger = util.CreateLogger(ioutil.Discard)
+
+	util.Config.Configuration = &util.Configuration{
+		Cookies: util.CookieConfig{
+			Name:     "castro",
+			MaxAge:   3600,
+			HashKey:  "session-test-hash-key-0123456789",
+			BlockKey: "session-test-block-key-012345678",
+		},
+	}
+
+	util.SessionStore = util.NewCookieStore(util.Config.Configuration.Cookies.KeyPairs())
+	util.Sessions = util.NewMemorySessionBackend()
+}
+
+// sessionTestHandler returns the session middleware chain. The final handler saves the
+// session when the request asks for it and echoes the stored session value
+func sessionTestHandler() http.Handler {
+	n := negroni.New(newSessionHandler(), newCsrfHandler())
+
+	n.UseHandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		session := req.Context().Value("session").(map[string]interface{})
+
+		if value := req.URL.Query().Get("set"); value != "" {
+			session["value"] = value
+
+			if err := util.SaveSession(w, req, session); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		value, _ := session["value"].(string)
+		w.Write([]byte(value))
+	})
+
+	return n
+}
+
+// sessionCookie returns the last session cookie set on the given response
+func sessionCookie(resp *http.Response) *http.Cookie {
+	var cookie *http.Cookie
+
+	for _, c := range resp.Cookies() {
+		if c.Name == util.SessionCookieName() {
+			cookie = c
+		}
+	}
+
+	return cookie
+}
+
+// anonymousSessions returns the number of sessions without a logged account
+func anonymousSessions(t *testing.T) int {
+	list, err := util.Sessions.List("")
+
+	if err != nil {
+		t.Fatalf("Cannot list sessions: %v", err)
+	}
+
+	return len(list)
+}
+
+func TestServerSessionMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		// cookie returns the session cookie value sent with the request
+		cookie   func(t *testing.T) string
+		set      string
+		body     string
+		sessions int
+		// cookieSet whether a cookie pointing to a saved session is expected
+		cookieSet bool
+	}{
+		{
+			name:     "no cookie without writes",
+			cookie:   func(t *testing.T) string { return "" },
+			sessions: 0,
+		},
+		{
+			name:      "no cookie with a write",
+			cookie:    func(t *testing.T) string { return "" },
+			set:       "first",
+			body:      "first",
+			sessions:  1,
+			cookieSet: true,
+		},
+		{
+			name:     "tampered cookie",
+			cookie:   func(t *testing.T) string { return "tampered" },
+			sessions: 0,
+		},
+		{
+			name: "valid cookie",
+			cookie: func(t *testing.T) string {
+				return newTestSession(t, []byte{}, map[string]interface{}{"value": "stored"})
+			},
+			body:      "stored",
+			sessions:  1,
+			cookieSet: true,
+		},
+		{
+			name: "revoked session",
+			cookie: func(t *testing.T) string {
+				c, err := util.ServerSessionCookie("revoked")
+
+				if err != nil {
+					t.Fatalf("Cannot encode cookie: %v", err)
+				}
+
+				return c.Value
+			},
+			set:       "new",
+			body:      "new",
+			sessions:  1,
+			cookieSet: true,
+		},
+		{
+			name: "undecodable session data",
+			cookie: func(t *testing.T) string {
+				return newTestSession(t, []byte("not a gob map"), nil)
+			},
+			set:       "new",
+			body:      "new",
+			sessions:  1,
+			cookieSet: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupSessionTest()
+
+			req := httptest.NewRequest(http.MethodGet, "/?set="+test.set, nil)
+
+			if cookie := test.cookie(t); cookie != "" {
+				req.AddCookie(&http.Cookie{Name: util.SessionCookieName(), Value: cookie})
+			}
+
+			w := httptest.NewRecorder()
+			sessionTestHandler().ServeHTTP(w, req)
+
+			resp := w.Result()
+
+			if resp.StatusCode != 200 || w.Body.String() != test.body {
+				t.Fatalf("Expected status 200 and body %q got %v %q", test.body, resp.StatusCode, w.Body.String())
+			}
+
+			if n := anonymousSessions(t); n != test.sessions {
+				t.Fatalf("Expected %v sessions got %v", test.sessions, n)
+			}
+
+			c := sessionCookie(resp)
+
+			if test.cookieSet != (c != nil && c.MaxAge > 0) {
+				t.Fatalf("Expected session cookie %v got %+v", test.cookieSet, c)
+			}
+
+			if c == nil || c.MaxAge <= 0 {
+				return
+			}
+
+			// The new cookie points to the saved session
+			id := ""
+
+			if err := util.SessionStore.Decode(util.Config.Configuration.Cookies.Name, c.Value, &id); err != nil {
+				t.Fatalf("Cannot decode new session cookie: %v", err)
+			}
+
+			if s, err := util.Sessions.Get(id); err != nil || s == nil {
+				t.Fatalf("Expected the new session to be saved: %v", err)
+			}
+		})
+	}
+}
+
+func TestServerSessionDropsUndecodableSession(t *testing.T) {
+	setupSessionTest()
+
+	cookie := newTestSession(t, []byte("not a gob map"), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: util.SessionCookieName(), Value: cookie})
+
+	w := httptest.NewRecorder()
+	sessionTestHandler().ServeHTTP(w, req)
+
+	// The broken session is removed and its cookie expired
+	if n := anonymousSessions(t); n != 0 {
+		t.Fatalf("Expected the broken session to be removed. Got %v sessions", n)
+	}
+
+	if c := sessionCookie(w.Result()); c == nil || c.MaxAge >= 0 {
+		t.Fatalf("Expected the session cookie to be expired got %+v", c)
+	}
+}
+
+// newTestSession saves a session with the given raw data or encoded map and returns its cookie value
+func newTestSession(t *testing.T, data []byte, v map[string]interface{}) string {
+	if v != nil {
+		v["issuer"] = "Castro"
+
+		encoded, err := util.EncodeSessionData(v)
+
+		if err != nil {
+			t.Fatalf("Cannot encode session data: %v", err)
+		}
+
+		data = encoded
+	}
+
+	s := &models.Session{
+		ID:        "test-session",
+		Data:      data,
+		Last_seen: 1 << 40,
+	}
+
+	if err := util.Sessions.Create(s); err != nil {
+		t.Fatalf("Cannot create session: %v", err)
+	}
+
+	c, err := util.ServerSessionCookie(s.ID)
+
+	if err != nil {
+		t.Fatalf("Cannot encode cookie: %v", err)
+	}
+
+	return c.Value
+}
+
+func TestCsrfMiddleware(t *testing.T) {
+	form := func(values string) (string, io.Reader) {
+		return "application/x-www-form-urlencoded", strings.NewReader(values)
+	}
+
+	multipartForm := func(token string) (string, io.Reader) {
+		buff := &bytes.Buffer{}
+		mw := multipart.NewWriter(buff)
+		mw.WriteField("_csrf", token)
+		mw.Close()
+
+		return mw.FormDataContentType(), buff
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		body   func() (string, io.Reader)
+		valid  bool
+	}{
+		{name: "safe method", method: http.MethodGet, path: "/", valid: true},
+		{name: "post without token", method: http.MethodPost, path: "/", valid: false},
+		{name: "header token", method: http.MethodPost, path: "/", header: "token", valid: true},
+		{name: "wrong header token", method: http.MethodPost, path: "/", header: "wrong", valid: false},
+		{name: "form token", method: http.MethodPost, path: "/", body: func() (string, io.Reader) { return form("_csrf=token") }, valid: true},
+		{name: "wrong form token", method: http.MethodPost, path: "/", body: func() (string, io.Reader) { return form("_csrf=wrong") }, valid: false},
+		{name: "query token", method: http.MethodPost, path: "/?_csrf=token", valid: false},
+		{name: "multipart token", method: http.MethodPost, path: "/", body: func() (string, io.Reader) { return multipartForm("token") }, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupSessionTest()
+
+			cookie := newTestSession(t, nil, map[string]interface{}{
+				"csrf-token": &models.CsrfToken{Token: "token", At: time.Now()},
+			})
+
+			var body io.Reader
+			contentType := ""
+
+			if test.body != nil {
+				contentType, body = test.body()
+			}
+
+			req := httptest.NewRequest(test.method, test.path, body)
+			req.AddCookie(&http.Cookie{Name: util.SessionCookieName(), Value: cookie})
+
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+
+			if test.header != "" {
+				req.Header.Set("X-CSRF-Token", test.header)
+			}
+
+			n := negroni.New(newSessionHandler(), newCsrfHandler())
+
+			var valid, ok bool
+
+			n.UseHandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				valid, ok = req.Context().Value("csrf-valid").(bool)
+			})
+
+			n.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !ok || valid != test.valid {
+				t.Fatalf("Expected token to be valid %v got %v", test.valid, valid)
+			}
+
+			// Multipart bodies are left for the page
+			if req.MultipartForm != nil {
+				t.Fatalf("Expected multipart body to be left unparsed")
+			}
+		})
+	}
+}
+
+func TestIsTwoFactorPage(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/", true},
+		{"/subtopic/admin", true},
+		{"/nocsrf/admin", true},
+		{"/subtopic/account/twofa/enable", false},
+		{"/nocsrf/account/twofa/enable", false},
+		{"/subtopic/logout", false},
+		{"/css/style.css", false},
+		{"/health", false},
+	}
+
+	for _, test := range tests {
+		if page := isTwoFactorPage(test.path); page != test.expected {
+			t.Errorf("Expected %v to be a two-factor page %v got %v", test.path, test.expected, page)
+		}
+	}
+}
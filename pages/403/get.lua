@@ -0,0 +1,3 @@
+function get()
+    http:render("403.html", nil)
+end
\ No newline at end of file
@@ -14,7 +14,8 @@ if crypto:sha1(http.postValues["account-password"]) ~= account.Password then
 end
 
 db:execute("UPDATE accounts SET password = ? WHERE id = ?", crypto:sha1(http.postValues["new-password"]), account.ID)
-session:setFlash("success", "Password changed")
+session:revokeOtherDevices()
+session:setFlash("success", "Password changed. All your other devices were logged out")
 http:redirect("/subtopic/account/dashboard")
 
     end
\ No newline at end of file
@@ -31,6 +31,13 @@ function get()
         data.twofa = false
     else
         data.twofa = true
+        data.recoveryCodesLeft = session:recoveryCodesLeft(account.ID)
+    end
+
+    data.devices = #session:devices()
+
+    if app.WebAuthn.Enabled then
+        data.passkeys = #webauthn:credentials(account.ID)
     end
 
     if data.account.PremiumDays > 0 then
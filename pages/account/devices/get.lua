@@ -0,0 +1,27 @@
+function get()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    local data = {}
+
+    data.success = session:getFlash("success")
+    data.validationError = session:getFlash("validationError")
+    data.list = session:devices()
+
+    for _, device in pairs(data.list) do
+        device.created = time:parseUnix(device.created).Result
+        device.lastSeen = time:parseUnix(device.lastSeen).Result
+    end
+
+    local account = session:loggedAccount()
+
+    data.logins = security:history(account.ID, 10)
+
+    for _, login in pairs(data.logins) do
+        login.created = time:parseUnix(login.created).Result
+    end
+
+    http:render("devices.html", data)
+end
\ No newline at end of file
@@ -0,0 +1,22 @@
+function post()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    if http.postValues.device == nil then
+        local n = session:revokeOtherDevices()
+        session:setFlash("success", string.format("Logged out from %d devices", n))
+        http:redirect("/subtopic/account/devices")
+        return
+    end
+
+    if not session:revokeDevice(http.postValues.device) then
+        session:setFlash("validationError", "Device not found")
+        http:redirect("/subtopic/account/devices")
+        return
+    end
+
+    session:setFlash("success", "Device logged out")
+    http:redirect("/subtopic/account/devices")
+end
\ No newline at end of file
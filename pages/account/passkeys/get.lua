@@ -0,0 +1,25 @@
+function get()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    if not app.WebAuthn.Enabled then
+        http:redirect("/subtopic/account/dashboard")
+        return
+    end
+
+    local account = session:loggedAccount()
+    local data = {}
+
+    data.success = session:getFlash("success")
+    data.validationError = session:getFlash("validationError")
+    data.list = webauthn:credentials(account.ID)
+
+    for _, credential in pairs(data.list) do
+        credential.created = time:parseUnix(credential.created).Result
+        credential.lastUsed = time:parseUnix(credential.lastUsed).Result
+    end
+
+    http:render("passkeys.html", data)
+end
\ No newline at end of file
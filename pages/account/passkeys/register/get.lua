@@ -0,0 +1,10 @@
+function get()
+    if not session:isLogged() or not app.WebAuthn.Enabled then
+        http:respond(403, {error = "Forbidden"})
+        return
+    end
+
+    local account = session:loggedAccount()
+
+    http:respond(200, webauthn:registerOptions(account.ID, account.Name))
+end
\ No newline at end of file
@@ -0,0 +1,29 @@
+function post()
+    if not session:isLogged() or not app.WebAuthn.Enabled then
+        http:respond(403, {error = "Forbidden"})
+        return
+    end
+
+    local body = http:json()
+
+    if type(body) ~= "table" or type(body.credential) ~= "table" then
+        http:respond(400, {error = "Invalid passkey response"})
+        return
+    end
+
+    local name = body.name
+
+    if type(name) ~= "string" or name == "" then
+        name = "Passkey"
+    end
+
+    local id, err = webauthn:register(body.credential, name:sub(1, 50))
+
+    if id == nil then
+        http:respond(400, {error = err})
+        return
+    end
+
+    session:setFlash("success", "Passkey added to your account")
+    http:respond(200, {id = id})
+end
\ No newline at end of file
@@ -0,0 +1,18 @@
+function post()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    local account = session:loggedAccount()
+    local id = tonumber(http.postValues.id)
+
+    if id == nil or not webauthn:remove(account.ID, id) then
+        session:setFlash("validationError", "Passkey not found")
+        http:redirect("/subtopic/account/passkeys")
+        return
+    end
+
+    session:setFlash("success", "Passkey removed from your account")
+    http:redirect("/subtopic/account/passkeys")
+end
\ No newline at end of file
@@ -5,7 +5,7 @@ function post()
     end
 
     if app.Captcha.Enabled then
-        if not captcha:verify(http.postValues["g-recaptcha-response"]) then
+        if not captcha:verify() then
             session:setFlash("validationError", "Invalid captcha answer")
             http:redirect("/subtopic/account/recover/account")
             return
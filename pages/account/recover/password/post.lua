@@ -5,7 +5,7 @@ function post()
     end
 
     if app.Captcha.Enabled then
-        if not captcha:verify(http.postValues["g-recaptcha-response"]) then
+        if not captcha:verify() then
             session:setFlash("validationError", "Invalid captcha answer")
             http:redirect("/subtopic/account/recover/password")
             return
@@ -27,6 +27,7 @@ function post()
     local pp = crypto:randomString(8)
 
     db:execute("UPDATE accounts SET password = ?  WHERE id = ?", crypto:sha1(pp), account.id)
+    session:revokeAccount(account.name)
 
     if app.Mail.Enabled then
         events:new(
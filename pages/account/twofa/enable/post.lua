@@ -18,14 +18,20 @@ function post()
         return
     end
 
-    if not validator:validQRToken(http.postValues.token, secret) then
+    if not validator:validQRToken(http.postValues.token, secret, account.ID) then
         session:setFlash("validationError", "Invalid token. Please try again")
         http:redirect()
         return
     end
 
-    session:destroy()
     db:execute("UPDATE accounts SET secret = ? WHERE id = ?", secret, account.ID)
-    session:setFlash("success", "Two-factor authentication enabled. Please log-in")
-    http:redirect("/subtopic/login")
+
+    -- Recovery codes are only shown once
+    local data = {}
+
+    data.codes = session:newRecoveryCodes(account.ID)
+    data.enabled = true
+
+    session:destroy()
+    http:render("recoverycodes.html", data)
 end
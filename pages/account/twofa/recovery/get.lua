@@ -0,0 +1,20 @@
+function get()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    local account = session:loggedAccount()
+
+    if account.Secret == nil then
+        http:redirect("/subtopic/account/dashboard")
+        return
+    end
+
+    local data = {}
+
+    data.validationError = session:getFlash("validationError")
+    data.left = session:recoveryCodesLeft(account.ID)
+
+    http:render("recovery.html", data)
+end
\ No newline at end of file
@@ -0,0 +1,25 @@
+function post()
+    if not session:isLogged() then
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    local account = session:loggedAccount()
+
+    if account.Secret == nil then
+        http:redirect("/subtopic/account/dashboard")
+        return
+    end
+
+    if not validator:validQRToken(http.postValues.token, account.Secret, account.ID) then
+        session:setFlash("validationError", "Invalid token. Please try again")
+        http:redirect()
+        return
+    end
+
+    local data = {}
+
+    data.codes = session:newRecoveryCodes(account.ID)
+
+    http:render("recoverycodes.html", data)
+end
\ No newline at end of file
@@ -0,0 +1,13 @@
+function get()
+    if session:isLogged() then
+        http:redirect("/")
+        return
+    end
+
+    local data = {}
+
+    data.validationError = session:getFlash("validationError")
+    data.success = session:getFlash("success")
+
+    http:render("twofareset.html", data)
+end
\ No newline at end of file
@@ -0,0 +1,40 @@
+function post()
+    if session:isLogged() then
+        http:redirect("/")
+        return
+    end
+
+    local account = db:singleQuery(
+        "SELECT id, name, email, secret FROM accounts WHERE name = ? AND email = ? AND password = ?",
+        http.postValues["account-name"],
+        http.postValues["email"],
+        crypto:sha1(http.postValues["password"])
+    )
+
+    if account == nil or account.secret == nil then
+        session:setFlash("validationError", "Wrong account name, email or password")
+        http:redirect("/subtopic/account/twofa/reset")
+        return
+    end
+
+    if not app.Mail.Enabled then
+        session:setFlash("validationError", "Two-factor reset requests are not available. Please contact an administrator")
+        http:redirect("/subtopic/account/twofa/reset")
+        return
+    end
+
+    local link = app.URL .. "/subtopic/account/twofa/reset/verify?token=" .. token:sign("twofa-reset", {account = account.id}, "24h", {once = true})
+
+    events:new(
+        function()
+            local m = {}
+            m.to = account.email
+            m.subject = "Two-factor reset request"
+            m.body = "Follow this link to confirm your two-factor reset request: <a href=\"" .. link .. "\">" .. link .. "</a>. Once confirmed an administrator will review your request"
+            mail:send(m)
+        end
+    )
+
+    session:setFlash("success", "You will get an email to confirm your request soon")
+    http:redirect("/subtopic/account/twofa/reset")
+end
\ No newline at end of file
@@ -0,0 +1,13 @@
+function get()
+    local payload, err = token:verify("twofa-reset", http.getValues.token or "", {consume = true})
+
+    if payload == nil then
+        session:setFlash("validationError", "Invalid reset link: " .. err)
+        http:redirect("/subtopic/account/twofa/reset")
+        return
+    end
+
+    session:requestTwoFactorReset(payload.account)
+    session:setFlash("success", "Request confirmed. An administrator will review your request")
+    http:redirect("/subtopic/account/twofa/reset")
+end
\ No newline at end of file
@@ -0,0 +1,21 @@
+function get()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    local data = {}
+
+    data.success = session:getFlash("success")
+    data.enabled = app.Security.CSP.Report
+    data.directives = db:query("SELECT directive, COUNT(*) AS reports, SUM(count) AS total FROM castro_csp_reports GROUP BY directive ORDER BY total DESC")
+    data.list = db:query("SELECT id, directive, blocked_uri, document_uri, source_file, line_number, sample, count, last_seen FROM castro_csp_reports ORDER BY count DESC, last_seen DESC LIMIT 100")
+
+    if data.list then
+        for _, r in pairs(data.list) do
+            r.seen = time:parseUnix(tonumber(r.last_seen)).Result
+        end
+    end
+
+    http:render("cspreports.html", data)
+end
\ No newline at end of file
@@ -0,0 +1,18 @@
+function post()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    local id = tonumber(http.postValues.id)
+
+    if id ~= nil then
+        db:execute("DELETE FROM castro_csp_reports WHERE id = ?", id)
+        session:setFlash("success", "Report removed")
+    else
+        db:execute("DELETE FROM castro_csp_reports")
+        session:setFlash("success", "All reports removed")
+    end
+
+    http:redirect("/subtopic/admin/csp")
+end
\ No newline at end of file
@@ -27,7 +27,7 @@ function get()
 
     try(
         function()
-            data.list = json:unmarshal(http:get(data.origin .. "/rest/list?p=" .. page))
+            data.list = http:getJSON(data.origin .. "/rest/list?p=" .. page)
         end,
         function()
             data.error = "Unable to retrieve extension list"
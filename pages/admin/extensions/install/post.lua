@@ -1,3 +1,5 @@
+-- lint: globals install, uninstall
+
 function post()
     -- Block access for anyone who is not admin
     if not session:isLogged() or not session:isAdmin() then
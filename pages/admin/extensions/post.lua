@@ -16,7 +16,7 @@ function post()
 
     try(
         function()
-            data.list = json:unmarshal(http:get(data.origin .. "/rest/list/search?name=".. http.postValues.name .. "&p=0"))
+            data.list = http:getJSON(data.origin .. "/rest/list/search?name=".. http.postValues.name .. "&p=0")
         end,
         function()
             data.error = "Unable to retrieve extension list"
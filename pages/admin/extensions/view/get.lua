@@ -15,7 +15,7 @@ function get()
 
     local data = {}
 
-    data.info = json:unmarshal(http:get(app.Plugin.Origin .. "/plugin/view/" .. http.getValues.id))
+    data.info = http:getJSON(app.Plugin.Origin .. "/plugin/view/" .. http.getValues.id)
 
     if data.info.Error then
         session:setFlash("Error", data.info.Message)
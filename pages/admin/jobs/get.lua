@@ -0,0 +1,21 @@
+function get()
+	-- Block access for anyone who is not admin
+	if not session:isLogged() or not session:isAdmin() then
+		http:redirect("/")
+		return
+	end
+
+	local data = {}
+	data.success = session:getFlash("success")
+	data.validationError = session:getFlash("validationError")
+	data.status = http.getValues.status or "dead"
+	data.statusList = {"pending", "running", "done", "dead"}
+	data.jobs = jobs:list(data.status, 50)
+
+	for _, job in pairs(data.jobs) do
+		job.Updated = time:parseUnix(job.Updated_at).Result
+		job.RunAt = time:parseUnix(job.Run_at).Result
+	end
+
+	http:render("jobs.html", data)
+end
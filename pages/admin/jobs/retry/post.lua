@@ -0,0 +1,18 @@
+function post()
+	-- Block access for anyone who is not admin
+	if not session:isLogged() or not session:isAdmin() then
+		http:redirect("/")
+		return
+	end
+
+	local id = tonumber(http.postValues.id)
+	if id == nil or jobs:get(id) == nil then
+		session:setFlash("validationError", "Job not found")
+		http:redirect("/subtopic/admin/jobs")
+		return
+	end
+
+	jobs:retry(id)
+	session:setFlash("success", "Job was moved back to the queue")
+	http:redirect("/subtopic/admin/jobs")
+end
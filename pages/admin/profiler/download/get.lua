@@ -0,0 +1,23 @@
+function get()
+	-- Block access for anyone who is not admin
+	if not session:isLogged() or not session:isAdmin() then
+		http:redirect("/")
+		return
+	end
+
+	local page = http.getValues.page
+	local profile = nil
+
+	if page ~= nil then
+		profile = profiler:pprof(page)
+	end
+
+	if profile == nil then
+		http:redirect("/subtopic/admin/profiler")
+		return
+	end
+
+	http:setHeader("Content-Type", "application/octet-stream")
+	http:setHeader("Content-Disposition", "attachment; filename=\"" .. page:gsub("[^%w]", "_") .. ".pb.gz\"")
+	http:write(profile)
+end
@@ -0,0 +1,31 @@
+function get()
+	-- Block access for anyone who is not admin
+	if not session:isLogged() or not session:isAdmin() then
+		http:redirect("/")
+		return
+	end
+
+	local data = {}
+	data.success = session:getFlash("success")
+	data.enabled = profiler:isEnabled()
+	data.pages = profiler:pages()
+	data.page = http.getValues.page
+
+	if data.page == nil and #data.pages > 0 then
+		data.page = data.pages[1].name
+	end
+
+	if data.page ~= nil then
+		data.top = profiler:top(data.page, 20)
+
+		if data.top ~= nil then
+			for _, list in pairs(data.top) do
+				for _, entry in pairs(list) do
+					entry.percent = string.format("%.2f", entry.percent)
+				end
+			end
+		end
+	end
+
+	http:render("profiler.html", data)
+end
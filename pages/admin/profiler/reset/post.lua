@@ -0,0 +1,11 @@
+function post()
+	-- Block access for anyone who is not admin
+	if not session:isLogged() or not session:isAdmin() then
+		http:redirect("/")
+		return
+	end
+
+	profiler:reset(http.postValues.page)
+	session:setFlash("success", "Profile data was removed")
+	http:redirect("/subtopic/admin/profiler")
+end
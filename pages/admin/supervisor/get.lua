@@ -0,0 +1,36 @@
+function get()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    local data = {}
+
+    data.success = session:getFlash("success")
+    data.validationError = session:getFlash("validationError")
+    data.enabled = supervisor:isEnabled()
+
+    if data.enabled then
+        data.status = supervisor:status()
+        data.console = supervisor:console(200)
+        data.lastLine = 0
+
+        if #data.console > 0 then
+            data.lastLine = data.console[#data.console].id
+        end
+
+        if data.status.startedAt > 0 then
+            data.started = time:parseUnix(data.status.startedAt).Result
+        end
+
+        if data.status.lastExitAt > 0 then
+            data.lastExit = time:parseUnix(data.status.lastExitAt).Result
+        end
+
+        if data.status.nextRestart > 0 then
+            data.nextRestart = time:parseUnix(data.status.nextRestart).Result
+        end
+    end
+
+    http:render("supervisor.html", data)
+end
\ No newline at end of file
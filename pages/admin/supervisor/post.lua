@@ -0,0 +1,61 @@
+function post()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    if not supervisor:isEnabled() then
+        http:redirect("/subtopic/admin/supervisor")
+        return
+    end
+
+    local action = http.postValues.action
+    local ok, err = true, nil
+    local message = nil
+
+    if action == "start" then
+        ok, err = supervisor:start()
+        message = "Game server started"
+    elseif action == "stop" then
+        ok, err = supervisor:stop()
+        message = "Game server is stopping"
+    elseif action == "restart" then
+        ok, err = supervisor:restart()
+        message = "Game server is restarting"
+    elseif action == "schedule" then
+        local minutes = tonumber(http.postValues.minutes)
+
+        if minutes == nil or minutes <= 0 then
+            session:setFlash("validationError", "Invalid restart time")
+            http:redirect("/subtopic/admin/supervisor")
+            return
+        end
+
+        ok, err = supervisor:schedule(minutes * 60, http.postValues.message or "")
+        message = "Restart scheduled"
+    elseif action == "cancel" then
+        supervisor:cancel()
+        message = "Scheduled restart cancelled"
+    elseif action == "broadcast" then
+        if http.postValues.message == nil or http.postValues.message == "" then
+            session:setFlash("validationError", "Invalid broadcast message")
+            http:redirect("/subtopic/admin/supervisor")
+            return
+        end
+
+        ok, err = supervisor:broadcast(http.postValues.message)
+        message = "Message broadcasted"
+    else
+        session:setFlash("validationError", "Invalid action")
+        http:redirect("/subtopic/admin/supervisor")
+        return
+    end
+
+    if not ok then
+        session:setFlash("validationError", err)
+    else
+        session:setFlash("success", message)
+    end
+
+    http:redirect("/subtopic/admin/supervisor")
+end
\ No newline at end of file
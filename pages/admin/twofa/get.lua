@@ -0,0 +1,20 @@
+function get()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    local data = {}
+
+    data.success = session:getFlash("success")
+    data.validationError = session:getFlash("validationError")
+    data.list = db:query("SELECT a.id, a.name, a.email, t.reset_requested_at FROM castro_twofactor t INNER JOIN accounts a ON a.id = t.account_id WHERE t.reset_requested_at > 0 ORDER BY t.reset_requested_at ASC")
+
+    if data.list then
+        for _, r in pairs(data.list) do
+            r.requested = time:parseUnix(tonumber(r.reset_requested_at)).Result
+        end
+    end
+
+    http:render("twofarequests.html", data)
+end
\ No newline at end of file
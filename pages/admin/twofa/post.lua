@@ -0,0 +1,25 @@
+function post()
+    if not session:isLogged() or not session:isAdmin() then
+        http:redirect("/")
+        return
+    end
+
+    local id = tonumber(http.postValues.account)
+
+    if id == nil then
+        session:setFlash("validationError", "Invalid account")
+        http:redirect("/subtopic/admin/twofa")
+        return
+    end
+
+    if http.postValues.action == "approve" then
+        session:resetTwoFactor(id)
+        session:setFlash("success", "Two-factor authentication disabled for the account")
+        http:redirect("/subtopic/admin/twofa")
+        return
+    end
+
+    db:execute("UPDATE castro_twofactor SET reset_requested_at = 0 WHERE account_id = ?", id)
+    session:setFlash("success", "Reset request rejected")
+    http:redirect("/subtopic/admin/twofa")
+end
\ No newline at end of file
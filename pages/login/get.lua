@@ -8,6 +8,8 @@ function get()
 
     data["validationError"] = session:getFlash("validationError")
     data["success"] = session:getFlash("success")
+    data["passkeys"] = app.WebAuthn.Enabled
+    data["captcha"] = session:getFlash("loginCaptcha") == true
 
     http:render("login.html", data)
 end
\ No newline at end of file
@@ -0,0 +1,20 @@
+function get()
+    if not app.WebAuthn.Enabled then
+        http:respond(403, {error = "Forbidden"})
+        return
+    end
+
+    -- Passkeys of the given account are used as second factor, otherwise the login is passwordless
+    local account = nil
+
+    if http.getValues.name ~= nil then
+        account = db:singleQuery("SELECT id FROM accounts WHERE name = ?", http.getValues.name)
+    end
+
+    if account ~= nil then
+        http:respond(200, webauthn:loginOptions(account.id))
+        return
+    end
+
+    http:respond(200, webauthn:loginOptions())
+end
\ No newline at end of file
@@ -0,0 +1,40 @@
+require "extensionhooks"
+
+function post()
+    if session:isLogged() or not app.WebAuthn.Enabled then
+        http:respond(403, {error = "Forbidden"})
+        return
+    end
+
+    local body = http:json()
+
+    if type(body) ~= "table" then
+        http:respond(400, {error = "Invalid passkey response"})
+        return
+    end
+
+    local id, err = webauthn:login(body)
+
+    if id == nil then
+        http:respond(403, {error = err})
+        return
+    end
+
+    local account = db:singleQuery("SELECT name FROM accounts WHERE id = ?", id)
+
+    security:recordLogin(account.name, true, {twoFactor = true})
+
+    session:set("logged", true)
+    session:set("loggedAccount", account.name)
+    session:set("admin", session:isAdmin())
+
+    -- Extension hook
+    local status = {continue = true}
+    executeHook("onLogin", session:loggedAccount(), status)
+    -- Allow extensions to take over
+    if not status.continue then
+        return
+    end
+
+    http:respond(200, {redirect = "/subtopic/account/dashboard"})
+end
\ No newline at end of file
@@ -1,27 +1,75 @@
 require "extensionhooks"
 
+-- validPasskey checks the passkey assertion sent as second factor
+local function validPasskey(account)
+    if http.postValues.passkey == nil or http.postValues.passkey == "" then
+        return false
+    end
+
+    local ok, response = pcall(json.unmarshal, json, http.postValues.passkey)
+
+    if not ok or type(response) ~= "table" then
+        return false
+    end
+
+    return webauthn:login(response) == account.id
+end
+
 function post()
     if session:isLogged() then
         http:redirect("/")
         return
     end
 
-    local account = db:singleQuery("SELECT name, secret, email FROM accounts WHERE name = ? AND password = ?", http.postValues["account-name"], crypto:sha1(http.postValues.password))
+    local name = http.postValues["account-name"] or ""
+
+    -- Brute-force protection
+    local locked, seconds = security:isLocked(name)
+
+    if locked then
+        session:setFlash("validationError", "Too many failed login attempts. Please try again in " .. seconds .. " seconds")
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    if security:captchaRequired(name) and not captcha:verify() then
+        session:setFlash("loginCaptcha", true)
+        session:setFlash("validationError", "Invalid captcha answer")
+        http:redirect("/subtopic/login")
+        return
+    end
+
+    local account = db:singleQuery("SELECT id, name, secret, email FROM accounts WHERE name = ? AND password = ?", name, crypto:sha1(http.postValues.password))
 
     if account == nil then
+        security:recordLogin(name, false)
+        session:setFlash("loginCaptcha", security:captchaRequired(name))
         session:setFlash("validationError", "Wrong account name or password")
         http:redirect("/subtopic/login")
         return
     end
 
-    if account.secret ~= nil then
-        if not validator:validQRToken(http.postValues.token, account.secret) then
+    local twoFactor = false
+
+    if account.secret ~= nil and not session:isDeviceRemembered(account.id, account.secret) then
+        -- Accept an authenticator token, a passkey or a single-use recovery code
+        if not validator:validQRToken(http.postValues.token, account.secret, account.id) and not validPasskey(account) and not validator:validRecoveryCode(account.id, http.postValues["recovery-code"]) then
+            security:recordLogin(name, false)
+            session:setFlash("loginCaptcha", security:captchaRequired(name))
             session:setFlash("validationError", "Invalid two-factor token. Please try again")
             http:redirect()
             return
         end
+
+        twoFactor = true
+
+        if http.postValues["remember-device"] ~= nil then
+            session:rememberDevice(account.id, account.secret)
+        end
     end
 
+    security:recordLogin(account.name, true, {twoFactor = twoFactor})
+
     session:set("logged", true)
     session:set("loggedAccount", account.name)
     session:set("admin", session:isAdmin())
@@ -68,7 +68,12 @@ function post()
     end
     offers = string.sub(offers, 1, -2)
     amount = string.sub(amount, 1, -2)
-    db:execute("INSERT INTO castro_shop_checkout (offer, amount, player, given) VALUES (?, ?, ?, 0)", offers, amount, character.name)
+
+    jobs:dispatch("shop.delivery", {
+        offers = offers,
+        amount = amount,
+        player = character.name
+    })
 
     session:set("shop-cart", {})
     session:setFlash("success", "You paid " .. totalprice .. " for all your cart items. You will get your items in-game")
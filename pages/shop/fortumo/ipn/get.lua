@@ -30,7 +30,12 @@ function get()
         return
     end
 
-    db:execute("UPDATE castro_accounts a, accounts b SET a.points = points + ? WHERE a.account_id = b.id AND b.name = ?", http.getValues.amount, http.getValues.cuid)
+    jobs:dispatch("shop.points", {
+        account = http.getValues.cuid,
+        points = http.getValues.amount
+    }, {
+        key = "fortumo:" .. http.getValues.payment_id
+    })
 
     db:execute(
         "INSERT INTO castro_fortumo_payments (account, points, price, currency, sender, operator, payment_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
@@ -21,6 +21,15 @@ function get()
         return
     end
 
-    db:execute("UPDATE castro_accounts a, accounts b SET a.points = points + ? WHERE a.account_id = b.id AND b.name = ?", points, custom)
+    if transaction_id == nil then
+        return
+    end
+
+    jobs:dispatch("shop.points", {
+        account = custom,
+        points = points
+    }, {
+        key = "paygol:" .. transaction_id
+    })
     db:execute("INSERT INTO castro_paygol_payments (transaction_id, custom, price, points, created_at) VALUES (?, ?, ?, ?, ?)", transaction_id, custom, price, points, os.time())
 end
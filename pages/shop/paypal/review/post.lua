@@ -51,9 +51,15 @@ function post()
         return
     end
 
-    db:execute("UPDATE castro_accounts a, accounts b SET a.points = points + ? WHERE a.account_id = b.id AND b.name = ?", pkg.points, payment.custom)
     db:execute("UPDATE castro_paypal_payments SET state = ? WHERE id = ?", "executed", http.postValues["id"])
 
+    jobs:dispatch("shop.points", {
+        account = payment.custom,
+        points = pkg.points
+    }, {
+        key = "paypal:" .. payment.payment_id
+    })
+
     session:setFlash("success", "Package " .. pkg.name .. " purchased. " .. pkg.points .. " points given")
 
     http:redirect("/subtopic/shop/paypal")
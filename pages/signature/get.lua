@@ -6,6 +6,9 @@ function get()
         return
     end
 
+    -- Signatures are embedded on other sites
+    http:setHeader("Cross-Origin-Resource-Policy", "cross-origin")
+
     if file:exists("public/images/signature/" .. character:getName() .. ".png") and not app.Mode == "dev" then
        local up = file:mod("public/images/signature/" .. character:getName() .. ".png") + 5 * 60
        if up > os.time() then
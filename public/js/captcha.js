@@ -0,0 +1,53 @@
+(function() {
+    var encoder = new TextEncoder();
+
+    function zeroBits(buffer) {
+        var bytes = new Uint8Array(buffer);
+        var n = 0;
+        for (var i = 0; i < bytes.length; i++) {
+            if (bytes[i] !== 0) {
+                return n + Math.clz32(bytes[i]) - 24;
+            }
+            n += 8;
+        }
+        return n;
+    }
+
+    function solve(challenge, difficulty, start) {
+        var batch = [];
+        for (var i = start; i < start + 256; i++) {
+            batch.push(crypto.subtle.digest('SHA-256', encoder.encode(challenge + ':' + i)));
+        }
+        return Promise.all(batch).then(function(hashes) {
+            for (var i = 0; i < hashes.length; i++) {
+                if (zeroBits(hashes[i]) >= difficulty) {
+                    return String(start + i);
+                }
+            }
+            return solve(challenge, difficulty, start + 256);
+        });
+    }
+
+    document.querySelectorAll('input[data-captcha-pow]').forEach(function(input) {
+        if (input.hasAttribute('data-captcha-solving')) {
+            return;
+        }
+        input.setAttribute('data-captcha-solving', '');
+
+        var form = input.form;
+        var answer = form.querySelector('input[name="captcha-answer"]');
+        var solving = solve(input.value, parseInt(input.getAttribute('data-captcha-pow'), 10), 0).then(function(nonce) {
+            answer.value = nonce;
+        });
+
+        form.addEventListener('submit', function(e) {
+            if (answer.value !== '') {
+                return;
+            }
+            e.preventDefault();
+            solving.then(function() {
+                form.submit();
+            });
+        });
+    });
+})();
\ No newline at end of file
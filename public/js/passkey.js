@@ -0,0 +1,78 @@
+var passkey = (function() {
+    function decode(value) {
+        var s = value.replace(/-/g, '+').replace(/_/g, '/');
+        while (s.length % 4) {
+            s += '=';
+        }
+        return Uint8Array.from(atob(s), function(c) { return c.charCodeAt(0); }).buffer;
+    }
+
+    function encode(buffer) {
+        var s = '';
+        new Uint8Array(buffer).forEach(function(b) { s += String.fromCharCode(b); });
+        return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function list(value) {
+        return Array.isArray(value) ? value : [];
+    }
+
+    function descriptors(value) {
+        return list(value).map(function(c) {
+            return {type: c.type, id: decode(c.id)};
+        });
+    }
+
+    function options(url) {
+        return fetch(url, {credentials: 'same-origin'}).then(function(r) {
+            if (!r.ok) {
+                throw new Error('Cannot start passkey ceremony');
+            }
+            return r.json();
+        });
+    }
+
+    return {
+        supported: function() {
+            return window.PublicKeyCredential !== undefined;
+        },
+        register: function(optionsURL) {
+            return options(optionsURL).then(function(o) {
+                o.challenge = decode(o.challenge);
+                o.user.id = decode(o.user.id);
+                o.pubKeyCredParams = list(o.pubKeyCredParams);
+                o.excludeCredentials = descriptors(o.excludeCredentials);
+                return navigator.credentials.create({publicKey: o});
+            }).then(function(c) {
+                return {
+                    id: c.id,
+                    rawId: encode(c.rawId),
+                    type: c.type,
+                    response: {
+                        clientDataJSON: encode(c.response.clientDataJSON),
+                        attestationObject: encode(c.response.attestationObject)
+                    }
+                };
+            });
+        },
+        login: function(optionsURL) {
+            return options(optionsURL).then(function(o) {
+                o.challenge = decode(o.challenge);
+                o.allowCredentials = descriptors(o.allowCredentials);
+                return navigator.credentials.get({publicKey: o});
+            }).then(function(c) {
+                return {
+                    id: c.id,
+                    rawId: encode(c.rawId),
+                    type: c.type,
+                    response: {
+                        clientDataJSON: encode(c.response.clientDataJSON),
+                        authenticatorData: encode(c.response.authenticatorData),
+                        signature: encode(c.response.signature),
+                        userHandle: c.response.userHandle ? encode(c.response.userHandle) : ''
+                    }
+                };
+            });
+        }
+    };
+})();
\ No newline at end of file
@@ -0,0 +1,66 @@
+// Command dummyserver imitates a game server process so the Castro supervisor can be
+// tested locally. It prints startup and status lines, echoes the lines written to its
+// input and exits when it receives an interrupt signal
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	interval := flag.Duration("interval", time.Second*5, "Time between status lines")
+	crash := flag.Duration("crash", 0, "Exit with an error after the given time")
+	shutdown := flag.Duration("shutdown", time.Second, "Time taken to shutdown")
+	flag.Parse()
+
+	fmt.Println("The Forgotten Server - Dummy")
+	fmt.Println(">> Loading config")
+	fmt.Println(">> Loading map")
+	fmt.Println(">> Dummy Server Online!")
+
+	// Echo broadcast lines written to the input
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+
+		for scanner.Scan() {
+			fmt.Printf(">> Input: %s\n", scanner.Text())
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	var crashed <-chan time.Time
+
+	if *crash > 0 {
+		crashed = time.After(*crash)
+	}
+
+	start := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Printf(">> Uptime %v\n", time.Since(start).Round(time.Second))
+
+		case <-crashed:
+			fmt.Fprintln(os.Stderr, "Segmentation fault (dummy crash)")
+			os.Exit(139)
+
+		case <-signals:
+			fmt.Println(">> Saving server...")
+			time.Sleep(*shutdown)
+			fmt.Println(">> Shutdown complete")
+			return
+		}
+	}
+}
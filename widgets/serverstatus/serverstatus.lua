@@ -0,0 +1,8 @@
+function widget()
+    local data = {}
+
+    data.status = server:status()
+    data.uptime = string.format("%dh %dm", math.floor(data.status.uptime / 3600), math.floor(data.status.uptime % 3600 / 60))
+
+    widgets:render("serverstatus.html", data)
+end